@@ -0,0 +1,87 @@
+// Package acmecert supplies the FTPS certificates of a Server from Let's
+// Encrypt, or another ACME certificate authority, obtaining them on first
+// use and renewing them while the server runs:
+//
+//	m := acmecert.New("/var/cache/ftpd", "ftp.example.com")
+//	go m.ListenAndServeHTTP(":80")
+//	server.CertManager = m
+//
+// The authority checks the control of the host names over HTTP on port 80,
+// with the http-01 challenge: the tls-alpn-01 challenge autocert prefers is
+// answered on port 443, which an FTP server does not serve.
+//
+// The package is a module of its own, for ftplib not to depend on
+// golang.org/x/crypto.
+package acmecert
+
+import (
+	"crypto/tls"
+	"net/http"
+
+	"github.com/cxfans/ftplib"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Manager is an ftplib.CertManager backed by an autocert.Manager, made by
+// New.
+type Manager struct {
+	// Manager obtains, caches and renews the certificates; its fields
+	// may be changed before the first handshake, such as Email or Client
+	// to use another authority than Let's Encrypt.
+	*autocert.Manager
+
+	// DefaultHost is the host name whose certificate is served to the
+	// clients not telling the host they reach with SNI, as many FTP
+	// clients do not. New sets it to its first host.
+	DefaultHost string
+
+	challenges http.Handler
+}
+
+var _ ftplib.CertManager = (*Manager)(nil)
+
+// New returns a Manager of the certificates of hosts, accepting the terms
+// of service of Let's Encrypt, which keeps the certificates and the account
+// key in cacheDir.
+func New(cacheDir string, hosts ...string) *Manager {
+	m := &Manager{
+		Manager: &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      autocert.DirCache(cacheDir),
+			HostPolicy: autocert.HostWhitelist(hosts...),
+		},
+	}
+	if len(hosts) > 0 {
+		m.DefaultHost = hosts[0]
+	}
+	// Asking for the handler enables the http-01 challenge.
+	m.challenges = m.Manager.HTTPHandler(http.NotFoundHandler())
+	return m
+}
+
+// GetCertificate returns the certificate of the host of hello, or of
+// DefaultHost when hello has none.
+func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if hello.ServerName == "" && m.DefaultHost != "" {
+		named := *hello
+		named.ServerName = m.DefaultHost
+		hello = &named
+	}
+	return m.Manager.GetCertificate(hello)
+}
+
+// ServeHTTP answers the http-01 challenges of the authority, and 404 Not
+// Found to the other requests, for a port 80 already served by another
+// HTTP server.
+func (m *Manager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.challenges.ServeHTTP(w, r)
+}
+
+// ListenAndServeHTTP serves the challenges on addr, ":80" if empty. It
+// returns when the listener fails.
+func (m *Manager) ListenAndServeHTTP(addr string) error {
+	if addr == "" {
+		addr = ":80"
+	}
+	return http.ListenAndServe(addr, m)
+}
@@ -0,0 +1,127 @@
+package acmecert_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cxfans/ftplib"
+	"github.com/cxfans/ftplib/acmecert"
+)
+
+// cacheCert stores in dir a self-signed certificate of host, as autocert
+// caches those it obtained.
+func cacheCert(dir, host string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	return ioutil.WriteFile(filepath.Join(dir, host), data, 0600)
+}
+
+// go test -run TestManager
+func TestManager(t *testing.T) {
+	dir, err := ioutil.TempDir("", "acmecert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := cacheCert(dir, "ftp.example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	server, err := ftplib.NewServer(addr, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	server.CertManager = acmecert.New(dir, "ftp.example.com")
+	go server.ListenAndServe()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := textproto.NewConn(conn)
+	c.ReadResponse(ftplib.StatusReady)
+	c.Cmd("AUTH TLS")
+	if _, msg, err := c.ReadResponse(ftplib.StatusAuthOK); err != nil {
+		t.Fatalf("AUTH TLS: %s (%v)", msg, err)
+	}
+	// The client reaches the server by its address, sending no SNI.
+	secured := tls.Client(conn, &tls.Config{InsecureSkipVerify: true})
+	if err := secured.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+	names := secured.ConnectionState().PeerCertificates[0].DNSNames
+	if len(names) != 1 || names[0] != "ftp.example.com" {
+		t.Errorf("certificate of %v, want ftp.example.com", names)
+	}
+}
+
+// go test -run TestManagerHostPolicy
+func TestManagerHostPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "acmecert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	m := acmecert.New(dir, "ftp.example.com")
+	// Refused before reaching the authority.
+	if _, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "other.example.com"}); err == nil {
+		t.Error("got a certificate of a host not listed")
+	}
+}
+
+// go test -run TestManagerHTTP
+func TestManagerHTTP(t *testing.T) {
+	dir, err := ioutil.TempDir("", "acmecert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	m := acmecert.New(dir, "ftp.example.com")
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "http://ftp.example.com/", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET / = %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,16 @@
+module github.com/cxfans/ftplib/acmecert
+
+go 1.20
+
+require (
+	github.com/cxfans/ftplib v0.0.0-20261017062650-16bad8f87320
+	golang.org/x/crypto v0.31.0
+)
+
+require (
+	golang.org/x/net v0.21.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+)
+
+// Within this repository, build against the ftplib next to the module.
+replace github.com/cxfans/ftplib => ..
@@ -0,0 +1,93 @@
+package ftplib
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+)
+
+var (
+	errDataAddress         = errors.New("invalid data connection address")
+	errUnsupportedProtocol = errors.New("unsupported network protocol")
+)
+
+// parsePortAddr parses the argument of PORT, "h1,h2,h3,h4,p1,p2".
+func parsePortAddr(arg string) (*net.TCPAddr, error) {
+	fields := strings.Split(arg, ",")
+	if len(fields) != 6 {
+		return nil, errDataAddress
+	}
+	var b [6]byte
+	for i, field := range fields {
+		n, err := strconv.ParseUint(strings.TrimSpace(field), 10, 8)
+		if err != nil {
+			return nil, errDataAddress
+		}
+		b[i] = byte(n)
+	}
+	return &net.TCPAddr{
+		IP:   net.IPv4(b[0], b[1], b[2], b[3]),
+		Port: int(b[4])<<8 | int(b[5]),
+	}, nil
+}
+
+// parseEPRTAddr parses the argument of EPRT (RFC 2428), "|1|1.2.3.4|6275|"
+// or "|2|::1|6275|", where the first character is the delimiter.
+func parseEPRTAddr(arg string) (*net.TCPAddr, error) {
+	if len(arg) < 1 {
+		return nil, errDataAddress
+	}
+	fields := strings.Split(arg, arg[:1])
+	if len(fields) != 5 || fields[0] != "" || fields[4] != "" {
+		return nil, errDataAddress
+	}
+	if fields[1] != "1" && fields[1] != "2" {
+		return nil, errUnsupportedProtocol
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[3], 10, 16)
+	if ip == nil || err != nil || port == 0 || (ip.To4() != nil) != (fields[1] == "1") {
+		return nil, errDataAddress
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// active sets up an active data connection to the address given to PORT or
+// EPRT. The address must be the client's own, unless the server allows
+// foreign data connections, and not a privileged port, so that the server
+// cannot be used to reach third parties (RFC 2577).
+func (serverConn *ServerConn) active(verb string, params []string) {
+	arg := strings.Join(params, " ")
+	var raddr *net.TCPAddr
+	var err error
+	if verb == EPRT {
+		raddr, err = parseEPRTAddr(arg)
+	} else {
+		raddr, err = parsePortAddr(arg)
+	}
+	if err == errUnsupportedProtocol {
+		serverConn.reply(StatusBadNetworkProtocol, "eprt")
+		return
+	}
+	if err != nil {
+		serverConn.sendStatusText(StatusBadArguments)
+		return
+	}
+	peer, ok := serverConn.RemoteAddr().(*net.TCPAddr)
+	if (ok && !peer.IP.Equal(raddr.IP) && !serverConn.server.AllowForeignData) || raddr.Port < 1024 {
+		serverConn.reply(StatusBadArguments, "port")
+		return
+	}
+
+	// The data connection leaves from the address the client reached, which
+	// matters on hosts with several.
+	var laddr *net.TCPAddr
+	if local, ok := serverConn.conn.LocalAddr().(*net.TCPAddr); ok {
+		laddr = &net.TCPAddr{IP: local.IP}
+	}
+	activeConn := NewActiveConn(raddr, laddr, serverConn.server.ActiveTimeout)
+	activeConn.sockopts = serverConn.server.DataSocket
+	serverConn.setDataConn(activeConn)
+	serverConn.reply(StatusCommandOK, "port", verb)
+}
@@ -0,0 +1,81 @@
+package ftplib
+
+import (
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+)
+
+// go test -run TestParseDataAddr
+func TestParseDataAddr(t *testing.T) {
+	tests := []struct {
+		arg  string
+		eprt bool
+		want string
+		err  error
+	}{
+		{"132,235,1,2,24,131", false, "132.235.1.2:6275", nil},
+		{"132,235,1,2,24", false, "", errDataAddress},
+		{"132,235,1,256,24,131", false, "", errDataAddress},
+		{"|1|132.235.1.2|6275|", true, "132.235.1.2:6275", nil},
+		{"!2!1080::8:800:200C:417A!5282!", true, "[1080::8:800:200c:417a]:5282", nil},
+		{"|2|132.235.1.2|6275|", true, "", errDataAddress},
+		{"|3|foo|6275|", true, "", errUnsupportedProtocol},
+		{"|1|132.235.1.2|6275", true, "", errDataAddress},
+	}
+	for _, test := range tests {
+		parse := parsePortAddr
+		if test.eprt {
+			parse = parseEPRTAddr
+		}
+		addr, err := parse(test.arg)
+		if err != test.err || (err == nil && addr.String() != test.want) {
+			t.Errorf("%q: got %v, %v", test.arg, addr, err)
+		}
+	}
+}
+
+// go test -run TestActiveConn
+func TestActiveConn(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			received <- err.Error()
+			return
+		}
+		data, _ := ioutil.ReadAll(conn)
+		received <- string(data)
+	}()
+
+	c, done := pipeServe(&Server{Driver: &DiskDriver{Root: "."}})
+	port := l.Addr().(*net.TCPAddr).Port
+	c.Cmd("PORT 127,0,0,1,%d,%d", port>>8, port&0xff)
+	if _, _, err := c.ReadResponse(StatusCommandOK); err != nil {
+		t.Fatal(err)
+	}
+	c.Cmd("NLST")
+	if _, _, err := c.ReadResponse(StatusAboutToSend); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.ReadResponse(StatusClosingDataConnection); err != nil {
+		t.Fatal(err)
+	}
+	if data := <-received; !strings.Contains(data, "go.mod\r\n") {
+		t.Errorf("unexpected listing %q", data)
+	}
+
+	c.Cmd("EPRT |1|127.0.0.1|21|")
+	if _, _, err := c.ReadResponse(StatusBadArguments); err != nil {
+		t.Error("privileged port accepted:", err)
+	}
+	c.Cmd("QUIT")
+	c.ReadResponse(StatusClosing)
+	<-done
+}
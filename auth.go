@@ -0,0 +1,96 @@
+package ftplib
+
+import (
+	"context"
+	"io"
+	"log"
+)
+
+// Auth checks the credentials of the users logging in.
+type Auth interface {
+	CheckPasswd(user, password string) (bool, error)
+}
+
+// AuthFunc adapts a function to the Auth interface.
+type AuthFunc func(user, password string) (bool, error)
+
+func (f AuthFunc) CheckPasswd(user, password string) (bool, error) {
+	return f(user, password)
+}
+
+// DriverAuth is an Auth also providing the Driver of each session, as a
+// gateway logging its clients in upstream does. The drivers implementing
+// io.Closer are closed when the session ends or its user logs in anew.
+type DriverAuth interface {
+	Auth
+	// Login checks the password of user and returns the Driver of the
+	// session, nil to refuse the user. ctx is the context of the session.
+	Login(ctx context.Context, user, password string) (Driver, error)
+}
+
+// preLoginVerbs are the commands allowed before logging in to a server
+// checking passwords.
+var preLoginVerbs = map[string]bool{
+	AUTH: true, CLNT: true, FEAT: true, HELP: true, HOST: true, LANG: true,
+	NOOP: true, OPTS: true, PASS: true, PBSZ: true, PROT: true, QUIT: true,
+	SYST: true, USER: true,
+}
+
+// auth returns the Auth of the session's virtual host, or of the server.
+func (serverConn *ServerConn) auth() Auth {
+	if host := serverConn.vhost; host != nil && host.Auth != nil {
+		return host.Auth
+	}
+	return serverConn.server.Auth
+}
+
+// loginRequired reports whether verb may not be run before logging in.
+func (serverConn *ServerConn) loginRequired(verb string) bool {
+	return !serverConn.loggedIn && serverConn.auth() != nil && !preLoginVerbs[verb]
+}
+
+// login checks the password of the user named with USER. Without Auth,
+// every user is let in.
+func (serverConn *ServerConn) login(password string) {
+	if serverConn.user == "" {
+		serverConn.sendStatusText(StatusBadSequence)
+		return
+	}
+	if auth := serverConn.auth(); auth != nil {
+		var ok bool
+		var err error
+		if driverAuth, isDriverAuth := auth.(DriverAuth); isDriverAuth {
+			var driver Driver
+			driver, err = driverAuth.Login(serverConn.Context(), serverConn.user, password)
+			serverConn.setSessionDriver(driver)
+			ok = driver != nil
+		} else if contextAuth, isContextAuth := auth.(ContextAuth); isContextAuth {
+			ok, err = contextAuth.CheckPasswdContext(serverConn.Context(), serverConn.user, password)
+		} else {
+			ok, err = auth.CheckPasswd(serverConn.user, password)
+		}
+		if err != nil {
+			log.Println(err)
+		}
+		if !ok {
+			log.Println(serverConn.RemoteAddr(), "failed login:", serverConn.user)
+			serverConn.user = ""
+			serverConn.sendStatusText(StatusNotLoggedIn)
+			return
+		}
+	}
+	serverConn.loggedIn = true
+	serverConn.setSessionUser(serverConn.user)
+	serverConn.sendStatusText(StatusLoggedIn)
+}
+
+// setSessionDriver replaces the Driver a DriverAuth gave the session,
+// closing the former one.
+func (serverConn *ServerConn) setSessionDriver(driver Driver) {
+	if closer, ok := serverConn.sessionDriver.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Println(err)
+		}
+	}
+	serverConn.sessionDriver = driver
+}
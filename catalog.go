@@ -0,0 +1,135 @@
+package ftplib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Catalog holds the texts of the server's replies, as fmt formats.
+//
+// Texts are keyed by status code ("250"), with variants for the replies
+// sharing a code keyed by the code and a name ("250.dele"). A variant
+// missing from a catalog falls back to the plain code of the same catalog.
+type Catalog map[string]string
+
+// DefaultCatalog holds the English texts used when neither the negotiated
+// language nor the server's "en" catalog has one.
+var DefaultCatalog = Catalog{
+	"150.list":      "Opening ASCII mode data connection for file list",
+	"150.retr":      "Data transfer starting %d bytes",
+	"150.stor":      "Data transfer starting.",
+	"200.lang":      "Language set to %s.",
+	"200.mode":      "Mode set to S.",
+	"200.opts.mlst": "MLST OPTS %s",
+	"200.pbsz":      "PBSZ=0",
+	"200.port":      "%s command successful.",
+	"200.prot":      "Protection level set to %s.",
+	"200.stru":      "Structure set to F.",
+	"200.type.a":    "Type set to ASCII.",
+	"200.type.i":    "Type set to binary.",
+	"202.allo":      "No storage allocation necessary.",
+	"211.feat":      "Features:",
+	"211.feat.end":  "End",
+	"211.stat":      "FTP server status:",
+	"211.stat.end":  "End of status",
+	"212.stat":      "Status of %s:",
+	"212.stat.end":  "End of status",
+	"213.stat":      "Status of %s:",
+	"213.stat.end":  "End of status",
+	"214.help":      "The following commands are recognized.",
+	"214.help.end":  "Help OK.",
+	"220.host":      "Welcome to %s.",
+	"226.data":      "Closing data connection, sent %d bytes.",
+	"226.stor":      "OK, received %d bytes.",
+	"234.auth":      "AUTH command ok. Expecting TLS Negotiation.",
+	"250.cpto":      "Copy successful.",
+	"250.cwd":       "Directory changed to %s",
+	"250.dele":      "File deleted.",
+	"250.mlst":      "Listing %s",
+	"250.mlst.end":  "End",
+	"250.rmd":       "Directory deleted.",
+	"250.rnto":      "File renamed.",
+	"257.mkd":       "\"%s\" created.",
+	"257.pwd":       "\"%s\" is current directory.",
+	"350.cpfr":      "File exists, ready for destination name.",
+	"350.rest":      "Restarting at %d. Send STORE or RETRIEVE.",
+	"501.type":      "Invalid type.",
+	"501.port":      "Illegal data connection address.",
+	"502.auth":      "TLS is not configured.",
+	"504.host":      "Unknown host %s.",
+	"504.lang":      "Language %s not supported.",
+	"522.eprt":      "Network protocol not supported, use (1,2)",
+	"552.quota":     "Quota exceeded.",
+	"552.size":      "Upload exceeds the maximum size of %d bytes.",
+	"553.scan":      "Upload rejected.",
+	"554.rest":      "Invalid restart offset %d.",
+}
+
+// text returns the format for code and variant, if the catalog has one.
+func (catalog Catalog) text(code int, variant string) (string, bool) {
+	key := strconv.Itoa(code)
+	if variant != "" {
+		if format, ok := catalog[key+"."+variant]; ok {
+			return format, true
+		}
+	}
+	format, ok := catalog[key]
+	return format, ok
+}
+
+// defaultLang is the language of sessions that did not send LANG.
+const defaultLang = "en"
+
+// catalog returns the server's catalog for lang, if any.
+func (server *Server) catalog(lang string) Catalog {
+	for tag, catalog := range server.Catalogs {
+		if strings.EqualFold(tag, lang) {
+			return catalog
+		}
+	}
+	return nil
+}
+
+// reply sends the catalog text of code and variant, formatted with args.
+func (serverConn *ServerConn) reply(code int, variant string, args ...interface{}) {
+	serverConn.sendCodeLine(code, serverConn.text(code, variant, args...))
+}
+
+// text returns the catalog text of code and variant, formatted with args.
+// The negotiated language is looked up first, then the server's "en"
+// catalog, then DefaultCatalog and finally the status code's Message.
+func (serverConn *ServerConn) text(code int, variant string, args ...interface{}) string {
+	catalogs := []Catalog{
+		serverConn.server.catalog(serverConn.lang),
+		serverConn.server.catalog(defaultLang),
+		DefaultCatalog,
+	}
+	format := Message(code)
+	for _, catalog := range catalogs {
+		if f, ok := catalog.text(code, variant); ok {
+			format = f
+			break
+		}
+	}
+	// Texts overriding a variant may leave its arguments out.
+	if len(args) > 0 && strings.Contains(format, "%") {
+		format = fmt.Sprintf(format, args...)
+	}
+	return format
+}
+
+// setLang selects the language of the replies, as requested by LANG
+// (RFC 2640). Without argument it restores the default language.
+func (serverConn *ServerConn) setLang(params []string) {
+	lang := strings.Join(params, " ")
+	if lang == "" {
+		lang = defaultLang
+	}
+	if !strings.EqualFold(lang, defaultLang) && serverConn.server.catalog(lang) == nil {
+		serverConn.reply(StatusNotImplementedParameter, "lang", lang)
+		return
+	}
+	serverConn.lang = lang
+	serverConn.reply(StatusCommandOK, "lang", lang)
+}
@@ -0,0 +1,37 @@
+package ftplib
+
+import (
+	"testing"
+)
+
+// go test -run TestCatalog
+func TestCatalog(t *testing.T) {
+	server := &Server{
+		Driver: &DiskDriver{Root: "."},
+		Catalogs: map[string]Catalog{
+			"en": {"200.type.i": "Binary it is."},
+			"fr": {"200": "Commande correcte.", "257.pwd": "\"%s\" est le répertoire courant."},
+		},
+	}
+	c, done := pipeServe(server)
+	expect := func(cmd string, code int, msg string) {
+		c.Cmd(cmd)
+		if _, got, err := c.ReadResponse(code); err != nil || got != msg {
+			t.Errorf("%s: got %q (%v), want %q", cmd, got, err, msg)
+		}
+	}
+
+	expect("TYPE I", StatusCommandOK, "Binary it is.")
+	expect("PWD", StatusPathCreated, "\"/\" is current directory.")
+	expect("LANG de", StatusNotImplementedParameter, "Language de not supported.")
+	expect("LANG FR", StatusCommandOK, "Commande correcte.")
+	expect("PWD", StatusPathCreated, "\"/\" est le répertoire courant.")
+	expect("TYPE I", StatusCommandOK, "Commande correcte.")
+	expect("NOOP", StatusCommandOK, "Commande correcte.")
+	expect("LANG", StatusCommandOK, "Language set to en.")
+	expect("NOOP", StatusCommandOK, "Command okay.")
+
+	c.Cmd("QUIT")
+	c.ReadResponse(StatusClosing)
+	<-done
+}
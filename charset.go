@@ -0,0 +1,221 @@
+package ftplib
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// Charset converts file names between UTF-8 and another encoding. An
+// adapter over a golang.org/x/text/encoding.Encoding takes a few lines.
+type Charset interface {
+	// Decode converts s from the encoding to UTF-8.
+	Decode(s string) (string, error)
+	// Encode converts the UTF-8 s to the encoding.
+	Encode(s string) (string, error)
+}
+
+var errNotEncodable = errors.New("name not representable in the charset")
+
+// Latin1 is the ISO-8859-1 charset, whose bytes are the first 256 runes.
+var Latin1 Charset = latin1{}
+
+type latin1 struct{}
+
+func (latin1) Decode(s string) (string, error) {
+	runes := make([]rune, len(s))
+	for i := 0; i < len(s); i++ {
+		runes[i] = rune(s[i])
+	}
+	return string(runes), nil
+}
+
+func (latin1) Encode(s string) (string, error) {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xff {
+			return "", errNotEncodable
+		}
+		b = append(b, byte(r))
+	}
+	return string(b), nil
+}
+
+// clientCharset returns the charset of the names exchanged with the client,
+// or nil for UTF-8: clients are assumed to use the server's ClientCharset
+// until they send "OPTS UTF8 ON" (RFC 2640).
+func (serverConn *ServerConn) clientCharset() Charset {
+	if serverConn.utf8 {
+		return nil
+	}
+	return serverConn.server.ClientCharset
+}
+
+// decodeClient converts s, as sent by the client, to UTF-8. Valid UTF-8 is
+// kept as is, for clients that never negotiated it but use it anyway.
+func (serverConn *ServerConn) decodeClient(s string) (string, error) {
+	charset := serverConn.clientCharset()
+	if charset == nil || utf8.ValidString(s) {
+		return s, nil
+	}
+	return charset.Decode(s)
+}
+
+// encodeClient converts the UTF-8 s to the charset of the client. Names it
+// cannot represent are sent in UTF-8.
+func (serverConn *ServerConn) encodeClient(s string) string {
+	charset := serverConn.clientCharset()
+	if charset == nil {
+		return s
+	}
+	if encoded, err := charset.Encode(s); err == nil {
+		return encoded
+	}
+	return s
+}
+
+// utf8Opts switches the names exchanged with the client to UTF-8, or back
+// to the server's ClientCharset, as requested by "OPTS UTF8 ON|OFF".
+func (serverConn *ServerConn) utf8Opts(args string) {
+	switch strings.ToUpper(args) {
+	case "ON", "":
+		serverConn.utf8 = true
+	case "OFF":
+		serverConn.utf8 = false
+	default:
+		serverConn.sendStatusText(StatusBadArguments)
+		return
+	}
+	serverConn.sendStatusText(StatusCommandOK)
+}
+
+// charsetDriver stores the names of the wrapped Driver in its charset,
+// while the session works with UTF-8 paths.
+type charsetDriver struct {
+	Driver
+	charset Charset
+}
+
+// namedInfo is a FileInfo under another name.
+type namedInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (info *namedInfo) Name() string {
+	return info.name
+}
+
+// info returns f under its UTF-8 name.
+func (d *charsetDriver) info(f os.FileInfo) os.FileInfo {
+	name, err := d.charset.Decode(f.Name())
+	if err != nil || name == f.Name() {
+		return f
+	}
+	return &namedInfo{FileInfo: f, name: name}
+}
+
+func (d *charsetDriver) Stat(p string) (os.FileInfo, error) {
+	p, err := d.charset.Encode(p)
+	if err != nil {
+		return nil, err
+	}
+	f, err := d.Driver.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	return d.info(f), nil
+}
+
+func (d *charsetDriver) ReadDir(p string) ([]os.FileInfo, error) {
+	p, err := d.charset.Encode(p)
+	if err != nil {
+		return nil, err
+	}
+	items, err := d.Driver.ReadDir(p)
+	for i, item := range items {
+		items[i] = d.info(item)
+	}
+	return items, err
+}
+
+func (d *charsetDriver) Open(p string, offset int64) (io.ReadCloser, error) {
+	p, err := d.charset.Encode(p)
+	if err != nil {
+		return nil, err
+	}
+	return d.Driver.Open(p, offset)
+}
+
+func (d *charsetDriver) Put(p string, r io.Reader, appending bool) (int64, error) {
+	p, err := d.charset.Encode(p)
+	if err != nil {
+		return 0, err
+	}
+	return d.Driver.Put(p, r, appending)
+}
+
+func (d *charsetDriver) Remove(p string) error {
+	p, err := d.charset.Encode(p)
+	if err != nil {
+		return err
+	}
+	return d.Driver.Remove(p)
+}
+
+func (d *charsetDriver) RemoveDir(p string) error {
+	p, err := d.charset.Encode(p)
+	if err != nil {
+		return err
+	}
+	return d.Driver.RemoveDir(p)
+}
+
+func (d *charsetDriver) Rename(from, to string) error {
+	from, to, err := d.encodePair(from, to)
+	if err != nil {
+		return err
+	}
+	return d.Driver.Rename(from, to)
+}
+
+func (d *charsetDriver) MakeDir(p string) error {
+	p, err := d.charset.Encode(p)
+	if err != nil {
+		return err
+	}
+	return d.Driver.MakeDir(p)
+}
+
+// Copy keeps the native copy of the wrapped Driver, if it has one.
+func (d *charsetDriver) Copy(from, to string) error {
+	from, to, err := d.encodePair(from, to)
+	if err != nil {
+		return err
+	}
+	return copyFile(d.Driver, from, to)
+}
+
+// Readlink keeps the links of the wrapped Driver, if it has any.
+func (d *charsetDriver) Readlink(p string) (string, error) {
+	p, err := d.charset.Encode(p)
+	if err != nil {
+		return "", err
+	}
+	target, err := readlink(d.Driver, p)
+	if err != nil {
+		return "", err
+	}
+	return d.charset.Decode(target)
+}
+
+func (d *charsetDriver) encodePair(from, to string) (string, string, error) {
+	from, err := d.charset.Encode(from)
+	if err != nil {
+		return "", "", err
+	}
+	to, err = d.charset.Encode(to)
+	return from, to, err
+}
@@ -0,0 +1,64 @@
+package ftplib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// go test -run TestLatin1
+func TestLatin1(t *testing.T) {
+	s, err := Latin1.Decode("caf\xe9")
+	if err != nil || s != "café" {
+		t.Errorf("Decode = %q (%v), want café", s, err)
+	}
+	s, err = Latin1.Encode("café")
+	if err != nil || s != "caf\xe9" {
+		t.Errorf("Encode = %q (%v)", s, err)
+	}
+	if _, err = Latin1.Encode("日本"); err == nil {
+		t.Error("Encode of runes beyond Latin-1 should fail")
+	}
+}
+
+// go test -run TestCharsets
+func TestCharsets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftplib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "caf\xe9"), []byte("1234"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, done := pipeServe(&Server{
+		Driver:        &DiskDriver{Root: dir},
+		DiskCharset:   Latin1,
+		ClientCharset: Latin1,
+	})
+	for _, step := range []struct {
+		cmd  string
+		code int
+	}{
+		{"SIZE caf\xe9", StatusFile},
+		{"MKD d\xe9j\xe0", StatusPathCreated},
+		{"OPTS UTF8 ON", StatusCommandOK},
+		{"SIZE café", StatusFile},
+		{"RMD déjà", StatusRequestedFileActionOK},
+		{"OPTS UTF8 MAYBE", StatusBadArguments},
+	} {
+		c.Cmd(step.cmd)
+		if _, msg, err := c.ReadResponse(step.code); err != nil {
+			t.Errorf("%s: %s (%v)", step.cmd, msg, err)
+		}
+		if step.code == StatusPathCreated {
+			if _, err := os.Stat(filepath.Join(dir, "d\xe9j\xe0")); err != nil {
+				t.Errorf("%s: %v", step.cmd, err)
+			}
+		}
+	}
+	c.Cmd("QUIT")
+	c.ReadResponse(StatusClosing)
+	<-done
+}
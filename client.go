@@ -2,37 +2,110 @@ package ftplib
 
 import (
 	"bufio"
+	"crypto/tls"
 	"errors"
 	"io"
-	"log"
 	"net"
 	"net/textproto"
+	"os"
 	"strconv"
 	"strings"
 	"time"
 )
 
-/// EntryType describes the different types of an Entry.
+// EntryType describes the different types of an Entry.
 type EntryType int
 
 const (
 	EntryTypeFile EntryType = iota
 	EntryTypeFolder
 	EntryTypeLink
+	EntryTypeOther // devices, sockets, FIFOs...
 )
 
 // ClientConn represents the connection to a remote FTP server.
 type ClientConn struct {
 	conn     *textproto.Conn
-	host     string
+	raw      net.Conn    // under conn, for AuthTLS
+	tls      *tls.Config // protecting the data connections, once set
+	secure   *tls.Config // of the control connection, once secured
+	implicit *tls.Config // of DialTLS, securing the connection from the start
+	explicit *tls.Config // of WithTLS, securing the session once connected
+	addr     string      // as given to Dial, resolved anew by Reconnect
+	host     string      // IP address of the server, with its zone, for the data connections
 	timeout  time.Duration
+	dialer   Dialer
+	trace    *traceWriter // of WithTrace
+	tracer   Tracer       // of WithTracer
+	localIP  net.IP       // of WithLocalAddr
+	alive    *keepAlive   // set by SetKeepAlive
+	logger   Logger
+	user     string // of Login, for the other sessions of UploadDir
+	password string
+	account  string
+	creds    CredentialProvider // of LoginWith, asked at each login instead
 	features map[string]string
+	facts    []string      // MLSx facts selected with SetMLSTFacts
+	hash     HashAlgorithm // selected with OPTS HASH, "" if the default
+	verify   UploadVerification
+	retry    RetryPolicy
+	parser   ListParser
+	types    map[string]TransferType // by extension, set by SetTransferTypes
+	typ      TransferType            // in effect, "" if unknown
+
+	disableEPSV   bool
+	checkPeer     bool      // set by WithPeerCheck
+	active        bool      // set by SetActiveMode
+	autoReconnect bool      // set by SetAutoReconnect
+	restoring     bool      // while restore sets up a new session
+	dir           string    // working directory, "" for the login one
+	watch         *ctxWatch // of the operation in progress with a context
+	transfer      *response // download in progress, for Abort
+	lastCode      int       // of the last reply, for the spans
 }
 
+// Client is the interface of ClientConn, for applications to substitute a
+// fake in their tests.
+type Client interface {
+	Login(user, password string) error
+	Logout() error
+	Quit() error
+	NoOp() error
+
+	SetListParser(parser ListParser)
+	NameList(path string) ([]string, error)
+	List(path string) ([]*Entry, error)
+
+	ChangeDir(path string) error
+	ChangeDirToParent() error
+	CurrentDir() (string, error)
+	MakeDir(path string) error
+	RemoveDir(path string) error
+
+	Retr(path string) (io.ReadCloser, error)
+	RetrFrom(path string, offset uint64) (io.ReadCloser, error)
+	Stor(path string, r io.Reader) error
+	StorFrom(path string, r io.Reader, offset uint64) error
+	Rename(from, to string) error
+	Delete(path string) error
+}
+
+var _ Client = (*ClientConn)(nil)
+
 // response represent a data-connection
 type response struct {
-	conn net.Conn
-	c    *ClientConn
+	conn    net.Conn
+	c       *ClientConn
+	aborted bool   // by Abort, which read the replies
+	cmd     string // of the transfer, for the error of its final reply
+
+	span *clientSpan // of a download, ended on Close
+	n    int64       // bytes read
+
+	// Set for the downloads resumed when the connection breaks.
+	path     string
+	offset   uint64 // of the next byte to read
+	failures int    // attempts to resume since the last data
 }
 
 // ClientConn represents the connection to a remote FTP server.
@@ -41,69 +114,238 @@ type Entry struct {
 	Type EntryType
 	Size uint64
 	Time time.Time
+
+	// The attributes below are only set when the listing shows them.
+	Mode   os.FileMode // type and permission bits
+	Owner  string
+	Group  string
+	Target string // what a symbolic link points to
+	NLink  uint64 // number of hard links
+	Perm   string // MLSx "perm" fact, the operations allowed, such as "adfrw"
+	Unique string // MLSx "unique" fact, identifying the file on the server
+
+	Raw string // the line the entry was parsed from
 }
 
 func (c *ClientConn) Quit() error {
+	c.stopKeepAlive()
 	c.conn.Cmd("QUIT")
 	return c.conn.Close()
 }
 
 func (r *response) Close() error {
+	if r.aborted {
+		return nil
+	}
+	if r.c.transfer == r {
+		r.c.transfer = nil
+	}
 	err := r.conn.Close()
-	_, _, err2 := r.c.conn.ReadResponse(StatusClosingDataConnection)
+	_, _, err2 := r.c.finalReply(StatusClosingDataConnection, r.cmd)
 	if err2 != nil {
 		err = err2
 	}
+	r.endSpan(err)
 	return err
 }
 
+// endSpan ends the span of the download, if any.
+func (r *response) endSpan(err error) {
+	r.span.setAttribute(AttrBytes, r.n)
+	r.span.end(err)
+	r.span = nil
+}
+
 func (r *response) Read(buf []byte) (int, error) {
-	return r.conn.Read(buf)
+	for {
+		n, err := r.conn.Read(buf)
+		r.offset += uint64(n)
+		r.n += int64(n)
+		if n > 0 {
+			r.failures = 0
+		}
+		if r.path == "" || err == nil || err == io.EOF || r.aborted {
+			return n, err
+		}
+		if n > 0 {
+			// The broken connection fails the next Read again.
+			return n, nil
+		}
+		r.failures++
+		if !r.c.retryTransfer(err, r.failures) || !r.c.backoff(r.failures) {
+			return 0, err
+		}
+		if err := r.reopen(); err != nil {
+			return 0, err
+		}
+	}
 }
 
-// Dial is like DialTimeout with no timeout
-func Dial(addr string) (*ClientConn, error) {
-	return DialTimeout(addr, 0)
+// Dial connects to the server at addr, configured by opts, and reads its
+// greeting and features.
+func Dial(addr string, opts ...DialOption) (*ClientConn, error) {
+	c := &ClientConn{addr: addr}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.implicit != nil {
+		c.implicit = c.sessionConfig(c.implicit)
+	}
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+	if c.creds != nil {
+		if err := c.LoginWith(c.creds); err != nil {
+			c.Quit()
+			return nil, err
+		}
+	}
+	c.startKeepAlive()
+	return c, nil
 }
 
+// DialTimeout is Dial with WithTimeout.
 func DialTimeout(addr string, timeout time.Duration) (*ClientConn, error) {
-	tconn, err := net.DialTimeout("tcp", addr, timeout)
-	if err != nil {
+	return Dial(addr, WithTimeout(timeout))
+}
+
+// DialTLS connects to a server with implicit FTPS, usually listening on
+// port 990, which expects TLS from the start of the connection instead of
+// an AUTH TLS command. The data connections are encrypted too. Without a
+// ServerName, config verifies the host of addr. It is Dial with
+// WithImplicitTLS.
+func DialTLS(addr string, config *tls.Config) (*ClientConn, error) {
+	return Dial(addr, WithImplicitTLS(config))
+}
+
+// sessionConfig returns config completed for the sessions of c: it names
+// the host of c.addr unless it names a server, and has a session cache, so
+// that the data connections resume the TLS session of the control
+// connection, as servers such as vsftpd with require_ssl_reuse or ProFTPD
+// demand. The sessions are resumed with tickets; crypto/tls cannot resume
+// them by session ID.
+func (c *ClientConn) sessionConfig(config *tls.Config) *tls.Config {
+	config = config.Clone()
+	if config.ServerName == "" {
+		if host, _, err := net.SplitHostPort(c.addr); err == nil {
+			config.ServerName = host
+		}
+	}
+	if config.ClientSessionCache == nil {
+		config.ClientSessionCache = tls.NewLRUClientSessionCache(1)
+	}
+	return config
+}
+
+// Reconnect replaces the control connection with a new one to the address
+// given to Dial, resolving its host name anew so that the failovers behind
+// round-robin DNS or load balancers are followed. The client must log in
+// again, and secure the session again if it called AuthTLS rather than
+// dialing WithTLS.
+func (c *ClientConn) Reconnect() error {
+	c.stopKeepAlive()
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+	c.startKeepAlive()
+	return nil
+}
+
+// session opens another session to the server of c, configured and
+// logged in alike, to run transfers alongside it.
+func (c *ClientConn) session() (*ClientConn, error) {
+	s := &ClientConn{
+		addr:        c.addr,
+		implicit:    c.implicit,
+		explicit:    c.explicit,
+		timeout:     c.timeout,
+		dialer:      c.dialer,
+		trace:       c.trace,
+		tracer:      c.tracer,
+		localIP:     c.localIP,
+		logger:      c.logger,
+		parser:      c.parser,
+		types:       c.types,
+		verify:      c.verify,
+		retry:       c.retry,
+		disableEPSV: c.disableEPSV,
+		checkPeer:   c.checkPeer,
+		active:      c.active,
+	}
+	if err := s.connect(); err != nil {
 		return nil, err
 	}
+	if err := s.resume(c.secure, c.secure != nil && c.tls == nil, c); err != nil {
+		s.Quit()
+		return nil, err
+	}
+	return s, nil
+}
+
+// connect dials c.addr and reads the greeting and the features.
+func (c *ClientConn) connect() error {
+	tconn, err := c.dial(c.addr)
+	if err != nil {
+		return err
+	}
 	// Use the resolved IP address in case addr contains a domain name
 	// If we use the domain name, we might not resolve to the same IP.
-	remoteAddr := tconn.RemoteAddr().(*net.TCPAddr)
-	conn := textproto.NewConn(tconn)
-
-	c := &ClientConn{
-		conn:     conn,
-		host:     remoteAddr.IP.String(),
-		timeout:  timeout,
-		features: make(map[string]string),
+	// Through a tunnel, the host is the one of addr, which the proxy
+	// resolves.
+	host, _, _ := net.SplitHostPort(c.addr)
+	if remoteAddr, ok := tconn.RemoteAddr().(*net.TCPAddr); ok {
+		host = (&net.IPAddr{IP: remoteAddr.IP, Zone: remoteAddr.Zone}).String()
+	}
+	if c.implicit != nil {
+		conn := tls.Client(tconn, c.implicit)
+		if err := conn.Handshake(); err != nil {
+			tconn.Close()
+			return err
+		}
+		tconn = conn
+	}
+	c.conn = c.textConn(tconn)
+	c.raw = tconn
+	c.tls, c.secure = nil, nil
+	c.host = host
+	c.features = make(map[string]string)
+	c.facts = nil
+	c.dir = ""
+	c.hash = ""
+	c.typ = ""
+
+	_, _, err = c.conn.ReadResponse(StatusReady)
+	if err != nil {
+		c.Quit()
+		return replyErr(err, "")
 	}
 
-	_, msg, err := c.conn.ReadResponse(StatusReady)
-	//_, msg, err := c.conn.ReadResponse(StatusReady)
-	log.Println(msg)
+	if c.implicit != nil {
+		err = c.protectData(c.implicit)
+	} else if c.explicit != nil {
+		err = c.AuthTLS(c.explicit)
+	}
 	if err != nil {
 		c.Quit()
-		return nil, err
+		return err
 	}
 
 	err = c.feat()
 	if err != nil {
 		c.Quit()
-		return nil, err
+		return err
 	}
 
 	err = c.setUTF8()
 	if err != nil {
 		c.Quit()
-		return nil, err
+		return err
 	}
 
-	return c, nil
+	return nil
 }
 
 // setUTF8 issues an "OPTS UTF8 ON" command.
@@ -121,7 +363,7 @@ func (c *ClientConn) setUTF8() error {
 		return errors.New(message)
 	}
 
-	log.Println("Set utf-8")
+	c.logf("Set utf-8")
 
 	return nil
 }
@@ -168,29 +410,65 @@ func (c *ClientConn) feat() error {
 // "anonymous"/"anonymous" is a common user/password scheme for FTP servers
 // that allows anonymous read-only accounts.
 func (c *ClientConn) Login(user, password string) error {
-	code, message, err := c.cmd(-1, "USER %s", user)
-	if err != nil {
+	return c.login(Credentials{User: user, Password: password})
+}
+
+// AuthTLS secures the session with "AUTH TLS" (RFC 4217), then encrypts
+// the data connections with "PBSZ 0" and "PROT P". Without a ServerName,
+// config verifies the host of the address dialed. The data connections
+// resume the TLS session of the control connection.
+func (c *ClientConn) AuthTLS(config *tls.Config) error {
+	if _, _, err := c.cmd(StatusAuthOK, "AUTH TLS"); err != nil {
 		return err
 	}
-
-	switch code {
-	case StatusLoggedIn:
-	case StatusUserOK:
-		_, _, err = c.cmd(StatusLoggedIn, "PASS %s", password)
-		if err != nil {
-			return err
-		}
-	default:
-		return errors.New(message)
+	config = c.sessionConfig(config)
+	c.lockControl()
+	tconn := tls.Client(c.raw, config)
+	if err := tconn.Handshake(); err != nil {
+		c.unlockControl(false)
+		return err
 	}
+	c.raw, c.conn = tconn, c.textConn(tconn)
+	c.unlockControl(false)
+	return c.protectData(config)
+}
 
-	// Switch to binary mode
-	_, _, err = c.cmd(StatusCommandOK, "TYPE I")
-	if err != nil {
+// DataProtection is the protection of the data connections, as set with
+// PROT (RFC 4217).
+type DataProtection string
+
+const (
+	ProtectionClear   DataProtection = "C"
+	ProtectionPrivate DataProtection = "P"
+)
+
+var errNotSecured = errors.New("control connection not secured with TLS")
+
+// protectData encrypts the data connections with config, once the control
+// connection is. If the server refuses, the control connection stays
+// secured and SetDataProtection can carry on in the clear.
+func (c *ClientConn) protectData(config *tls.Config) error {
+	c.secure = config
+	if _, _, err := c.cmd(StatusCommandOK, "PBSZ 0"); err != nil {
 		return err
 	}
+	return c.SetDataProtection(ProtectionPrivate)
+}
 
-	log.Println("User logged in.")
+// SetDataProtection switches the data connections of a session secured
+// with AuthTLS or DialTLS between encrypted and clear, for servers refusing
+// encrypted transfers or to spare the cost of TLS on public data.
+func (c *ClientConn) SetDataProtection(level DataProtection) error {
+	if c.secure == nil {
+		return errNotSecured
+	}
+	if _, _, err := c.cmd(StatusCommandOK, "PROT %s", level); err != nil {
+		return err
+	}
+	c.tls = nil
+	if level == ProtectionPrivate {
+		c.tls = c.secure
+	}
 	return nil
 }
 
@@ -207,7 +485,6 @@ func ConnectAnonymous(addr string) (*ClientConn, error) {
 func Connect(addr, user, password string) (*ClientConn, error) {
 	c, err := Dial(addr)
 	if err != nil {
-		c.Quit()
 		return nil, err
 	}
 	return c, c.Login(user, password)
@@ -220,15 +497,7 @@ func (c *ClientConn) epsv() (port int, err error) {
 	if err != nil {
 		return
 	}
-	// 229 Entering Extended Passive Mode (|||65202|)
-	start := strings.Index(line, "|||")
-	end := strings.LastIndex(line, "|")
-	if start == -1 || end == -1 {
-		err = errors.New("invalid EPSV response format")
-		return
-	}
-	port, err = strconv.Atoi(line[start+3 : end])
-	return
+	return ParseEPSV(line)
 }
 
 // Enter passive mode
@@ -237,89 +506,97 @@ func (c *ClientConn) pasv() (port int, err error) {
 	if err != nil {
 		return
 	}
-	// 227 Entering Passive Mode (172,17,66,241,254,179)
-	start := strings.Index(line, "(")
-	end := strings.LastIndex(line, ")")
-	if start == -1 || end == -1 {
-		err = errors.New("invalid PASV response format")
-		return
+	// The address is ignored, unless checked: servers behind NAT advertise
+	// one the client cannot reach.
+	host, port, err := ParsePASV(line)
+	if err == nil && c.checkPeer && !c.isServer(net.ParseIP(host)) {
+		return 0, errPASVAddress
 	}
-	lst := strings.Split(string(line[start+1:end]), ",")
-	n := len(lst)
-	x, _ := strconv.Atoi(lst[n-2])
-	y, _ := strconv.Atoi(lst[n-1])
-	port, err = x*256+y, nil
-	return
+	return port, err
+}
+
+var (
+	errPASVAddress = errors.New("PASV reply with another address than the server")
+	errPassivePeer = errors.New("data connection to another host than the server")
+)
+
+// isServer reports whether ip is the address of the server, or may be as
+// far as c knows, through a tunnel.
+func (c *ClientConn) isServer(ip net.IP) bool {
+	server := net.ParseIP(c.host)
+	return server == nil || server.Equal(ip)
 }
 
 // openDataConn creates a new FTP data connection.
 func (c *ClientConn) openDataConn() (net.Conn, error) {
 	var (
-		port int
+		conn net.Conn
 		err  error
 	)
-
-	if port, err = c.epsv(); err != nil {
-		if port, err = c.pasv(); err != nil {
-		}
+	if c.active {
+		conn, err = c.activeDataConn()
+	} else {
+		conn, err = c.passiveDataConn()
 	}
-
-	return net.DialTimeout("tcp", net.JoinHostPort(c.host, strconv.Itoa(port)), c.timeout)
+	if err == nil && c.watch != nil {
+		c.watch.add(conn)
+	}
+	if err != nil || c.tls == nil {
+		return conn, err
+	}
+	return tls.Client(conn, c.tls), nil
 }
 
-// parseListLine parses the various non-standard
-// format returned by the LIST FTP command.
-func parseListLine(line string) (*Entry, error) {
-	fields := strings.Fields(line)
-	if len(fields) < 9 {
-		return nil, errors.New("unsupported LIST line")
+// passiveDataConn connects to the port the server opens with EPSV, or PASV.
+func (c *ClientConn) passiveDataConn() (net.Conn, error) {
+	port, err := c.passivePort()
+	if err != nil {
+		return nil, err
 	}
-
-	e := &Entry{}
-	switch fields[0][0] {
-	case '-':
-		e.Type = EntryTypeFile
-	case 'd':
-		e.Type = EntryTypeFolder
-	case 'l':
-		e.Type = EntryTypeLink
-	default:
-		return nil, errors.New("unknown entry type")
+	conn, err := c.dial(net.JoinHostPort(c.host, strconv.Itoa(port)))
+	if err != nil || !c.checkPeer {
+		return conn, err
 	}
-
-	if e.Type == EntryTypeFile {
-		size, err := strconv.ParseUint(fields[4], 10, 0)
-		if err != nil {
-			return nil, err
-		}
-		e.Size = size
+	if remote, ok := conn.RemoteAddr().(*net.TCPAddr); ok && !c.isServer(remote.IP) {
+		conn.Close()
+		return nil, errPassivePeer
 	}
-	var timeStr string
-	if strings.Contains(fields[7], ":") { // this year
-		thisYear, _, _ := time.Now().Date()
-		timeStr = fields[6] + " " + fields[5] + " " +
-			strconv.Itoa(thisYear)[2:4] + " " + fields[7] + " GMT"
-	} else { // not this year
-		timeStr = fields[6] + " " + fields[5] + " " + fields[7][2:4] + " " + "00:00" + " GMT"
+	return conn, nil
+}
+
+// passivePort has the server open a port for the next transfer, with EPSV
+// or PASV, and returns it.
+func (c *ClientConn) passivePort() (port int, err error) {
+	if c.disableEPSV {
+		return c.pasv()
 	}
-	t, err := time.Parse("_2 Jan 06 15:04 MST", timeStr)
-	if err != nil {
-		return nil, err
+	if port, err = c.epsv(); err != nil && !c.ipv6() {
+		// PASV only carries IPv4 addresses.
+		port, err = c.pasv()
 	}
-	e.Time = t
+	return
+}
 
-	e.Name = strings.Join(fields[8:], " ")
-	return e, nil
+// ipv6 reports whether the control connection is over IPv6.
+func (c *ClientConn) ipv6() bool {
+	ip := net.ParseIP(c.host) // nil with a zone, for IPv6 only
+	if ip == nil {
+		// Or a host name, through a tunnel.
+		return strings.Contains(c.host, "%")
+	}
+	return ip.To4() == nil
 }
 
 // NameList issues an NLST FTP command.
 func (c *ClientConn) NameList(path string) (entries []string, err error) {
+	span := c.startSpan("NLST", path)
+	defer func() { span.end(err) }()
 	conn, err := c.cmdDataConnFrom(0, "NLST %s", path)
 	if err != nil {
 		return
 	}
 
-	r := &response{conn, c}
+	r := &response{conn: conn, c: c, cmd: "NLST " + path}
 	defer r.Close()
 
 	scanner := bufio.NewScanner(r)
@@ -332,13 +609,29 @@ func (c *ClientConn) NameList(path string) (entries []string, err error) {
 	return
 }
 
+// SetListParser sets the parser of the lines returned by List, for servers
+// whose format DefaultListParser does not understand. A nil parser restores
+// the default.
+func (c *ClientConn) SetListParser(parser ListParser) {
+	c.parser = parser
+}
+
+func (c *ClientConn) listParser() ListParser {
+	if c.parser == nil {
+		return DefaultListParser
+	}
+	return c.parser
+}
+
 // List issues a LIST FTP command.
 func (c *ClientConn) List(path string) (entries []*Entry, err error) {
+	span := c.startSpan("LIST", path)
+	defer func() { span.end(err) }()
 	conn, err := c.cmdDataConnFrom(0, "LIST %s", path)
 	if err != nil {
 		return
 	}
-	r := &response{conn, c}
+	r := &response{conn: conn, c: c, cmd: "LIST " + path}
 	defer r.Close()
 
 	bio := bufio.NewReader(r)
@@ -349,7 +642,7 @@ func (c *ClientConn) List(path string) (entries []*Entry, err error) {
 		} else if e != nil {
 			return nil, e
 		}
-		entry, err := parseListLine(line)
+		entry, err := c.listParser().ParseListLine(line)
 		if err == nil {
 			entries = append(entries, entry)
 		}
@@ -357,8 +650,48 @@ func (c *ClientConn) List(path string) (entries []*Entry, err error) {
 	return
 }
 
+// ListMLSD lists the directory path with MLSD (RFC 3659) when the server
+// advertises MLST in FEAT, taking the type, size, time and permissions of
+// the entries from their facts instead of guessing them from a LIST line.
+// It falls back on List otherwise. The directory and its parent, which
+// MLSD may list, are left out.
+func (c *ClientConn) ListMLSD(path string) (entries []*Entry, err error) {
+	if _, ok := c.features["MLST"]; !ok {
+		return c.List(path)
+	}
+	span := c.startSpan("MLSD", path)
+	defer func() { span.end(err) }()
+	conn, err := c.cmdDataConnFrom(0, "MLSD %s", path)
+	if err != nil {
+		return
+	}
+	r := &response{conn: conn, c: c, cmd: "MLSD " + path}
+	defer r.Close()
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		entry, err := ParseMLSxLine(scanner.Text())
+		if err != nil || !mlsdListed(entry.Raw) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// mlsdListed reports whether the MLSD line names an entry of the listed
+// directory, rather than the directory itself ("cdir") or its parent
+// ("pdir").
+func mlsdListed(line string) bool {
+	facts := ";" + strings.ToLower(line[:strings.IndexByte(line, ' ')])
+	return !strings.Contains(facts, ";type=cdir;") && !strings.Contains(facts, ";type=pdir;")
+}
+
 func (c *ClientConn) ChangeDir(path string) error {
 	_, _, err := c.cmd(StatusRequestedFileActionOK, "CWD %s", path)
+	if err == nil {
+		c.changedDir(path)
+	}
 	return err
 }
 
@@ -366,6 +699,9 @@ func (c *ClientConn) ChangeDir(path string) error {
 // ChangeDir("..")
 func (c *ClientConn) ChangeDirToParent() error {
 	_, _, err := c.cmd(StatusRequestedFileActionOK, "CDUP")
+	if err == nil {
+		c.changedDir("..")
+	}
 	return err
 }
 
@@ -375,15 +711,7 @@ func (c *ClientConn) CurrentDir() (string, error) {
 	if err != nil {
 		return "", err
 	}
-
-	start := strings.Index(msg, "\"")
-	end := strings.LastIndex(msg, "\"")
-
-	if start == -1 || end == -1 {
-		return "", errors.New("unsupported PWD response format")
-	}
-
-	return msg[start+1 : end], nil
+	return ParsePWD(msg)
 }
 
 // Retrieves a file from the remote FTP server.
@@ -395,12 +723,30 @@ func (c *ClientConn) Retr(path string) (io.ReadCloser, error) {
 // Retr issues a RETR FTP command to fetch the specified file from the remote
 // FTP server, the server will not send the offset first bytes of the file.
 func (c *ClientConn) RetrFrom(path string, offset uint64) (io.ReadCloser, error) {
+	return c.retr(path, offset, c.typeFor(path))
+}
+
+func (c *ClientConn) retr(path string, offset uint64, t TransferType) (io.ReadCloser, error) {
+	span := c.startSpan("RETR", path)
+	if err := c.setType(t); err != nil {
+		span.end(err)
+		return nil, err
+	}
 	conn, err := c.cmdDataConnFrom(offset, "RETR %s", path)
 	if err != nil {
+		span.end(err)
 		return nil, err
 	}
 
-	return &response{conn, c}, nil
+	r := &response{conn: conn, c: c, cmd: "RETR " + path, span: span}
+	if t == TypeBinary && c.retries() {
+		r.path, r.offset = path, offset
+	}
+	c.transfer = r
+	if t == TypeASCII {
+		return &fromNetASCII{r, bufio.NewReader(r)}, nil
+	}
+	return r, nil
 }
 
 // Uploads a file to the remote FTP server.
@@ -411,22 +757,120 @@ func (c *ClientConn) Stor(path string, r io.Reader) error {
 
 // Stor issues a STOR FTP command to store a file to the remote FTP server.
 // Stor creates the specified file with the content of the io.Reader, writing
-// on the server will start at the given file offset.
+// on the server will start at the given file offset. To resume an upload,
+// offset is the size of the file on the server and r holds the rest of it.
 func (c *ClientConn) StorFrom(path string, r io.Reader, offset uint64) error {
-	conn, err := c.cmdDataConnFrom(offset, "STOR %s", path)
+	_, err := c.stor("STOR", path, r, offset, c.typeFor(path))
+	return err
+}
+
+// Append issues an APPE FTP command, adding the content of the io.Reader
+// at the end of the file on the server, which is created if it does not
+// exist, as for shipping logs.
+func (c *ClientConn) Append(path string, r io.Reader) error {
+	_, err := c.stor("APPE", path, r, 0, c.typeFor(path))
+	return err
+}
 
+// StorUnique issues a STOU FTP command, storing the content of the
+// io.Reader in binary under a name the server chooses so as not to
+// overwrite any file, and returns that name. The server tells it in the
+// "FILE: name" preliminary reply of RFC 1123, or in its final reply.
+func (c *ClientConn) StorUnique(r io.Reader) (string, error) {
+	msg, err := c.stor("STOU", "", r, 0, TypeBinary)
 	if err != nil {
-		return err
+		return "", err
+	}
+	return parseUniqueName(msg)
+}
+
+// parseUniqueName extracts the name of a file stored by STOU from the
+// messages of the replies, as in "FILE: name" or
+// "Transfer complete (unique file name: name).".
+func parseUniqueName(msg string) (string, error) {
+	for _, line := range strings.Split(msg, "\n") {
+		lower := strings.ToLower(line)
+		for _, prefix := range []string{"file:", "unique file name:"} {
+			if i := strings.Index(lower, prefix); i != -1 {
+				name := strings.TrimSpace(line[i+len(prefix):])
+				name = strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(name, "."), ")"))
+				if name != "" {
+					return name, nil
+				}
+			}
+		}
+	}
+	return "", errors.New("no file name in the STOU replies: " + msg)
+}
+
+// stor uploads r with the command verb, STOR, APPE or STOU, and returns
+// the messages of its preliminary and final replies, one after the other.
+func (c *ClientConn) stor(verb, path string, r io.Reader, offset uint64, t TransferType) (msg string, err error) {
+	span := c.startSpan(verb, path)
+	var n int64 // sent by the last attempt
+	defer func() {
+		span.setAttribute(AttrBytes, n)
+		span.end(err)
+	}()
+	if err := c.setType(t); err != nil {
+		return "", err
+	}
+	seeker, ok := r.(io.Seeker)
+	if !ok || verb != "STOR" || !c.retries() {
+		return c.storOnce(verb, path, r, offset, t, &n)
+	}
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return c.storOnce(verb, path, r, offset, t, &n)
+	}
+	for attempt := 1; ; attempt++ {
+		msg, err := c.storOnce(verb, path, r, offset, t, &n)
+		if !c.retryTransfer(err, attempt) || !c.backoff(attempt) {
+			return msg, err
+		}
+		if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+			return "", err
+		}
 	}
+}
+
+// storOnce is an attempt of stor, setting *sent to the bytes sent.
+func (c *ClientConn) storOnce(verb, path string, r io.Reader, offset uint64, t TransferType, sent *int64) (string, error) {
+	var check *uploadCheck
+	if t == TypeASCII {
+		r = &toNetASCII{r: bufio.NewReader(r)}
+	} else if verb == "STOR" {
+		check, r = c.checkUpload(path, r, offset)
+	}
+	cmd := verb
+	if path != "" {
+		cmd += " " + path
+	}
+	conn, prelim, err := c.cmdDataConnReply(offset, "%s", cmd)
 
-	_, err = io.Copy(conn, r)
+	if err != nil {
+		return "", err
+	}
+
+	n, err := io.Copy(conn, r)
+	*sent = n
 	conn.Close()
 	if err != nil {
-		return err
+		// The reply ending the broken transfer, usually 426.
+		c.finalReply(-1, cmd)
+		return "", err
 	}
 
-	_, _, err = c.conn.ReadResponse(StatusClosingDataConnection)
-	return err
+	// Some servers end STOU with 250 rather than 226.
+	expected := StatusClosingDataConnection
+	if verb == "STOU" {
+		expected = 2
+	}
+	_, msg, err := c.finalReply(expected, cmd)
+	if err == nil && check != nil {
+		err = check.verify(uint64(n))
+	}
+	return prelim + "\n" + msg, err
 }
 
 func (c *ClientConn) Rename(from, to string) error {
@@ -441,19 +885,25 @@ func (c *ClientConn) Rename(from, to string) error {
 
 // Creates a new directory on the remote FTP server.
 func (c *ClientConn) MakeDir(path string) error {
+	span := c.startSpan("MKD", path)
 	_, _, err := c.cmd(StatusPathCreated, "MKD %s", path)
+	span.end(err)
 	return err
 }
 
 // Removes a directory from the remote FTP server.
 func (c *ClientConn) RemoveDir(path string) error {
+	span := c.startSpan("RMD", path)
 	_, _, err := c.cmd(StatusRequestedFileActionOK, "RMD %s", path)
+	span.end(err)
 	return err
 }
 
 // Deletes a file on the remote FTP server.
 func (c *ClientConn) Delete(path string) error {
+	span := c.startSpan("DELE", path)
 	_, _, err := c.cmd(StatusRequestedFileActionOK, "DELE %s", path)
+	span.end(err)
 	return err
 }
 
@@ -463,47 +913,125 @@ func (c *ClientConn) NoOp() error {
 	return err
 }
 
+// Quote sends a command the client has no method for, such as SITE IDLE,
+// CLNT or a vendor extension, and returns the reply, the lines of a
+// multiline one joined by "\n". Replies of code 400 and above also come
+// with an *FTPError. Commands opening a data connection cannot be
+// quoted.
+func (c *ClientConn) Quote(format string, args ...interface{}) (code int, msg string, err error) {
+	code, msg, err = c.cmd(-1, format, args...)
+	if err == nil && code >= 400 {
+		err = replyErr(&textproto.Error{Code: code, Msg: msg}, commandLine(format, args...))
+	}
+	return code, msg, err
+}
+
 // cmd is a helper function to execute a command and
 // check for the expected FTP return code
 func (c *ClientConn) cmd(expected int, format string, args ...interface{}) (int, string, error) {
+	for attempt := 1; ; attempt++ {
+		code, msg, err := c.exchange(expected, format, args...)
+		if c.shouldRestore(err) && c.restore() == nil {
+			code, msg, err = c.exchange(expected, format, args...)
+		}
+		if !c.retryReply(err, attempt) || !c.backoff(attempt) {
+			return code, msg, err
+		}
+	}
+}
+
+// exchange sends a command and reads its reply.
+func (c *ClientConn) exchange(expected int, format string, args ...interface{}) (int, string, error) {
+	c.lockControl()
+	defer c.unlockControl(false)
 	_, err := c.conn.Cmd(format, args...)
 	if err != nil {
 		return 0, "", err
 	}
 
-	return c.conn.ReadResponse(expected)
+	code, msg, err := c.conn.ReadResponse(expected)
+	c.lastCode = code
+	if err != nil {
+		err = replyErr(err, commandLine(format, args...))
+	}
+	return code, msg, err
+}
+
+// finalReply reads the reply ending the transfer of cmd.
+func (c *ClientConn) finalReply(expected int, cmd string) (int, string, error) {
+	c.lockControl()
+	defer c.unlockControl(false)
+	code, msg, err := c.conn.ReadResponse(expected)
+	c.lastCode = code
+	return code, msg, replyErr(err, cmd)
 }
 
 // cmdDataConnFrom executes a command which require a FTP data connection.
 // Issues a REST FTP command to specify the number of bytes to skip for the transfer.
 func (c *ClientConn) cmdDataConnFrom(offset uint64, format string, args ...interface{}) (net.Conn, error) {
+	conn, _, err := c.cmdDataConnReply(offset, format, args...)
+	return conn, err
+}
+
+// cmdDataConnReply is cmdDataConnFrom, also returning the message of the
+// preliminary reply.
+func (c *ClientConn) cmdDataConnReply(offset uint64, format string, args ...interface{}) (net.Conn, string, error) {
+	for attempt := 1; ; attempt++ {
+		conn, msg, err := c.dataConnReply(offset, format, args...)
+		if c.shouldRestore(err) && c.restore() == nil {
+			conn, msg, err = c.dataConnReply(offset, format, args...)
+		}
+		if !c.retryTransfer(err, attempt) || !c.backoff(attempt) {
+			return conn, msg, err
+		}
+	}
+}
+
+func (c *ClientConn) dataConnReply(offset uint64, format string, args ...interface{}) (net.Conn, string, error) {
 	conn, err := c.openDataConn()
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	if offset != 0 {
 		_, _, err := c.cmd(StatusRequestFilePending, "REST %d", offset)
 		if err != nil {
 			conn.Close()
-			return nil, err
+			return nil, "", err
 		}
 	}
 
-	_, err = c.conn.Cmd(format, args...)
+	msg, err := c.startTransfer(format, args...)
 	if err != nil {
 		conn.Close()
-		return nil, err
+		if _, refused := replyCode(err); refused && offset != 0 {
+			// Servers keeping the offset of a refused transfer would apply
+			// it to the next one.
+			c.cmd(StatusRequestFilePending, "REST 0")
+		}
+		return nil, "", err
+	}
+	return conn, msg, nil
+}
+
+// startTransfer sends the transfer command of format and args, and reads
+// its preliminary reply.
+func (c *ClientConn) startTransfer(format string, args ...interface{}) (string, error) {
+	c.lockControl()
+	_, err := c.conn.Cmd(format, args...)
+	if err != nil {
+		c.unlockControl(false)
+		return "", err
 	}
 	code, msg, err := c.conn.ReadResponse(-1)
+	started := err == nil && (code == StatusAlreadyOpen || code == StatusAboutToSend)
+	c.unlockControl(started)
 	if err != nil {
-		conn.Close()
-		return nil, err
+		return "", err
 	}
-	if code != StatusAlreadyOpen && code != StatusAboutToSend {
-		conn.Close()
+	if !started {
 		// It easier for the client to extract the code and message with type assertions.
-		return nil, &textproto.Error{code, msg}
+		return "", replyErr(&textproto.Error{Code: code, Msg: msg}, commandLine(format, args...))
 	}
-	return conn, nil
+	return msg, nil
 }
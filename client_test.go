@@ -1,22 +1,2340 @@
-package ftplib
+package ftplib_test
 
 import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
+
+	"github.com/cxfans/ftplib"
+	"github.com/cxfans/ftplib/ftptest"
 )
 
 // go test -run TestConnect
 func TestConnect(t *testing.T) {
-	c, err := Connect("localhost:2121", "up", "up")
+	addr, cleanup, err := ftptest.Start(nil)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+	defer cleanup()
+	c, err := ftplib.Connect(addr, "up", "up")
+	if err != nil {
+		t.Fatal(err)
 	}
 	_ = c.Quit()
+	if c, err := ftplib.Connect(addr, "up", "wrong"); err == nil {
+		c.Quit()
+		t.Error("logged in with a wrong password")
+	}
 }
 
 func TestConnectAnonymous(t *testing.T) {
-	c, err := ConnectAnonymous("localhost:2121")
+	addr, cleanup, err := ftptest.Start(nil)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+	defer cleanup()
+	c, err := ftplib.ConnectAnonymous(addr)
+	if err != nil {
+		t.Fatal(err)
 	}
 	_ = c.Quit()
 }
+
+// go test -run TestReconnect
+func TestReconnect(t *testing.T) {
+	first, err := ftptest.NewServer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, stopFirst := ftptest.Serve(first)
+	_, port, _ := net.SplitHostPort(addr)
+	c, err := ftplib.Connect(net.JoinHostPort("localhost", port), "user", "password")
+	if err != nil {
+		stopFirst()
+		t.Fatal(err)
+	}
+	defer c.Quit()
+	stopFirst()
+
+	// The replacement server takes over the name and port.
+	driver := ftptest.NewMemDriver()
+	driver.WriteFile("/second.txt", nil)
+	second, err := ftplib.NewServer(addr, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.Driver = driver
+	_, stopSecond := ftptest.Serve(second)
+	defer stopSecond()
+
+	if err := c.Reconnect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Login("anonymous", "anonymous"); err != nil {
+		t.Fatal(err)
+	}
+	names, err := c.NameList("/")
+	if err != nil || len(names) != 1 || names[0] != "second.txt" {
+		t.Errorf("listed %q, %v", names, err)
+	}
+}
+
+// play runs client against a FakeServer playing script, failing the test
+// if the client departs from it.
+func play(t *testing.T, script ftptest.Script, client func(addr string)) *ftptest.FakeServer {
+	t.Helper()
+	server, err := ftptest.NewFakeServer(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client(server.Addr())
+	if err := server.Close(); err != nil {
+		t.Error(err)
+	}
+	return server
+}
+
+// go test -run TestMultilineReplies
+func TestMultilineReplies(t *testing.T) {
+	script := ftptest.Script{
+		{Reply: "220-Welcome.\n220-Second line,\n with a continuation.\n220 Ready."},
+		{Expect: "FEAT", Reply: "211-Extensions supported:\n UTF8\n SIZE\n211 End"},
+		{Expect: "OPTS UTF8 ON", Reply: "200 Always in UTF8 mode."},
+		{Expect: "USER joe", Reply: "331-Hello joe.\n331 Password required."},
+		{Expect: "PASS secret", Reply: "230-Line one.\n230-Line two.\n230 Logged in."},
+		{Expect: "TYPE I", Reply: "200 Type set to I."},
+		{Expect: "QUIT", Reply: "221 Goodbye."},
+	}
+	play(t, script, func(addr string) {
+		c, err := ftplib.Connect(addr, "joe", "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Quit()
+	})
+}
+
+// go test -run TestEarly421
+func TestEarly421(t *testing.T) {
+	play(t, ftptest.Script{
+		{Reply: "421 Too many connections.", Hangup: true},
+	}, func(addr string) {
+		if c, err := ftplib.Dial(addr); err == nil {
+			c.Quit()
+			t.Error("dialed a server refusing the connection")
+		}
+	})
+
+	script := append(ftptest.LoginScript("joe", "secret"),
+		ftptest.Step{Expect: "EPSV", Reply: "421 Shutting down.", Hangup: true})
+	play(t, script, func(addr string) {
+		c, err := ftplib.Connect(addr, "joe", "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Quit()
+		if _, err := c.List(""); err == nil {
+			t.Error("listed on a closed connection")
+		}
+	})
+}
+
+// go test -run TestPassiveFallback
+func TestPassiveFallback(t *testing.T) {
+	script := append(ftptest.LoginScript("joe", "secret"),
+		// Servers behind NAT advertise an address the client cannot reach;
+		// the client connects to the control host instead.
+		ftptest.Step{Expect: "EPSV", Reply: "500 EPSV not understood."},
+		ftptest.Step{Expect: "PASV", Reply: "227 Entering Passive Mode (10,0,0,1,{pasvport})."},
+		ftptest.Step{Expect: "RETR missing", Reply: "550 No such file."},
+		ftptest.Step{Expect: "EPSV", Reply: "229 Entering Extended Passive Mode (|||{port}|)"},
+		ftptest.Step{Expect: "RETR f.txt", Reply: "150 Opening data connection.", Data: "content"},
+		ftptest.Step{Reply: "226 Transfer complete."},
+		ftptest.Step{Expect: "EPSV", Reply: "229 Entering Extended Passive Mode (|||{port}|)"},
+		ftptest.Step{Expect: "STOR up.txt", Reply: "125 Go ahead.", Upload: true},
+		ftptest.Step{Reply: "226 Transfer complete."},
+		ftptest.Step{Expect: "QUIT", Reply: "221 Goodbye."},
+	)
+	server := play(t, script, func(addr string) {
+		c, err := ftplib.Connect(addr, "joe", "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Quit()
+		if _, err := c.Retr("missing"); err == nil {
+			t.Error("retrieved a missing file")
+		}
+		r, err := c.Retr("f.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(r)
+		if err := r.Close(); err != nil {
+			t.Error(err)
+		}
+		if err != nil || string(b) != "content" {
+			t.Errorf("retrieved %q, %v", b, err)
+		}
+		if err := c.Stor("up.txt", strings.NewReader("uploaded")); err != nil {
+			t.Error(err)
+		}
+	})
+	if uploads := server.Uploads(); len(uploads) != 1 || uploads[0] != "uploaded" {
+		t.Errorf("uploaded %q", uploads)
+	}
+}
+
+// go test -run TestTransferTypes
+func TestTransferTypes(t *testing.T) {
+	script := append(ftptest.LoginScript("joe", "secret"),
+		ftptest.Step{Expect: "TYPE A", Reply: "200 Type set to ASCII."},
+		ftptest.Step{Expect: "EPSV", Reply: "229 Entering Extended Passive Mode (|||{port}|)"},
+		ftptest.Step{Expect: "STOR notes.TXT", Reply: "150 Go ahead.", Upload: true},
+		ftptest.Step{Reply: "226 Transfer complete."},
+		ftptest.Step{Expect: "TYPE I", Reply: "200 Type set to binary."},
+		ftptest.Step{Expect: "EPSV", Reply: "229 Entering Extended Passive Mode (|||{port}|)"},
+		ftptest.Step{Expect: "RETR data.bin", Reply: "150 Opening data connection.", Data: "1\r\n2"},
+		ftptest.Step{Reply: "226 Transfer complete."},
+		ftptest.Step{Expect: "TYPE A", Reply: "200 Type set to ASCII."},
+		ftptest.Step{Expect: "EPSV", Reply: "229 Entering Extended Passive Mode (|||{port}|)"},
+		ftptest.Step{Expect: "RETR README", Reply: "150 Opening data connection.", Data: "x\r\ny\r\n"},
+		ftptest.Step{Reply: "226 Transfer complete."},
+		ftptest.Step{Expect: "QUIT", Reply: "221 Goodbye."},
+	)
+	server := play(t, script, func(addr string) {
+		c, err := ftplib.Connect(addr, "joe", "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Quit()
+		c.SetTransferTypes(ftplib.DefaultTransferTypes)
+		if err := c.Stor("notes.TXT", strings.NewReader("a\nb\n")); err != nil {
+			t.Error(err)
+		}
+		retr := func(r io.ReadCloser, err error) string {
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := ioutil.ReadAll(r)
+			if cerr := r.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				t.Error(err)
+			}
+			return string(b)
+		}
+		if got := retr(c.Retr("data.bin")); got != "1\r\n2" {
+			t.Errorf("retrieved %q in binary", got)
+		}
+		if got := retr(c.RetrAs("README", ftplib.TypeASCII)); got != "x\ny\n" {
+			t.Errorf("retrieved %q in ASCII", got)
+		}
+	})
+	if uploads := server.Uploads(); len(uploads) != 1 || uploads[0] != "a\r\nb\r\n" {
+		t.Errorf("uploaded %q", uploads)
+	}
+}
+
+// go test -run TestMalformedPassive
+func TestMalformedPassive(t *testing.T) {
+	script := append(ftptest.LoginScript("joe", "secret"),
+		ftptest.Step{Expect: "EPSV", Reply: "229 Entering Extended Passive Mode (|||abc|)"},
+		ftptest.Step{Expect: "PASV", Reply: "227 Entering Passive Mode 10,0,0,1,{pasvport}"},
+		ftptest.Step{Expect: "NLST ", Reply: "150 Here it comes.", Data: "a.txt\r\nb.txt\r\n"},
+		ftptest.Step{Reply: "226 Done."},
+		ftptest.Step{Expect: "EPSV", Reply: "229 (|||)"},
+		ftptest.Step{Expect: "PASV", Reply: "227 Entering Passive Mode (1,2,3)"},
+		ftptest.Step{Expect: "QUIT", Reply: "221 Goodbye."},
+	)
+	play(t, script, func(addr string) {
+		c, err := ftplib.Connect(addr, "joe", "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Quit()
+		names, err := c.NameList("")
+		if err != nil || strings.Join(names, " ") != "a.txt b.txt" {
+			t.Errorf("NameList() = %q, %v", names, err)
+		}
+		if _, err := c.NameList(""); err != ftplib.ErrInvalidPASV {
+			t.Errorf("NameList() with no valid passive reply: %v", err)
+		}
+	})
+}
+
+// countingDialer counts the connections it opens.
+type countingDialer struct {
+	net.Dialer
+	n int
+}
+
+func (d *countingDialer) Dial(network, address string) (net.Conn, error) {
+	d.n++
+	return d.Dialer.Dial(network, address)
+}
+
+// go test -run TestDialOptions
+func TestDialOptions(t *testing.T) {
+	script := append(ftptest.LoginScript("joe", "secret"),
+		ftptest.Step{Expect: "PASV", Reply: "227 Entering Passive Mode ({pasv})."},
+		ftptest.Step{Expect: "RETR f.txt", Reply: "150 Opening data connection.", Data: "content"},
+		ftptest.Step{Reply: "226 Transfer complete."},
+		ftptest.Step{Expect: "QUIT", Reply: "221 Goodbye."},
+	)
+	dialer := &countingDialer{}
+	var logged strings.Builder
+	play(t, script, func(addr string) {
+		c, err := ftplib.Dial(addr,
+			ftplib.WithDialer(dialer),
+			ftplib.WithDisabledEPSV(),
+			ftplib.WithLogger(log.New(&logged, "", 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Quit()
+		if err := c.Login("joe", "secret"); err != nil {
+			t.Fatal(err)
+		}
+		r, err := c.Retr("f.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.ReadAll(r)
+		if err := r.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+	if dialer.n != 2 {
+		t.Errorf("dialer opened %d connections, want 2", dialer.n)
+	}
+	if !strings.Contains(logged.String(), "User logged in.") {
+		t.Errorf("logged %q", logged.String())
+	}
+}
+
+// go test -run TestContextOperations
+func TestContextOperations(t *testing.T) {
+	script := append(ftptest.LoginScript("joe", "secret"),
+		ftptest.Step{Expect: "EPSV", Reply: "229 Entering Extended Passive Mode (|||{port}|)"},
+		ftptest.Step{Expect: "NLST /", Reply: "150 Here it comes.", Data: "a\r\nb\r\n"},
+		ftptest.Step{Reply: "226 Transfer complete."},
+		// The listing of /slow never ends.
+		ftptest.Step{Expect: "EPSV", Reply: "229 Entering Extended Passive Mode (|||{port}|)"},
+		ftptest.Step{Expect: "LIST /slow", Reply: "150 Here it comes."},
+		ftptest.Step{Expect: "ABOR", Reply: "426 Transfer aborted.\n226 Abort successful."},
+		ftptest.Step{Expect: "NOOP", Reply: "200 OK."},
+		// Abort after a download the server completed.
+		ftptest.Step{Expect: "EPSV", Reply: "229 Entering Extended Passive Mode (|||{port}|)"},
+		ftptest.Step{Expect: "RETR f.txt", Reply: "150 Here it comes.", Data: "content"},
+		ftptest.Step{Reply: "226 Transfer complete."},
+		ftptest.Step{Expect: "ABOR", Reply: "225 No transfer to abort."},
+		ftptest.Step{Expect: "NOOP", Reply: "200 OK."},
+		ftptest.Step{Expect: "QUIT", Reply: "221 Goodbye."},
+	)
+	play(t, script, func(addr string) {
+		c, err := ftplib.Dial(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Quit()
+		ctx := context.Background()
+		if err := c.LoginContext(ctx, "joe", "secret"); err != nil {
+			t.Fatal(err)
+		}
+		if names, err := c.NameListContext(ctx, "/"); err != nil || len(names) != 2 {
+			t.Errorf("NLST: %v, %v", names, err)
+		}
+		ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		if _, err := c.ListContext(ctx, "/slow"); err != context.DeadlineExceeded {
+			t.Errorf("LIST past its deadline: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("LIST given up after %v", elapsed)
+		}
+
+		r, err := c.Retr("f.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.Read(make([]byte, 3)); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Abort(); err != nil {
+			t.Errorf("ABOR: %v", err)
+		}
+		if err := r.Close(); err != nil {
+			t.Errorf("closing an aborted download: %v", err)
+		}
+	})
+}
+
+// go test -run TestContextCommands
+func TestContextCommands(t *testing.T) {
+	script := append(ftptest.LoginScript("joe", "secret"),
+		ftptest.Step{Expect: "CWD /pub", Reply: "250 Okay."},
+		ftptest.Step{Expect: "PWD", Reply: `257 "/pub" is the current directory.`},
+		ftptest.Step{Expect: "RNFR a.txt", Reply: "350 Ready for RNTO."},
+		ftptest.Step{Expect: "RNTO b.txt", Reply: "250 Renamed."},
+		ftptest.Step{Expect: "DELE b.txt", Reply: "250 Deleted."},
+		ftptest.Step{Expect: "SITE CHMOD 644 c.txt", Reply: "200 Done."},
+		// The directory is never made.
+		ftptest.Step{Expect: "MKD slow"},
+		ftptest.Step{Expect: "ABOR", Reply: "550 Gave up."},
+		ftptest.Step{Expect: "NOOP", Reply: "200 OK."},
+		ftptest.Step{Expect: "RMD old", Reply: "250 Removed."},
+		ftptest.Step{Expect: "QUIT", Reply: "221 Goodbye."},
+	)
+	play(t, script, func(addr string) {
+		c, err := ftplib.Dial(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Quit()
+		ctx := context.Background()
+		if err := c.LoginContext(ctx, "joe", "secret"); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.ChangeDirContext(ctx, "/pub"); err != nil {
+			t.Errorf("CWD: %v", err)
+		}
+		if dir, err := c.CurrentDirContext(ctx); err != nil || dir != "/pub" {
+			t.Errorf("PWD: %q, %v", dir, err)
+		}
+		if err := c.RenameContext(ctx, "a.txt", "b.txt"); err != nil {
+			t.Errorf("rename: %v", err)
+		}
+		if err := c.DeleteContext(ctx, "b.txt"); err != nil {
+			t.Errorf("DELE: %v", err)
+		}
+		if code, _, err := c.QuoteContext(ctx, "SITE CHMOD %d %s", 644, "c.txt"); err != nil || code != ftplib.StatusCommandOK {
+			t.Errorf("SITE CHMOD: %d, %v", code, err)
+		}
+		slow, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		if err := c.MakeDirContext(slow, "slow"); err != context.DeadlineExceeded {
+			t.Errorf("MKD past its deadline: %v", err)
+		}
+		if err := c.RemoveDirContext(ctx, "old"); err != nil {
+			t.Errorf("RMD after the deadline: %v", err)
+		}
+	})
+}
+
+// go test -run TestActiveMode
+func TestActiveMode(t *testing.T) {
+	addr, cleanup, err := ftptest.Start(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	c, err := ftplib.Dial(addr, ftplib.WithActiveMode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Quit()
+	if err := c.Login("user", "password"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Stor("/active.txt", strings.NewReader("over PORT")); err != nil {
+		t.Fatal(err)
+	}
+	r, err := c.Retr("/active.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err := r.Close(); err != nil {
+		t.Error(err)
+	}
+	if err != nil || string(data) != "over PORT" {
+		t.Errorf("retrieved %q, %v", data, err)
+	}
+	if entries, err := c.List("/"); err != nil || len(entries) != 1 {
+		t.Errorf("listed %v, %v", entries, err)
+	}
+}
+
+// serveIPv6 answers NLST with two names over IPv6, in passive mode (EPSV)
+// or active mode (EPRT), until QUIT.
+func serveIPv6(t *testing.T, l net.Listener) {
+	conn, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	c := textproto.NewConn(conn)
+	c.PrintfLine("220 Ready.")
+	var data net.Conn
+	var passive net.Listener
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		switch verb := strings.Fields(line)[0]; verb {
+		case "EPSV":
+			if passive, err = net.Listen("tcp6", "[::1]:0"); err != nil {
+				c.PrintfLine("425 %v", err)
+				continue
+			}
+			c.PrintfLine("229 Entering Extended Passive Mode (|||%d|)", passive.Addr().(*net.TCPAddr).Port)
+		case "EPRT":
+			fields := strings.Split(line[5:], "|")
+			if len(fields) != 5 || fields[1] != "2" {
+				t.Errorf("sent %q", line)
+				c.PrintfLine("501 Bad EPRT.")
+				continue
+			}
+			if data, err = net.Dial("tcp6", net.JoinHostPort(fields[2], fields[3])); err != nil {
+				c.PrintfLine("425 %v", err)
+				continue
+			}
+			c.PrintfLine("200 EPRT command successful.")
+		case "PORT", "PASV":
+			t.Errorf("sent %s over IPv6", verb)
+			c.PrintfLine("522 Use EPRT or EPSV.")
+		case "NLST":
+			if passive != nil {
+				data, err = passive.Accept()
+				passive.Close()
+				passive = nil
+				if err != nil {
+					c.PrintfLine("425 %v", err)
+					continue
+				}
+			}
+			c.PrintfLine("150 Opening data connection.")
+			io.WriteString(data, "a\r\nb\r\n")
+			data.Close()
+			c.PrintfLine("226 Transfer complete.")
+		case "QUIT":
+			c.PrintfLine("221 Goodbye.")
+			return
+		case "FEAT":
+			c.PrintfLine("502 Not implemented.")
+		default:
+			c.PrintfLine("200 OK.")
+		}
+	}
+}
+
+// go test -run TestIPv6
+func TestIPv6(t *testing.T) {
+	for _, active := range []bool{false, true} {
+		l, err := net.Listen("tcp6", "[::1]:0")
+		if err != nil {
+			t.Skip("no IPv6:", err)
+		}
+		go serveIPv6(t, l)
+		c, err := ftplib.Dial(l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.SetActiveMode(active)
+		if names, err := c.NameList("/"); err != nil || strings.Join(names, ",") != "a,b" {
+			t.Errorf("active %v: listed %q, %v", active, names, err)
+		}
+		c.Quit()
+		l.Close()
+	}
+}
+
+// go test -run TestListMLSD
+func TestListMLSD(t *testing.T) {
+	script := ftptest.Script{
+		{Reply: "220 Ready."},
+		{Expect: "FEAT", Reply: "211-Features:\n MLST type*;size*;modify*;perm*;\n211 End"},
+		{Expect: "USER joe", Reply: "331 Password required."},
+		{Expect: "PASS secret", Reply: "230 Logged in."},
+		{Expect: "TYPE I", Reply: "200 Type set to binary."},
+		{Expect: "EPSV", Reply: "229 Entering Extended Passive Mode (|||{port}|)"},
+		{Expect: "MLSD /pub", Reply: "150 Opening data connection.", Data: "type=cdir;perm=el; /pub\r\n" +
+			"type=pdir;perm=el; /\r\n" +
+			"type=file;size=42;modify=20220609102400;perm=adfrw; notes 2022.txt\r\n" +
+			"type=dir;modify=20220101000000;perm=flcdmpe; old\r\n"},
+		{Reply: "226 Transfer complete."},
+		{Expect: "QUIT", Reply: "221 Goodbye."},
+	}
+	play(t, script, func(addr string) {
+		c, err := ftplib.Connect(addr, "joe", "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Quit()
+		entries, err := c.ListMLSD("/pub")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 2 {
+			t.Fatalf("listed %d entries", len(entries))
+		}
+		if e := entries[0]; e.Name != "notes 2022.txt" || e.Type != ftplib.EntryTypeFile || e.Size != 42 ||
+			!e.Time.Equal(time.Date(2022, 6, 9, 10, 24, 0, 0, time.UTC)) || e.Perm != "adfrw" {
+			t.Errorf("file: %+v", e)
+		}
+		if e := entries[1]; e.Name != "old" || e.Type != ftplib.EntryTypeFolder || e.Perm != "flcdmpe" {
+			t.Errorf("directory: %+v", e)
+		}
+	})
+
+	// Without MLST, the listing comes from LIST.
+	script = append(ftptest.LoginScript("joe", "secret"),
+		ftptest.Step{Expect: "EPSV", Reply: "229 Entering Extended Passive Mode (|||{port}|)"},
+		ftptest.Step{Expect: "LIST /pub", Reply: "150 Opening data connection.",
+			Data: "-rw-r--r--   1 joe  staff  42 Jun  9  2022 notes.txt\r\n"},
+		ftptest.Step{Reply: "226 Transfer complete."},
+		ftptest.Step{Expect: "QUIT", Reply: "221 Goodbye."},
+	)
+	play(t, script, func(addr string) {
+		c, err := ftplib.Connect(addr, "joe", "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Quit()
+		if entries, err := c.ListMLSD("/pub"); err != nil || len(entries) != 1 || entries[0].Size != 42 {
+			t.Errorf("listed %v, %v", entries, err)
+		}
+	})
+}
+
+// go test -run TestStat
+func TestStat(t *testing.T) {
+	script := ftptest.Script{
+		{Reply: "220 Ready."},
+		{Expect: "FEAT", Reply: "211-Features:\n MLST type*;size*;modify*;\n211 End"},
+		{Expect: "USER joe", Reply: "331 Password required."},
+		{Expect: "PASS secret", Reply: "230 Logged in."},
+		{Expect: "TYPE I", Reply: "200 Type set to binary."},
+		{Expect: "MLST /pub/notes.txt", Reply: "250-Listing /pub/notes.txt\n type=file;size=42;modify=20220609102400; /pub/notes.txt\n250 End."},
+		{Expect: "MLST /missing", Reply: "550 No such file."},
+		{Expect: "QUIT", Reply: "221 Goodbye."},
+	}
+	play(t, script, func(addr string) {
+		c, err := ftplib.Connect(addr, "joe", "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Quit()
+		e, err := c.Stat("/pub/notes.txt")
+		if err != nil || e.Name != "notes.txt" || e.Type != ftplib.EntryTypeFile || e.Size != 42 ||
+			!e.Time.Equal(time.Date(2022, 6, 9, 10, 24, 0, 0, time.UTC)) {
+			t.Errorf("stat %+v, %v", e, err)
+		}
+		if _, err := c.Stat("/missing"); err == nil {
+			t.Error("found a missing file")
+		}
+	})
+
+	// Without MLST, SIZE and MDTM answer.
+	script = append(ftptest.LoginScript("joe", "secret"),
+		ftptest.Step{Expect: "SIZE /pub/notes.txt", Reply: "213 42"},
+		ftptest.Step{Expect: "MDTM /pub/notes.txt", Reply: "213 20220609102400"},
+		ftptest.Step{Expect: "SIZE /pub/old.txt", Reply: "213 7"},
+		ftptest.Step{Expect: "MDTM /pub/old.txt", Reply: "502 Command not implemented."},
+		ftptest.Step{Expect: "SIZE /missing", Reply: "550 No such file."},
+		ftptest.Step{Expect: "QUIT", Reply: "221 Goodbye."},
+	)
+	play(t, script, func(addr string) {
+		c, err := ftplib.Connect(addr, "joe", "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Quit()
+		e, err := c.Stat("/pub/notes.txt")
+		if err != nil || e.Name != "notes.txt" || e.Size != 42 ||
+			!e.Time.Equal(time.Date(2022, 6, 9, 10, 24, 0, 0, time.UTC)) {
+			t.Errorf("stat %+v, %v", e, err)
+		}
+		if e, err := c.Stat("/pub/old.txt"); err != nil || e.Size != 7 || !e.Time.IsZero() {
+			t.Errorf("stat without MDTM %+v, %v", e, err)
+		}
+		if _, err := c.Stat("/missing"); err == nil {
+			t.Error("found a missing file")
+		}
+	})
+}
+
+// go test -run TestMLSTFacts
+func TestMLSTFacts(t *testing.T) {
+	addr, cleanup, err := ftptest.Start(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	c, err := ftplib.Connect(addr, "user", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Quit()
+	if facts := c.MLSTFacts(); len(facts) < 3 {
+		t.Errorf("default facts %q", facts)
+	}
+	facts, err := c.SetMLSTFacts("type", "size", "bogus")
+	if err != nil || strings.Join(facts, ";") != "type;size" {
+		t.Fatalf("selected %q, %v", facts, err)
+	}
+	if facts := c.MLSTFacts(); strings.Join(facts, ";") != "type;size" {
+		t.Errorf("facts in effect %q", facts)
+	}
+	if err := c.Stor("/f.txt", strings.NewReader("facts")); err != nil {
+		t.Fatal(err)
+	}
+	e, err := c.Stat("/f.txt")
+	if err != nil || e.Size != 5 || !e.Time.IsZero() {
+		t.Errorf("stat %+v, %v", e, err)
+	}
+
+	// Servers replying without the list select the requested facts they
+	// advertise.
+	script := ftptest.Script{
+		{Reply: "220 Ready."},
+		{Expect: "FEAT", Reply: "211-Features:\n MLST Type*;Size*;Modify*;Perm;\n211 End"},
+		{Expect: "OPTS MLST type;perm;unique;", Reply: "200 Command okay."},
+		{Expect: "QUIT", Reply: "221 Goodbye."},
+	}
+	play(t, script, func(addr string) {
+		c, err := ftplib.Dial(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Quit()
+		if facts := c.MLSTFacts(); strings.Join(facts, ";") != "Type;Size;Modify" {
+			t.Errorf("default facts %q", facts)
+		}
+		if facts, err := c.SetMLSTFacts("type", "perm", "unique"); err != nil || strings.Join(facts, ";") != "Type;Perm" {
+			t.Errorf("selected %q, %v", facts, err)
+		}
+	})
+}
+
+// go test -run TestAppend
+func TestAppend(t *testing.T) {
+	addr, cleanup, err := ftptest.Start(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	c, err := ftplib.Connect(addr, "user", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Quit()
+	for _, line := range []string{"one\n", "two\n"} {
+		if err := c.Append("/app.log", strings.NewReader(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := c.Retr("/app.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err := r.Close(); err != nil {
+		t.Error(err)
+	}
+	if err != nil || string(data) != "one\ntwo\n" {
+		t.Errorf("retrieved %q, %v", data, err)
+	}
+}
+
+// go test -run TestStorUnique
+func TestStorUnique(t *testing.T) {
+	script := append(ftptest.LoginScript("joe", "secret"),
+		ftptest.Step{Expect: "EPSV", Reply: "229 Entering Extended Passive Mode (|||{port}|)"},
+		ftptest.Step{Expect: "STOU", Reply: "150 FILE: upload.0001", Upload: true},
+		ftptest.Step{Reply: "226 Transfer complete."},
+		ftptest.Step{Expect: "EPSV", Reply: "229 Entering Extended Passive Mode (|||{port}|)"},
+		ftptest.Step{Expect: "STOU", Reply: "150 Opening data connection.", Upload: true},
+		ftptest.Step{Reply: "250 Transfer complete (unique file name:drop.42)."},
+		ftptest.Step{Expect: "EPSV", Reply: "229 Entering Extended Passive Mode (|||{port}|)"},
+		ftptest.Step{Expect: "STOU", Reply: "150 Opening data connection.", Upload: true},
+		ftptest.Step{Reply: "226 Transfer complete."},
+		ftptest.Step{Expect: "QUIT", Reply: "221 Goodbye."},
+	)
+	server := play(t, script, func(addr string) {
+		c, err := ftplib.Connect(addr, "joe", "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Quit()
+		for _, want := range []string{"upload.0001", "drop.42"} {
+			if name, err := c.StorUnique(strings.NewReader(want)); err != nil || name != want {
+				t.Errorf("stored as %q, %v; want %q", name, err, want)
+			}
+		}
+		if name, err := c.StorUnique(strings.NewReader("anonymous")); err == nil {
+			t.Errorf("stored as %q without a name in the replies", name)
+		}
+	})
+	if uploads := server.Uploads(); len(uploads) != 3 || uploads[0] != "upload.0001" {
+		t.Errorf("uploaded %q", uploads)
+	}
+}
+
+// go test -run TestWalk
+func TestWalk(t *testing.T) {
+	addr, cleanup, err := ftptest.Start(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	c, err := ftplib.Connect(addr, "user", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Quit()
+	for _, dir := range []string{"/tree", "/tree/b", "/tree/b/c", "/tree/skip"} {
+		if err := c.MakeDir(dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{"/tree/a.txt", "/tree/b/c/d.txt", "/tree/skip/e.txt"} {
+		if err := c.Stor(file, strings.NewReader(file)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var walked []string
+	err = c.Walk("/tree", func(p string, e *ftplib.Entry, err error) error {
+		if err != nil {
+			return err
+		}
+		walked = append(walked, p)
+		if e.Name == "skip" {
+			return ftplib.SkipDir
+		}
+		return nil
+	})
+	want := "/tree/a.txt /tree/b /tree/b/c /tree/b/c/d.txt /tree/skip"
+	if got := strings.Join(walked, " "); err != nil || got != want {
+		t.Errorf("walked %s, %v; want %s", got, err, want)
+	}
+
+	// A directory listed within itself is not walked again.
+	script := ftptest.Script{
+		{Reply: "220 Ready."},
+		{Expect: "FEAT", Reply: "211-Features:\n MLST type*;unique*;\n211 End"},
+		{Expect: "EPSV", Reply: "229 Entering Extended Passive Mode (|||{port}|)"},
+		{Expect: "MLSD /", Reply: "150 Opening data connection.", Data: "type=dir;unique=1; loop\r\n"},
+		{Reply: "226 Transfer complete."},
+		{Expect: "EPSV", Reply: "229 Entering Extended Passive Mode (|||{port}|)"},
+		{Expect: "MLSD /loop", Reply: "150 Opening data connection.", Data: "type=dir;unique=1; self\r\n"},
+		{Reply: "226 Transfer complete."},
+		{Expect: "QUIT", Reply: "221 Goodbye."},
+	}
+	play(t, script, func(addr string) {
+		c, err := ftplib.Dial(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Quit()
+		var walked []string
+		err = c.Walk("/", func(p string, e *ftplib.Entry, err error) error {
+			walked = append(walked, p)
+			return err
+		})
+		if got := strings.Join(walked, " "); err != nil || got != "/loop /loop/self" {
+			t.Errorf("walked %s, %v", got, err)
+		}
+	})
+}
+
+// go test -run TestUploadDir
+func TestUploadDir(t *testing.T) {
+	local, err := ioutil.TempDir("", "ftplib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(local)
+	files := map[string]string{"index.html": "<p>", "css/site.css": "p {}", "img/a/1.png": "1", "img/a/2.png": "2", "img/b.png": "b"}
+	for name, content := range files {
+		p := filepath.Join(local, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(local, "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	addr, cleanup, err := ftptest.Start(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	c, err := ftplib.Connect(addr, "user", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Quit()
+	if err := c.MakeDir("/www"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ChangeDir("/www"); err != nil {
+		t.Fatal(err)
+	}
+	for _, parallelism := range []int{1, 3} {
+		remote := fmt.Sprintf("site/%d", parallelism)
+		if err := c.UploadDir(local, remote, ftplib.WithParallelism(parallelism)); err != nil {
+			t.Fatalf("parallelism %d: %v", parallelism, err)
+		}
+		if dir, err := c.CurrentDir(); err != nil || dir != "/www" {
+			t.Errorf("left in %s, %v", dir, err)
+		}
+		got := make(map[string]string)
+		err := c.Walk("/www/"+remote, func(p string, e *ftplib.Entry, err error) error {
+			if err != nil || e.Type != ftplib.EntryTypeFile {
+				return err
+			}
+			r, err := c.Retr(p)
+			if err != nil {
+				return err
+			}
+			data, err := ioutil.ReadAll(r)
+			r.Close()
+			got[strings.TrimPrefix(p, "/www/"+remote+"/")] = string(data)
+			return err
+		})
+		if err != nil || fmt.Sprint(got) != fmt.Sprint(files) {
+			t.Errorf("parallelism %d: uploaded %v, %v", parallelism, got, err)
+		}
+		if _, err := c.ListMLSD("/www/" + remote + "/empty"); err != nil {
+			t.Errorf("parallelism %d: empty directory: %v", parallelism, err)
+		}
+	}
+	// Uploading again overwrites the files in the existing directories.
+	if err := c.UploadDir(local, "/www/site/1"); err != nil {
+		t.Error(err)
+	}
+
+	filter := ftplib.PathFilter{Include: []string{"*.png"}, Exclude: []string{"a"}}
+	if err := c.UploadDir(local, "/www/png", ftplib.WithFilter(filter)); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTree(t, c, "/www/png"); fmt.Sprint(got) != fmt.Sprint(map[string]string{"img/b.png": "b"}) {
+		t.Errorf("uploaded with a filter %v", got)
+	}
+}
+
+// go test -run TestRemoveDirRecur
+func TestRemoveDirRecur(t *testing.T) {
+	script := append(ftptest.LoginScript("joe", "secret"),
+		ftptest.Step{Expect: "EPSV", Reply: "229 Entering Extended Passive Mode (|||{port}|)"},
+		ftptest.Step{Expect: "LIST /old", Reply: "150 Opening data connection.", Data: "" +
+			"drwxr-xr-x   2 joe  staff   0 Jun  9  2022 .\r\n" +
+			"drwxr-xr-x   2 joe  staff   0 Jun  9  2022 a\r\n" +
+			"-rw-r--r--   1 joe  staff  42 Jun  9  2022 f\r\n" +
+			"lrwxrwxrwx   1 joe  staff   1 Jun  9  2022 up -> ..\r\n"},
+		ftptest.Step{Reply: "226 Transfer complete."},
+		ftptest.Step{Expect: "EPSV", Reply: "229 Entering Extended Passive Mode (|||{port}|)"},
+		ftptest.Step{Expect: "LIST /old/a", Reply: "150 Opening data connection.",
+			Data: "-rw-r--r--   1 joe  staff  42 Jun  9  2022 g\r\n"},
+		ftptest.Step{Reply: "226 Transfer complete."},
+		ftptest.Step{Expect: "DELE /old/a/g", Reply: "250 Deleted."},
+		ftptest.Step{Expect: "RMD /old/a", Reply: "250 Removed."},
+		ftptest.Step{Expect: "DELE /old/f", Reply: "250 Deleted."},
+		ftptest.Step{Expect: "DELE /old/up", Reply: "250 Deleted."},
+		ftptest.Step{Expect: "RMD /old", Reply: "250 Removed."},
+		ftptest.Step{Expect: "EPSV", Reply: "229 Entering Extended Passive Mode (|||{port}|)"},
+		ftptest.Step{Expect: "LIST /missing", Reply: "550 No such directory."},
+		ftptest.Step{Expect: "QUIT", Reply: "221 Goodbye."},
+	)
+	play(t, script, func(addr string) {
+		c, err := ftplib.Connect(addr, "joe", "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Quit()
+		if err := c.RemoveDirRecur("/old"); err != nil {
+			t.Error(err)
+		}
+		if err := c.RemoveDirRecur("/missing"); err == nil {
+			t.Error("removed a missing directory")
+		}
+	})
+}
+
+// go test -run TestQuote
+func TestQuote(t *testing.T) {
+	script := append(ftptest.LoginScript("joe", "secret"),
+		ftptest.Step{Expect: "SITE IDLE 600", Reply: "200 Idle time set to 600 seconds."},
+		ftptest.Step{Expect: "CLNT ftplib", Reply: "200-Noted.\n200 Hello ftplib."},
+		ftptest.Step{Expect: "XYZZY", Reply: "500 Unknown command."},
+		ftptest.Step{Expect: "QUIT", Reply: "221 Goodbye."},
+	)
+	play(t, script, func(addr string) {
+		c, err := ftplib.Connect(addr, "joe", "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Quit()
+		if code, msg, err := c.Quote("SITE IDLE %d", 600); err != nil || code != 200 || msg != "Idle time set to 600 seconds." {
+			t.Errorf("SITE IDLE: %d %q, %v", code, msg, err)
+		}
+		if code, msg, err := c.Quote("CLNT ftplib"); err != nil || code != 200 || msg != "Noted.\nHello ftplib." {
+			t.Errorf("CLNT: %d %q, %v", code, msg, err)
+		}
+		code, _, err := c.Quote("XYZZY")
+		var e *textproto.Error
+		if code != 500 || !errors.As(err, &e) || e.Code != 500 {
+			t.Errorf("XYZZY: %d, %v", code, err)
+		}
+	})
+}
+
+// go test -run TestSite
+func TestSite(t *testing.T) {
+	script := append(ftptest.LoginScript("joe", "secret"),
+		ftptest.Step{Expect: "SITE HELP", Reply: "214-The following SITE commands are recognized (* =>'s unimplemented).\n" +
+			"   UMASK           IDLE            CHMOD           HELP\n" +
+			"   GROUP*          UTIME\n" +
+			"214 Direct comments to ftp@example.com."},
+		ftptest.Step{Expect: "SITE CHMOD 644 notes.txt", Reply: "200 SITE CHMOD command successful."},
+		ftptest.Step{Expect: "SITE GROUP staff", Reply: "502 Command not implemented."},
+		ftptest.Step{Expect: "QUIT", Reply: "221 Goodbye."},
+	)
+	play(t, script, func(addr string) {
+		c, err := ftplib.Connect(addr, "joe", "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Quit()
+		commands, err := c.SiteCommands()
+		if got := strings.Join(commands, " "); err != nil || got != "UMASK IDLE CHMOD HELP UTIME" {
+			t.Errorf("SITE commands %s, %v", got, err)
+		}
+		if err := c.Site("CHMOD 644 notes.txt"); err != nil {
+			t.Error(err)
+		}
+		if err := c.Site("GROUP staff"); err == nil {
+			t.Error("unimplemented SITE command accepted")
+		}
+	})
+
+	script = append(ftptest.LoginScript("joe", "secret"),
+		ftptest.Step{Expect: "SITE HELP", Reply: "214 CHMOD UMASK HELP"},
+		ftptest.Step{Expect: "QUIT", Reply: "221 Goodbye."},
+	)
+	play(t, script, func(addr string) {
+		c, err := ftplib.Connect(addr, "joe", "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Quit()
+		commands, err := c.SiteCommands()
+		if got := strings.Join(commands, " "); err != nil || got != "CHMOD UMASK HELP" {
+			t.Errorf("SITE commands %s, %v", got, err)
+		}
+	})
+}
+
+// go test -run TestChecksum
+func TestChecksum(t *testing.T) {
+	const sha256 = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	script := ftptest.Script{
+		{Reply: "220 Ready."},
+		{Expect: "FEAT", Reply: "211-Features:\n HASH SHA-256*;SHA-1;MD5\n XCRC\n211 End"},
+		{Expect: "HASH /f.txt", Reply: "213 SHA-256 0-4 " + strings.ToUpper(sha256) + " /f.txt"},
+		{Expect: "OPTS HASH MD5", Reply: "200 MD5"},
+		{Expect: "HASH /f.txt", Reply: "213 MD5 0-4 5d41402abc4b2a76b9719d911017c592 /f.txt"},
+		{Expect: "HASH /g.txt", Reply: "213 MD5 0-4 d41d8cd98f00b204e9800998ecf8427e /g.txt"},
+		{Expect: "XCRC /f.txt", Reply: "250 3610A686"},
+		{Expect: "QUIT", Reply: "221 Goodbye."},
+	}
+	play(t, script, func(addr string) {
+		c, err := ftplib.Dial(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Quit()
+		for _, test := range []struct {
+			path   string
+			algo   ftplib.HashAlgorithm
+			digest string
+		}{
+			{"/f.txt", ftplib.HashSHA256, sha256},
+			{"/f.txt", ftplib.HashMD5, "5d41402abc4b2a76b9719d911017c592"},
+			{"/g.txt", ftplib.HashMD5, "d41d8cd98f00b204e9800998ecf8427e"},
+			{"/f.txt", ftplib.HashCRC32, "3610a686"},
+		} {
+			if digest, err := c.Checksum(test.path, test.algo); err != nil || digest != test.digest {
+				t.Errorf("%s of %s: %s, %v", test.algo, test.path, digest, err)
+			}
+		}
+		if _, err := c.Checksum("/f.txt", ftplib.HashSHA512); err == nil {
+			t.Error("SHA-512 checksum without a command for it")
+		}
+	})
+}
+
+// go test -run TestUploadVerification
+func TestUploadVerification(t *testing.T) {
+	addr, cleanup, err := ftptest.Start(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	c, err := ftplib.Dial(addr, ftplib.WithUploadVerification(ftplib.UploadVerification{Size: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Quit()
+	if err := c.Login("user", "password"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Stor("/f.txt", strings.NewReader("hello")); err != nil {
+		t.Error(err)
+	}
+	if err := c.StorFrom("/f.txt", strings.NewReader(" world"), 5); err != nil {
+		t.Error(err)
+	}
+
+	script := ftptest.Script{
+		{Reply: "220 Ready."},
+		{Expect: "FEAT", Reply: "211-Features:\n XMD5\n SIZE\n211 End"},
+		{Expect: "TYPE I", Reply: "200 Type set to binary."},
+		{Expect: "EPSV", Reply: "229 Entering Extended Passive Mode (|||{port}|)"},
+		{Expect: "STOR /f.txt", Reply: "150 Go ahead.", Upload: true},
+		{Reply: "226 Transfer complete."},
+		{Expect: "SIZE /f.txt", Reply: "213 5"},
+		{Expect: "XMD5 /f.txt", Reply: "250 5D41402ABC4B2A76B9719D911017C592"},
+		{Expect: "EPSV", Reply: "229 Entering Extended Passive Mode (|||{port}|)"},
+		{Expect: "STOR /g.txt", Reply: "150 Go ahead.", Upload: true},
+		{Reply: "226 Transfer complete."},
+		{Expect: "SIZE /g.txt", Reply: "213 4"},
+		{Expect: "EPSV", Reply: "229 Entering Extended Passive Mode (|||{port}|)"},
+		{Expect: "STOR /h.txt", Reply: "150 Go ahead.", Upload: true},
+		{Reply: "226 Transfer complete."},
+		{Expect: "SIZE /h.txt", Reply: "213 5"},
+		{Expect: "XMD5 /h.txt", Reply: "250 d41d8cd98f00b204e9800998ecf8427e"},
+		{Expect: "QUIT", Reply: "221 Goodbye."},
+	}
+	play(t, script, func(addr string) {
+		c, err := ftplib.Dial(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Quit()
+		c.SetUploadVerification(ftplib.UploadVerification{Size: true, Hash: ftplib.HashMD5})
+		if err := c.Stor("/f.txt", strings.NewReader("hello")); err != nil {
+			t.Error(err)
+		}
+		err = c.Stor("/g.txt", strings.NewReader("hello"))
+		if e, ok := err.(*ftplib.VerifyError); !ok || e.Check != "size" || e.Sent != "5" || e.Stored != "4" {
+			t.Errorf("truncated upload: %v", err)
+		}
+		err = c.Stor("/h.txt", strings.NewReader("hello"))
+		if e, ok := err.(*ftplib.VerifyError); !ok || e.Check != "MD5" || e.Sent != "5d41402abc4b2a76b9719d911017c592" {
+			t.Errorf("corrupted upload: %v", err)
+		}
+	})
+}
+
+// noopDialer counts the NOOP commands sent on the connections it opens.
+type noopDialer struct {
+	net.Dialer
+	mu    sync.Mutex
+	noops int
+}
+
+func (d *noopDialer) Dial(network, address string) (net.Conn, error) {
+	conn, err := d.Dialer.Dial(network, address)
+	return &noopConn{Conn: conn, d: d}, err
+}
+
+func (d *noopDialer) count() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.noops
+}
+
+type noopConn struct {
+	net.Conn
+	d *noopDialer
+}
+
+func (c *noopConn) Write(p []byte) (int, error) {
+	if string(p) == "NOOP\r\n" {
+		c.d.mu.Lock()
+		c.d.noops++
+		c.d.mu.Unlock()
+	}
+	return c.Conn.Write(p)
+}
+
+// go test -run TestKeepAlive
+func TestKeepAlive(t *testing.T) {
+	addr, cleanup, err := ftptest.Start(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	d := &noopDialer{}
+	c, err := ftplib.Dial(addr, ftplib.WithDialer(d), ftplib.WithKeepAlive(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Quit()
+	if err := c.Login("user", "password"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := d.count(); n < 2 {
+		t.Errorf("%d NOOPs sent while idle", n)
+	}
+
+	// No NOOP goes during a transfer, and the session stays in step.
+	if err := c.Stor("/f.txt", strings.NewReader("kept alive")); err != nil {
+		t.Fatal(err)
+	}
+	r, err := c.Retr("/f.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := d.count()
+	time.Sleep(100 * time.Millisecond)
+	if d.count() != n {
+		t.Error("NOOP sent during a transfer")
+	}
+	data, err := ioutil.ReadAll(r)
+	if err := r.Close(); err != nil {
+		t.Error(err)
+	}
+	if err != nil || string(data) != "kept alive" {
+		t.Errorf("retrieved %q, %v", data, err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if dir, err := c.CurrentDir(); err != nil || dir != "/" {
+		t.Errorf("current directory %q, %v", dir, err)
+	}
+
+	c.SetKeepAlive(0)
+	n = d.count()
+	time.Sleep(60 * time.Millisecond)
+	if d.count() != n {
+		t.Error("NOOP sent once stopped")
+	}
+}
+
+// cuttingDialer keeps the connections it opens, for the test to cut them.
+type cuttingDialer struct {
+	net.Dialer
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func (d *cuttingDialer) Dial(network, address string) (net.Conn, error) {
+	conn, err := d.Dialer.Dial(network, address)
+	if err == nil {
+		d.mu.Lock()
+		d.conns = append(d.conns, conn)
+		d.mu.Unlock()
+	}
+	return conn, err
+}
+
+// cut closes the connections opened so far.
+func (d *cuttingDialer) cut() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, conn := range d.conns {
+		conn.Close()
+	}
+	d.conns = nil
+}
+
+// go test -run TestAutoReconnect
+func TestAutoReconnect(t *testing.T) {
+	addr, cleanup, err := ftptest.Start(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	d := &cuttingDialer{}
+	c, err := ftplib.Dial(addr, ftplib.WithDialer(d), ftplib.WithAutoReconnect())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Quit()
+	if err := c.Login("user", "password"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.MakeDir("/logs"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ChangeDir("logs"); err != nil {
+		t.Fatal(err)
+	}
+
+	d.cut()
+	if dir, err := c.CurrentDir(); err != nil || dir != "/logs" {
+		t.Errorf("restored in %q, %v", dir, err)
+	}
+	d.cut()
+	if err := c.Stor("app.log", strings.NewReader("restored")); err != nil {
+		t.Fatal(err)
+	}
+	d.cut()
+	r, err := c.Retr("/logs/app.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err := r.Close(); err != nil {
+		t.Error(err)
+	}
+	if err != nil || string(data) != "restored" {
+		t.Errorf("retrieved %q, %v", data, err)
+	}
+
+	c.SetAutoReconnect(false)
+	d.cut()
+	if _, err := c.CurrentDir(); err == nil {
+		t.Error("reconnected once turned off")
+	}
+}
+
+// resettingDialer breaks the data connections it opens after a few bytes,
+// as many times as resets.
+type resettingDialer struct {
+	net.Dialer
+	control string
+	mu      sync.Mutex
+	resets  int
+}
+
+func (d *resettingDialer) Dial(network, address string) (net.Conn, error) {
+	conn, err := d.Dialer.Dial(network, address)
+	if err != nil || address == d.control {
+		return conn, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.resets == 0 {
+		return conn, nil
+	}
+	d.resets--
+	return &resettingConn{Conn: conn, left: 4}, nil
+}
+
+type resettingConn struct {
+	net.Conn
+	left int
+}
+
+func (c *resettingConn) reset(op string) error {
+	return &net.OpError{Op: op, Net: "tcp", Err: syscall.ECONNRESET}
+}
+
+func (c *resettingConn) Read(p []byte) (int, error) {
+	if c.left == 0 {
+		return 0, c.reset("read")
+	}
+	if len(p) > c.left {
+		p = p[:c.left]
+	}
+	n, err := c.Conn.Read(p)
+	c.left -= n
+	return n, err
+}
+
+func (c *resettingConn) Write(p []byte) (int, error) {
+	if len(p) <= c.left {
+		n, err := c.Conn.Write(p)
+		c.left -= n
+		return n, err
+	}
+	n, _ := c.Conn.Write(p[:c.left])
+	c.left = 0
+	return n, c.reset("write")
+}
+
+// go test -run TestRetryPolicy
+func TestRetryPolicy(t *testing.T) {
+	policy := ftplib.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+	script := append(ftptest.LoginScript("joe", "secret"),
+		ftptest.Step{Expect: "DELE busy.txt", Reply: "450 File busy."},
+		ftptest.Step{Expect: "DELE busy.txt", Reply: "450 File busy."},
+		ftptest.Step{Expect: "DELE busy.txt", Reply: "250 Deleted."},
+		ftptest.Step{Expect: "DELE locked.txt", Reply: "450 File busy."},
+		ftptest.Step{Expect: "DELE locked.txt", Reply: "450 File busy."},
+		ftptest.Step{Expect: "DELE locked.txt", Reply: "450 File busy."},
+		ftptest.Step{Expect: "DELE gone.txt", Reply: "550 No such file."},
+		ftptest.Step{Expect: "QUIT", Reply: "221 Goodbye."},
+	)
+	play(t, script, func(addr string) {
+		c, err := ftplib.Dial(addr, ftplib.WithRetryPolicy(policy))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Quit()
+		if err := c.Login("joe", "secret"); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Delete("busy.txt"); err != nil {
+			t.Error(err)
+		}
+		if err := c.Delete("locked.txt"); err == nil {
+			t.Error("deleted past the attempts")
+		}
+		if err := c.Delete("gone.txt"); err == nil {
+			t.Error("deleted a missing file")
+		}
+	})
+
+	addr, cleanup, err := ftptest.Start(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	d := &resettingDialer{control: addr}
+	c, err := ftplib.Dial(addr, ftplib.WithDialer(d), ftplib.WithRetryPolicy(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Quit()
+	if err := c.Login("user", "password"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The upload starts over, the download resumes.
+	const content = "sent again, then resumed"
+	d.resets = 1
+	if err := c.Stor("/r.bin", strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	d.resets = 2
+	r, err := c.Retr("/r.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err := r.Close(); err != nil {
+		t.Error(err)
+	}
+	if err != nil || string(data) != content {
+		t.Errorf("retrieved %q, %v", data, err)
+	}
+
+	c.SetRetryPolicy(ftplib.RetryPolicy{})
+	d.resets = 1
+	if err := c.Stor("/r.bin", strings.NewReader(content)); err == nil {
+		t.Error("broken upload succeeded once retries turned off")
+	}
+	if dir, err := c.CurrentDir(); err != nil || dir != "/" {
+		t.Errorf("current directory %q, %v", dir, err)
+	}
+}
+
+// go test -run TestErrorKinds
+func TestErrorKinds(t *testing.T) {
+	script := append(ftptest.LoginScript("joe", "secret"),
+		ftptest.Step{Expect: "DELE missing.txt", Reply: "550 missing.txt: No such file or directory."},
+		ftptest.Step{Expect: "DELE locked.txt", Reply: "550 locked.txt: Permission denied."},
+		ftptest.Step{Expect: "MKD logs", Reply: "550 logs: File exists."},
+		ftptest.Step{Expect: "MKD tmp", Reply: "521 \"/tmp\" directory already exists."},
+		ftptest.Step{Expect: "RNFR a.txt", Reply: "350 Ready for RNTO."},
+		ftptest.Step{Expect: "RNTO ../a.txt", Reply: "553 File name not allowed."},
+		ftptest.Step{Expect: "DELE busy.txt", Reply: "450 File busy."},
+		ftptest.Step{Expect: "QUIT", Reply: "221 Goodbye."},
+	)
+	play(t, script, func(addr string) {
+		c, err := ftplib.Connect(addr, "joe", "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Quit()
+		for _, tt := range []struct {
+			err  error
+			kind error
+		}{
+			{c.Delete("missing.txt"), os.ErrNotExist},
+			{c.Delete("locked.txt"), os.ErrPermission},
+			{c.MakeDir("logs"), os.ErrExist},
+			{c.MakeDir("tmp"), os.ErrExist},
+			{c.Rename("a.txt", "../a.txt"), os.ErrPermission},
+			{c.Delete("busy.txt"), nil},
+		} {
+			for _, kind := range []error{os.ErrNotExist, os.ErrPermission, os.ErrExist} {
+				if errors.Is(tt.err, kind) != (kind == tt.kind) {
+					t.Errorf("errors.Is(%v, %v) = %v", tt.err, kind, !(kind == tt.kind))
+				}
+			}
+			var e *textproto.Error
+			if !errors.As(tt.err, &e) {
+				t.Errorf("%v: no reply code", tt.err)
+			}
+		}
+	})
+
+	addr, cleanup, err := ftptest.Start(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	c, err := ftplib.Connect(addr, "user", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Quit()
+	if _, err := c.Retr("/missing.txt"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("RETR of a missing file: %v", err)
+	}
+	if _, err := c.Stat("/missing.txt"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Stat of a missing file: %v", err)
+	}
+}
+
+// go test -run TestFTPError
+func TestFTPError(t *testing.T) {
+	play(t, ftptest.Script{
+		{Reply: "220 Service ready for new user."},
+		{Expect: "FEAT", Reply: "502 Command not implemented."},
+		{Expect: "USER joe", Reply: "331 User name okay, need password."},
+		{Expect: "PASS wrong", Reply: "530 Login incorrect."},
+		{Expect: "DELE busy.txt", Reply: "450 File busy."},
+		{Expect: "NOOP", Reply: "421 Timeout (300 seconds): closing control connection.", Hangup: true},
+	}, func(addr string) {
+		c, err := ftplib.Dial(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Quit()
+
+		err = c.Login("joe", "wrong")
+		var e *ftplib.FTPError
+		if !errors.As(err, &e) || e.Code != 530 || e.Cmd != "PASS" || e.Temporary() {
+			t.Errorf("PASS: %#v", err)
+		}
+		if err.Error() != "PASS: 530 Login incorrect." {
+			t.Errorf("PASS: %q", err)
+		}
+
+		err = c.Delete("busy.txt")
+		if !errors.As(err, &e) || e.Cmd != "DELE busy.txt" || !e.Temporary() || e.Timeout() {
+			t.Errorf("DELE: %#v", err)
+		}
+
+		err = c.NoOp()
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			t.Errorf("NOOP: %#v", err)
+		}
+	})
+}
+
+// sessionDialer counts the control connections it opens.
+type sessionDialer struct {
+	net.Dialer
+	control string
+	mu      sync.Mutex
+	dials   int
+}
+
+func (d *sessionDialer) Dial(network, address string) (net.Conn, error) {
+	if address == d.control {
+		d.mu.Lock()
+		d.dials++
+		d.mu.Unlock()
+	}
+	return d.Dialer.Dial(network, address)
+}
+
+// writerAt is an io.WriterAt in memory.
+type writerAt struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (w *writerAt) WriteAt(p []byte, off int64) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if end := int(off) + len(p); end > len(w.buf) {
+		w.buf = append(w.buf, make([]byte, end-len(w.buf))...)
+	}
+	return copy(w.buf[off:], p), nil
+}
+
+// go test -run TestDownload
+func TestDownload(t *testing.T) {
+	addr, cleanup, err := ftptest.Start(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	d := &sessionDialer{control: addr}
+	c, err := ftplib.Dial(addr, ftplib.WithDialer(d))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Quit()
+	if err := c.Login("user", "password"); err != nil {
+		t.Fatal(err)
+	}
+
+	content := make([]byte, 3*ftplib.MinSegmentSize+12345)
+	for i := range content {
+		content[i] = byte(i * 7 / 5)
+	}
+	if err := c.Stor("/big.bin", strings.NewReader(string(content))); err != nil {
+		t.Fatal(err)
+	}
+	for _, segments := range []int{1, 3, 8} {
+		w := &writerAt{}
+		d.dials = 0
+		if err := c.Download("/big.bin", w, ftplib.WithSegments(segments)); err != nil {
+			t.Fatal(err)
+		}
+		if string(w.buf) != string(content) {
+			t.Errorf("%d segments: downloaded %d bytes, differing", segments, len(w.buf))
+		}
+		// A segment per MiB at most, the last one shorter.
+		want := segments - 1
+		if want > 3 {
+			want = 3
+		}
+		if d.dials != want {
+			t.Errorf("%d segments: %d more sessions", segments, d.dials)
+		}
+	}
+
+	if err := c.Stor("/small.txt", strings.NewReader("small")); err != nil {
+		t.Fatal(err)
+	}
+	w := &writerAt{}
+	if err := c.Download("/small.txt", w); err != nil || string(w.buf) != "small" {
+		t.Errorf("downloaded %q, %v", w.buf, err)
+	}
+	if err := c.Download("/missing.bin", w); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("download of a missing file: %v", err)
+	}
+}
+
+// go test -run TestTransfer
+func TestTransfer(t *testing.T) {
+	var conns []*ftplib.ClientConn
+	for i := 0; i < 2; i++ {
+		addr, cleanup, err := ftptest.Start(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cleanup()
+		c, err := ftplib.Connect(addr, "user", "password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Quit()
+		conns = append(conns, c)
+	}
+	src, dst := conns[0], conns[1]
+	if err := src.Stor("/a.txt", strings.NewReader("server to server")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ftplib.Transfer(src, "/a.txt", dst, "/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	r, err := dst.Retr("/b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err := r.Close(); err != nil {
+		t.Error(err)
+	}
+	if err != nil || string(data) != "server to server" {
+		t.Errorf("transferred %q, %v", data, err)
+	}
+
+	// Both sessions stay in step after a refused transfer.
+	if err := ftplib.Transfer(src, "/missing.txt", dst, "/c.txt"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("transfer of a missing file: %v", err)
+	}
+	for _, c := range conns {
+		if dir, err := c.CurrentDir(); err != nil || dir != "/" {
+			t.Errorf("current directory %q, %v", dir, err)
+		}
+	}
+}
+
+// readTree returns the files under dir, on the disk or on the server of c
+// if set, by their slash-separated path.
+func readTree(t *testing.T, c *ftplib.ClientConn, dir string) map[string]string {
+	files := make(map[string]string)
+	if c == nil {
+		err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			data, err := ioutil.ReadFile(p)
+			rel, _ := filepath.Rel(dir, p)
+			files[filepath.ToSlash(rel)] = string(data)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return files
+	}
+	err := c.Walk(dir, func(p string, e *ftplib.Entry, err error) error {
+		if err != nil || e.Type != ftplib.EntryTypeFile {
+			return err
+		}
+		r, err := c.Retr(p)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadAll(r)
+		r.Close()
+		files[strings.TrimPrefix(p, dir+"/")] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// writeTree writes files under the local directory dir.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// go test -run TestSync
+func TestSync(t *testing.T) {
+	local, err := ioutil.TempDir("", "ftplib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(local)
+	addr, cleanup, err := ftptest.Start(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	c, err := ftplib.Connect(addr, "user", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Quit()
+
+	// Push into a missing directory.
+	src := filepath.Join(local, "src")
+	writeTree(t, src, map[string]string{"a.txt": "a", "same.txt": "same", "sub/b.txt": "b"})
+	push := ftplib.SyncOptions{Direction: ftplib.Push, Parallelism: 2}
+	if err := c.Sync(src, "/mirror", push); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"a.txt": "a", "same.txt": "same", "sub/b.txt": "b"}
+	if got := readTree(t, c, "/mirror"); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("pushed %v", got)
+	}
+
+	// Only the changes go, and the extraneous files are deleted.
+	writeTree(t, src, map[string]string{"a.txt": "changed", "c.txt": "c"})
+	if err := os.RemoveAll(filepath.Join(src, "sub")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Stor("/mirror/same.txt", strings.NewReader("SAME")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Stor("/mirror/extra.txt", strings.NewReader("extra")); err != nil {
+		t.Fatal(err)
+	}
+	push.Delete = true
+	if err := c.Sync(src, "/mirror", push); err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]string{"a.txt": "changed", "c.txt": "c", "same.txt": "SAME"}
+	if got := readTree(t, c, "/mirror"); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("pushed %v", got)
+	}
+	if _, err := c.Stat("/mirror/sub"); err == nil {
+		t.Error("extraneous directory kept")
+	}
+
+	// Pull, then pull again over local changes.
+	dst := filepath.Join(local, "dst")
+	pull := ftplib.SyncOptions{Direction: ftplib.Pull, Delete: true}
+	if err := c.Sync(dst, "/mirror", pull); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTree(t, nil, dst); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("pulled %v", got)
+	}
+	writeTree(t, dst, map[string]string{"extra/x.txt": "x", "c.txt": "longer"})
+	if err := c.Sync(dst, "/mirror", pull); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTree(t, nil, dst); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("pulled %v", got)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "extra")); !os.IsNotExist(err) {
+		t.Errorf("extraneous directory kept: %v", err)
+	}
+
+	// The files the filter leaves out are neither copied nor deleted.
+	writeTree(t, src, map[string]string{"a.txt": "changed again", "c.txt": "changed", ".git/HEAD": "ref"})
+	push.Filter = ftplib.PathFilter{Exclude: []string{".git", "c.txt"}}
+	if err := c.Stor("/mirror/kept.tmp", strings.NewReader("tmp")); err != nil {
+		t.Fatal(err)
+	}
+	push.Filter.Exclude = append(push.Filter.Exclude, "*.tmp")
+	if err := c.Sync(src, "/mirror", push); err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]string{"a.txt": "changed again", "c.txt": "c", "kept.tmp": "tmp", "same.txt": "SAME"}
+	if got := readTree(t, c, "/mirror"); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("pushed with a filter %v", got)
+	}
+
+	// A dry run reports the operations and changes nothing.
+	var ops []string
+	report := func(op ftplib.Operation) { ops = append(ops, op.Verb+" "+op.Path) }
+	writeTree(t, src, map[string]string{"new/d.txt": "d"})
+	dry := ftplib.SyncOptions{Direction: ftplib.Push, Delete: true, Report: report, DryRun: true}
+	if err := c.Sync(src, "/mirror", dry); err != nil {
+		t.Fatal(err)
+	}
+	wantOps := []string{"mkdir .git", "mkdir new", "upload .git/HEAD", "upload c.txt", "upload new/d.txt", "delete kept.tmp"}
+	if fmt.Sprint(ops) != fmt.Sprint(wantOps) {
+		t.Errorf("dry run reported %q", ops)
+	}
+	if got := readTree(t, c, "/mirror"); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("dry run changed the tree to %v", got)
+	}
+	ops = nil
+	dry.Direction = ftplib.Pull
+	if err := c.Sync(filepath.Join(local, "none"), "/mirror", dry); err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 4 {
+		t.Errorf("dry run reported %q", ops)
+	}
+	if _, err := os.Stat(filepath.Join(local, "none")); !os.IsNotExist(err) {
+		t.Errorf("dry run made the local directory: %v", err)
+	}
+
+	ops = nil
+	if err := c.RemoveDirRecur("/mirror", ftplib.WithReport(report), ftplib.WithDryRun()); err != nil {
+		t.Fatal(err)
+	}
+	wantOps = []string{"delete /mirror/a.txt", "delete /mirror/c.txt", "delete /mirror/kept.tmp", "delete /mirror/same.txt", "delete /mirror"}
+	if fmt.Sprint(ops) != fmt.Sprint(wantOps) {
+		t.Errorf("dry run reported %q", ops)
+	}
+	if got := readTree(t, c, "/mirror"); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("dry run changed the tree to %v", got)
+	}
+}
+
+// go test -run TestTransport
+func TestTransport(t *testing.T) {
+	driver := ftptest.NewMemDriver()
+	if err := driver.WriteFile("/pub/file.txt", []byte("some text")); err != nil {
+		t.Fatal(err)
+	}
+	addr, cleanup, err := ftptest.Start(driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	tr := &http.Transport{}
+	tr.RegisterProtocol("ftp", &ftplib.Transport{})
+	client := &http.Client{Transport: tr}
+	base := "ftp://user:password@" + addr
+
+	do := func(method, path, body string) (int, string) {
+		req, err := http.NewRequest(method, base+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, string(b)
+	}
+	if code, body := do("GET", "/pub/file.txt", ""); code != http.StatusOK || body != "some text" {
+		t.Errorf("GET: %d %q", code, body)
+	}
+	if code, _ := do("PUT", "/pub/new.txt", "new text"); code != http.StatusCreated {
+		t.Errorf("PUT: %d", code)
+	}
+	if b, _ := driver.ReadFile("/pub/new.txt"); string(b) != "new text" {
+		t.Errorf("PUT stored %q", b)
+	}
+	if code, body := do("GET", "/pub/", ""); code != http.StatusOK || !strings.Contains(body, "new.txt\n") {
+		t.Errorf("GET of a directory: %d %q", code, body)
+	}
+	if code, _ := do("DELETE", "/pub/new.txt", ""); code != http.StatusNoContent {
+		t.Errorf("DELETE: %d", code)
+	}
+	if code, _ := do("GET", "/pub/new.txt", ""); code != http.StatusNotFound {
+		t.Errorf("GET of a deleted file: %d", code)
+	}
+	if code, _ := do("POST", "/pub/file.txt", ""); code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: %d", code)
+	}
+}
+
+// go test -run TestOpenURL
+func TestOpenURL(t *testing.T) {
+	driver := ftptest.NewMemDriver()
+	if err := driver.WriteFile("/pub/file.txt", []byte("some text")); err != nil {
+		t.Fatal(err)
+	}
+	addr, cleanup, err := ftptest.Start(driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	c, err := ftplib.OpenURL("ftp://user:password@" + addr + "/pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Quit()
+	if dir, err := c.CurrentDir(); err != nil || dir != "/pub" {
+		t.Errorf("CurrentDir: %q, %v", dir, err)
+	}
+	if _, err := ftplib.OpenURL("ftp://user:password@" + addr + "/missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("OpenURL of a missing directory: %v", err)
+	}
+	if _, err := ftplib.OpenURL("http://" + addr + "/"); err == nil {
+		t.Error("opened an http URL")
+	}
+}
+
+// go test -run TestCredentialProvider
+func TestCredentialProvider(t *testing.T) {
+	script := ftptest.Script{
+		{Reply: "220 Service ready for new user."},
+		{Expect: "FEAT", Reply: "502 Command not implemented."},
+		{Expect: "USER ann", Reply: "331 User name okay, need password."},
+		{Expect: "PASS secret", Reply: "332 Need account for login."},
+		{Expect: "ACCT billing", Reply: "230 User logged in, proceed."},
+		{Expect: "TYPE I", Reply: "200 Type set to binary."},
+		{Expect: "QUIT", Reply: "221 Goodbye."},
+	}
+	play(t, script, func(addr string) {
+		creds := ftplib.CredentialsFunc(func(string) (ftplib.Credentials, error) {
+			return ftplib.Credentials{User: "ann", Password: "secret", Account: "billing"}, nil
+		})
+		c, err := ftplib.Dial(addr, ftplib.WithCredentials(creds))
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Quit()
+	})
+
+	// The other sessions ask the provider again.
+	addr, cleanup, err := ftptest.Start(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	var mu sync.Mutex
+	var asked []string
+	creds := ftplib.CredentialsFunc(func(addr string) (ftplib.Credentials, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		asked = append(asked, addr)
+		return ftplib.Credentials{User: "user", Password: "password"}, nil
+	})
+	c, err := ftplib.Dial(addr, ftplib.WithCredentials(creds))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Quit()
+	dir, err := ioutil.TempDir("", "ftplib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeTree(t, dir, map[string]string{"a.txt": "a", "b.txt": "b"})
+	if err := c.UploadDir(dir, "/up", ftplib.WithParallelism(2)); err != nil {
+		t.Fatal(err)
+	}
+	if len(asked) != 2 || asked[0] != addr || asked[1] != addr {
+		t.Errorf("provider asked for %q", asked)
+	}
+
+	// A refused login is an *FTPError.
+	refuse := ftplib.CredentialsFunc(func(string) (ftplib.Credentials, error) {
+		return ftplib.Credentials{User: "user", Password: "wrong"}, nil
+	})
+	if _, err := ftplib.Dial(addr, ftplib.WithCredentials(refuse)); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("login with a wrong password: %v", err)
+	}
+}
+
+// go test -run TestDialContext
+func TestDialContext(t *testing.T) {
+	addr, cleanup, err := ftptest.Start(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	type key struct{}
+	var mu sync.Mutex
+	var values []interface{}
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		mu.Lock()
+		values = append(values, ctx.Value(key{}))
+		mu.Unlock()
+		var d net.Dialer
+		return d.DialContext(ctx, network, address)
+	}
+	c, err := ftplib.Dial(addr, ftplib.WithDialContext(dial))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Quit()
+	if err := c.Login("user", "password"); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.WithValue(context.Background(), key{}, "list")
+	if _, err := c.ListContext(ctx, "/"); err != nil {
+		t.Fatal(err)
+	}
+	// The control connection, then the data connection of the listing.
+	if len(values) != 2 || values[0] != nil || values[1] != "list" {
+		t.Errorf("dialed with the values %v", values)
+	}
+}
+
+// connectProxy is an HTTP proxy serving CONNECT to the user joe.
+type connectProxy struct {
+	mu      sync.Mutex
+	tunnels []string
+}
+
+func (p *connectProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "CONNECT" {
+		http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Header.Get("Proxy-Authorization") != "Basic "+base64.StdEncoding.EncodeToString([]byte("joe:secret")) {
+		w.Header().Set("Proxy-Authenticate", `Basic realm="proxy"`)
+		http.Error(w, "who are you?", http.StatusProxyAuthRequired)
+		return
+	}
+	server, err := net.Dial("tcp", r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	p.mu.Lock()
+	p.tunnels = append(p.tunnels, r.Host)
+	p.mu.Unlock()
+	client, rw, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		server.Close()
+		return
+	}
+	rw.WriteString("HTTP/1.1 200 Connection established\r\n\r\n")
+	rw.Flush()
+	go func() {
+		io.Copy(server, client)
+		server.(*net.TCPConn).CloseWrite()
+	}()
+	io.Copy(client, server)
+	client.Close()
+}
+
+// go test -run TestHTTPProxy
+func TestHTTPProxy(t *testing.T) {
+	addr, cleanup, err := ftptest.Start(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	proxy := &connectProxy{}
+	ps := httptest.NewServer(proxy)
+	defer ps.Close()
+	p, err := ftplib.NewHTTPProxy("http://joe:secret@" + ps.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := ftplib.Dial(addr, ftplib.WithDialer(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Quit()
+	if err := c.Login("user", "password"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Stor("/proxied.txt", strings.NewReader("through the proxy")); err != nil {
+		t.Fatal(err)
+	}
+	r, err := c.Retr("/proxied.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(r)
+	r.Close()
+	if string(b) != "through the proxy" || err != nil {
+		t.Errorf("Retr: %q, %v", b, err)
+	}
+	proxy.mu.Lock()
+	if len(proxy.tunnels) != 3 || proxy.tunnels[0] != addr {
+		t.Errorf("tunnels: %v", proxy.tunnels)
+	}
+	proxy.mu.Unlock()
+
+	p.Password = "wrong"
+	var perr *ftplib.HTTPProxyError
+	if _, err := ftplib.Dial(addr, ftplib.WithDialer(p)); !errors.As(err, &perr) || !strings.HasPrefix(perr.Status, "407") {
+		t.Errorf("Dial with a wrong proxy password: %v", err)
+	}
+}
+
+// go test -run TestLocalAddr
+func TestLocalAddr(t *testing.T) {
+	addr, cleanup, err := ftptest.Start(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	local := net.ParseIP("127.0.0.2")
+	if l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: local}); err != nil {
+		t.Skip("no 127.0.0.2 on this host:", err)
+	} else {
+		l.Close()
+	}
+	for _, active := range []bool{false, true} {
+		c, err := ftplib.Dial(addr, ftplib.WithLocalAddr(local))
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.SetActiveMode(active)
+		if err := c.Login("user", "password"); err != nil {
+			t.Fatal(err)
+		}
+		if _, msg, err := c.Quote("STAT"); err != nil || !strings.Contains(msg, "Connected from 127.0.0.2:") {
+			t.Errorf("STAT: %q, %v", msg, err)
+		}
+		if err := c.Stor("/bound.txt", strings.NewReader("bound")); err != nil {
+			t.Errorf("active %v: %v", active, err)
+		}
+		c.Quit()
+	}
+}
+
+// go test -run TestPeerCheck
+func TestPeerCheck(t *testing.T) {
+	// Another host to land on.
+	other, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Skip("no 127.0.0.2 on this host:", err)
+	}
+	defer other.Close()
+	script := append(ftptest.LoginScript("joe", "secret"),
+		ftptest.Step{Expect: "PASV", Reply: "227 Entering Passive Mode (10,0,0,1,{pasvport})."},
+		ftptest.Step{Expect: "PASV", Reply: "227 Entering Passive Mode ({pasv})."},
+		ftptest.Step{Expect: "RETR f.txt", Reply: "150 Opening data connection.", Data: "content"},
+		ftptest.Step{Reply: "226 Transfer complete."},
+		ftptest.Step{Expect: "PASV", Reply: "227 Entering Passive Mode ({pasv})."},
+		ftptest.Step{Expect: "QUIT", Reply: "221 Goodbye."},
+	)
+	play(t, script, func(addr string) {
+		redirect := false
+		dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+			if redirect {
+				address = other.Addr().String()
+			}
+			var d net.Dialer
+			return d.DialContext(ctx, network, address)
+		}
+		c, err := ftplib.Dial(addr, ftplib.WithDialContext(dial), ftplib.WithDisabledEPSV(), ftplib.WithPeerCheck())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Quit()
+		if err := c.Login("joe", "secret"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Retr("f.txt"); err == nil || !strings.Contains(err.Error(), "another address") {
+			t.Errorf("retrieved after a PASV reply with another address: %v", err)
+		}
+		r, err := c.Retr("f.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.ReadAll(r)
+		r.Close()
+		redirect = true
+		if _, err := c.Retr("f.txt"); err == nil || !strings.Contains(err.Error(), "another host") {
+			t.Errorf("retrieved from another host: %v", err)
+		}
+	})
+}
+
+// go test -run TestTrace
+func TestTrace(t *testing.T) {
+	script := append(ftptest.LoginScript("joe", "secret"),
+		ftptest.Step{Expect: "NOOP", Reply: "200-Multiline\n200 NOOP ok."},
+		ftptest.Step{Expect: "QUIT", Reply: "221 Goodbye."},
+	)
+	var trace strings.Builder
+	play(t, script, func(addr string) {
+		c, err := ftplib.Dial(addr, ftplib.WithTrace(&trace))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Login("joe", "secret"); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.NoOp(); err != nil {
+			t.Fatal(err)
+		}
+		c.Quit()
+	})
+	want := `< 220 Service ready for new user.
+> FEAT
+< 502 Command not implemented.
+> USER joe
+< 331 User name okay, need password.
+> PASS ****
+< 230 User logged in, proceed.
+> TYPE I
+< 200 Type set to binary.
+> NOOP
+< 200-Multiline
+< 200 NOOP ok.
+> QUIT
+`
+	if trace.String() != want {
+		t.Errorf("trace:\n%s\nwant:\n%s", trace.String(), want)
+	}
+}
+
+// go test -run TestLoggerSilentByDefault
+func TestLoggerSilentByDefault(t *testing.T) {
+	script := append(ftptest.LoginScript("joe", "secret"),
+		ftptest.Step{Expect: "QUIT", Reply: "221 Goodbye."},
+	)
+	var std strings.Builder
+	log.SetOutput(&std)
+	defer log.SetOutput(os.Stderr)
+	play(t, script, func(addr string) {
+		c, err := ftplib.Connect(addr, "joe", "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Quit()
+	})
+	if std.String() != "" {
+		t.Errorf("logged %q to the standard logger", std.String())
+	}
+}
+
+// spanRecorder is a Tracer recording the ended spans.
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+type recordedSpan struct {
+	r     *spanRecorder
+	name  string
+	attrs map[string]interface{}
+}
+
+func (r *spanRecorder) Start(ctx context.Context, name string) (context.Context, ftplib.Span) {
+	return ctx, &recordedSpan{r: r, name: name, attrs: make(map[string]interface{})}
+}
+
+func (s *recordedSpan) SetAttribute(key string, value interface{}) { s.attrs[key] = value }
+
+func (s *recordedSpan) End() {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.r.spans = append(s.r.spans, s)
+}
+
+// go test -run TestTracer
+func TestTracer(t *testing.T) {
+	addr, cleanup, err := ftptest.Start(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	tracer := &spanRecorder{}
+	c, err := ftplib.Dial(addr, ftplib.WithTracer(tracer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Quit()
+	if err := c.Login("user", "password"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Stor("/traced.txt", strings.NewReader("traced")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.List("/"); err != nil {
+		t.Fatal(err)
+	}
+	r, err := c.Retr("/traced.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.ReadAll(r)
+	r.Close()
+	if err := c.Delete("/missing.txt"); err == nil {
+		t.Error("deleted a missing file")
+	}
+
+	var names []string
+	for _, span := range tracer.spans {
+		names = append(names, span.name)
+	}
+	if strings.Join(names, ",") != "FTP LOGIN,FTP STOR,FTP LIST,FTP RETR,FTP DELE" {
+		t.Fatalf("spans %q", names)
+	}
+	login, stor, retr, dele := tracer.spans[0].attrs, tracer.spans[1].attrs, tracer.spans[3].attrs, tracer.spans[4].attrs
+	if login[ftplib.AttrUser] != "user" || login[ftplib.AttrPeer] != addr || login[ftplib.AttrReplyCode] != ftplib.StatusCommandOK {
+		t.Errorf("LOGIN attributes %v", login)
+	}
+	if stor[ftplib.AttrPath] != "/traced.txt" || stor[ftplib.AttrBytes] != int64(6) || stor[ftplib.AttrReplyCode] != ftplib.StatusClosingDataConnection {
+		t.Errorf("STOR attributes %v", stor)
+	}
+	if retr[ftplib.AttrBytes] != int64(6) || retr[ftplib.AttrReplyCode] != ftplib.StatusClosingDataConnection {
+		t.Errorf("RETR attributes %v", retr)
+	}
+	if dele[ftplib.AttrReplyCode] != ftplib.StatusFileUnavailable || dele[ftplib.AttrError] == nil {
+		t.Errorf("DELE attributes %v", dele)
+	}
+}
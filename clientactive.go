@@ -0,0 +1,173 @@
+package ftplib
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	errActivePeer  = errors.New("data connection from another host than the server")
+	errActiveLocal = errors.New("no TCP address to listen on in active mode")
+)
+
+// SetActiveMode makes the server open the data connections to the client,
+// announced with PORT or EPRT, for servers and firewalls allowing only active
+// transfers. The server must reach the client on the address of its end of
+// the control connection.
+func (c *ClientConn) SetActiveMode(active bool) {
+	c.active = active
+}
+
+// WithActiveMode dials a ClientConn in active mode, as SetActiveMode.
+func WithActiveMode() DialOption {
+	return func(c *ClientConn) {
+		c.active = true
+	}
+}
+
+// activeDataConn listens for the data connection of the next transfer and
+// sends its address with PORT, or EPRT (RFC 2428) over IPv6.
+func (c *ClientConn) activeDataConn() (net.Conn, error) {
+	local, ok := c.raw.LocalAddr().(*net.TCPAddr)
+	remote, ok2 := c.raw.RemoteAddr().(*net.TCPAddr)
+	if !ok || !ok2 {
+		return nil, errActiveLocal
+	}
+	network, ip := "tcp6", local.IP
+	if ip4 := ip.To4(); ip4 != nil {
+		network, ip = "tcp4", ip4
+	}
+	l, err := net.ListenTCP(network, &net.TCPAddr{IP: ip, Zone: local.Zone})
+	if err != nil {
+		return nil, err
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	if network == "tcp4" {
+		_, _, err = c.cmd(StatusCommandOK, "PORT %d,%d,%d,%d,%d,%d", ip[0], ip[1], ip[2], ip[3], port>>8, port&0xff)
+	} else {
+		_, _, err = c.cmd(StatusCommandOK, "EPRT |2|%s|%d|", ip, port)
+	}
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	return &activeConn{l: l, peer: remote.IP, timeout: c.timeout}, nil
+}
+
+// activeConn is a data connection of active mode, which the server opens
+// once the transfer command is sent. It is accepted on first use, from the
+// server only.
+type activeConn struct {
+	l       *net.TCPListener
+	peer    net.IP
+	timeout time.Duration
+
+	once sync.Once
+	err  error
+
+	mu       sync.Mutex
+	conn     net.Conn
+	deadline time.Time
+}
+
+// accept waits for the server to connect, the first time it is called.
+func (a *activeConn) accept() (net.Conn, error) {
+	a.once.Do(func() {
+		a.mu.Lock()
+		deadline := a.deadline
+		if a.timeout > 0 && (deadline.IsZero() || time.Until(deadline) > a.timeout) {
+			deadline = time.Now().Add(a.timeout)
+		}
+		a.l.SetDeadline(deadline)
+		a.mu.Unlock()
+
+		conn, err := a.l.AcceptTCP()
+		a.l.Close()
+		if err != nil {
+			a.err = err
+			return
+		}
+		if ip := conn.RemoteAddr().(*net.TCPAddr).IP; a.peer != nil && !ip.Equal(a.peer) {
+			conn.Close()
+			a.err = errActivePeer
+			return
+		}
+		a.mu.Lock()
+		a.conn = conn
+		if !a.deadline.IsZero() {
+			conn.SetDeadline(a.deadline)
+		}
+		a.mu.Unlock()
+	})
+	return a.conn, a.err
+}
+
+func (a *activeConn) Read(p []byte) (int, error) {
+	conn, err := a.accept()
+	if err != nil {
+		return 0, err
+	}
+	return conn.Read(p)
+}
+
+func (a *activeConn) Write(p []byte) (int, error) {
+	conn, err := a.accept()
+	if err != nil {
+		return 0, err
+	}
+	return conn.Write(p)
+}
+
+func (a *activeConn) Close() error {
+	// Closing the listener first ends a wait in accept.
+	a.l.Close()
+	a.once.Do(func() {
+		a.err = errDataConnClosed
+	})
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.conn != nil {
+		return a.conn.Close()
+	}
+	return nil
+}
+
+func (a *activeConn) LocalAddr() net.Addr {
+	return a.l.Addr()
+}
+
+func (a *activeConn) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: a.peer}
+}
+
+// SetDeadline applies to the wait for the server too, unlike the read and
+// write deadlines.
+func (a *activeConn) SetDeadline(t time.Time) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.deadline = t
+	if a.conn != nil {
+		return a.conn.SetDeadline(t)
+	}
+	return a.l.SetDeadline(t)
+}
+
+func (a *activeConn) SetReadDeadline(t time.Time) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.conn != nil {
+		return a.conn.SetReadDeadline(t)
+	}
+	return nil
+}
+
+func (a *activeConn) SetWriteDeadline(t time.Time) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.conn != nil {
+		return a.conn.SetWriteDeadline(t)
+	}
+	return nil
+}
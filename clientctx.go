@@ -0,0 +1,245 @@
+package ftplib
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// The Context variants of the operations of ClientConn give up when their
+// context is done, interrupting the control and data connections. The
+// operation is then aborted with ABOR and the session goes on.
+
+// LoginContext is Login, given up when ctx is done.
+func (c *ClientConn) LoginContext(ctx context.Context, user, password string) error {
+	w := c.startContext(ctx)
+	return c.stopContext(w, c.Login(user, password))
+}
+
+// NameListContext is NameList, given up when ctx is done.
+func (c *ClientConn) NameListContext(ctx context.Context, path string) ([]string, error) {
+	w := c.startContext(ctx)
+	entries, err := c.NameList(path)
+	return entries, c.stopContext(w, err)
+}
+
+// ListContext is List, given up when ctx is done.
+func (c *ClientConn) ListContext(ctx context.Context, path string) ([]*Entry, error) {
+	w := c.startContext(ctx)
+	entries, err := c.List(path)
+	return entries, c.stopContext(w, err)
+}
+
+// StorContext is Stor, given up when ctx is done.
+func (c *ClientConn) StorContext(ctx context.Context, path string, r io.Reader) error {
+	w := c.startContext(ctx)
+	return c.stopContext(w, c.Stor(path, r))
+}
+
+// RetrContext is Retr, given up when ctx is done, while the download is
+// read too.
+func (c *ClientConn) RetrContext(ctx context.Context, path string) (io.ReadCloser, error) {
+	w := c.startContext(ctx)
+	r, err := c.Retr(path)
+	if err != nil {
+		return nil, c.stopContext(w, err)
+	}
+	return &ctxReader{ReadCloser: r, c: c, w: w}, nil
+}
+
+// AppendContext is Append, given up when ctx is done.
+func (c *ClientConn) AppendContext(ctx context.Context, path string, r io.Reader) error {
+	w := c.startContext(ctx)
+	return c.stopContext(w, c.Append(path, r))
+}
+
+// StatContext is Stat, given up when ctx is done. It stands for SIZE and
+// MDTM as well, which Stat sends without MLST.
+func (c *ClientConn) StatContext(ctx context.Context, path string) (*Entry, error) {
+	w := c.startContext(ctx)
+	e, err := c.Stat(path)
+	return e, c.stopContext(w, err)
+}
+
+// ChangeDirContext is ChangeDir, given up when ctx is done.
+func (c *ClientConn) ChangeDirContext(ctx context.Context, path string) error {
+	w := c.startContext(ctx)
+	return c.stopContext(w, c.ChangeDir(path))
+}
+
+// CurrentDirContext is CurrentDir, given up when ctx is done.
+func (c *ClientConn) CurrentDirContext(ctx context.Context) (string, error) {
+	w := c.startContext(ctx)
+	dir, err := c.CurrentDir()
+	return dir, c.stopContext(w, err)
+}
+
+// MakeDirContext is MakeDir, given up when ctx is done.
+func (c *ClientConn) MakeDirContext(ctx context.Context, path string) error {
+	w := c.startContext(ctx)
+	return c.stopContext(w, c.MakeDir(path))
+}
+
+// RemoveDirContext is RemoveDir, given up when ctx is done.
+func (c *ClientConn) RemoveDirContext(ctx context.Context, path string) error {
+	w := c.startContext(ctx)
+	return c.stopContext(w, c.RemoveDir(path))
+}
+
+// DeleteContext is Delete, given up when ctx is done.
+func (c *ClientConn) DeleteContext(ctx context.Context, path string) error {
+	w := c.startContext(ctx)
+	return c.stopContext(w, c.Delete(path))
+}
+
+// RenameContext is Rename, given up when ctx is done.
+func (c *ClientConn) RenameContext(ctx context.Context, from, to string) error {
+	w := c.startContext(ctx)
+	return c.stopContext(w, c.Rename(from, to))
+}
+
+// QuoteContext is Quote, given up when ctx is done.
+func (c *ClientConn) QuoteContext(ctx context.Context, format string, args ...interface{}) (code int, msg string, err error) {
+	w := c.startContext(ctx)
+	code, msg, err = c.Quote(format, args...)
+	return code, msg, c.stopContext(w, err)
+}
+
+// aLongTimeAgo is a deadline interrupting the I/O in progress.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// ctxWatch interrupts the connections of an operation when its context is
+// done.
+type ctxWatch struct {
+	ctx  context.Context
+	done chan struct{}
+
+	mu      sync.Mutex
+	conns   []net.Conn
+	fired   bool
+	stopped bool
+}
+
+// startContext watches ctx for the operation about to start, until
+// stopContext.
+func (c *ClientConn) startContext(ctx context.Context) *ctxWatch {
+	w := &ctxWatch{ctx: ctx, done: make(chan struct{})}
+	w.add(c.raw)
+	c.watch = w
+	if ctx.Done() != nil {
+		go w.run()
+	}
+	return w
+}
+
+// stopContext ends the watch w of the operation which failed with err, and
+// returns err, or the error of the context if it interrupted the operation.
+func (c *ClientConn) stopContext(w *ctxWatch, err error) error {
+	w.mu.Lock()
+	fired := w.fired
+	w.stopped = true
+	w.mu.Unlock()
+	close(w.done)
+	c.watch = nil
+	if !fired {
+		return err
+	}
+	w.conns[0].SetDeadline(time.Time{})
+	for _, conn := range w.conns[1:] {
+		conn.Close()
+	}
+	if r := c.transfer; r != nil {
+		c.transfer = nil
+		r.aborted = true
+	}
+	if rerr := c.resync(); err == nil {
+		err = rerr
+	}
+	if err != nil {
+		return w.ctx.Err()
+	}
+	return nil
+}
+
+// add interrupts conn too when the context is done.
+func (w *ctxWatch) add(conn net.Conn) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.conns = append(w.conns, conn)
+	if w.fired {
+		conn.SetDeadline(aLongTimeAgo)
+	}
+}
+
+func (w *ctxWatch) run() {
+	select {
+	case <-w.ctx.Done():
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if w.stopped {
+			return
+		}
+		w.fired = true
+		for _, conn := range w.conns {
+			conn.SetDeadline(aLongTimeAgo)
+		}
+	case <-w.done:
+	}
+}
+
+// ctxReader is a download watched until it is closed.
+type ctxReader struct {
+	io.ReadCloser
+	c *ClientConn
+	w *ctxWatch
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err != nil && err != io.EOF && r.w.ctx.Err() != nil {
+		err = r.w.ctx.Err()
+	}
+	return n, err
+}
+
+func (r *ctxReader) Close() error {
+	return r.c.stopContext(r.w, r.ReadCloser.Close())
+}
+
+// Abort ends the download in progress with ABOR, closing its data
+// connection, and reads the replies to the transfer and to ABOR, so that
+// the session can go on. Closing the download afterwards does nothing.
+func (c *ClientConn) Abort() error {
+	if r := c.transfer; r != nil {
+		c.transfer = nil
+		r.aborted = true
+		r.conn.Close()
+		r.endSpan(nil)
+	}
+	return c.resync()
+}
+
+// resync sends ABOR, then NOOP, and skips the replies up to that of NOOP:
+// whatever replies the interrupted command still had due, and whether or
+// not the server knows ABOR, the session is back in step.
+func (c *ClientConn) resync() error {
+	c.lockControl()
+	defer c.unlockControl(false)
+	if _, err := c.conn.Cmd("ABOR"); err != nil {
+		return err
+	}
+	if _, err := c.conn.Cmd("NOOP"); err != nil {
+		return err
+	}
+	for {
+		code, _, err := c.conn.ReadResponse(-1)
+		if err != nil {
+			return err
+		}
+		if code == StatusCommandOK {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package ftplib
+
+import (
+	"io"
+)
+
+// DefaultDownloadSegments is the number of segments Download fetches at
+// once, unless set with WithSegments.
+const DefaultDownloadSegments = 4
+
+// MinSegmentSize is the size under which Download does not split a file
+// further: smaller segments would not repay the opening of their
+// sessions.
+const MinSegmentSize = 1 << 20
+
+// DownloadOption configures Download.
+type DownloadOption func(o *downloadOptions)
+
+type downloadOptions struct {
+	segments int
+}
+
+// WithSegments splits the file in up to n segments, fetched at once on a
+// session each; 1 downloads it over the session of the client.
+func WithSegments(n int) DownloadOption {
+	return func(o *downloadOptions) {
+		o.segments = n
+	}
+}
+
+// Download retrieves the file path in binary into w, in segments fetched at
+// once on several sessions, opened and logged in as the client: each
+// session skips to its segment with REST and stops the transfer with ABOR
+// at its end. This makes the most of links where a single connection is
+// held back by latency. When the server refuses more sessions, the
+// segments are fetched on those it let open. Without SIZE, the file is
+// downloaded whole over the session of the client. The segments are
+// written to w at once, as *os.File allows. The first error stops the
+// download.
+func (c *ClientConn) Download(path string, w io.WriterAt, opts ...DownloadOption) error {
+	o := downloadOptions{segments: DefaultDownloadSegments}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := c.setType(TypeBinary); err != nil {
+		return err
+	}
+	size, err := c.fileSize(path)
+	if err != nil {
+		return c.downloadSegment(path, w, segment{0, -1})
+	}
+
+	n := int64(o.segments)
+	if most := (int64(size) + MinSegmentSize - 1) / MinSegmentSize; n > most {
+		n = most
+	}
+	if n < 1 {
+		n = 1
+	}
+	segments := make([]segment, n)
+	for i := range segments {
+		segments[i] = segment{int64(size) * int64(i) / n, int64(size) * int64(i+1) / n}
+	}
+	segments[n-1].end = -1 // to the end, should the file have grown
+	return c.downloadSegments(path, w, segments)
+}
+
+// segment is the range [start, end) of a file, end -1 reaching to its
+// end.
+type segment struct {
+	start, end int64
+}
+
+// downloadSegments fetches the segments of path into w, on up to as many
+// sessions, c serving the first.
+func (c *ClientConn) downloadSegments(path string, w io.WriterAt, segments []segment) error {
+	return c.runParallel("Download", len(segments), len(segments), func(s *ClientConn, i int) error {
+		return s.downloadSegment(path, w, segments[i])
+	})
+}
+
+// downloadSegment fetches the segment seg of path into w.
+func (c *ClientConn) downloadSegment(path string, w io.WriterAt, seg segment) error {
+	r, err := c.retr(path, uint64(seg.start), TypeBinary)
+	if err != nil {
+		return err
+	}
+	dst := &offsetWriter{w, seg.start}
+	if seg.end < 0 {
+		_, err = io.Copy(dst, r)
+		if err2 := r.Close(); err == nil {
+			err = err2
+		}
+		return err
+	}
+	_, err = io.CopyN(dst, r, seg.end-seg.start)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	// The server would send the rest of the file.
+	if err2 := c.Abort(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// offsetWriter writes to w from off on.
+type offsetWriter struct {
+	w   io.WriterAt
+	off int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.w.WriteAt(p, w.off)
+	w.off += int64(n)
+	return n, err
+}
@@ -0,0 +1,109 @@
+package ftplib
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+	"os"
+	"strings"
+)
+
+// FTPError is the error of a command the server refused, or of a transfer
+// it failed. errors.Is matches it with os.ErrNotExist, os.ErrPermission or
+// os.ErrExist when the reply tells so, and it unwraps to the
+// *textproto.Error of the reply.
+type FTPError struct {
+	Code    int    // of the reply
+	Message string // of the reply, the lines of a multiline one joined by "\n"
+	Cmd     string // the command refused, its argument hidden for PASS
+}
+
+func (e *FTPError) Error() string {
+	if e.Cmd == "" {
+		return fmt.Sprintf("%03d %s", e.Code, e.Message)
+	}
+	return fmt.Sprintf("%s: %03d %s", e.Cmd, e.Code, e.Message)
+}
+
+// Temporary reports whether the reply is a transient negative completion
+// (4xx), as IsTemporary tells: the command may succeed if sent again later.
+func (e *FTPError) Temporary() bool {
+	return IsTemporary(e.Code)
+}
+
+// Timeout reports whether the server closed the session for its being
+// idle, with a 421 reply telling so.
+func (e *FTPError) Timeout() bool {
+	msg := strings.ToLower(e.Message)
+	return e.Code == StatusNotAvailable && containsAny(msg, "timeout", "timed out", "idle")
+}
+
+func (e *FTPError) Unwrap() error {
+	return &textproto.Error{Code: e.Code, Msg: e.Message}
+}
+
+func (e *FTPError) Is(target error) bool {
+	switch target {
+	case os.ErrNotExist, os.ErrPermission, os.ErrExist:
+		return replyKind(e.Code, e.Message) == target
+	}
+	return false
+}
+
+// replyKind returns the one of os.ErrNotExist, os.ErrPermission and
+// os.ErrExist a reply means, or nil. Servers answer 550 to most failures
+// on files, which their message tells apart.
+func replyKind(code int, msg string) error {
+	switch code {
+	case StatusNotLoggedIn, StatusStorNeedAccount, StatusBadFileName:
+		return os.ErrPermission
+	case 521: // "directory already exists", of RFC 959 implementations
+		return os.ErrExist
+	case StatusFileUnavailable:
+		msg = strings.ToLower(msg)
+		switch {
+		case containsAny(msg, "permission", "denied", "not allowed", "forbidden"):
+			return os.ErrPermission
+		case containsAny(msg, "already exists", "file exists", "directory exists"):
+			return os.ErrExist
+		}
+		return os.ErrNotExist
+	}
+	return nil
+}
+
+func containsAny(s string, substrs ...string) bool {
+	for _, substr := range substrs {
+		if strings.Contains(s, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// replyCode returns the code of the reply err reports, if any.
+func replyCode(err error) (int, bool) {
+	var e *FTPError
+	if errors.As(err, &e) {
+		return e.Code, true
+	}
+	return 0, false
+}
+
+// replyErr returns err, the error of the reply to cmd, as an *FTPError.
+func replyErr(err error, cmd string) error {
+	if e, ok := err.(*textproto.Error); ok {
+		return &FTPError{Code: e.Code, Message: e.Msg, Cmd: cmd}
+	}
+	return err
+}
+
+// commandLine returns the command of format and args, as FTPError shows
+// it.
+func commandLine(format string, args ...interface{}) string {
+	line := fmt.Sprintf(format, args...)
+	if len(line) > 5 && strings.EqualFold(line[:5], "PASS ") {
+		return "PASS"
+	}
+	return line
+}
@@ -0,0 +1,69 @@
+package ftplib
+
+import (
+	"errors"
+	"net"
+)
+
+var (
+	errFXPProtected = errors.New("FXP of protected data connections is not supported")
+	errFXPAddress   = errors.New("no TCP address of the destination server for FXP")
+)
+
+// Transfer copies the file srcPath of the server of src to dstPath on the
+// server of dst, the data going from one server to the other without
+// passing through the client (FXP): dst opens a port with EPSV, or PASV,
+// which src is given with PORT, or EPRT over IPv6, then src sends the file
+// with RETR and dst stores it with STOR. The file is copied in binary.
+//
+// Both servers must allow it: many refuse by default a PORT to another
+// address than that of the client, or connections to their passive port
+// from it. The address of dst is the one the client reaches it at, which
+// must be reachable from src. The data connections must be in the clear,
+// as SetDataProtection sets them.
+func Transfer(src *ClientConn, srcPath string, dst *ClientConn, dstPath string) error {
+	if src.tls != nil || dst.tls != nil {
+		return errFXPProtected
+	}
+	remote, ok := dst.raw.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return errFXPAddress
+	}
+	if err := src.setType(TypeBinary); err != nil {
+		return err
+	}
+	if err := dst.setType(TypeBinary); err != nil {
+		return err
+	}
+
+	port, err := dst.passivePort()
+	if err != nil {
+		return err
+	}
+	if ip := remote.IP.To4(); ip != nil {
+		_, _, err = src.cmd(StatusCommandOK, "PORT %d,%d,%d,%d,%d,%d", ip[0], ip[1], ip[2], ip[3], port>>8, port&0xff)
+	} else {
+		_, _, err = src.cmd(StatusCommandOK, "EPRT |2|%s|%d|", remote.IP, port)
+	}
+	if err != nil {
+		return err
+	}
+
+	stor, retr := "STOR "+dstPath, "RETR "+srcPath
+	// The connection of src waits in the backlog of dst until it stores:
+	// starting with RETR leaves dst alone if src refuses it.
+	if _, err := src.startTransfer("%s", retr); err != nil {
+		return err
+	}
+	if _, err := dst.startTransfer("%s", stor); err != nil {
+		// src still sends the data.
+		src.resync()
+		return err
+	}
+	_, _, err = src.finalReply(StatusClosingDataConnection, retr)
+	_, _, err2 := dst.finalReply(StatusClosingDataConnection, stor)
+	if err == nil {
+		err = err2
+	}
+	return err
+}
@@ -0,0 +1,123 @@
+package ftplib
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"strings"
+)
+
+// HashAlgorithm is an algorithm of the checksums servers compute.
+type HashAlgorithm string
+
+const (
+	HashCRC32  HashAlgorithm = "CRC32"
+	HashMD5    HashAlgorithm = "MD5"
+	HashSHA1   HashAlgorithm = "SHA-1"
+	HashSHA256 HashAlgorithm = "SHA-256"
+	HashSHA512 HashAlgorithm = "SHA-512"
+)
+
+// hashCommands are the commands of the algorithms predating HASH.
+var hashCommands = map[HashAlgorithm]string{
+	HashCRC32:  "XCRC",
+	HashMD5:    "XMD5",
+	HashSHA1:   "XSHA1",
+	HashSHA256: "XSHA256",
+	HashSHA512: "XSHA512",
+}
+
+// hashes compute the digests of the algorithms locally.
+var hashes = map[HashAlgorithm]func() hash.Hash{
+	HashCRC32:  func() hash.Hash { return crc32.NewIEEE() },
+	HashMD5:    md5.New,
+	HashSHA1:   sha1.New,
+	HashSHA256: sha256.New,
+	HashSHA512: sha512.New,
+}
+
+// Checksum returns the digest of the file p in the algorithm algo, in
+// lower case hexadecimal, as computed by the server: with HASH
+// (draft-bryan-ftpext-hash) when FEAT advertises it with algo, with XCRC,
+// XMD5, XSHA1, XSHA256 or XSHA512 otherwise. Comparing it with the digest
+// of the local file verifies a transfer end to end.
+func (c *ClientConn) Checksum(p string, algo HashAlgorithm) (string, error) {
+	newHash, ok := hashes[algo]
+	if !ok {
+		return "", fmt.Errorf("unknown hash algorithm %q", algo)
+	}
+	size := 2 * newHash().Size()
+	var msg string
+	var err error
+	if algos, ok := c.features["HASH"]; ok && hashAdvertised(algos, algo) {
+		if err := c.selectHash(algos, algo); err != nil {
+			return "", err
+		}
+		_, msg, err = c.cmd(StatusFile, "HASH %s", p)
+	} else if cmd := hashCommands[algo]; c.hasFeature(cmd) {
+		_, msg, err = c.cmd(2, "%s %s", cmd, p)
+	} else {
+		return "", fmt.Errorf("server cannot compute %s checksums", algo)
+	}
+	if err != nil {
+		return "", err
+	}
+	for _, word := range strings.Fields(msg) {
+		if len(word) == size && isHex(word) {
+			return strings.ToLower(word), nil
+		}
+	}
+	return "", fmt.Errorf("no %s digest in reply %q", algo, msg)
+}
+
+// selectHash makes algo the algorithm of HASH, given the algorithms
+// advertised in FEAT, the default marked with an asterisk.
+func (c *ClientConn) selectHash(algos string, algo HashAlgorithm) error {
+	current := c.hash
+	if current == "" {
+		for _, a := range strings.Split(algos, ";") {
+			if a = strings.TrimSpace(a); strings.HasSuffix(a, "*") {
+				current = HashAlgorithm(strings.TrimSuffix(a, "*"))
+			}
+		}
+	}
+	if strings.EqualFold(string(current), string(algo)) {
+		return nil
+	}
+	if _, _, err := c.cmd(StatusCommandOK, "OPTS HASH %s", algo); err != nil {
+		return err
+	}
+	c.hash = algo
+	return nil
+}
+
+// hashAdvertised reports whether algo is in the list of FEAT HASH, as
+// "SHA-256*;SHA-1;MD5;CRC32".
+func hashAdvertised(algos string, algo HashAlgorithm) bool {
+	for _, a := range strings.Split(algos, ";") {
+		if strings.EqualFold(strings.TrimSuffix(strings.TrimSpace(a), "*"), string(algo)) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasFeature reports whether FEAT advertises the command cmd.
+func (c *ClientConn) hasFeature(cmd string) bool {
+	_, ok := c.features[cmd]
+	return ok
+}
+
+// isHex reports whether s is made of hexadecimal digits.
+func isHex(s string) bool {
+	for _, r := range s {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') && (r < 'A' || r > 'F') {
+			return false
+		}
+	}
+	return true
+}
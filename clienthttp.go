@@ -0,0 +1,162 @@
+package ftplib
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Transport is an http.RoundTripper fetching ftp URLs, for HTTP clients to
+// reach FTP servers once registered:
+//
+//	t := &http.Transport{}
+//	t.RegisterProtocol("ftp", &ftplib.Transport{})
+//	resp, err := (&http.Client{Transport: t}).Get("ftp://ftp.example.com/pub/file.txt")
+//
+// GET retrieves the file of the URL with RETR, or lists the names in the
+// directory with NLST when the path ends with a slash; PUT stores the body
+// with STOR and DELETE deletes the file with DELE. Each request has a
+// session of its own, logged in as OpenURL logs in, and closed once the
+// response is read.
+//
+// Replies refusing the command are responses, not errors: 404 Not Found
+// and 403 Forbidden for those matching os.ErrNotExist and os.ErrPermission,
+// 502 Bad Gateway for the others, with the reply as body.
+type Transport struct {
+	// Options configure the sessions of the requests.
+	Options []DialOption
+}
+
+var _ http.RoundTripper = (*Transport)(nil)
+
+// RoundTrip runs the request req.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		defer req.Body.Close()
+	}
+	if req.URL.Scheme != "ftp" {
+		return nil, fmt.Errorf("unsupported protocol scheme %q", req.URL.Scheme)
+	}
+	c, err := dialURL(req.URL, t.Options...)
+	if err != nil {
+		return replyResponse(req, err)
+	}
+	p := req.URL.Path
+	switch req.Method {
+	case "GET", "":
+		if p == "" || strings.HasSuffix(p, "/") {
+			return c.getDir(req, p)
+		}
+		return c.getFile(req, p)
+	case "PUT":
+		var body io.Reader = http.NoBody
+		if req.Body != nil {
+			body = req.Body
+		}
+		err = c.Stor(p, body)
+		c.Quit()
+		if err != nil {
+			return replyResponse(req, err)
+		}
+		return newResponse(req, http.StatusCreated, nil, 0), nil
+	case "DELETE":
+		err = c.Delete(p)
+		c.Quit()
+		if err != nil {
+			return replyResponse(req, err)
+		}
+		return newResponse(req, http.StatusNoContent, nil, 0), nil
+	}
+	c.Quit()
+	return newResponse(req, http.StatusMethodNotAllowed, nil, 0), nil
+}
+
+// getFile responds with the file p, its length told by SIZE if the server
+// supports it.
+func (c *ClientConn) getFile(req *http.Request, p string) (*http.Response, error) {
+	length := int64(-1)
+	if size, err := c.fileSize(p); err == nil {
+		length = int64(size)
+	}
+	r, err := c.Retr(p)
+	if err != nil {
+		c.Quit()
+		return replyResponse(req, err)
+	}
+	return newResponse(req, http.StatusOK, &sessionBody{r, c}, length), nil
+}
+
+// getDir responds with the names in the directory p, one per line.
+func (c *ClientConn) getDir(req *http.Request, p string) (*http.Response, error) {
+	names, err := c.NameList(p)
+	c.Quit()
+	if err != nil {
+		return replyResponse(req, err)
+	}
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteByte('\n')
+	}
+	resp := newResponse(req, http.StatusOK, ioutil.NopCloser(strings.NewReader(b.String())), int64(b.Len()))
+	resp.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	return resp, nil
+}
+
+// sessionBody is the body of a file, closing its session with it.
+type sessionBody struct {
+	io.ReadCloser
+	c *ClientConn
+}
+
+func (b *sessionBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.c.Quit()
+	return err
+}
+
+// replyResponse responds with the reply refusing a command, or returns err
+// if it is no reply.
+func replyResponse(req *http.Request, err error) (*http.Response, error) {
+	if _, ok := replyCode(err); !ok {
+		return nil, err
+	}
+	code := http.StatusBadGateway
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		code = http.StatusNotFound
+	case errors.Is(err, os.ErrPermission):
+		code = http.StatusForbidden
+	}
+	msg := err.Error() + "\n"
+	resp := newResponse(req, code, ioutil.NopCloser(strings.NewReader(msg)), int64(len(msg)))
+	resp.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	return resp, nil
+}
+
+// newResponse returns the response to req of code, with body of length,
+// -1 if unknown.
+func newResponse(req *http.Request, code int, body io.ReadCloser, length int64) *http.Response {
+	if body == nil {
+		body = http.NoBody
+	}
+	resp := &http.Response{
+		Status:        strconv.Itoa(code) + " " + http.StatusText(code),
+		StatusCode:    code,
+		Proto:         "HTTP/1.0",
+		ProtoMajor:    1,
+		Header:        make(http.Header),
+		Body:          body,
+		ContentLength: length,
+		Request:       req,
+	}
+	if length >= 0 {
+		resp.Header.Set("Content-Length", strconv.FormatInt(length, 10))
+	}
+	return resp
+}
@@ -0,0 +1,70 @@
+package ftplib
+
+import (
+	"strings"
+)
+
+// Site sends the SITE command cmd, such as "CHMOD 644 notes.txt" or
+// "IDLE 600", and checks that the server accepted it. Quote returns the
+// reply of those whose message matters.
+func (c *ClientConn) Site(cmd string) error {
+	_, _, err := c.cmd(2, "SITE %s", cmd)
+	return err
+}
+
+// SiteCommands returns the SITE commands the server lists in reply to
+// SITE HELP, those it marks as unimplemented left out.
+func (c *ClientConn) SiteCommands() ([]string, error) {
+	_, msg, err := c.cmd(2, "SITE HELP")
+	if err != nil {
+		return nil, err
+	}
+	return parseSiteHelp(msg), nil
+}
+
+// parseSiteHelp extracts the commands of a SITE HELP reply. Multiline
+// replies list them on their indented lines, between a header and a
+// trailer, as in:
+//
+//	214-The following SITE commands are recognized (* =>'s unimplemented).
+//	   UMASK           IDLE            CHMOD           HELP
+//	   GROUP*
+//	214 Direct comments to ftp@example.com.
+//
+// Single-line replies list them all, as "214 CHMOD UMASK HELP".
+func parseSiteHelp(msg string) []string {
+	lines := strings.Split(msg, "\n")
+	var indented []string
+	for _, line := range lines {
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			indented = append(indented, line)
+		}
+	}
+	if len(indented) > 0 {
+		lines = indented
+	}
+	var commands []string
+	for _, line := range lines {
+		for _, word := range strings.Fields(line) {
+			if isSiteCommand(word) {
+				commands = append(commands, word)
+			}
+		}
+	}
+	return commands
+}
+
+// isSiteCommand reports whether word names an implemented SITE command:
+// it is in capitals, without the trailing asterisk of the unimplemented
+// ones.
+func isSiteCommand(word string) bool {
+	if len(word) < 2 || word == "SITE" {
+		return false
+	}
+	for _, r := range word {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '_' && r != '-' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,73 @@
+package ftplib
+
+import (
+	"context"
+)
+
+// WithTracer records a span of each operation of the client with t, as
+// the Tracer of a Server does of its commands: "FTP LOGIN", "FTP LIST",
+// "FTP MLSD", "FTP NLST", "FTP RETR", "FTP STOR", "FTP APPE", "FTP STOU",
+// "FTP DELE", "FTP MKD" and "FTP RMD". They have the address of the server
+// (AttrPeer), the path (AttrPath), the bytes transferred (AttrBytes), the
+// code of the last reply (AttrReplyCode) and the error if any (AttrError)
+// among their attributes. The spans of the Context variants of the
+// operations are children of the span of their context, if any. A download
+// is traced until closed. The otelftp module records the spans with
+// OpenTelemetry.
+func WithTracer(t Tracer) DialOption {
+	return func(c *ClientConn) {
+		c.tracer = t
+	}
+}
+
+// clientSpan is the span of an operation of a client; nil when the client
+// has no Tracer.
+type clientSpan struct {
+	c    *ClientConn
+	span Span
+}
+
+// startSpan opens the span of the operation verb on path, "" if none.
+func (c *ClientConn) startSpan(verb, path string) *clientSpan {
+	if c.tracer == nil {
+		return nil
+	}
+	ctx := context.Background()
+	if c.watch != nil {
+		ctx = c.watch.ctx
+	}
+	_, span := c.tracer.Start(ctx, "FTP "+verb)
+	span.SetAttribute(AttrVerb, verb)
+	span.SetAttribute(AttrPeer, c.addr)
+	if path != "" {
+		span.SetAttribute(AttrPath, path)
+	}
+	c.lastCode = 0
+	return &clientSpan{c, span}
+}
+
+// setAttribute records an attribute on the span.
+func (s *clientSpan) setAttribute(key string, value interface{}) {
+	if s != nil {
+		s.span.SetAttribute(key, value)
+	}
+}
+
+// end closes the span of the operation which ended with err, recording the
+// code of its last reply.
+func (s *clientSpan) end(err error) {
+	if s == nil {
+		return
+	}
+	code := s.c.lastCode
+	if c, ok := replyCode(err); ok {
+		code = c
+	}
+	if code != 0 {
+		s.span.SetAttribute(AttrReplyCode, code)
+	}
+	if err != nil {
+		s.span.SetAttribute(AttrError, err.Error())
+	}
+	s.span.End()
+}
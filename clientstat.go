@@ -0,0 +1,138 @@
+package ftplib
+
+import (
+	"errors"
+	"path"
+	"strconv"
+	"strings"
+)
+
+var (
+	errMLSTReply = errors.New("MLST reply without facts")
+	errNoMLST    = errors.New("server does not support MLST")
+)
+
+// Stat returns the entry of the file path, without listing its directory:
+// from the facts of MLST (RFC 3659) when the server advertises it, from SIZE
+// and MDTM otherwise. The fallback only finds files, and leaves the time
+// zero when the server does not support MDTM. A missing file is reported
+// with the *FTPError of the server, matching os.ErrNotExist with errors.Is.
+func (c *ClientConn) Stat(p string) (*Entry, error) {
+	if _, ok := c.features["MLST"]; ok {
+		return c.mlst(p)
+	}
+	size, err := c.fileSize(p)
+	if err != nil {
+		return nil, err
+	}
+	e := &Entry{Name: path.Base(p), Type: EntryTypeFile, Size: size}
+	if code, msg, err := c.cmd(-1, "MDTM %s", p); err != nil {
+		return nil, err
+	} else if code == StatusFile {
+		if e.Time, err = parseMLSxTime(strings.TrimSpace(msg)); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// fileSize returns the size of the file p, with SIZE.
+func (c *ClientConn) fileSize(p string) (uint64, error) {
+	_, msg, err := c.cmd(StatusFile, "SIZE %s", p)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(msg), 10, 64)
+}
+
+// mlst returns the entry of the file p from the facts of MLST, sent on the
+// control connection between the first and last lines of the reply.
+func (c *ClientConn) mlst(p string) (*Entry, error) {
+	_, msg, err := c.cmd(StatusRequestedFileActionOK, "MLST %s", p)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(msg, "\n") {
+		if !strings.HasPrefix(line, " ") {
+			continue
+		}
+		e, err := ParseMLSxLine(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		e.Name = path.Base(e.Name)
+		return e, nil
+	}
+	return nil, errMLSTReply
+}
+
+// MLSTFacts returns the MLSx facts the server sends in the listings of
+// MLSD and MLST, as selected with SetMLSTFacts or else by default according
+// to FEAT. It returns nil when the server does not advertise MLST.
+func (c *ClientConn) MLSTFacts() []string {
+	if c.facts != nil {
+		return c.facts
+	}
+	desc, ok := c.features["MLST"]
+	if !ok {
+		return nil
+	}
+	_, selected := parseFeatFacts(desc)
+	return selected
+}
+
+// SetMLSTFacts selects the MLSx facts, such as "type", "size", "modify" and
+// "perm", the server sends in the listings of MLSD and MLST, with
+// "OPTS MLST" (RFC 3659). It returns the facts the server selected, unknown
+// ones being dropped.
+func (c *ClientConn) SetMLSTFacts(facts ...string) ([]string, error) {
+	desc, ok := c.features["MLST"]
+	if !ok {
+		return nil, errNoMLST
+	}
+	var list string
+	for _, fact := range facts {
+		list += fact + ";"
+	}
+	_, msg, err := c.cmd(StatusCommandOK, "OPTS MLST %s", list)
+	if err != nil {
+		return nil, err
+	}
+	// The reply is "MLST OPTS type;size;", but some servers omit the list:
+	// the requested facts they advertise are taken as selected then.
+	selected := []string{}
+	if fields := strings.Fields(msg); len(fields) >= 2 && strings.EqualFold(fields[0], "MLST") && strings.EqualFold(fields[1], "OPTS") {
+		if len(fields) > 2 {
+			selected, _ = parseFeatFacts(fields[2])
+		}
+	} else {
+		known, _ := parseFeatFacts(desc)
+		for _, fact := range facts {
+			for _, name := range known {
+				if strings.EqualFold(fact, name) {
+					selected = append(selected, name)
+					break
+				}
+			}
+		}
+	}
+	c.facts = selected
+	return selected, nil
+}
+
+// parseFeatFacts parses the facts of MLST in FEAT, "type*;size*;perm;",
+// returning them all and those selected, marked with an asterisk.
+func parseFeatFacts(desc string) (all, selected []string) {
+	all, selected = []string{}, []string{}
+	for _, fact := range strings.Split(desc, ";") {
+		if fact = strings.TrimSpace(fact); fact == "" {
+			continue
+		}
+		if strings.HasSuffix(fact, "*") {
+			fact = strings.TrimSuffix(fact, "*")
+			selected = append(selected, fact)
+		}
+		all = append(all, fact)
+	}
+	return all, selected
+}
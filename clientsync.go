@@ -0,0 +1,381 @@
+package ftplib
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SyncDirection is the way Sync copies the files.
+type SyncDirection int
+
+const (
+	// Push makes the remote tree a mirror of the local one.
+	Push SyncDirection = iota
+	// Pull makes the local tree a mirror of the remote one.
+	Pull
+)
+
+// SyncOptions configures Sync.
+type SyncOptions struct {
+	Direction SyncDirection
+	// Delete removes the files and directories of the destination that
+	// the source lacks.
+	Delete bool
+	// Hash, if set, compares the files of equal size by their digests in
+	// this algorithm, the remote ones from Checksum, rather than by their
+	// modification times.
+	Hash HashAlgorithm
+	// Parallelism is the number of files copied at once, each on a session
+	// of its own; DefaultUploadParallelism if zero.
+	Parallelism int
+	// Filter selects the files taking part in the mirror, on both sides:
+	// those it leaves out are neither copied nor deleted.
+	Filter PathFilter
+	// Report, if set, is called with each operation before it runs, one
+	// at a time.
+	Report func(op Operation)
+	// DryRun reports the operations without running them, leaving both
+	// trees alone.
+	DryRun bool
+}
+
+// Operation is a change to a tree, which Sync and RemoveDirRecur report.
+type Operation struct {
+	Verb string // "mkdir", "upload", "download" or "delete"
+	Path string // relative to the root of Sync, on the server for RemoveDirRecur
+	Dir  bool   // whether Path is a directory
+}
+
+// Sync mirrors the local directory to the remote one, or the remote to the
+// local as opts.Direction sets, copying only the files the destination
+// lacks or holds otherwise: of another size, or modified before the one of
+// the source, to the minute as listings tell the time at best. The
+// downloaded files get the modification time of the remote ones, for the
+// next Sync to find them equal. The missing directories are made first,
+// then the files copied, on several sessions at once as UploadDir does,
+// then the extraneous files deleted if opts.Delete is set. The first error
+// stops the mirror.
+func (c *ClientConn) Sync(local, remote string, opts SyncOptions) error {
+	if opts.Parallelism == 0 {
+		opts.Parallelism = DefaultUploadParallelism
+	}
+	if err := opts.Filter.validate(); err != nil {
+		return err
+	}
+	// The other sessions start in the login directory, not in the current
+	// one of c.
+	cwd, err := c.CurrentDir()
+	if err != nil {
+		return err
+	}
+	if !path.IsAbs(remote) {
+		remote = path.Join(cwd, remote)
+	}
+	push := opts.Direction == Push
+
+	remoteTree, err := c.remoteSyncTree(remote, push, &opts.Filter)
+	if err != nil {
+		return err
+	}
+	if !push && !opts.DryRun {
+		if err := os.MkdirAll(local, 0755); err != nil {
+			return err
+		}
+	}
+	localTree, err := localSyncTree(local, &opts.Filter)
+	if err != nil && !(opts.DryRun && !push && os.IsNotExist(err)) {
+		return err
+	}
+	s := &syncer{c: c, local: local, remote: remote, push: push, opts: opts}
+	src, dst := remoteTree, localTree
+	if push {
+		src, dst = localTree, remoteTree
+	}
+	ops, err := s.plan(src, dst)
+	if err != nil {
+		return err
+	}
+	if opts.DryRun {
+		for _, op := range ops {
+			s.report(op)
+		}
+		return nil
+	}
+	return s.run(ops, cwd)
+}
+
+// syncFile is what Sync compares of a file or directory.
+type syncFile struct {
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+// syncTree holds the files and directories of a side of Sync, by their
+// slash-separated path relative to its root.
+type syncTree map[string]syncFile
+
+// sortedPaths returns the paths of t, parents before their children.
+func (t syncTree) sortedPaths() []string {
+	paths := make([]string, 0, len(t))
+	for rel := range t {
+		paths = append(paths, rel)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// localSyncTree returns the tree under dir, as filter selects it.
+func localSyncTree(dir string, filter *PathFilter) (syncTree, error) {
+	t := make(syncTree)
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		switch {
+		case info.IsDir():
+			if filter.Excluded(rel) {
+				return filepath.SkipDir
+			}
+			t[rel] = syncFile{dir: true}
+		case info.Mode().IsRegular() && filter.Selected(rel):
+			t[rel] = syncFile{size: info.Size(), modTime: info.ModTime()}
+		}
+		return nil
+	})
+	return t, err
+}
+
+// remoteSyncTree returns the tree under dir, as filter selects it, empty
+// if dir is missing and made by the mirror, as when pushing.
+func (c *ClientConn) remoteSyncTree(dir string, made bool, filter *PathFilter) (syncTree, error) {
+	t := make(syncTree)
+	err := c.WalkFiltered(dir, *filter, func(p string, entry *Entry, err error) error {
+		if err != nil {
+			if p == dir && made && errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return fmt.Errorf("%s: %v", p, err)
+		}
+		rel := relPath(dir, p)
+		switch entry.Type {
+		case EntryTypeFolder:
+			t[rel] = syncFile{dir: true}
+		case EntryTypeFile:
+			t[rel] = syncFile{size: int64(entry.Size), modTime: entry.Time}
+		}
+		return nil
+	})
+	return t, err
+}
+
+// syncOp is an operation of Sync.
+type syncOp struct {
+	Operation
+	modTime time.Time // of the source file
+}
+
+// syncer runs a Sync.
+type syncer struct {
+	c             *ClientConn
+	local, remote string
+	push          bool
+	opts          SyncOptions
+
+	mu sync.Mutex // serializing the reports of the copies
+}
+
+// plan returns the operations making dst a mirror of src: the directories
+// to make, the files to copy, then the extraneous files to delete.
+func (s *syncer) plan(src, dst syncTree) ([]syncOp, error) {
+	var dirs, copies, deletes []syncOp
+	copyVerb := "download"
+	if s.push {
+		copyVerb = "upload"
+	}
+	for _, rel := range src.sortedPaths() {
+		f := src[rel]
+		g, exists := dst[rel]
+		if f.dir {
+			if !exists {
+				dirs = append(dirs, syncOp{Operation: Operation{Verb: "mkdir", Path: rel, Dir: true}})
+			}
+			continue
+		}
+		differ := !exists || g.dir || f.size != g.size
+		if !differ && s.opts.Hash != "" {
+			var err error
+			if differ, err = s.digestsDiffer(rel); err != nil {
+				return nil, err
+			}
+		} else if !differ {
+			differ = newer(f.modTime, g.modTime)
+		}
+		if differ {
+			copies = append(copies, syncOp{Operation{Verb: copyVerb, Path: rel}, f.modTime})
+		}
+	}
+	if s.opts.Delete {
+		paths := dst.sortedPaths()
+		// Children go before their parents.
+		for i := len(paths) - 1; i >= 0; i-- {
+			if _, ok := src[paths[i]]; !ok {
+				deletes = append(deletes, syncOp{Operation: Operation{Verb: "delete", Path: paths[i], Dir: dst[paths[i]].dir}})
+			}
+		}
+	}
+	return append(append(dirs, copies...), deletes...), nil
+}
+
+// newer reports whether t is after u by a minute or more, listings giving
+// the time to the minute at best.
+func newer(t, u time.Time) bool {
+	return t.Truncate(time.Minute).After(u.Truncate(time.Minute))
+}
+
+// digestsDiffer reports whether the local and remote files rel differ by
+// their digests.
+func (s *syncer) digestsDiffer(rel string) (bool, error) {
+	newHash, ok := hashes[s.opts.Hash]
+	if !ok {
+		return false, fmt.Errorf("unknown hash algorithm %q", s.opts.Hash)
+	}
+	f, err := os.Open(s.localPath(rel))
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	h := newHash()
+	if _, err := io.Copy(h, f); err != nil {
+		return false, err
+	}
+	digest, err := s.c.Checksum(s.remotePath(rel), s.opts.Hash)
+	if err != nil {
+		return false, err
+	}
+	return digest != hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (s *syncer) localPath(rel string) string {
+	return filepath.Join(s.local, filepath.FromSlash(rel))
+}
+
+func (s *syncer) remotePath(rel string) string {
+	return path.Join(s.remote, rel)
+}
+
+// run runs ops: the copies on up to opts.Parallelism sessions, the others
+// on the session of the client, which it leaves in cwd.
+func (s *syncer) run(ops []syncOp, cwd string) error {
+	var dirs []string
+	var copies []syncOp
+	for _, op := range ops {
+		switch op.Verb {
+		case "mkdir":
+			s.report(op)
+			dirs = append(dirs, op.Path)
+		case "upload", "download":
+			copies = append(copies, op)
+		}
+	}
+	if s.push {
+		if err := s.c.makeDirs(s.remote, dirs, cwd); err != nil {
+			return err
+		}
+	} else {
+		for _, rel := range dirs {
+			if err := os.Mkdir(s.localPath(rel), 0755); err != nil {
+				return err
+			}
+		}
+	}
+	err := s.c.runParallel("Sync", s.opts.Parallelism, len(copies), func(c *ClientConn, i int) error {
+		op := copies[i]
+		s.report(op)
+		if err := s.copy(c, op); err != nil {
+			return fmt.Errorf("%s %s: %v", op.Verb, op.Path, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, op := range ops {
+		if op.Verb == "delete" {
+			s.report(op)
+			if err := s.remove(op); err != nil {
+				return fmt.Errorf("delete %s: %v", op.Path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// report passes op to opts.Report.
+func (s *syncer) report(op syncOp) {
+	if s.opts.Report != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.opts.Report(op.Operation)
+	}
+}
+
+// copy runs the copy op on the session c.
+func (s *syncer) copy(c *ClientConn, op syncOp) error {
+	localPath := s.localPath(op.Path)
+	if s.push {
+		f, err := os.Open(localPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return c.Stor(s.remotePath(op.Path), f)
+	}
+	r, err := c.Retr(s.remotePath(op.Path))
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(localPath)
+	if err != nil {
+		r.Close()
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if err2 := r.Close(); err == nil {
+		err = err2
+	}
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		return err
+	}
+	if t := op.modTime; !t.IsZero() {
+		return os.Chtimes(localPath, t, t)
+	}
+	return nil
+}
+
+// remove deletes the extraneous file or directory of op.
+func (s *syncer) remove(op syncOp) error {
+	if !s.push {
+		return os.Remove(s.localPath(op.Path))
+	}
+	if op.Dir {
+		return s.c.RemoveDir(s.remotePath(op.Path))
+	}
+	return s.c.Delete(s.remotePath(op.Path))
+}
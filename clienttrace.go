@@ -0,0 +1,90 @@
+package ftplib
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/textproto"
+	"sync"
+)
+
+// WithTrace writes the commands of the session and the replies of the
+// server to w, as they cross the control connection, for debugging: the
+// commands prefixed with "> ", the replies with "< ", a line each. The
+// argument of PASS is hidden. The sessions UploadDir, Download and Sync
+// open alongside trace to w too, their lines interleaved.
+func WithTrace(w io.Writer) DialOption {
+	return func(c *ClientConn) {
+		c.trace = &traceWriter{w: w}
+	}
+}
+
+// traceWriter serializes the lines of the traces sharing w.
+type traceWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *traceWriter) writeLine(line string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	io.WriteString(w.w, line)
+}
+
+// textConn returns the control connection over conn, traced if set.
+func (c *ClientConn) textConn(conn net.Conn) *textproto.Conn {
+	if c.trace == nil {
+		return textproto.NewConn(conn)
+	}
+	return textproto.NewConn(&tracedConn{conn, &protocolTrace{out: c.trace}})
+}
+
+// protocolTrace traces the lines of a control connection to out.
+type protocolTrace struct {
+	out *traceWriter
+
+	mu       sync.Mutex
+	sent     []byte // a line being written, up to its end
+	received []byte // a line being read, up to its end
+}
+
+// write traces the bytes p, sent if sent or else received.
+func (t *protocolTrace) write(p []byte, sent bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	buf, prefix := &t.received, "< "
+	if sent {
+		buf, prefix = &t.sent, "> "
+	}
+	*buf = append(*buf, p...)
+	for {
+		i := bytes.IndexByte(*buf, '\n')
+		if i < 0 {
+			return
+		}
+		line := bytes.TrimRight((*buf)[:i], "\r")
+		if sent && len(line) > 5 && bytes.EqualFold(line[:5], []byte("PASS ")) {
+			line = []byte("PASS ****")
+		}
+		t.out.writeLine(prefix + string(line) + "\n")
+		*buf = (*buf)[i+1:]
+	}
+}
+
+// tracedConn is a control connection traced to t.
+type tracedConn struct {
+	net.Conn
+	t *protocolTrace
+}
+
+func (c *tracedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.t.write(b[:n], false)
+	return n, err
+}
+
+func (c *tracedConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.t.write(b[:n], true)
+	return n, err
+}
@@ -0,0 +1,189 @@
+package ftplib
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+)
+
+// DefaultUploadParallelism is the number of files UploadDir uploads at
+// once, unless set with WithParallelism.
+const DefaultUploadParallelism = 4
+
+// UploadOption configures UploadDir.
+type UploadOption func(o *uploadOptions)
+
+type uploadOptions struct {
+	parallelism int
+	filter      PathFilter
+}
+
+// WithParallelism uploads up to n files at once, each on a session of its
+// own; 1 uploads them one after the other on the session of the client.
+func WithParallelism(n int) UploadOption {
+	return func(o *uploadOptions) {
+		o.parallelism = n
+	}
+}
+
+// WithFilter uploads only the files filter keeps, by their paths relative
+// to the local directory, and skips the directories it excludes.
+func WithFilter(filter PathFilter) UploadOption {
+	return func(o *uploadOptions) {
+		o.filter = filter
+	}
+}
+
+// UploadDir uploads the tree of the local directory to the remote one,
+// making the directories missing on the server with MKD. The files are
+// uploaded on several sessions at once, opened and logged in as the client;
+// when the server refuses more sessions, on those it let open. The first
+// error stops the upload.
+func (c *ClientConn) UploadDir(local, remote string, opts ...UploadOption) error {
+	o := uploadOptions{parallelism: DefaultUploadParallelism}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := o.filter.validate(); err != nil {
+		return err
+	}
+
+	var dirs, files []string
+	err := filepath.Walk(local, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(local, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if info.IsDir() {
+			if o.filter.Excluded(rel) {
+				return filepath.SkipDir
+			}
+			dirs = append(dirs, rel)
+		} else if info.Mode().IsRegular() && o.filter.Selected(rel) {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The other sessions start in the login directory, not in the current
+	// one of c.
+	cwd, err := c.CurrentDir()
+	if err != nil {
+		return err
+	}
+	if !path.IsAbs(remote) {
+		remote = path.Join(cwd, remote)
+	}
+	if err := c.makeDirs(remote, dirs, cwd); err != nil {
+		return err
+	}
+	return c.uploadFiles(local, remote, files, o.parallelism)
+}
+
+// makeDirs makes the directory remote with its parents, then its
+// subdirectories dirs, unless they exist. It finds the existing ones by
+// changing to them, and returns to cwd.
+func (c *ClientConn) makeDirs(remote string, dirs []string, cwd string) error {
+	var all []string
+	for i := 1; i <= len(remote); i++ {
+		if i == len(remote) || remote[i] == '/' {
+			all = append(all, remote[:i])
+		}
+	}
+	for _, dir := range dirs {
+		all = append(all, path.Join(remote, dir))
+	}
+	changed := false
+	for _, dir := range all {
+		if err := c.MakeDir(dir); err != nil {
+			if c.ChangeDir(dir) != nil {
+				return fmt.Errorf("%s: %v", dir, err)
+			}
+			changed = true
+		}
+	}
+	if changed {
+		return c.ChangeDir(cwd)
+	}
+	return nil
+}
+
+// uploadFiles uploads the files under local to remote, with up to
+// parallelism sessions, c serving the first.
+func (c *ClientConn) uploadFiles(local, remote string, files []string, parallelism int) error {
+	return c.runParallel("Upload", parallelism, len(files), func(s *ClientConn, i int) error {
+		rel := files[i]
+		return s.uploadFile(filepath.Join(local, filepath.FromSlash(rel)), path.Join(remote, rel))
+	})
+}
+
+// runParallel runs the jobs 0 to n-1 on up to parallelism sessions, c
+// serving the first, as many as the server lets open. The first error
+// stops them.
+func (c *ClientConn) runParallel(what string, parallelism, n int, job func(s *ClientConn, i int) error) error {
+	if parallelism > n {
+		parallelism = n
+	}
+	sessions := []*ClientConn{c}
+	for len(sessions) < parallelism {
+		s, err := c.session()
+		if err != nil {
+			c.logf("%s session: %v", what, err)
+			break
+		}
+		defer s.Quit()
+		sessions = append(sessions, s)
+	}
+
+	queue := make(chan int)
+	errs := make(chan error, len(sessions))
+	var wg sync.WaitGroup
+	for _, s := range sessions {
+		wg.Add(1)
+		go func(s *ClientConn) {
+			defer wg.Done()
+			for i := range queue {
+				if err := job(s, i); err != nil {
+					errs <- err
+					// Drain the queue, for the other sessions to stop.
+					for range queue {
+					}
+					return
+				}
+			}
+		}(s)
+	}
+	for i := 0; i < n; i++ {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return nil
+	}
+}
+
+// uploadFile stores the local file name at p.
+func (c *ClientConn) uploadFile(name, p string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := c.Stor(p, f); err != nil {
+		return fmt.Errorf("%s: %v", p, err)
+	}
+	return nil
+}
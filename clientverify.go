@@ -0,0 +1,93 @@
+package ftplib
+
+import (
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"strconv"
+)
+
+// UploadVerification selects the checks of the files uploaded in binary
+// with Stor, StorFrom and StorAs, once the server has stored them.
+type UploadVerification struct {
+	// Size compares the size of the file, with SIZE, with the bytes sent.
+	Size bool
+	// Hash, if set, compares the digest of the file in this algorithm, as
+	// Checksum returns it, with that of the bytes sent. Resumed uploads
+	// are only checked for size.
+	Hash HashAlgorithm
+}
+
+// VerifyError reports an upload the server stored otherwise than sent.
+type VerifyError struct {
+	Path   string
+	Check  string // "size", or the hash algorithm
+	Sent   string
+	Stored string
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("%s: %s %s stored, %s sent", e.Path, e.Check, e.Stored, e.Sent)
+}
+
+// SetUploadVerification checks the uploads as v selects; the zero
+// UploadVerification checks nothing.
+func (c *ClientConn) SetUploadVerification(v UploadVerification) {
+	c.verify = v
+}
+
+// WithUploadVerification dials a ClientConn checking its uploads, as
+// SetUploadVerification.
+func WithUploadVerification(v UploadVerification) DialOption {
+	return func(c *ClientConn) {
+		c.verify = v
+	}
+}
+
+// uploadCheck verifies an upload once stored.
+type uploadCheck struct {
+	c      *ClientConn
+	path   string
+	offset uint64
+	hash   hash.Hash
+}
+
+// checkUpload returns the check of the upload of r to path from offset,
+// and the reader to upload, or a nil check if there is nothing to check.
+func (c *ClientConn) checkUpload(path string, r io.Reader, offset uint64) (*uploadCheck, io.Reader) {
+	if !c.verify.Size && c.verify.Hash == "" {
+		return nil, r
+	}
+	check := &uploadCheck{c: c, path: path, offset: offset}
+	if newHash, ok := hashes[c.verify.Hash]; ok && offset == 0 {
+		check.hash = newHash()
+		r = io.TeeReader(r, check.hash)
+	}
+	return check, r
+}
+
+// verify compares the file stored by the server with the n bytes sent.
+func (check *uploadCheck) verify(n uint64) error {
+	c := check.c
+	if c.verify.Size {
+		size, err := c.fileSize(check.path)
+		if err != nil {
+			return err
+		}
+		if sent := check.offset + n; size != sent {
+			return &VerifyError{Path: check.path, Check: "size",
+				Sent: strconv.FormatUint(sent, 10), Stored: strconv.FormatUint(size, 10)}
+		}
+	}
+	if check.hash != nil {
+		digest, err := c.Checksum(check.path, c.verify.Hash)
+		if err != nil {
+			return err
+		}
+		if sent := hex.EncodeToString(check.hash.Sum(nil)); digest != sent {
+			return &VerifyError{Path: check.path, Check: string(c.verify.Hash), Sent: sent, Stored: digest}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package ftplib
+
+import (
+	"path"
+	"path/filepath"
+	"sort"
+)
+
+// WalkFunc is the function Walk calls for each entry of a tree, with its
+// path, the root joined with the names leading to it. When a directory
+// cannot be listed, it is called again for the directory, with a nil entry
+// and the error, and returning nil goes on with the rest of the tree.
+type WalkFunc func(path string, entry *Entry, err error) error
+
+// SkipDir, returned by a WalkFunc for a directory, skips its contents, and
+// for a file, the rest of its directory. It is filepath.SkipDir, so either
+// will do.
+var SkipDir = filepath.SkipDir
+
+// Walk calls fn for each entry of the tree under root, root excluded,
+// directory by directory in lexical order, as filepath.Walk does. The
+// directories are listed with ListMLSD. Symbolic links are passed to fn but
+// not followed; directories the server lists within themselves, as when it
+// resolves links, are not walked again if it identifies them with the
+// unique fact of MLSD.
+func (c *ClientConn) Walk(root string, fn WalkFunc) error {
+	err := c.walk(root, fn, make(map[string]bool))
+	if err == SkipDir {
+		return nil
+	}
+	return err
+}
+
+// WalkFiltered is Walk calling fn only for the entries filter keeps, by
+// their paths relative to root: the directories it excludes are skipped
+// with their trees, and the files it does not select left out.
+func (c *ClientConn) WalkFiltered(root string, filter PathFilter, fn WalkFunc) error {
+	if err := filter.validate(); err != nil {
+		return err
+	}
+	return c.Walk(root, func(p string, entry *Entry, err error) error {
+		if err != nil {
+			return fn(p, entry, err)
+		}
+		rel := relPath(root, p)
+		if entry.Type == EntryTypeFolder {
+			if filter.Excluded(rel) {
+				return SkipDir
+			}
+		} else if !filter.Selected(rel) {
+			return nil
+		}
+		return fn(p, entry, nil)
+	})
+}
+
+// relPath returns the path p, of the tree walked from root, relative to
+// root.
+func relPath(root, p string) string {
+	switch root = path.Clean(root); root {
+	case ".":
+		return p
+	case "/":
+		return p[1:]
+	}
+	return p[len(root)+1:]
+}
+
+// walk walks the directory dir, under the directories of unique facts
+// parents.
+func (c *ClientConn) walk(dir string, fn WalkFunc, parents map[string]bool) error {
+	entries, err := c.ListMLSD(dir)
+	if err != nil {
+		return fn(dir, nil, err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	for _, entry := range entries {
+		if entry.Name == "." || entry.Name == ".." {
+			continue
+		}
+		p := path.Join(dir, entry.Name)
+		if err := fn(p, entry, nil); err == SkipDir && entry.Type == EntryTypeFolder {
+			continue
+		} else if err == SkipDir {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if entry.Type != EntryTypeFolder || entry.Unique != "" && parents[entry.Unique] {
+			continue
+		}
+		if entry.Unique != "" {
+			parents[entry.Unique] = true
+		}
+		err := c.walk(p, fn, parents)
+		delete(parents, entry.Unique)
+		if err != nil && err != SkipDir {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveOption configures RemoveDirRecur.
+type RemoveOption func(o *removeOptions)
+
+type removeOptions struct {
+	report func(op Operation)
+	dryRun bool
+}
+
+// WithReport calls report with each deletion before it runs.
+func WithReport(report func(op Operation)) RemoveOption {
+	return func(o *removeOptions) {
+		o.report = report
+	}
+}
+
+// WithDryRun lists the tree and reports the deletions, to the function of
+// WithReport, without running them.
+func WithDryRun() RemoveOption {
+	return func(o *removeOptions) {
+		o.dryRun = true
+	}
+}
+
+// RemoveDirRecur removes the directory dir with its tree, as RMD only
+// removes empty directories: the files of each directory are deleted,
+// then its subdirectories removed, children before parents. Symbolic links
+// are deleted, not followed.
+func (c *ClientConn) RemoveDirRecur(dir string, opts ...RemoveOption) error {
+	var o removeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return c.removeDirRecur(dir, &o)
+}
+
+func (c *ClientConn) removeDirRecur(dir string, o *removeOptions) error {
+	entries, err := c.ListMLSD(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Name == "." || entry.Name == ".." {
+			continue
+		}
+		p := path.Join(dir, entry.Name)
+		if entry.Type == EntryTypeFolder {
+			err = c.removeDirRecur(p, o)
+		} else {
+			err = o.remove(p, false, c.Delete)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return o.remove(dir, true, c.RemoveDir)
+}
+
+// remove reports the deletion of p, then runs it with del unless
+// dry-running.
+func (o *removeOptions) remove(p string, dir bool, del func(p string) error) error {
+	if o.report != nil {
+		o.report(Operation{Verb: "delete", Path: p, Dir: dir})
+	}
+	if o.dryRun {
+		return nil
+	}
+	return del(p)
+}
@@ -0,0 +1,100 @@
+// Command ftp is an interactive FTP client.
+//
+// Usage:
+//
+//	ftp [host[:port]]
+//	ftp [-o file] ftp://[user[:password]@]host[:port]/path
+//
+// Given a URL, ftp downloads the file it names, or lists the directory when
+// the path ends with "/", and exits. Otherwise it reads commands such as
+// open, ls, cd, get, put, mget and mput from its input; "help" lists them.
+//
+// The credentials a URL lacks come from ~/.netrc, else ftp logs in as
+// anonymous; open logs in with those of ~/.netrc too, if it has the host.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/cxfans/ftplib"
+)
+
+func main() {
+	output := flag.String("o", "", "`file` the URL is saved to, \"-\" for standard output (default its name)")
+	quiet := flag.Bool("q", false, "do not show the progress of transfers")
+	flag.Parse()
+
+	sh := newShell(os.Stdin, os.Stdout)
+	sh.interactive = isTerminal(os.Stdin)
+	if !*quiet && isTerminal(os.Stderr) {
+		sh.progress = os.Stderr
+	}
+	arg := flag.Arg(0)
+	if strings.Contains(arg, "://") {
+		if err := fetch(sh, arg, *output); err != nil {
+			fmt.Fprintln(os.Stderr, "ftp:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if arg != "" {
+		sh.exec("open " + strings.Join(flag.Args(), " "))
+	}
+	sh.loop()
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// fetch downloads the file named by rawurl to output, or lists the
+// directory it names.
+func fetch(sh *shell, rawurl, output string) error {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "ftp" {
+		return fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "21")
+	}
+	var user, password string
+	hasPassword := false
+	if u.User != nil {
+		user = u.User.Username()
+		password, hasPassword = u.User.Password()
+	}
+	if !hasPassword {
+		if login, p, ok := ftplib.NetrcCredentials(u.Hostname(), user); ok {
+			user, password = login, p
+		} else if user == "" {
+			user, password = "anonymous", "anonymous"
+		}
+	}
+	if err := sh.open(addr); err != nil {
+		return err
+	}
+	defer sh.close()
+	if err := sh.conn.Login(user, password); err != nil {
+		return err
+	}
+	p := u.Path
+	if p == "" || strings.HasSuffix(p, "/") {
+		return sh.list([]string{p})
+	}
+	if output == "" {
+		output = path.Base(p)
+	}
+	return sh.get(p, output)
+}
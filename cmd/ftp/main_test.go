@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cxfans/ftplib"
+)
+
+// go test -run TestFetch
+func TestFetch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "pub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "pub", "f.txt"), []byte("fetched"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	server, err := ftplib.NewServer("127.0.0.1:0", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	go server.ListenAndServe()
+	base := "ftp://user:secret@" + server.Addr().String()
+
+	output := filepath.Join(dir, "out.txt")
+	if err := fetch(newShell(nil, ioutil.Discard), base+"/pub/f.txt", output); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ioutil.ReadFile(output); err != nil || string(got) != "fetched" {
+		t.Errorf("fetched %q (%v)", got, err)
+	}
+
+	var listing bytes.Buffer
+	if err := fetch(newShell(nil, &listing), base+"/pub/", ""); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(listing.String(), "f.txt") {
+		t.Errorf("listing %q lacks f.txt", listing.String())
+	}
+	if err := fetch(newShell(nil, ioutil.Discard), "http://example.com/", ""); err == nil {
+		t.Error("http URL fetched")
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// progress shows the progress of a transfer, counting the bytes written to
+// it.
+type progress struct {
+	w          io.Writer // nil hides the progress
+	name       string
+	total      int64 // size of the transfer, or -1 if unknown
+	done       int64
+	start      time.Time
+	lastUpdate time.Time
+}
+
+func (sh *shell) newProgress(name string, total int64) *progress {
+	return &progress{w: sh.progress, name: name, total: total, start: time.Now()}
+}
+
+func (p *progress) Write(b []byte) (int, error) {
+	p.done += int64(len(b))
+	if p.w != nil && time.Since(p.lastUpdate) > 200*time.Millisecond {
+		p.lastUpdate = time.Now()
+		p.print()
+	}
+	return len(b), nil
+}
+
+// finish shows the final state of the transfer.
+func (p *progress) finish() {
+	if p.w == nil {
+		return
+	}
+	p.print()
+	fmt.Fprintln(p.w)
+}
+
+func (p *progress) print() {
+	rate := float64(p.done) / time.Since(p.start).Seconds()
+	percent := "    "
+	if p.total > 0 {
+		percent = fmt.Sprintf("%3d%%", p.done*100/p.total)
+	}
+	fmt.Fprintf(p.w, "\r%-32s %s %10s %10s/s", p.name, percent, byteSize(float64(p.done)), byteSize(rate))
+}
+
+// byteSize formats n bytes with a binary unit.
+func byteSize(n float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	i := 0
+	for ; n >= 1024 && i < len(units)-1; i++ {
+		n /= 1024
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f %s", n, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cxfans/ftplib"
+)
+
+// shell runs the commands of an interactive session.
+type shell struct {
+	conn        *ftplib.ClientConn
+	in          *bufio.Scanner
+	out         io.Writer
+	progress    io.Writer // where transfers show their progress, if set
+	interactive bool      // whether to prompt for commands and credentials
+	quit        bool
+}
+
+// command is a command of the shell.
+type command struct {
+	usage     string
+	help      string
+	connected bool // whether the command needs a connection
+	run       func(sh *shell, args []string) error
+}
+
+var (
+	commands = map[string]*command{}
+	aliases  = map[string]string{"bye": "quit", "exit": "quit", "dir": "ls", "rm": "delete"}
+
+	errNotConnected = errors.New("not connected")
+)
+
+func init() {
+	for name, cmd := range map[string]*command{
+		"open":   {"open host[:port]", "connect to a server", false, (*shell).cmdOpen},
+		"user":   {"user name [password]", "log in", true, (*shell).cmdUser},
+		"close":  {"close", "disconnect from the server", true, (*shell).cmdClose},
+		"quit":   {"quit", "disconnect and exit", false, (*shell).cmdQuit},
+		"help":   {"help [command]", "describe the commands", false, (*shell).cmdHelp},
+		"ls":     {"ls [path]", "list a directory", true, (*shell).list},
+		"nlist":  {"nlist [path]", "list the names in a directory", true, (*shell).cmdNlist},
+		"cd":     {"cd path", "change the remote directory", true, (*shell).cmdCd},
+		"cdup":   {"cdup", "change to the parent remote directory", true, (*shell).cmdCdup},
+		"pwd":    {"pwd", "print the remote directory", true, (*shell).cmdPwd},
+		"lcd":    {"lcd path", "change the local directory", false, (*shell).cmdLcd},
+		"get":    {"get remote [local]", "download a file", true, (*shell).cmdGet},
+		"put":    {"put local [remote]", "upload a file", true, (*shell).cmdPut},
+		"mget":   {"mget pattern...", "download the files matching the patterns", true, (*shell).cmdMget},
+		"mput":   {"mput pattern...", "upload the files matching the patterns", true, (*shell).cmdMput},
+		"delete": {"delete path", "delete a remote file", true, (*shell).cmdDelete},
+		"mkdir":  {"mkdir path", "make a remote directory", true, (*shell).cmdMkdir},
+		"rmdir":  {"rmdir path", "remove a remote directory", true, (*shell).cmdRmdir},
+		"rename": {"rename from to", "rename a remote file", true, (*shell).cmdRename},
+	} {
+		commands[name] = cmd
+	}
+}
+
+func newShell(in io.Reader, out io.Writer) *shell {
+	return &shell{in: bufio.NewScanner(in), out: out}
+}
+
+// loop runs the commands read until the end of the input, or quit.
+func (sh *shell) loop() {
+	for !sh.quit {
+		if sh.interactive {
+			fmt.Fprint(sh.out, "ftp> ")
+		}
+		if !sh.in.Scan() {
+			break
+		}
+		sh.exec(sh.in.Text())
+	}
+	sh.close()
+}
+
+// exec runs the command line, reporting its failure.
+func (sh *shell) exec(line string) {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return
+	}
+	name := strings.ToLower(args[0])
+	if alias, ok := aliases[name]; ok {
+		name = alias
+	}
+	cmd, ok := commands[name]
+	var err error
+	switch {
+	case !ok:
+		err = fmt.Errorf("unknown command %q, try help", args[0])
+	case cmd.connected && sh.conn == nil:
+		err = errNotConnected
+	default:
+		err = cmd.run(sh, args[1:])
+	}
+	if err != nil {
+		fmt.Fprintln(sh.out, "ftp:", err)
+	}
+}
+
+// ask prompts for a line of input.
+func (sh *shell) ask(prompt string) string {
+	fmt.Fprint(sh.out, prompt)
+	if !sh.in.Scan() {
+		return ""
+	}
+	return strings.TrimSpace(sh.in.Text())
+}
+
+func (sh *shell) open(addr string) error {
+	sh.close()
+	conn, err := ftplib.Dial(addr)
+	if err != nil {
+		return err
+	}
+	sh.conn = conn
+	return nil
+}
+
+func (sh *shell) close() {
+	if sh.conn != nil {
+		sh.conn.Quit()
+		sh.conn = nil
+	}
+}
+
+func (sh *shell) cmdOpen(args []string) error {
+	if len(args) != 1 {
+		return usageError("open")
+	}
+	addr := args[0]
+	if !strings.Contains(addr, ":") {
+		addr += ":21"
+	}
+	if err := sh.open(addr); err != nil {
+		return err
+	}
+	fmt.Fprintln(sh.out, "Connected to", addr+".")
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		if login, password, ok := ftplib.NetrcCredentials(host, ""); ok {
+			return sh.cmdUser([]string{login, password})
+		}
+	}
+	if !sh.interactive {
+		return nil
+	}
+	return sh.cmdUser([]string{sh.ask("Name: ")})
+}
+
+func (sh *shell) cmdUser(args []string) error {
+	if len(args) < 1 || len(args) > 2 || args[0] == "" {
+		return usageError("user")
+	}
+	password := ""
+	if len(args) == 2 {
+		password = args[1]
+	} else if sh.interactive {
+		password = sh.ask("Password: ")
+	}
+	if err := sh.conn.Login(args[0], password); err != nil {
+		return err
+	}
+	fmt.Fprintln(sh.out, "Logged in as", args[0]+".")
+	return nil
+}
+
+func (sh *shell) cmdClose(args []string) error {
+	sh.close()
+	return nil
+}
+
+func (sh *shell) cmdQuit(args []string) error {
+	sh.quit = true
+	return nil
+}
+
+func (sh *shell) cmdHelp(args []string) error {
+	if len(args) > 0 {
+		cmd, ok := commands[args[0]]
+		if !ok {
+			return fmt.Errorf("unknown command %q", args[0])
+		}
+		fmt.Fprintf(sh.out, "%-24s %s\n", cmd.usage, cmd.help)
+		return nil
+	}
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(sh.out, "%-24s %s\n", commands[name].usage, commands[name].help)
+	}
+	return nil
+}
+
+// list prints the listing of the directory of args, or of the current one.
+func (sh *shell) list(args []string) error {
+	entries, err := sh.conn.List(strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		fmt.Fprintln(sh.out, strings.TrimRight(entry.Raw, "\r\n"))
+	}
+	return nil
+}
+
+func (sh *shell) cmdNlist(args []string) error {
+	names, err := sh.conn.NameList(strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		fmt.Fprintln(sh.out, name)
+	}
+	return nil
+}
+
+func (sh *shell) cmdCd(args []string) error {
+	if len(args) != 1 {
+		return usageError("cd")
+	}
+	return sh.conn.ChangeDir(args[0])
+}
+
+func (sh *shell) cmdCdup(args []string) error {
+	return sh.conn.ChangeDirToParent()
+}
+
+func (sh *shell) cmdPwd(args []string) error {
+	dir, err := sh.conn.CurrentDir()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(sh.out, dir)
+	return nil
+}
+
+func (sh *shell) cmdLcd(args []string) error {
+	if len(args) != 1 {
+		return usageError("lcd")
+	}
+	return os.Chdir(args[0])
+}
+
+func (sh *shell) cmdGet(args []string) error {
+	switch len(args) {
+	case 1:
+		return sh.get(args[0], path.Base(args[0]))
+	case 2:
+		return sh.get(args[0], args[1])
+	}
+	return usageError("get")
+}
+
+func (sh *shell) cmdPut(args []string) error {
+	switch len(args) {
+	case 1:
+		return sh.put(args[0], filepath.Base(args[0]))
+	case 2:
+		return sh.put(args[0], args[1])
+	}
+	return usageError("put")
+}
+
+func (sh *shell) cmdMget(args []string) error {
+	if len(args) == 0 {
+		return usageError("mget")
+	}
+	names, err := sh.conn.NameList("")
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		name = path.Base(name)
+		for _, pattern := range args {
+			if ok, _ := path.Match(pattern, name); ok {
+				if err := sh.get(name, name); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (sh *shell) cmdMput(args []string) error {
+	if len(args) == 0 {
+		return usageError("mput")
+	}
+	for _, pattern := range args {
+		names, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if info, err := os.Stat(name); err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			if err := sh.put(name, filepath.Base(name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (sh *shell) cmdDelete(args []string) error {
+	if len(args) != 1 {
+		return usageError("delete")
+	}
+	return sh.conn.Delete(args[0])
+}
+
+func (sh *shell) cmdMkdir(args []string) error {
+	if len(args) != 1 {
+		return usageError("mkdir")
+	}
+	return sh.conn.MakeDir(args[0])
+}
+
+func (sh *shell) cmdRmdir(args []string) error {
+	if len(args) != 1 {
+		return usageError("rmdir")
+	}
+	return sh.conn.RemoveDir(args[0])
+}
+
+func (sh *shell) cmdRename(args []string) error {
+	if len(args) != 2 {
+		return usageError("rename")
+	}
+	return sh.conn.Rename(args[0], args[1])
+}
+
+// get downloads the remote file to local, "-" being the standard output.
+func (sh *shell) get(remote, local string) error {
+	size := sh.remoteSize(remote)
+	r, err := sh.conn.Retr(remote)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	var w io.Writer = os.Stdout
+	if local != "-" {
+		f, err := os.Create(local)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	progress := sh.newProgress(remote, size)
+	_, err = io.Copy(w, io.TeeReader(r, progress))
+	progress.finish()
+	return err
+}
+
+// put uploads the local file to remote.
+func (sh *shell) put(local, remote string) error {
+	f, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	size := int64(-1)
+	if info, err := f.Stat(); err == nil {
+		size = info.Size()
+	}
+	progress := sh.newProgress(local, size)
+	err = sh.conn.Stor(remote, io.TeeReader(f, progress))
+	progress.finish()
+	return err
+}
+
+// remoteSize returns the size of the remote file p as listed, or -1.
+func (sh *shell) remoteSize(p string) int64 {
+	entries, err := sh.conn.List(p)
+	if err != nil || len(entries) != 1 || entries[0].Name != path.Base(p) {
+		return -1
+	}
+	return int64(entries[0].Size)
+}
+
+func usageError(name string) error {
+	return fmt.Errorf("usage: %s", commands[name].usage)
+}
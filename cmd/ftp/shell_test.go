@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cxfans/ftplib"
+)
+
+// go test -run TestShell
+func TestShell(t *testing.T) {
+	remote, err := ioutil.TempDir("", "ftp-remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(remote)
+	local, err := ioutil.TempDir("", "ftp-local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(local)
+	for name, content := range map[string]string{"a.txt": "alpha", "b.txt": "beta", "c.log": "log"} {
+		if err := ioutil.WriteFile(filepath.Join(remote, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(local, "up.txt"), []byte("upload"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	server, err := ftplib.NewServer("127.0.0.1:0", remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	go server.ListenAndServe()
+
+	script := strings.Join([]string{
+		"ls",
+		"open " + server.Addr().String(),
+		"user anonymous guest",
+		"lcd " + local,
+		"put up.txt",
+		"mget *.txt",
+		"get c.log copy.log",
+		"mkdir sub",
+		"cd sub",
+		"pwd",
+		"cdup",
+		"rename up.txt moved.txt",
+		"delete b.txt",
+		"nlist",
+		"frobnicate",
+		"quit",
+		"pwd",
+	}, "\n")
+	var out bytes.Buffer
+	newShell(strings.NewReader(script), &out).loop()
+
+	for name, want := range map[string]string{
+		filepath.Join(remote, "moved.txt"): "upload",
+		filepath.Join(local, "a.txt"):      "alpha",
+		filepath.Join(local, "b.txt"):      "beta",
+		filepath.Join(local, "copy.log"):   "log",
+	} {
+		if got, err := ioutil.ReadFile(name); err != nil || string(got) != want {
+			t.Errorf("%s: %q (%v), want %q", name, got, err, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(remote, "b.txt")); !os.IsNotExist(err) {
+		t.Errorf("b.txt not deleted: %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(remote, "sub")); err != nil || !info.IsDir() {
+		t.Errorf("sub not made: %v", err)
+	}
+	output := out.String()
+	for _, want := range []string{
+		"ftp: not connected\n",
+		"Logged in as anonymous.\n",
+		"/sub\n",
+		"moved.txt\n",
+		`ftp: unknown command "frobnicate"`,
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output lacks %q:\n%s", want, output)
+		}
+	}
+	if strings.Count(output, "/sub\n") != 1 {
+		t.Errorf("commands ran after quit:\n%s", output)
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cxfans/ftplib"
+)
+
+// config is the settings of a benchmark.
+type config struct {
+	addr, user, password string
+	sessions             int
+	duration             time.Duration
+	count                int64 // operations to run in all, 0 for no limit
+	ops                  []string
+	size                 int64
+	dir                  string
+	out                  io.Writer
+}
+
+// remotePath returns the path of the file name in the directory of the
+// transfers.
+func (cfg *config) remotePath(name string) string {
+	if cfg.dir == "" {
+		return name
+	}
+	return path.Join(cfg.dir, name)
+}
+
+// session is the state of a benchmarking session.
+type session struct {
+	cfg  *config
+	id   int
+	conn *ftplib.ClientConn
+}
+
+// operation runs an operation on s, returning the bytes it transferred.
+type operation func(s *session) (int64, error)
+
+var operations = map[string]operation{
+	"login":    (*session).login,
+	"list":     (*session).list,
+	"upload":   (*session).upload,
+	"download": (*session).download,
+}
+
+// downloadName is the file the download operations retrieve.
+const downloadName = "ftpbench.dat"
+
+func (cfg *config) connect() (*ftplib.ClientConn, error) {
+	conn, err := ftplib.Dial(cfg.addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Login(cfg.user, cfg.password); err != nil {
+		conn.Quit()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (s *session) login() (int64, error) {
+	conn, err := s.cfg.connect()
+	if err != nil {
+		return 0, err
+	}
+	return 0, conn.Quit()
+}
+
+func (s *session) list() (int64, error) {
+	_, err := s.conn.List(s.cfg.dir)
+	return 0, err
+}
+
+func (s *session) upload() (int64, error) {
+	name := s.cfg.remotePath(fmt.Sprintf("ftpbench-%d.dat", s.id))
+	r := io.LimitReader(zeros{}, s.cfg.size)
+	if err := s.conn.Stor(name, r); err != nil {
+		return 0, err
+	}
+	return s.cfg.size, nil
+}
+
+func (s *session) download() (int64, error) {
+	r, err := s.conn.Retr(s.cfg.remotePath(downloadName))
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(ioutil.Discard, r)
+	if cerr := r.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+// zeros reads an endless stream of zero bytes.
+type zeros struct{}
+
+func (zeros) Read(b []byte) (int, error) {
+	for i := range b {
+		b[i] = 0
+	}
+	return len(b), nil
+}
+
+// stats are the results of an operation.
+type stats struct {
+	latencies []time.Duration
+	errors    int
+	bytes     int64
+	lastErr   error
+}
+
+func (st *stats) add(o *stats) {
+	st.latencies = append(st.latencies, o.latencies...)
+	st.errors += o.errors
+	st.bytes += o.bytes
+	if o.lastErr != nil {
+		st.lastErr = o.lastErr
+	}
+}
+
+// percentile returns the latency below which lie p percent of the sorted
+// latencies.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := (len(sorted)*p + 99) / 100
+	if i > 0 {
+		i--
+	}
+	return sorted[i]
+}
+
+// run runs the benchmark and prints its report.
+func run(cfg *config) error {
+	if cfg.sessions < 1 {
+		return fmt.Errorf("invalid number of sessions %d", cfg.sessions)
+	}
+	if err := setup(cfg); err != nil {
+		return err
+	}
+	results, elapsed, err := bench(cfg)
+	if err != nil {
+		return err
+	}
+	report(cfg, results, elapsed)
+	return cleanup(cfg)
+}
+
+// needs reports whether the benchmark runs the operation op.
+func (cfg *config) needs(op string) bool {
+	for _, o := range cfg.ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// setup uploads the file of the download operations.
+func setup(cfg *config) error {
+	if !cfg.needs("download") {
+		return nil
+	}
+	conn, err := cfg.connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Quit()
+	return conn.Stor(cfg.remotePath(downloadName), io.LimitReader(zeros{}, cfg.size))
+}
+
+// cleanup deletes the files the benchmark left on the server.
+func cleanup(cfg *config) error {
+	if !cfg.needs("download") && !cfg.needs("upload") {
+		return nil
+	}
+	conn, err := cfg.connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Quit()
+	if cfg.needs("download") {
+		conn.Delete(cfg.remotePath(downloadName))
+	}
+	if cfg.needs("upload") {
+		for i := 0; i < cfg.sessions; i++ {
+			conn.Delete(cfg.remotePath(fmt.Sprintf("ftpbench-%d.dat", i)))
+		}
+	}
+	return nil
+}
+
+// bench runs the sessions, returning the stats of each operation and the
+// time they took.
+func bench(cfg *config) (map[string]*stats, time.Duration, error) {
+	var (
+		mu      sync.Mutex
+		results = make(map[string]*stats)
+		wg      sync.WaitGroup
+		started int64
+	)
+	start := time.Now()
+	deadline := start.Add(cfg.duration)
+	// next reports whether the session may run another operation.
+	next := func() bool {
+		if cfg.count > 0 {
+			return atomic.AddInt64(&started, 1) <= cfg.count
+		}
+		return time.Now().Before(deadline)
+	}
+	errs := make(chan error, cfg.sessions)
+	for i := 0; i < cfg.sessions; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			local := make(map[string]*stats)
+			defer func() {
+				mu.Lock()
+				for op, st := range local {
+					if results[op] == nil {
+						results[op] = new(stats)
+					}
+					results[op].add(st)
+				}
+				mu.Unlock()
+			}()
+			s := &session{cfg: cfg, id: id}
+			for k := 0; next(); k++ {
+				if s.conn == nil {
+					conn, err := cfg.connect()
+					if err != nil {
+						errs <- err
+						return
+					}
+					s.conn = conn
+				}
+				op := cfg.ops[(id+k)%len(cfg.ops)]
+				st := local[op]
+				if st == nil {
+					st = new(stats)
+					local[op] = st
+				}
+				t := time.Now()
+				n, err := operations[op](s)
+				if err != nil {
+					// Start over on a new session, this one may be broken.
+					st.errors++
+					st.lastErr = err
+					s.conn.Quit()
+					s.conn = nil
+					continue
+				}
+				st.latencies = append(st.latencies, time.Since(t))
+				st.bytes += n
+			}
+			if s.conn != nil {
+				s.conn.Quit()
+			}
+		}(i)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	select {
+	case err := <-errs:
+		return nil, 0, err
+	default:
+		return results, elapsed, nil
+	}
+}
+
+// report prints the stats of the operations, run in elapsed.
+func report(cfg *config, results map[string]*stats, elapsed time.Duration) {
+	seen := make(map[string]bool)
+	var names []string
+	for _, op := range cfg.ops {
+		if !seen[op] && results[op] != nil {
+			seen[op] = true
+			names = append(names, op)
+		}
+	}
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "op\tcount\terrors\tops/s\tMiB/s\tp50\tp90\tp99\tmax\t")
+	for _, op := range names {
+		st := results[op]
+		sort.Slice(st.latencies, func(i, j int) bool { return st.latencies[i] < st.latencies[j] })
+		seconds := elapsed.Seconds()
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.1f\t%.2f\t%v\t%v\t%v\t%v\t\n",
+			op, len(st.latencies), st.errors,
+			float64(len(st.latencies))/seconds, float64(st.bytes)/seconds/(1<<20),
+			round(percentile(st.latencies, 50)), round(percentile(st.latencies, 90)),
+			round(percentile(st.latencies, 99)), round(percentile(st.latencies, 100)))
+	}
+	w.Flush()
+	fmt.Fprintf(&buf, "%d sessions in %v\n", cfg.sessions, round(elapsed))
+	for _, op := range names {
+		if err := results[op].lastErr; err != nil {
+			fmt.Fprintf(&buf, "%s: last error: %v\n", op, err)
+		}
+	}
+	cfg.out.Write(buf.Bytes())
+}
+
+// round rounds d for display.
+func round(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond)
+	}
+	return d.Round(time.Microsecond)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cxfans/ftplib"
+)
+
+// go test -run TestBench
+func TestBench(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftpbench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	server, err := ftplib.NewServer("127.0.0.1:0", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	go server.ListenAndServe()
+
+	var out bytes.Buffer
+	cfg := &config{
+		addr: server.Addr().String(), user: "user", password: "secret",
+		sessions: 3, duration: time.Minute, count: 24,
+		ops: []string{"login", "list", "upload", "download"}, size: 64 << 10,
+		out: &out,
+	}
+	if err := setup(cfg); err != nil {
+		t.Fatal(err)
+	}
+	results, elapsed, err := bench(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 0
+	for op, st := range results {
+		if st.errors != 0 {
+			t.Errorf("%s: %d errors, last %v", op, st.errors, st.lastErr)
+		}
+		total += len(st.latencies)
+	}
+	if total != 24 {
+		t.Errorf("ran %d operations, want 24", total)
+	}
+	report(cfg, results, elapsed)
+	for _, op := range cfg.ops {
+		if !strings.Contains(out.String(), op) {
+			t.Errorf("report %q lacks %s", out.String(), op)
+		}
+	}
+	if err := cleanup(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := ioutil.ReadDir(dir); len(names) != 0 {
+		t.Errorf("left %d files on the server", len(names))
+	}
+}
+
+// go test -run TestParseSize
+func TestParseSize(t *testing.T) {
+	for s, want := range map[string]int64{"0": 0, "100": 100, "100B": 100, "4KiB": 4096, "16MiB": 16 << 20, "1GiB": 1 << 30} {
+		if got, err := parseSize(s); err != nil || got != want {
+			t.Errorf("parseSize(%q) = %d, %v, want %d", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "-1", "1TB", "MiB"} {
+		if _, err := parseSize(s); err == nil {
+			t.Errorf("parseSize(%q) succeeded", s)
+		}
+	}
+}
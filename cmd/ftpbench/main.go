@@ -0,0 +1,101 @@
+// Command ftpbench drives concurrent sessions against an FTP server and
+// reports the throughput and latency percentiles of their operations.
+//
+// Usage:
+//
+//	ftpbench [flags] host[:port]
+//
+// Each session runs the operations of -ops in turn until -duration elapses,
+// or -n operations ran in all:
+//
+//	login     connect, log in and quit, on a new control connection
+//	list      list the working directory
+//	upload    store a file of -size bytes
+//	download  retrieve a file of -size bytes, uploaded beforehand
+//
+// For instance, a login storm and a transfer mix:
+//
+//	ftpbench -sessions 100 -ops login ftp.example.com
+//	ftpbench -sessions 8 -ops upload,download,download -size 16MiB ftp.example.com
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func main() {
+	cfg := config{out: os.Stdout}
+	var ops, size string
+	flag.StringVar(&cfg.user, "user", "anonymous", "user `name` of the sessions")
+	flag.StringVar(&cfg.password, "password", "anonymous", "`password` of the user")
+	flag.IntVar(&cfg.sessions, "sessions", 10, "`number` of concurrent sessions")
+	flag.DurationVar(&cfg.duration, "duration", 10*time.Second, "how long to run")
+	flag.Int64Var(&cfg.count, "n", 0, "stop after `number` operations (0 for -duration only)")
+	flag.StringVar(&ops, "ops", "list", "comma-separated `operations`: login, list, upload, download")
+	flag.StringVar(&size, "size", "1MiB", "`size` of the transferred files")
+	flag.StringVar(&cfg.dir, "dir", "", "remote `directory` of the transferred files")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: ftpbench [flags] host[:port]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	cfg.addr = flag.Arg(0)
+	if _, _, err := net.SplitHostPort(cfg.addr); err != nil {
+		cfg.addr = net.JoinHostPort(cfg.addr, "21")
+	}
+	var err error
+	if cfg.ops, err = parseOps(ops); err == nil {
+		cfg.size, err = parseSize(size)
+	}
+	if err == nil {
+		err = run(&cfg)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ftpbench:", err)
+		os.Exit(1)
+	}
+}
+
+// parseOps parses a comma-separated list of operations.
+func parseOps(s string) ([]string, error) {
+	ops := strings.Split(s, ",")
+	for i, op := range ops {
+		op = strings.TrimSpace(op)
+		if _, ok := operations[op]; !ok {
+			return nil, fmt.Errorf("unknown operation %q", op)
+		}
+		ops[i] = op
+	}
+	return ops, nil
+}
+
+// parseSize parses a number of bytes with an optional binary unit, as in
+// "512KiB".
+func parseSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		scale  int64
+	}{{"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10}, {"B", 1}}
+	scale := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(s, unit.suffix) {
+			s, scale = strings.TrimSuffix(s, unit.suffix), unit.scale
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * scale, nil
+}
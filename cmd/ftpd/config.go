@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// config is the configuration of ftpd, read from a TOML file:
+//
+//	listen = [":2121"]
+//	root = "/srv/ftp"
+//	users = "/etc/ftpd/users"
+//	log = "/var/log/ftpd.log"
+//	user = "ftp"
+//	group = "ftp"
+//	lenient_replies = false
+//
+//	[passive]
+//	ports = "50000-50099"
+//	address = "203.0.113.5"
+//	timeout = "30s"
+//
+//	[data]
+//	timeout = "5m"
+//
+//	[tls]
+//	cert = "/etc/ftpd/cert.pem"
+//	key = "/etc/ftpd/key.pem"
+//
+//	[hosts."ftp.example.com"]
+//	root = "/srv/example"
+//	banner = "Welcome to example."
+//	users = "/etc/ftpd/example.users"
+//
+// Only the part of TOML such files need is understood: tables, strings,
+// integers, booleans and arrays of strings on one line.
+type config struct {
+	Listen         []string
+	Root           string
+	Users          string
+	Log            string
+	LenientReplies bool
+	PassivePorts   string
+	PassiveAddress string
+	PassiveTimeout time.Duration
+	DataTimeout    time.Duration
+	TLSCert        string
+	TLSKey         string
+	User           string
+	Group          string
+	Chroot         string
+	Hosts          map[string]*hostConfig
+}
+
+// hostConfig is the configuration of a virtual host.
+type hostConfig struct {
+	Root    string
+	Banner  string
+	Users   string
+	TLSCert string
+	TLSKey  string
+}
+
+// loadConfig reads the configuration file name.
+func loadConfig(name string) (*config, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	values, err := parseTOML(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	conf := &config{Hosts: make(map[string]*hostConfig)}
+	for key, value := range values {
+		if err := conf.set(key, value); err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", name, key, err)
+		}
+	}
+	return conf, nil
+}
+
+// set sets the setting key, a dotted path, to value.
+func (conf *config) set(key string, value interface{}) (err error) {
+	if strings.HasPrefix(key, "hosts\x00") {
+		return conf.setHost(strings.TrimPrefix(key, "hosts\x00"), value)
+	}
+	switch strings.Replace(key, "\x00", ".", -1) {
+	case "listen":
+		conf.Listen, err = stringsValue(value)
+	case "root":
+		conf.Root, err = stringValue(value)
+	case "users":
+		conf.Users, err = stringValue(value)
+	case "log":
+		conf.Log, err = stringValue(value)
+	case "lenient_replies":
+		conf.LenientReplies, err = boolValue(value)
+	case "passive.ports":
+		conf.PassivePorts, err = stringValue(value)
+	case "passive.address":
+		conf.PassiveAddress, err = stringValue(value)
+	case "passive.timeout":
+		conf.PassiveTimeout, err = durationValue(value)
+	case "data.timeout":
+		conf.DataTimeout, err = durationValue(value)
+	case "tls.cert":
+		conf.TLSCert, err = stringValue(value)
+	case "tls.key":
+		conf.TLSKey, err = stringValue(value)
+	case "user":
+		conf.User, err = stringValue(value)
+	case "group":
+		conf.Group, err = stringValue(value)
+	case "chroot":
+		conf.Chroot, err = stringValue(value)
+	default:
+		err = fmt.Errorf("unknown setting")
+	}
+	return err
+}
+
+// setHost sets the setting "name\x00key" of a virtual host.
+func (conf *config) setHost(key string, value interface{}) (err error) {
+	i := strings.LastIndex(key, "\x00")
+	if i < 0 {
+		return fmt.Errorf("hosts must be tables")
+	}
+	name := key[:i]
+	host := conf.Hosts[name]
+	if host == nil {
+		host = &hostConfig{}
+		conf.Hosts[name] = host
+	}
+	switch key[i+1:] {
+	case "root":
+		host.Root, err = stringValue(value)
+	case "banner":
+		host.Banner, err = stringValue(value)
+	case "users":
+		host.Users, err = stringValue(value)
+	case "tls_cert":
+		host.TLSCert, err = stringValue(value)
+	case "tls_key":
+		host.TLSKey, err = stringValue(value)
+	default:
+		err = fmt.Errorf("unknown setting")
+	}
+	return err
+}
+
+func stringValue(value interface{}) (string, error) {
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("%v is not a string", value)
+	}
+	return s, nil
+}
+
+func stringsValue(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, nil
+	case []string:
+		return v, nil
+	}
+	return nil, fmt.Errorf("%v is not an array of strings", value)
+}
+
+func boolValue(value interface{}) (bool, error) {
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("%v is not a boolean", value)
+	}
+	return b, nil
+}
+
+// durationValue reads a duration such as "30s", or a number of seconds.
+func durationValue(value interface{}) (time.Duration, error) {
+	switch v := value.(type) {
+	case int64:
+		return time.Duration(v) * time.Second, nil
+	case string:
+		return time.ParseDuration(v)
+	}
+	return 0, fmt.Errorf("%v is not a duration", value)
+}
+
+// parseTOML returns the values of the TOML document r, keyed by their
+// dotted path with NUL for the dots, since keys may hold dots when quoted.
+func parseTOML(r io.Reader) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	table := ""
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: unterminated table header", n)
+			}
+			keys, err := splitKey(line[1 : len(line)-1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			table = keys + "\x00"
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("line %d: expected key = value", n)
+		}
+		key, err := splitKey(line[:i])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		value, err := parseValue(strings.TrimSpace(line[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		if _, ok := values[table+key]; ok {
+			return nil, fmt.Errorf("line %d: duplicate key", n)
+		}
+		values[table+key] = value
+	}
+	return values, scanner.Err()
+}
+
+// stripComment removes the comment ending line, if any.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote == 0 && c == '#':
+			return line[:i]
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == '"' && c == '\\':
+			i++
+		case c == quote:
+			quote = 0
+		}
+	}
+	return line
+}
+
+// splitKey returns the dotted key s with NUL for the dots.
+func splitKey(s string) (string, error) {
+	var parts []string
+	for _, part := range splitOutsideQuotes(s, '.') {
+		part = strings.TrimSpace(part)
+		if strings.HasPrefix(part, `"`) || strings.HasPrefix(part, "'") {
+			unquoted, err := parseValue(part)
+			if err != nil {
+				return "", err
+			}
+			part = unquoted.(string)
+		} else if part == "" || strings.ContainsAny(part, " \t\"'") {
+			return "", fmt.Errorf("invalid key %q", s)
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "\x00"), nil
+}
+
+// splitOutsideQuotes splits s around the separators sep not quoted.
+func splitOutsideQuotes(s string, sep byte) []string {
+	var parts []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote == 0 && c == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == '"' && c == '\\':
+			i++
+		case c == quote:
+			quote = 0
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// parseValue parses a string, integer, boolean or array of strings.
+func parseValue(s string) (interface{}, error) {
+	switch {
+	case s == "true":
+		return true, nil
+	case s == "false":
+		return false, nil
+	case strings.HasPrefix(s, `"`) && strings.HasSuffix(s, `"`) && len(s) > 1:
+		return strconv.Unquote(s)
+	case strings.HasPrefix(s, "'") && strings.HasSuffix(s, "'") && len(s) > 1:
+		return s[1 : len(s)-1], nil
+	case strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]"):
+		list := []string{}
+		for _, item := range splitOutsideQuotes(s[1:len(s)-1], ',') {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			value, err := parseValue(item)
+			if err != nil {
+				return nil, err
+			}
+			str, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("only arrays of strings are supported")
+			}
+			list = append(list, str)
+		}
+		return list, nil
+	}
+	n, err := strconv.ParseInt(strings.Replace(s, "_", "", -1), 0, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %s", s)
+	}
+	return n, nil
+}
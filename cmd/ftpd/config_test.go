@@ -0,0 +1,111 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// go test -run TestLoadConfig
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftpd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "ftpd.toml")
+	err = ioutil.WriteFile(name, []byte(`
+# Served on two addresses.
+listen = [":2121", "127.0.0.1:2122"] # trailing comment
+root = "/srv/ftp"
+lenient_replies = true
+user = "ftp"
+
+[passive]
+ports = "50000-50099"
+address = "203.0.113.5"
+timeout = 45
+
+[data]
+timeout = "5m"
+
+[hosts."ftp.example.com"]
+root = '/srv/example'
+banner = "Welcome to \"example\" # not a comment"
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := loadConfig(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conf.Listen) != 2 || conf.Listen[1] != "127.0.0.1:2122" || conf.Root != "/srv/ftp" || !conf.LenientReplies {
+		t.Errorf("unexpected settings %+v", conf)
+	}
+	if conf.User != "ftp" || conf.Group != "" {
+		t.Errorf("user %q, group %q", conf.User, conf.Group)
+	}
+	if conf.PassivePorts != "50000-50099" || conf.PassiveAddress != "203.0.113.5" ||
+		conf.PassiveTimeout != 45*time.Second || conf.DataTimeout != 5*time.Minute {
+		t.Errorf("unexpected transfer settings %+v", conf)
+	}
+	host := conf.Hosts["ftp.example.com"]
+	if host == nil || host.Root != "/srv/example" || host.Banner != `Welcome to "example" # not a comment` {
+		t.Errorf("unexpected host %+v", host)
+	}
+}
+
+// go test -run TestConfigErrors
+func TestConfigErrors(t *testing.T) {
+	for _, doc := range []string{
+		"root = /srv",
+		"[passive",
+		"root",
+		"a b = 1",
+		"root = 1\nroot = 2",
+	} {
+		if _, err := parseTOML(strings.NewReader(doc)); err == nil {
+			t.Errorf("%q: no error", doc)
+		}
+	}
+	conf := &config{Hosts: make(map[string]*hostConfig)}
+	if err := conf.set("listen", int64(1)); err == nil {
+		t.Error("listen = 1: no error")
+	}
+	if err := conf.set("bogus", "x"); err == nil {
+		t.Error("bogus: no error")
+	}
+}
+
+// go test -run TestParsePortRange
+func TestParsePortRange(t *testing.T) {
+	if first, last, err := parsePortRange("50000-50099"); err != nil || first != 50000 || last != 50099 {
+		t.Errorf("got %d-%d (%v)", first, last, err)
+	}
+	for _, s := range []string{"50000", "2-1", "0-10", "1-70000", "a-b"} {
+		if _, _, err := parsePortRange(s); err == nil {
+			t.Errorf("%q: no error", s)
+		}
+	}
+}
+
+// go test -run TestNewServersPassiveAddress
+func TestNewServersPassiveAddress(t *testing.T) {
+	conf := &config{Listen: []string{"127.0.0.1:0"}, Root: ".", PassiveAddress: "203.0.113.5"}
+	servers, err := newServers(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	servers[0].Stop()
+	if servers[0].PassiveAddress != "203.0.113.5" {
+		t.Errorf("server announces %q", servers[0].PassiveAddress)
+	}
+	conf.PassiveAddress = "ftp.example.com"
+	if _, err := newServers(conf); err == nil {
+		t.Error("passive address ftp.example.com: no error")
+	}
+}
@@ -0,0 +1,265 @@
+// Command ftpd serves directories over FTP, as configured by a file and
+// flags.
+//
+// Usage:
+//
+//	ftpd [-config file] [-listen addrs] [-root dir] [-users file]
+//	     [-passive-ports first-last] [-passive-address ip]
+//	     [-tls-cert file -tls-key file] [-log file]
+//	     [-user name [-group name] [-chroot dir]]
+//
+// Flags override the settings of the configuration file; see config for
+// its format. The users file holds a "name:password hash" line per user,
+// with hashes as ftplib.HashPassword returns them; without one, every user
+// is let in. A users file named *.json is an ftplib.UserFile instead, which
+// also sets the home, permissions and limits of each user.
+//
+// Started as root to listen on port 21, ftpd switches to user once its
+// ports are bound, confined to the chroot directory if one is set. On
+// Linux, switching user needs ftpd built with Go 1.16 or later.
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/cxfans/ftplib"
+)
+
+func main() {
+	configFile := flag.String("config", "", "configuration `file`")
+	listen := flag.String("listen", "", "comma-separated `addresses` to listen on (default \":2121\")")
+	root := flag.String("root", "", "`directory` to serve (default \".\")")
+	users := flag.String("users", "", "users `file`")
+	passivePorts := flag.String("passive-ports", "", "`range` of passive ports, as first-last")
+	passiveAddress := flag.String("passive-address", "", "IPv4 `address` announced for passive mode, as the public one behind NAT")
+	tlsCert := flag.String("tls-cert", "", "TLS certificate `file`, enabling AUTH TLS")
+	tlsKey := flag.String("tls-key", "", "TLS key `file`")
+	logFile := flag.String("log", "", "log `file`, or \"off\" (default standard error)")
+	runUser := flag.String("user", "", "`user` to run as once the ports are bound")
+	runGroup := flag.String("group", "", "`group` to run as (default the user's)")
+	chroot := flag.String("chroot", "", "`directory` to confine the process to")
+	flag.Parse()
+
+	conf := &config{}
+	if *configFile != "" {
+		var err error
+		if conf, err = loadConfig(*configFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "listen":
+			conf.Listen = strings.Split(*listen, ",")
+		case "root":
+			conf.Root = *root
+		case "users":
+			conf.Users = *users
+		case "passive-ports":
+			conf.PassivePorts = *passivePorts
+		case "passive-address":
+			conf.PassiveAddress = *passiveAddress
+		case "tls-cert":
+			conf.TLSCert = *tlsCert
+		case "tls-key":
+			conf.TLSKey = *tlsKey
+		case "log":
+			conf.Log = *logFile
+		case "user":
+			conf.User = *runUser
+		case "group":
+			conf.Group = *runGroup
+		case "chroot":
+			conf.Chroot = *chroot
+		}
+	})
+	if len(conf.Listen) == 0 {
+		conf.Listen = []string{":2121"}
+	}
+	if conf.Root == "" {
+		conf.Root = "."
+	}
+	if err := setupLog(conf.Log); err != nil {
+		log.Fatal(err)
+	}
+
+	servers, err := newServers(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	errs := make(chan error, len(servers))
+	for _, server := range servers {
+		go func(server *ftplib.Server) {
+			errs <- server.ListenAndServe()
+		}(server)
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err = <-errs:
+	case <-signals:
+	}
+	for _, server := range servers {
+		server.Stop()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// setupLog sends the log to the file name, to standard error when name is
+// empty, or nowhere when it is "off".
+func setupLog(name string) error {
+	switch name {
+	case "":
+		return nil
+	case "off":
+		log.SetOutput(ioutil.Discard)
+		return nil
+	}
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	log.SetOutput(f)
+	return nil
+}
+
+// newServers returns a server per listen address of conf, sharing their
+// passive ports.
+func newServers(conf *config) ([]*ftplib.Server, error) {
+	if conf.PassiveAddress != "" && net.ParseIP(conf.PassiveAddress).To4() == nil {
+		return nil, fmt.Errorf("passive address %s is not an IPv4 address", conf.PassiveAddress)
+	}
+	var pool *ftplib.PassivePool
+	if conf.PassivePorts != "" {
+		first, last, err := parsePortRange(conf.PassivePorts)
+		if err != nil {
+			return nil, err
+		}
+		if pool, err = ftplib.NewPassivePool("", first, last); err != nil {
+			return nil, err
+		}
+	}
+	auth, err := loadAuth(conf.Users)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := loadTLS(conf.TLSCert, conf.TLSKey)
+	if err != nil {
+		return nil, err
+	}
+	hosts := make(map[string]*ftplib.VirtualHost)
+	for name, host := range conf.Hosts {
+		vhost := &ftplib.VirtualHost{Banner: host.Banner}
+		if host.Root != "" {
+			vhost.Driver = &ftplib.DiskDriver{Root: host.Root}
+		}
+		hostAuth, err := loadAuth(host.Users)
+		if err != nil {
+			return nil, err
+		}
+		if hostAuth != nil {
+			vhost.Auth = hostAuth
+		}
+		if vhost.TLSConfig, err = loadTLS(host.TLSCert, host.TLSKey); err != nil {
+			return nil, err
+		}
+		hosts[name] = vhost
+	}
+
+	var servers []*ftplib.Server
+	for _, addr := range conf.Listen {
+		server, err := ftplib.NewServer(strings.TrimSpace(addr), conf.Root)
+		if err != nil {
+			for _, server := range servers {
+				server.Stop()
+			}
+			return nil, err
+		}
+		server.PassivePool = pool
+		server.PassiveAddress = conf.PassiveAddress
+		server.PassiveTimeout = conf.PassiveTimeout
+		server.DataTimeout = conf.DataTimeout
+		server.LenientReplies = conf.LenientReplies
+		server.TLSConfig = tlsConfig
+		server.Hosts = hosts
+		if conf.User != "" {
+			server.Privileges = &ftplib.Privileges{User: conf.User, Group: conf.Group, Chroot: conf.Chroot}
+		}
+		if users, ok := auth.(*ftplib.UserFile); ok {
+			users.Install(server)
+		} else if auth != nil {
+			server.Auth = auth
+		}
+		servers = append(servers, server)
+	}
+	return servers, nil
+}
+
+// parsePortRange parses a range of ports "first-last".
+func parsePortRange(s string) (first, last int, err error) {
+	i := strings.Index(s, "-")
+	if i < 0 {
+		return 0, 0, fmt.Errorf("invalid port range %q", s)
+	}
+	first, err1 := strconv.Atoi(s[:i])
+	last, err2 := strconv.Atoi(s[i+1:])
+	if err1 != nil || err2 != nil || first <= 0 || last < first || last > 65535 {
+		return 0, 0, fmt.Errorf("invalid port range %q", s)
+	}
+	return first, last, nil
+}
+
+// loadAuth returns the Auth of the users file name, or nil without one.
+func loadAuth(name string) (ftplib.Auth, error) {
+	if name == "" {
+		return nil, nil
+	}
+	if strings.HasSuffix(name, ".json") {
+		return ftplib.LoadUserFile(name)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	auth := &ftplib.PasswordAuth{Hashes: make(map[string]string)}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("%s:%d: expected name:hash", name, n)
+		}
+		auth.Hashes[line[:i]] = line[i+1:]
+	}
+	return auth, scanner.Err()
+}
+
+// loadTLS returns the TLS configuration serving the certificate cert, or
+// nil without one.
+func loadTLS(cert, key string) (*tls.Config, error) {
+	if cert == "" && key == "" {
+		return nil, nil
+	}
+	certificate, err := tls.LoadX509KeyPair(cert, key)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{Certificates: []tls.Certificate{certificate}}, nil
+}
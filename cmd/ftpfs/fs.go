@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"bazil.org/fuse"
+	fusefs "bazil.org/fuse/fs"
+	"github.com/cxfans/ftplib/ftpfs"
+)
+
+// filesystem serves an ftpfs.FS to FUSE.
+type filesystem struct {
+	fs  *ftpfs.FS
+	ttl time.Duration // how long the kernel may cache attributes
+}
+
+func (f *filesystem) Root() (fusefs.Node, error) {
+	return &node{f, "/"}, nil
+}
+
+// errno maps the errors of ftpfs to the error numbers of FUSE, EIO by
+// default.
+func errno(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case os.IsNotExist(err):
+		return fuse.ENOENT
+	case os.IsExist(err):
+		return fuse.EEXIST
+	case os.IsPermission(err):
+		return fuse.EPERM
+	}
+	return err
+}
+
+// node is a file or a directory.
+type node struct {
+	*filesystem
+	path string
+}
+
+func (n *node) child(name string) *node {
+	return &node{n.filesystem, path.Join(n.path, name)}
+}
+
+func (n *node) Attr(ctx context.Context, a *fuse.Attr) error {
+	fi, err := n.fs.Stat(n.path)
+	if err != nil {
+		return errno(err)
+	}
+	a.Valid = n.ttl
+	a.Mode = fi.Mode()
+	a.Size = uint64(fi.Size())
+	a.Mtime = fi.ModTime()
+	return nil
+}
+
+func (n *node) Lookup(ctx context.Context, name string) (fusefs.Node, error) {
+	child := n.child(name)
+	if _, err := n.fs.Stat(child.path); err != nil {
+		return nil, errno(err)
+	}
+	return child, nil
+}
+
+func (n *node) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	infos, err := n.fs.ReadDir(n.path)
+	if err != nil {
+		return nil, errno(err)
+	}
+	dirents := make([]fuse.Dirent, len(infos))
+	for i, fi := range infos {
+		dirents[i] = fuse.Dirent{Name: fi.Name(), Type: fuse.DT_File}
+		if fi.IsDir() {
+			dirents[i].Type = fuse.DT_Dir
+		}
+	}
+	return dirents, nil
+}
+
+func (n *node) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fusefs.Node, error) {
+	child := n.child(req.Name)
+	return child, errno(n.fs.Mkdir(child.path))
+}
+
+func (n *node) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.CreateResponse) (fusefs.Node, fusefs.Handle, error) {
+	child := n.child(req.Name)
+	f, err := n.fs.OpenFile(child.path, int(req.Flags)|os.O_CREATE)
+	if err != nil {
+		return nil, nil, errno(err)
+	}
+	return child, &handle{f}, nil
+}
+
+func (n *node) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fusefs.Handle, error) {
+	if req.Dir {
+		return n, nil
+	}
+	f, err := n.fs.OpenFile(n.path, int(req.Flags))
+	if err != nil {
+		return nil, errno(err)
+	}
+	return &handle{f}, nil
+}
+
+func (n *node) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
+	p := path.Join(n.path, req.Name)
+	if req.Dir {
+		return errno(n.fs.RemoveDir(p))
+	}
+	return errno(n.fs.Remove(p))
+}
+
+func (n *node) Rename(ctx context.Context, req *fuse.RenameRequest, newDir fusefs.Node) error {
+	to, ok := newDir.(*node)
+	if !ok {
+		return fuse.EIO
+	}
+	return errno(n.fs.Rename(path.Join(n.path, req.OldName), path.Join(to.path, req.NewName)))
+}
+
+// Setattr handles truncations; other changes are ignored, FTP having no
+// portable command for them.
+func (n *node) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
+	if req.Valid.Size() {
+		f, err := n.fs.OpenFile(n.path, os.O_RDWR)
+		if err != nil {
+			return errno(err)
+		}
+		err = f.Truncate(int64(req.Size))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return errno(err)
+		}
+	}
+	return n.Attr(ctx, &resp.Attr)
+}
+
+// handle is an open file.
+type handle struct {
+	f *ftpfs.File
+}
+
+func (h *handle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	b := make([]byte, req.Size)
+	n, err := h.f.ReadAt(b, req.Offset)
+	if err == io.EOF {
+		err = nil
+	}
+	resp.Data = b[:n]
+	return errno(err)
+}
+
+func (h *handle) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	n, err := h.f.WriteAt(req.Data, req.Offset)
+	resp.Size = n
+	return errno(err)
+}
+
+// Flush uploads the file when written, as close(2) calls it.
+func (h *handle) Flush(ctx context.Context, req *fuse.FlushRequest) error {
+	return errno(h.f.Sync())
+}
+
+func (h *handle) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	return errno(h.f.Close())
+}
@@ -0,0 +1,11 @@
+module github.com/cxfans/ftplib/cmd/ftpfs
+
+go 1.13
+
+require (
+	bazil.org/fuse v0.0.0-20200117225306-7b5117fecadc
+	github.com/cxfans/ftplib v0.0.0-20261017062658-e8003ca77124
+)
+
+// Within this repository, build against the ftplib of the tree.
+replace github.com/cxfans/ftplib => ../..
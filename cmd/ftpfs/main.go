@@ -0,0 +1,108 @@
+// Command ftpfs mounts the tree of an FTP server as a local file system,
+// with FUSE.
+//
+// Usage:
+//
+//	ftpfs [flags] ftp://[user[:password]@]host[:port]/path mountpoint
+//
+// The flags are:
+//
+//	-ro       mount read-only
+//	-ttl d    cache the directory listings for d (default 5s)
+//
+// Files are downloaded when opened, and uploaded when closed after being
+// written. ftpfs runs until the file system is unmounted, with
+// "fusermount -u mountpoint" on Linux, or until interrupted.
+//
+// ftpfs is a module of its own, so that ftplib does not depend on FUSE.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+	"time"
+
+	"bazil.org/fuse"
+	fusefs "bazil.org/fuse/fs"
+	"github.com/cxfans/ftplib"
+	"github.com/cxfans/ftplib/ftpfs"
+)
+
+func main() {
+	readOnly := flag.Bool("ro", false, "mount read-only")
+	ttl := flag.Duration("ttl", 5*time.Second, "cache the directory listings for `d`")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: ftpfs [flags] ftp://[user[:password]@]host[:port]/path mountpoint")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(flag.Arg(0), flag.Arg(1), *ttl, *readOnly); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// connect logs in the server of the URL ftp://[user[:password]@]host[:port]/path,
+// returning the client and the path.
+func connect(spec string) (*ftplib.ClientConn, string, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, "", err
+	}
+	if u.Scheme != "ftp" {
+		return nil, "", fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	addr, user, password := u.Host, "anonymous", "anonymous"
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "21")
+	}
+	if u.User != nil {
+		user = u.User.Username()
+		if p, ok := u.User.Password(); ok {
+			password = p
+		}
+	}
+	c, err := ftplib.Connect(addr, user, password)
+	return c, u.Path, err
+}
+
+func run(spec, mountpoint string, ttl time.Duration, readOnly bool) error {
+	c, root, err := connect(spec)
+	if err != nil {
+		return err
+	}
+	defer c.Quit()
+
+	options := []fuse.MountOption{fuse.FSName(spec), fuse.Subtype("ftpfs")}
+	if readOnly {
+		options = append(options, fuse.ReadOnly())
+	}
+	conn, err := fuse.Mount(mountpoint, options...)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		if err := fuse.Unmount(mountpoint); err != nil {
+			log.Print(err)
+		}
+	}()
+
+	if err := fusefs.Serve(conn, &filesystem{fs: ftpfs.New(c, root, ttl), ttl: ttl}); err != nil {
+		return err
+	}
+	<-conn.Ready
+	return conn.MountError
+}
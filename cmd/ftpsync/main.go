@@ -0,0 +1,119 @@
+// Command ftpsync mirrors a directory tree between the local disk and an
+// FTP server, in the manner of "lftp mirror".
+//
+// Usage:
+//
+//	ftpsync [flags] source destination
+//
+// One of source and destination is a local directory, the other an URL
+// ftp://[user[:password]@]host[:port]/path; the direction follows their
+// order. Files missing from the destination, or differing by size or by a
+// newer modification time, are copied; with -delete, files and directories
+// missing from the source are removed from the destination.
+//
+// The flags are:
+//
+//	-delete          delete the extraneous files of the destination
+//	-dry-run         print the operations without running them
+//	-include glob    only copy the files matching glob (repeatable)
+//	-exclude glob    skip the files and directories matching glob (repeatable)
+//	-parallel n      transfer n files at once (default 1)
+//	-v               print the operations as they run
+//
+// Globs are matched against the base name and the path relative to the
+// root of the mirror. Without a user in the URL, the credentials are looked
+// up in ~/.netrc, anonymous otherwise.
+//
+// The mirror is ftplib.Sync; ftpsync only maps its flags to SyncOptions.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/cxfans/ftplib"
+)
+
+// patterns is a repeatable flag.
+type patterns []string
+
+func (p *patterns) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *patterns) Set(s string) error {
+	*p = append(*p, s)
+	return nil
+}
+
+func main() {
+	var opts ftplib.SyncOptions
+	var include, exclude patterns
+	flag.BoolVar(&opts.Delete, "delete", false, "delete the extraneous files of the destination")
+	flag.BoolVar(&opts.DryRun, "dry-run", false, "print the operations without running them")
+	flag.Var(&include, "include", "only copy the files matching `glob` (repeatable)")
+	flag.Var(&exclude, "exclude", "skip the files and directories matching `glob` (repeatable)")
+	flag.IntVar(&opts.Parallelism, "parallel", 1, "transfer `n` files at once")
+	verbose := flag.Bool("v", false, "print the operations as they run")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: ftpsync [flags] source destination")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	opts.Filter = ftplib.PathFilter{Include: include, Exclude: exclude}
+	if *verbose || opts.DryRun {
+		opts.Report = report(os.Stdout)
+	}
+	if err := run(flag.Arg(0), flag.Arg(1), opts); err != nil {
+		fmt.Fprintln(os.Stderr, "ftpsync:", err)
+		os.Exit(1)
+	}
+}
+
+// report returns a SyncOptions.Report printing the operations to w.
+func report(w io.Writer) func(op ftplib.Operation) {
+	return func(op ftplib.Operation) {
+		fmt.Fprintln(w, op.Verb, op.Path)
+	}
+}
+
+// run mirrors source to destination, one of them an ftp URL, the other a
+// local directory.
+func run(source, destination string, opts ftplib.SyncOptions) error {
+	srcRemote, dstRemote := isURL(source), isURL(destination)
+	if srcRemote == dstRemote {
+		return fmt.Errorf("one of source and destination must be an ftp:// URL, the other a local directory")
+	}
+	opts.Direction = ftplib.Pull
+	spec, local := source, destination
+	if dstRemote {
+		opts.Direction = ftplib.Push
+		spec, local = destination, source
+	}
+	u, err := url.Parse(spec)
+	if err != nil {
+		return err
+	}
+	// Sync makes the remote directory when pushing, which OpenURL would
+	// fail to enter.
+	dir := u.Path
+	u.Path, u.RawPath = "", ""
+	c, err := ftplib.OpenURL(u.String())
+	if err != nil {
+		return err
+	}
+	defer c.Quit()
+	return c.Sync(local, dir, opts)
+}
+
+func isURL(s string) bool {
+	return strings.Contains(s, "://")
+}
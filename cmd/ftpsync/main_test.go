@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/cxfans/ftplib"
+)
+
+// files returns the files under dir with their contents, and its
+// directories with an empty content.
+func files(t *testing.T, dir string) map[string]string {
+	found := make(map[string]string)
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || p == dir {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		rel = filepath.ToSlash(rel)
+		if info.IsDir() {
+			found[rel+"/"] = ""
+			return nil
+		}
+		b, err := ioutil.ReadFile(p)
+		found[rel] = string(b)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return found
+}
+
+func keys(m map[string]string) string {
+	var names []string
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, " ")
+}
+
+// go test -run TestMirror
+func TestMirror(t *testing.T) {
+	remote, err := ioutil.TempDir("", "ftpsync-remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(remote)
+	local, err := ioutil.TempDir("", "ftpsync-local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(local)
+	for name, content := range map[string]string{
+		"a.txt":         "alpha",
+		"skip.tmp":      "temporary",
+		"sub/b.txt":     "beta",
+		"sub/deep/c.md": "gamma",
+		"cache/d.txt":   "cached",
+	} {
+		p := filepath.Join(local, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(remote, "pub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(remote, "pub", "stale.txt"), []byte("stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := ftplib.NewServer("127.0.0.1:0", remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	go server.ListenAndServe()
+	url := "ftp://user:secret@" + server.Addr().String() + "/pub"
+	opts := func() ftplib.SyncOptions {
+		return ftplib.SyncOptions{Filter: ftplib.PathFilter{Exclude: []string{"*.tmp", "cache"}}, Parallelism: 3}
+	}
+
+	// A dry run changes nothing.
+	var out bytes.Buffer
+	dry := opts()
+	dry.DryRun, dry.Delete, dry.Report = true, true, report(&out)
+	if err := run(local, url, dry); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"mkdir sub\n", "upload sub/deep/c.md\n", "delete stale.txt\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("dry run printed %q, lacking %q", out.String(), want)
+		}
+	}
+	if got := keys(files(t, filepath.Join(remote, "pub"))); got != "stale.txt" {
+		t.Errorf("dry run left %s", got)
+	}
+
+	// Push, deleting the extraneous files.
+	push := opts()
+	push.Delete = true
+	if err := run(local, url, push); err != nil {
+		t.Fatal(err)
+	}
+	want := "a.txt sub/ sub/b.txt sub/deep/ sub/deep/c.md"
+	if got := keys(files(t, filepath.Join(remote, "pub"))); got != want {
+		t.Errorf("pushed %s, want %s", got, want)
+	}
+
+	// A second run finds nothing to do.
+	out.Reset()
+	again := opts()
+	again.Delete, again.Report = true, report(&out)
+	if err := run(local, url, again); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("second run did %q", out.String())
+	}
+
+	// Pull back the text files only.
+	pulled := filepath.Join(local, "pulled")
+	pull := opts()
+	pull.Filter.Include = []string{"*.txt"}
+	if err := run(url, pulled, pull); err != nil {
+		t.Fatal(err)
+	}
+	got := files(t, pulled)
+	if keys(got) != "a.txt sub/ sub/b.txt sub/deep/" || got["sub/b.txt"] != "beta" {
+		t.Errorf("pulled %v", got)
+	}
+
+	if err := run(local, local, opts()); err == nil {
+		t.Error("mirrored two local directories")
+	}
+}
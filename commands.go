@@ -11,6 +11,7 @@ const (
 	AVBL = "AVBL" // Get the available space
 	CCC  = "CCC"  // Clear Command Channel
 	CDUP = "CDUP" // Change to Parent Directory.
+	CLNT = "CLNT" // Send FTP Client Name to server.
 	CONF = "CONF" // Confidentiality Protection Command
 	CSID = "CSID" // Client / Server Identification
 	CWD  = "CWD"  // Change working directory.
@@ -65,6 +66,7 @@ const (
 	TYPE = "TYPE" // Sets the transfer mode (ASCII/Binary).
 	USER = "USER" // Authentication username.
 	XCUP = "XCUP" // Change to the parent of the current working directory
+	XCWD = "XCWD" // Change the working directory
 	XMKD = "XMKD" // Make a directory
 	XPWD = "XPWD" // Print the current working directory
 	XRCP = "XRCP" //
@@ -73,3 +75,19 @@ const (
 	XSEM = "XSEM" // Send, mail if cannot
 	XSEN = "XSEN" // Send to terminal
 )
+
+// knownCommands are the commands defined by the RFCs, served or not.
+var knownCommands = map[string]bool{
+	ABOR: true, ACCT: true, ADAT: true, ALLO: true, APPE: true, AUTH: true,
+	AVBL: true, CCC: true, CDUP: true, CLNT: true, CONF: true, CSID: true,
+	CWD: true, DELE: true, DSIZ: true, ENC: true, EPRT: true, EPSV: true,
+	FEAT: true, HELP: true, HOST: true, LANG: true, LIST: true, LPRT: true,
+	LPSV: true, MDTM: true, MFCT: true, MFF: true, MFMT: true, MIC: true,
+	MKD: true, MLSD: true, MLST: true, MODE: true, NLST: true, NOOP: true,
+	OPTS: true, PASS: true, PASV: true, PBSZ: true, PORT: true, PROT: true,
+	PWD: true, QUIT: true, REIN: true, REST: true, RETR: true, RMD: true,
+	RMDA: true, RNFR: true, RNTO: true, SITE: true, SIZE: true, SMNT: true,
+	SPSV: true, STAT: true, STOR: true, STOU: true, STRU: true, SYST: true,
+	THMB: true, TYPE: true, USER: true, XCUP: true, XCWD: true, XMKD: true,
+	XPWD: true, XRCP: true, XRMD: true, XRSQ: true, XSEM: true, XSEN: true,
+}
@@ -0,0 +1,397 @@
+package conformance
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cxfans/ftplib"
+)
+
+// Checks are the checks Run runs, in order.
+var Checks = []Check{
+	{Name: "login", RFC: "RFC 959 5.4", anonymous: true, run: checkLogin},
+	{Name: "commands need login", RFC: "RFC 959 5.4", anonymous: true, run: checkNeedLogin},
+	{Name: "NOOP", RFC: "RFC 959 4.1.3", run: checkNoop},
+	{Name: "SYST", RFC: "RFC 959 4.1.3", run: checkSyst},
+	{Name: "unknown command", RFC: "RFC 959 4.2", run: checkUnknown},
+	{Name: "HELP multiline reply", RFC: "RFC 959 4.2", run: checkHelp},
+	{Name: "TYPE", RFC: "RFC 959 4.1.2", run: checkType},
+	{Name: "MODE and STRU", RFC: "RFC 959 4.1.2", run: checkModeStru},
+	{Name: "PWD quoting", RFC: "RFC 959 7", run: checkPwd},
+	{Name: "directories", RFC: "RFC 959 4.1.1", run: checkDirectories},
+	{Name: "missing directory", RFC: "RFC 959 4.1.1", run: checkMissingDir},
+	{Name: "STOR and RETR", RFC: "RFC 959 4.1.3", run: checkStorRetr},
+	{Name: "missing file", RFC: "RFC 959 4.1.3", run: checkMissingFile},
+	{Name: "LIST and NLST", RFC: "RFC 959 4.1.3", run: checkListings},
+	{Name: "RNFR and RNTO", RFC: "RFC 959 4.1.3", run: checkRename},
+	{Name: "RNTO without RNFR", RFC: "RFC 959 5.4", run: checkRntoAlone},
+	{Name: "QUIT", RFC: "RFC 959 4.1.1", run: checkQuit},
+	{Name: "FEAT", RFC: "RFC 2389 3", run: checkFeat},
+	{Name: "OPTS of an unknown command", RFC: "RFC 2389 4", run: checkOpts},
+	{Name: "SIZE", RFC: "RFC 3659 4", Feature: "SIZE", run: checkSize},
+	{Name: "REST STREAM", RFC: "RFC 3659 5", Feature: "REST STREAM", run: checkRest},
+	{Name: "MLST", RFC: "RFC 3659 7", Feature: "MLST", run: checkMlst},
+	{Name: "MLSD", RFC: "RFC 3659 7", Feature: "MLST", run: checkMlsd},
+	{Name: "TVFS paths", RFC: "RFC 3659 6", Feature: "TVFS", run: checkTvfs},
+	{Name: "EPSV", RFC: "RFC 2428 3", Feature: "EPSV", run: checkEpsv},
+}
+
+var content = []byte("conformance check\r\n")
+
+// withFile runs f on the name of a file stored for it, deleted afterwards.
+func (s *session) withFile(f func(name string) error) error {
+	name := tempName()
+	if _, err := s.transfer(content, "STOR %s", name); err != nil {
+		return err
+	}
+	err := f(name)
+	if _, derr := s.expect([]int{ftplib.StatusRequestedFileActionOK}, "DELE %s", name); err == nil {
+		err = derr
+	}
+	return err
+}
+
+func checkLogin(s *session) error {
+	return s.login()
+}
+
+func checkNeedLogin(s *session) error {
+	_, err := s.expect([]int{ftplib.StatusNotLoggedIn}, "PWD")
+	return err
+}
+
+func checkNoop(s *session) error {
+	_, err := s.expect([]int{ftplib.StatusCommandOK}, "NOOP")
+	return err
+}
+
+func checkSyst(s *session) error {
+	_, err := s.expect([]int{ftplib.StatusName}, "SYST")
+	return err
+}
+
+func checkUnknown(s *session) error {
+	_, err := s.expect([]int{ftplib.StatusBadCommand, ftplib.StatusNotImplemented}, "XYZZY")
+	return err
+}
+
+func checkHelp(s *session) error {
+	_, err := s.expect([]int{ftplib.StatusSystem, ftplib.StatusHelp}, "HELP")
+	return err
+}
+
+func checkType(s *session) error {
+	for _, t := range []string{"A", "I"} {
+		if _, err := s.expect([]int{ftplib.StatusCommandOK}, "TYPE %s", t); err != nil {
+			return err
+		}
+	}
+	_, err := s.expect([]int{ftplib.StatusBadArguments, ftplib.StatusNotImplementedParameter}, "TYPE Z")
+	return err
+}
+
+func checkModeStru(s *session) error {
+	if _, err := s.expect([]int{ftplib.StatusCommandOK}, "MODE S"); err != nil {
+		return err
+	}
+	_, err := s.expect([]int{ftplib.StatusCommandOK}, "STRU F")
+	return err
+}
+
+func checkPwd(s *session) error {
+	msg, err := s.expect([]int{ftplib.StatusPathCreated}, "PWD")
+	if err != nil {
+		return err
+	}
+	if _, err := ftplib.ParsePWD(msg); err != nil {
+		return fmt.Errorf("PWD: %v in %q", err, msg)
+	}
+	return nil
+}
+
+func checkDirectories(s *session) error {
+	msg, err := s.expect([]int{ftplib.StatusPathCreated}, "PWD")
+	if err != nil {
+		return err
+	}
+	home, err := ftplib.ParsePWD(msg)
+	if err != nil {
+		return err
+	}
+	name := strings.TrimSuffix(tempName(), ".txt")
+	msg, err = s.expect([]int{ftplib.StatusPathCreated}, "MKD %s", name)
+	if err != nil {
+		return err
+	}
+	if created, err := ftplib.ParsePWD(msg); err != nil || path.Base(created) != name {
+		err = fmt.Errorf("MKD: reply %q does not quote the directory", msg)
+		s.cmd("RMD %s", name)
+		return err
+	}
+	err = func() error {
+		if _, err := s.expect([]int{ftplib.StatusRequestedFileActionOK}, "CWD %s", name); err != nil {
+			return err
+		}
+		msg, err := s.expect([]int{ftplib.StatusPathCreated}, "PWD")
+		if err != nil {
+			return err
+		}
+		if dir, _ := ftplib.ParsePWD(msg); path.Base(dir) != name {
+			return fmt.Errorf("PWD: %q after CWD %s", dir, name)
+		}
+		if _, err := s.expect([]int{ftplib.StatusCommandOK, ftplib.StatusRequestedFileActionOK}, "CDUP"); err != nil {
+			return err
+		}
+		msg, err = s.expect([]int{ftplib.StatusPathCreated}, "PWD")
+		if err != nil {
+			return err
+		}
+		if dir, _ := ftplib.ParsePWD(msg); dir != home {
+			return fmt.Errorf("PWD: %q after CDUP, want %q", dir, home)
+		}
+		return nil
+	}()
+	if _, rerr := s.expect([]int{ftplib.StatusRequestedFileActionOK}, "RMD %s", name); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+func checkMissingDir(s *session) error {
+	_, err := s.expect([]int{ftplib.StatusFileUnavailable}, "CWD %s", tempName())
+	return err
+}
+
+func checkStorRetr(s *session) error {
+	if _, err := s.expect([]int{ftplib.StatusCommandOK}, "TYPE I"); err != nil {
+		return err
+	}
+	return s.withFile(func(name string) error {
+		data, err := s.transfer(nil, "RETR %s", name)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(data, content) {
+			return fmt.Errorf("RETR: got %q, stored %q", data, content)
+		}
+		return nil
+	})
+}
+
+func checkMissingFile(s *session) error {
+	dc, err := s.passive()
+	if err != nil {
+		return err
+	}
+	defer dc.Close()
+	_, err = s.expect([]int{ftplib.StatusFileUnavailable, ftplib.StatusFileActionIgnored}, "RETR %s", tempName())
+	return err
+}
+
+func checkListings(s *session) error {
+	return s.withFile(func(name string) error {
+		data, err := s.transfer(nil, "NLST")
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, line := range strings.Split(string(data), "\n") {
+			if path.Base(strings.TrimRight(line, "\r")) == name {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("NLST: %s not listed in %q", name, data)
+		}
+		if data, err = s.transfer(nil, "LIST"); err != nil {
+			return err
+		}
+		if !bytes.Contains(data, []byte(name)) {
+			return fmt.Errorf("LIST: %s not listed in %q", name, data)
+		}
+		return nil
+	})
+}
+
+func checkRename(s *session) error {
+	return s.withFile(func(name string) error {
+		renamed := "renamed-" + name
+		if _, err := s.expect([]int{ftplib.StatusRequestFilePending}, "RNFR %s", name); err != nil {
+			return err
+		}
+		if _, err := s.expect([]int{ftplib.StatusRequestedFileActionOK}, "RNTO %s", renamed); err != nil {
+			return err
+		}
+		// Rename it back for withFile to delete it.
+		if _, err := s.expect([]int{ftplib.StatusRequestFilePending}, "RNFR %s", renamed); err != nil {
+			return err
+		}
+		_, err := s.expect([]int{ftplib.StatusRequestedFileActionOK}, "RNTO %s", name)
+		return err
+	})
+}
+
+func checkRntoAlone(s *session) error {
+	_, err := s.expect([]int{ftplib.StatusBadSequence}, "RNTO %s", tempName())
+	return err
+}
+
+func checkQuit(s *session) error {
+	_, err := s.expect([]int{ftplib.StatusClosing}, "QUIT")
+	return err
+}
+
+func checkFeat(s *session) error {
+	code, msg, err := s.cmd("FEAT")
+	if err != nil {
+		return err
+	}
+	if code == ftplib.StatusBadCommand || code == ftplib.StatusNotImplemented {
+		// Servers without extensions need not implement FEAT.
+		return nil
+	}
+	if err := want("FEAT", code, msg, []int{ftplib.StatusSystem}); err != nil {
+		return err
+	}
+	lines := strings.Split(msg, "\n")
+	for _, line := range lines[1 : len(lines)-1] {
+		if !strings.HasPrefix(line, " ") {
+			return fmt.Errorf("FEAT: feature line %q does not start with a space", line)
+		}
+	}
+	return nil
+}
+
+func checkOpts(s *session) error {
+	_, err := s.expect([]int{ftplib.StatusBadArguments, ftplib.StatusNotImplementedParameter}, "OPTS XYZZY on")
+	return err
+}
+
+func checkSize(s *session) error {
+	if _, err := s.expect([]int{ftplib.StatusCommandOK}, "TYPE I"); err != nil {
+		return err
+	}
+	return s.withFile(func(name string) error {
+		msg, err := s.expect([]int{ftplib.StatusFile}, "SIZE %s", name)
+		if err != nil {
+			return err
+		}
+		if size, err := strconv.Atoi(strings.TrimSpace(msg)); err != nil || size != len(content) {
+			return fmt.Errorf("SIZE: got %q, want %d", msg, len(content))
+		}
+		_, err = s.expect([]int{ftplib.StatusFileUnavailable}, "SIZE %s", tempName())
+		return err
+	})
+}
+
+func checkRest(s *session) error {
+	if _, err := s.expect([]int{ftplib.StatusCommandOK}, "TYPE I"); err != nil {
+		return err
+	}
+	return s.withFile(func(name string) error {
+		const offset = 5
+		dc, err := s.passive()
+		if err != nil {
+			return err
+		}
+		defer dc.Close()
+		// REST applies to the transfer command right after it.
+		if _, err := s.expect([]int{ftplib.StatusRequestFilePending}, "REST %d", offset); err != nil {
+			return err
+		}
+		if _, err := s.expect([]int{ftplib.StatusAlreadyOpen, ftplib.StatusAboutToSend}, "RETR %s", name); err != nil {
+			return err
+		}
+		dc.SetDeadline(time.Now().Add(s.cfg.Timeout))
+		data, err := ioutil.ReadAll(dc)
+		if err != nil {
+			return err
+		}
+		code, msg, err := s.read()
+		if err != nil {
+			return err
+		}
+		if err := want("RETR", code, msg, []int{ftplib.StatusClosingDataConnection, ftplib.StatusRequestedFileActionOK}); err != nil {
+			return err
+		}
+		if !bytes.Equal(data, content[offset:]) {
+			return fmt.Errorf("RETR after REST %d: got %q, want %q", offset, data, content[offset:])
+		}
+		return nil
+	})
+}
+
+func checkMlst(s *session) error {
+	return s.withFile(func(name string) error {
+		msg, err := s.expect([]int{ftplib.StatusRequestedFileActionOK}, "MLST %s", name)
+		if err != nil {
+			return err
+		}
+		lines := strings.Split(msg, "\n")
+		if len(lines) < 3 || !strings.HasPrefix(lines[1], " ") {
+			return fmt.Errorf("MLST: reply %q lacks a fact line", msg)
+		}
+		e, err := ftplib.ParseMLSxLine(lines[1][1:])
+		if err != nil {
+			return fmt.Errorf("MLST: %v in %q", err, lines[1])
+		}
+		if e.Type != ftplib.EntryTypeFile || path.Base(e.Name) != name {
+			return fmt.Errorf("MLST: facts %q do not describe %s", lines[1], name)
+		}
+		return nil
+	})
+}
+
+func checkMlsd(s *session) error {
+	return s.withFile(func(name string) error {
+		data, err := s.transfer(nil, "MLSD")
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			e, err := ftplib.ParseMLSxLine(line)
+			if err != nil {
+				return fmt.Errorf("MLSD: %v in %q", err, line)
+			}
+			if e.Name == name {
+				if e.Size != uint64(len(content)) {
+					return fmt.Errorf("MLSD: size of %s is %d, want %d", name, e.Size, len(content))
+				}
+				return nil
+			}
+		}
+		return fmt.Errorf("MLSD: %s not listed in %q", name, data)
+	})
+}
+
+func checkTvfs(s *session) error {
+	msg, err := s.expect([]int{ftplib.StatusPathCreated}, "PWD")
+	if err != nil {
+		return err
+	}
+	home, err := ftplib.ParsePWD(msg)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(home, "/") {
+		return fmt.Errorf("PWD: %q is not a TVFS path", home)
+	}
+	_, err = s.expect([]int{ftplib.StatusRequestedFileActionOK}, "CWD %s", path.Join(home, "."))
+	return err
+}
+
+func checkEpsv(s *session) error {
+	msg, err := s.expect([]int{ftplib.StatusExtendedPassiveMode}, "EPSV")
+	if err != nil {
+		return err
+	}
+	if _, err := ftplib.ParseEPSV(msg); err != nil {
+		return fmt.Errorf("EPSV: %v in %q", err, msg)
+	}
+	return nil
+}
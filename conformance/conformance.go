@@ -0,0 +1,307 @@
+// Package conformance checks that an FTP server follows RFC 959, RFC 2389
+// and RFC 3659, and the extensions the package's client relies on.
+//
+// Run plays each check on a session of its own, logged in unless the check
+// is about logging in, and returns a Result per check:
+//
+//	results := conformance.Run(conformance.Config{Addr: "ftp.example.com:21", User: "joe", Password: "secret"})
+//	conformance.WriteMatrix(os.Stdout, results)
+//
+// The checks storing files do so in the login directory, under names
+// starting with "conformance-", and delete them afterwards. Checks of
+// extensions the server does not list in its FEAT reply are skipped.
+package conformance
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cxfans/ftplib"
+)
+
+// Config is the server to check.
+type Config struct {
+	Addr           string
+	User, Password string
+	// Timeout bounds each network operation, 10 seconds if zero.
+	Timeout time.Duration
+}
+
+// Check is a check of the suite.
+type Check struct {
+	Name string
+	RFC  string // the document and section it checks, as "RFC 959 4.1.1"
+	// Feature is the FEAT line the check needs, "" for commands every
+	// server must implement.
+	Feature string
+
+	anonymous bool // whether the session is left before logging in
+	run       func(s *session) error
+}
+
+// Result is the outcome of a check.
+type Result struct {
+	Check   Check
+	Skipped bool
+	Err     error // nil if the check passed or was skipped
+}
+
+// Passed reports whether the check ran and passed.
+func (r Result) Passed() bool {
+	return !r.Skipped && r.Err == nil
+}
+
+// Run runs the checks of the suite against the server of cfg.
+func Run(cfg Config) []Result {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	results := make([]Result, 0, len(Checks))
+	for _, check := range Checks {
+		results = append(results, runCheck(cfg, check))
+	}
+	return results
+}
+
+func runCheck(cfg Config, check Check) Result {
+	s, err := dial(cfg)
+	if err != nil {
+		return Result{Check: check, Err: err}
+	}
+	defer s.close()
+	if !check.anonymous {
+		if err := s.login(); err != nil {
+			return Result{Check: check, Err: fmt.Errorf("login: %v", err)}
+		}
+	}
+	if check.Feature != "" {
+		if err := s.feat(); err != nil {
+			return Result{Check: check, Err: err}
+		}
+		if !s.hasFeature(check.Feature) {
+			return Result{Check: check, Skipped: true}
+		}
+	}
+	return Result{Check: check, Err: check.run(s)}
+}
+
+// WriteMatrix writes results as a table, with a summary line.
+func WriteMatrix(w io.Writer, results []Result) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "RFC\tCHECK\tRESULT\tDETAIL")
+	var passed, failed, skipped int
+	for _, r := range results {
+		status, detail := "pass", ""
+		switch {
+		case r.Skipped:
+			status, detail = "skip", "no "+r.Check.Feature+" in FEAT"
+			skipped++
+		case r.Err != nil:
+			status, detail = "FAIL", r.Err.Error()
+			failed++
+		default:
+			passed++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Check.RFC, r.Check.Name, status, detail)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%d passed, %d failed, %d skipped\n", passed, failed, skipped)
+	return err
+}
+
+// session is a control connection to the server checked.
+type session struct {
+	cfg      Config
+	conn     *textproto.Conn
+	raw      net.Conn
+	host     string
+	features map[string]string
+}
+
+func dial(cfg Config) (*session, error) {
+	raw, err := net.DialTimeout("tcp", cfg.Addr, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	host, _, _ := net.SplitHostPort(raw.RemoteAddr().String())
+	s := &session{cfg: cfg, raw: raw, conn: textproto.NewConn(raw), host: host}
+	code, msg, err := s.read()
+	if err == nil && code == ftplib.StatusReadyMinute {
+		code, msg, err = s.read()
+	}
+	if err == nil && code != ftplib.StatusReady {
+		err = fmt.Errorf("greeting %d %s", code, msg)
+	}
+	if err != nil {
+		s.close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *session) close() {
+	s.conn.Close()
+}
+
+// read reads a reply.
+func (s *session) read() (int, string, error) {
+	s.raw.SetDeadline(time.Now().Add(s.cfg.Timeout))
+	code, msg, err := s.conn.ReadResponse(-1)
+	if _, ok := err.(*textproto.Error); ok {
+		// Only malformed replies are errors here, codes are for the checks.
+		err = nil
+	}
+	return code, msg, err
+}
+
+// cmd sends a command and returns the code and text of its reply.
+func (s *session) cmd(format string, args ...interface{}) (int, string, error) {
+	s.raw.SetDeadline(time.Now().Add(s.cfg.Timeout))
+	if _, err := s.conn.Cmd(format, args...); err != nil {
+		return 0, "", err
+	}
+	return s.read()
+}
+
+// expect sends a command and checks that the code of its reply is one of
+// codes, returning its text.
+func (s *session) expect(codes []int, format string, args ...interface{}) (string, error) {
+	code, msg, err := s.cmd(format, args...)
+	if err != nil {
+		return "", err
+	}
+	return msg, want(verbOf(format), code, msg, codes)
+}
+
+// want checks that the reply to verb has one of codes.
+func want(verb string, code int, msg string, codes []int) error {
+	for _, c := range codes {
+		if code == c {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: got %d %s, want %s", verb, code, firstLine(msg), codeList(codes))
+}
+
+func verbOf(format string) string {
+	return strings.SplitN(format, " ", 2)[0]
+}
+
+func firstLine(msg string) string {
+	return strings.SplitN(msg, "\n", 2)[0]
+}
+
+func codeList(codes []int) string {
+	s := make([]string, len(codes))
+	for i, c := range codes {
+		s[i] = strconv.Itoa(c)
+	}
+	return strings.Join(s, " or ")
+}
+
+func (s *session) login() error {
+	code, msg, err := s.cmd("USER %s", s.cfg.User)
+	if err != nil {
+		return err
+	}
+	switch code {
+	case ftplib.StatusLoggedIn:
+		return nil
+	case ftplib.StatusUserOK:
+		_, err := s.expect([]int{ftplib.StatusLoggedIn, ftplib.StatusCommandNotImplemented}, "PASS %s", s.cfg.Password)
+		return err
+	}
+	return fmt.Errorf("USER: got %d %s", code, firstLine(msg))
+}
+
+func (s *session) feat() error {
+	if s.features != nil {
+		return nil
+	}
+	s.features = make(map[string]string)
+	code, msg, err := s.cmd("FEAT")
+	if err != nil || code != ftplib.StatusSystem {
+		return err
+	}
+	for _, line := range strings.Split(msg, "\n") {
+		if !strings.HasPrefix(line, " ") {
+			continue
+		}
+		fields := strings.SplitN(strings.TrimSpace(line), " ", 2)
+		name := strings.ToUpper(fields[0])
+		if len(fields) == 2 {
+			s.features[name] = fields[1]
+		} else {
+			s.features[name] = ""
+		}
+	}
+	return nil
+}
+
+// hasFeature reports whether the FEAT reply lists feature, a name possibly
+// followed by a parameter as in "REST STREAM".
+func (s *session) hasFeature(feature string) bool {
+	fields := strings.SplitN(feature, " ", 2)
+	params, ok := s.features[strings.ToUpper(fields[0])]
+	if !ok || len(fields) == 1 {
+		return ok
+	}
+	return strings.EqualFold(params, fields[1])
+}
+
+// passive opens a data connection with PASV, connecting to the control
+// host rather than the address of the reply, like the client does.
+func (s *session) passive() (net.Conn, error) {
+	msg, err := s.expect([]int{ftplib.StatusPassiveMode}, "PASV")
+	if err != nil {
+		return nil, err
+	}
+	_, port, err := ftplib.ParsePASV(msg)
+	if err != nil {
+		return nil, fmt.Errorf("PASV: %v in %q", err, msg)
+	}
+	return net.DialTimeout("tcp", net.JoinHostPort(s.host, strconv.Itoa(port)), s.cfg.Timeout)
+}
+
+// transfer runs the data command over a passive connection, sending upload
+// if not nil, and returns the data received.
+func (s *session) transfer(upload []byte, format string, args ...interface{}) ([]byte, error) {
+	dc, err := s.passive()
+	if err != nil {
+		return nil, err
+	}
+	defer dc.Close()
+	if _, err := s.expect([]int{ftplib.StatusAlreadyOpen, ftplib.StatusAboutToSend}, format, args...); err != nil {
+		return nil, err
+	}
+	dc.SetDeadline(time.Now().Add(s.cfg.Timeout))
+	var data []byte
+	if upload != nil {
+		_, err = dc.Write(upload)
+	} else {
+		data, err = ioutil.ReadAll(dc)
+	}
+	dc.Close()
+	if err != nil {
+		return nil, err
+	}
+	code, msg, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	return data, want(verbOf(format), code, msg, []int{ftplib.StatusClosingDataConnection, ftplib.StatusRequestedFileActionOK})
+}
+
+// tempName returns a name for a file of the check.
+func tempName() string {
+	return fmt.Sprintf("conformance-%d.txt", time.Now().UnixNano())
+}
@@ -0,0 +1,44 @@
+package conformance_test
+
+import (
+	"flag"
+	"strings"
+	"testing"
+
+	"github.com/cxfans/ftplib/conformance"
+	"github.com/cxfans/ftplib/ftptest"
+)
+
+var (
+	addr     = flag.String("addr", "", "check the server at this address rather than an ftptest server")
+	user     = flag.String("user", "anonymous", "user name for -addr")
+	password = flag.String("password", "conformance@", "password for -addr")
+)
+
+// go test -run TestConformance
+// go test -run TestConformance -v -args -addr ftp.example.com:21 -user joe -password secret
+func TestConformance(t *testing.T) {
+	cfg := conformance.Config{Addr: *addr, User: *user, Password: *password}
+	if cfg.Addr == "" {
+		a, cleanup, err := ftptest.Start(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cleanup()
+		cfg = conformance.Config{Addr: a, User: "user", Password: "password"}
+	}
+	results := conformance.Run(cfg)
+	if len(results) != len(conformance.Checks) {
+		t.Fatalf("got %d results for %d checks", len(results), len(conformance.Checks))
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			t.Errorf("%s (%s): %v", r.Check.Name, r.Check.RFC, r.Err)
+		}
+	}
+	var matrix strings.Builder
+	if err := conformance.WriteMatrix(&matrix, results); err != nil {
+		t.Fatal(err)
+	}
+	t.Log("\n" + matrix.String())
+}
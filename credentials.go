@@ -0,0 +1,109 @@
+package ftplib
+
+import (
+	"errors"
+)
+
+// Credentials are what a client logs in with.
+type Credentials struct {
+	User     string
+	Password string
+	// Account is sent with ACCT to the servers asking for one, with a 332
+	// reply.
+	Account string
+}
+
+// CredentialProvider supplies the credentials of a client at each of its
+// logins: the first one, those of SetAutoReconnect and those of the other
+// sessions of UploadDir, Download and Sync. Asking at each login lets the
+// provider fetch the credentials from a vault or a secret manager, and
+// rotate them, without the caller reconnecting.
+type CredentialProvider interface {
+	// Credentials returns the credentials for the server at addr, as
+	// given to Dial.
+	Credentials(addr string) (Credentials, error)
+}
+
+// CredentialsFunc adapts a function to a CredentialProvider.
+type CredentialsFunc func(addr string) (Credentials, error)
+
+// Credentials calls f(addr).
+func (f CredentialsFunc) Credentials(addr string) (Credentials, error) {
+	return f(addr)
+}
+
+// WithCredentials dials a ClientConn logged in with the credentials of p,
+// asking p again at each login, as LoginWith.
+func WithCredentials(p CredentialProvider) DialOption {
+	return func(c *ClientConn) {
+		c.creds = p
+	}
+}
+
+// LoginWith logs in with the credentials of p, and asks p again at each
+// later login of the client instead of reusing them.
+func (c *ClientConn) LoginWith(p CredentialProvider) error {
+	creds, err := p.Credentials(c.addr)
+	if err != nil {
+		return err
+	}
+	if err := c.login(creds); err != nil {
+		return err
+	}
+	c.creds = p
+	return nil
+}
+
+var errNeedAccount = errors.New("server asks for an account, which the credentials lack")
+
+// login logs in with creds, sending their account if the server asks for
+// it after USER or PASS.
+func (c *ClientConn) login(creds Credentials) (err error) {
+	span := c.startSpan("LOGIN", "")
+	span.setAttribute(AttrUser, creds.User)
+	defer func() { span.end(err) }()
+	cmd := "USER"
+	code, message, err := c.cmd(-1, "USER %s", creds.User)
+	if err == nil && code == StatusUserOK {
+		cmd = "PASS"
+		code, message, err = c.cmd(-1, "PASS %s", creds.Password)
+	}
+	if err == nil && code == StatusLoginNeedAccount {
+		if creds.Account == "" {
+			return errNeedAccount
+		}
+		cmd = "ACCT"
+		code, message, err = c.cmd(-1, "ACCT %s", creds.Account)
+	}
+	if err != nil {
+		return err
+	}
+	// 202: the server needs no account, or no password.
+	if code != StatusLoggedIn && code != StatusCommandNotImplemented {
+		return &FTPError{Code: code, Message: message, Cmd: cmd}
+	}
+
+	// Switch to binary mode
+	_, _, err = c.cmd(StatusCommandOK, "TYPE I")
+	if err != nil {
+		return err
+	}
+	c.typ = TypeBinary
+	c.user, c.password, c.account = creds.User, creds.Password, creds.Account
+	c.creds = nil
+
+	c.logf("User logged in.")
+	return nil
+}
+
+// relogin logs c in as from is: with the credentials of its provider, or
+// those it logged in with. It does nothing if from never logged in.
+func (c *ClientConn) relogin(from *ClientConn) error {
+	if from.creds != nil {
+		return c.LoginWith(from.creds)
+	}
+	if from.user == "" {
+		return nil
+	}
+	return c.login(Credentials{from.user, from.password, from.account})
+}
@@ -1,10 +1,12 @@
 package ftplib
 
 import (
+	"errors"
 	"log"
 	"net"
 	"strconv"
-	"strings"
+	"sync"
+	"time"
 )
 
 type DataConn interface {
@@ -13,17 +15,96 @@ type DataConn interface {
 	Write(p []byte) (n int, err error)
 	Read(p []byte) (n int, err error)
 	Close() error
+
+	// Deadlines may be set before the connection is established; they
+	// apply once it is.
+	SetDeadline(t time.Time) error
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+
+	// RemoteAddr returns the address of the peer, or nil while the
+	// connection is not established.
+	RemoteAddr() net.Addr
+}
+
+// deadlines holds the deadlines of a data connection until it is
+// established.
+type deadlines struct {
+	read, write time.Time
+}
+
+// set records the deadlines t, applying them to conn if not nil.
+func (d *deadlines) set(conn net.Conn, read, write bool, t time.Time) error {
+	if read {
+		d.read = t
+	}
+	if write {
+		d.write = t
+	}
+	if conn == nil {
+		return nil
+	}
+	if read && write {
+		return conn.SetDeadline(t)
+	}
+	if read {
+		return conn.SetReadDeadline(t)
+	}
+	return conn.SetWriteDeadline(t)
 }
 
+// apply sets the deadlines recorded on the newly established conn.
+func (d *deadlines) apply(conn net.Conn) {
+	conn.SetReadDeadline(d.read)
+	conn.SetWriteDeadline(d.write)
+}
+
+// DefaultPassiveTimeout bounds the wait for the client to connect to a
+// PassiveConn created without a timeout.
+const DefaultPassiveTimeout = 30 * time.Second
+
+var errDataConnClosed = errors.New("data connection closed")
+
+// PassiveConn is the data connection of passive mode (PASV, EPSV): the
+// server listens and the client connects to it.
+//
+// The first connection accepted is the data connection; the listener is
+// released right after it, or once the wait for the client times out.
 type PassiveConn struct {
-	conn       *net.TCPConn
 	host, port string
-	done       chan bool
-	err        error
+	pool       *PassivePool
+	timeout    time.Duration
+	sockopts   SocketOptions
+
+	mu        sync.Mutex
+	listener  *net.TCPListener // nil once released
+	peer      *net.TCPConn     // conn, for the methods not waiting for it
+	deadlines deadlines
+
+	accepted  chan struct{} // closed once conn and err are set
+	conn      *net.TCPConn
+	err       error
+	closeOnce sync.Once
 }
 
 func NewPassiveConn(host string) (passiveConn *PassiveConn, err error) {
-	passiveConn = &PassiveConn{host: host, done: make(chan bool, 1)}
+	return newPassiveConn(host, nil, 0, SocketOptions{})
+}
+
+// newPassiveConn returns a passive connection listening on a listener
+// borrowed from pool, or on a new one when pool is nil, which waits for the
+// client up to timeout and sets sockopts on the connection accepted.
+func newPassiveConn(host string, pool *PassivePool, timeout time.Duration, sockopts SocketOptions) (passiveConn *PassiveConn, err error) {
+	if timeout <= 0 {
+		timeout = DefaultPassiveTimeout
+	}
+	passiveConn = &PassiveConn{
+		host:     host,
+		pool:     pool,
+		timeout:  timeout,
+		sockopts: sockopts,
+		accepted: make(chan struct{}),
+	}
 	if err := passiveConn.ListenAndServe(); err != nil {
 		return nil, err
 	}
@@ -31,8 +112,9 @@ func NewPassiveConn(host string) (passiveConn *PassiveConn, err error) {
 	return passiveConn, nil
 }
 
+// Host returns the address the connection listens on.
 func (passiveConn *PassiveConn) Host() string {
-	return "127.0.0.1"
+	return passiveConn.host
 }
 
 func (passiveConn *PassiveConn) Port() int {
@@ -40,60 +122,241 @@ func (passiveConn *PassiveConn) Port() int {
 	return port
 }
 
-func (passiveConn *PassiveConn) Close() error {
-	log.Println("Passive data connection closed.")
-	return passiveConn.conn.Close()
+// Close closes the data connection, or stops waiting for it.
+func (passiveConn *PassiveConn) Close() (err error) {
+	passiveConn.closeOnce.Do(func() {
+		passiveConn.mu.Lock()
+		if passiveConn.listener != nil {
+			// Wake the pending accept up; it releases the listener.
+			passiveConn.listener.SetDeadline(time.Now())
+		}
+		passiveConn.mu.Unlock()
+		<-passiveConn.accepted
+		if passiveConn.conn != nil {
+			err = passiveConn.conn.Close()
+		}
+		log.Println("Passive data connection closed.")
+	})
+	return err
 }
 
-func (passiveConn *PassiveConn) ListenAndServe() error {
+// listen returns the listener of the connection.
+func (passiveConn *PassiveConn) listen() (*net.TCPListener, error) {
+	if passiveConn.pool != nil {
+		return passiveConn.pool.get()
+	}
 	laddr, err := net.ResolveTCPAddr("tcp4", passiveConn.host+":0")
 	if err != nil {
-		log.Println(err)
-		return err
+		return nil, err
 	}
-	listener, err := net.ListenTCP("tcp4", laddr)
+	return net.ListenTCP("tcp4", laddr)
+}
+
+// ListenAndServe starts listening and accepts the data connection in the
+// background.
+func (passiveConn *PassiveConn) ListenAndServe() error {
+	listener, err := passiveConn.listen()
 	if err != nil {
 		log.Println(err)
 		return err
 	}
-	addr := listener.Addr()
-	parts := strings.Split(addr.String(), ":")
-	passiveConn.host = parts[0]
-	passiveConn.port = parts[1]
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	passiveConn.host, passiveConn.port = host, port
+	passiveConn.listener = listener
+	listener.SetDeadline(time.Now().Add(passiveConn.timeout))
 
 	go func() {
 		conn, err := listener.AcceptTCP()
-		passiveConn.done <- true
+		passiveConn.release()
 		if err != nil {
 			log.Println(err)
-			passiveConn.err = err
-			return
+		} else {
+			if err := passiveConn.sockopts.apply(conn); err != nil {
+				log.Println(err)
+			}
+			passiveConn.mu.Lock()
+			passiveConn.deadlines.apply(conn)
+			passiveConn.peer = conn
+			passiveConn.mu.Unlock()
 		}
-		passiveConn.err = nil
-		passiveConn.conn = conn
+		passiveConn.conn, passiveConn.err = conn, err
+		close(passiveConn.accepted)
 	}()
-
 	return nil
 }
 
-func (passiveConn *PassiveConn) wait() bool {
-	if passiveConn.conn != nil {
-		return true
+// release closes the listener, or gives it back to its pool.
+func (passiveConn *PassiveConn) release() {
+	passiveConn.mu.Lock()
+	listener := passiveConn.listener
+	passiveConn.listener = nil
+	passiveConn.mu.Unlock()
+	if passiveConn.pool == nil {
+		listener.Close()
+		return
 	}
-	<-passiveConn.done
-	return passiveConn.conn != nil
+	listener.SetDeadline(time.Time{})
+	passiveConn.pool.put(listener)
+}
+
+func (passiveConn *PassiveConn) SetDeadline(t time.Time) error {
+	return passiveConn.setDeadlines(true, true, t)
+}
+
+func (passiveConn *PassiveConn) SetReadDeadline(t time.Time) error {
+	return passiveConn.setDeadlines(true, false, t)
+}
+
+func (passiveConn *PassiveConn) SetWriteDeadline(t time.Time) error {
+	return passiveConn.setDeadlines(false, true, t)
+}
+
+func (passiveConn *PassiveConn) setDeadlines(read, write bool, t time.Time) error {
+	passiveConn.mu.Lock()
+	defer passiveConn.mu.Unlock()
+	var conn net.Conn
+	if passiveConn.peer != nil {
+		conn = passiveConn.peer
+	}
+	return passiveConn.deadlines.set(conn, read, write, t)
+}
+
+// RemoteAddr returns the address of the client, once connected.
+func (passiveConn *PassiveConn) RemoteAddr() net.Addr {
+	passiveConn.mu.Lock()
+	defer passiveConn.mu.Unlock()
+	if passiveConn.peer == nil {
+		return nil
+	}
+	return passiveConn.peer.RemoteAddr()
+}
+
+// wait returns once the client connected, or failed to.
+func (passiveConn *PassiveConn) wait() error {
+	<-passiveConn.accepted
+	return passiveConn.err
 }
 
 func (passiveConn *PassiveConn) Read(data []byte) (n int, err error) {
-	if !passiveConn.wait() {
-		return 0, passiveConn.err
+	if err := passiveConn.wait(); err != nil {
+		return 0, err
 	}
 	return passiveConn.conn.Read(data)
 }
 
 func (passiveConn *PassiveConn) Write(data []byte) (n int, err error) {
-	if !passiveConn.wait() {
-		return 0, passiveConn.err
+	if err := passiveConn.wait(); err != nil {
+		return 0, err
 	}
 	return passiveConn.conn.Write(data)
 }
+
+// DefaultActiveTimeout bounds the connection to the client of an ActiveConn
+// created without a timeout.
+const DefaultActiveTimeout = 30 * time.Second
+
+// ActiveConn is the data connection of active mode (PORT, EPRT): the server
+// connects to the address announced by the client, on first use.
+type ActiveConn struct {
+	raddr, laddr *net.TCPAddr
+	timeout      time.Duration
+	sockopts     SocketOptions // set on the connection once made
+
+	once sync.Once
+	conn net.Conn
+	err  error
+
+	mu        sync.Mutex
+	dialed    net.Conn // conn, for the methods not waiting for it
+	deadlines deadlines
+}
+
+// NewActiveConn returns a data connection to raddr, made from the local
+// address laddr when it is not nil, and failing after timeout.
+func NewActiveConn(raddr, laddr *net.TCPAddr, timeout time.Duration) *ActiveConn {
+	if timeout <= 0 {
+		timeout = DefaultActiveTimeout
+	}
+	return &ActiveConn{raddr: raddr, laddr: laddr, timeout: timeout}
+}
+
+func (activeConn *ActiveConn) Host() string {
+	return activeConn.raddr.IP.String()
+}
+
+func (activeConn *ActiveConn) Port() int {
+	return activeConn.raddr.Port
+}
+
+// dial connects to the client the first time it is called.
+func (activeConn *ActiveConn) dial() error {
+	activeConn.once.Do(func() {
+		dialer := &net.Dialer{Timeout: activeConn.timeout}
+		if activeConn.laddr != nil {
+			dialer.LocalAddr = activeConn.laddr
+		}
+		activeConn.conn, activeConn.err = dialer.Dial("tcp", activeConn.raddr.String())
+		if activeConn.err != nil {
+			log.Println(activeConn.err)
+			return
+		}
+		if err := activeConn.sockopts.apply(activeConn.conn); err != nil {
+			log.Println(err)
+		}
+		activeConn.mu.Lock()
+		activeConn.deadlines.apply(activeConn.conn)
+		activeConn.dialed = activeConn.conn
+		activeConn.mu.Unlock()
+	})
+	return activeConn.err
+}
+
+func (activeConn *ActiveConn) Read(data []byte) (n int, err error) {
+	if err := activeConn.dial(); err != nil {
+		return 0, err
+	}
+	return activeConn.conn.Read(data)
+}
+
+func (activeConn *ActiveConn) Write(data []byte) (n int, err error) {
+	if err := activeConn.dial(); err != nil {
+		return 0, err
+	}
+	return activeConn.conn.Write(data)
+}
+
+func (activeConn *ActiveConn) SetDeadline(t time.Time) error {
+	return activeConn.setDeadlines(true, true, t)
+}
+
+func (activeConn *ActiveConn) SetReadDeadline(t time.Time) error {
+	return activeConn.setDeadlines(true, false, t)
+}
+
+func (activeConn *ActiveConn) SetWriteDeadline(t time.Time) error {
+	return activeConn.setDeadlines(false, true, t)
+}
+
+func (activeConn *ActiveConn) setDeadlines(read, write bool, t time.Time) error {
+	activeConn.mu.Lock()
+	defer activeConn.mu.Unlock()
+	return activeConn.deadlines.set(activeConn.dialed, read, write, t)
+}
+
+// RemoteAddr returns the address given by the client, which is known
+// before the connection is made.
+func (activeConn *ActiveConn) RemoteAddr() net.Addr {
+	return activeConn.raddr
+}
+
+// Close closes the connection, or prevents it when it was never used.
+func (activeConn *ActiveConn) Close() error {
+	activeConn.once.Do(func() {
+		activeConn.err = errDataConnClosed
+	})
+	if activeConn.conn == nil {
+		return nil
+	}
+	log.Println("Active data connection closed.")
+	return activeConn.conn.Close()
+}
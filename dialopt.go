@@ -0,0 +1,149 @@
+package ftplib
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+// DialOption configures the ClientConn of Dial.
+type DialOption func(c *ClientConn)
+
+// Dialer opens the connections of a client, as net.Dialer does, or through
+// a proxy such as the SOCKS dialers of golang.org/x/net/proxy.
+type Dialer interface {
+	Dial(network, address string) (net.Conn, error)
+}
+
+// DialContextFunc is a Dialer calling a function such as the DialContext
+// method of net.Dialer, or of a custom network stack, with the context of
+// the operation opening the connection: the one of the Context variants of
+// the operations, or context.Background.
+type DialContextFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// Dial calls f with context.Background.
+func (f DialContextFunc) Dial(network, address string) (net.Conn, error) {
+	return f(context.Background(), network, address)
+}
+
+// DialContext calls f.
+func (f DialContextFunc) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return f(ctx, network, address)
+}
+
+// WithTimeout bounds the opening of the control and data connections.
+func WithTimeout(timeout time.Duration) DialOption {
+	return func(c *ClientConn) {
+		c.timeout = timeout
+	}
+}
+
+// WithDialer opens the control and data connections with d, instead of
+// net.Dialer. The Timeout of WithTimeout is then up to d.
+func WithDialer(d Dialer) DialOption {
+	return func(c *ClientConn) {
+		c.dialer = d
+	}
+}
+
+// WithDialContext opens the control and data connections with f, instead
+// of net.Dialer, as WithDialer with a DialContextFunc.
+func WithDialContext(f func(ctx context.Context, network, address string) (net.Conn, error)) DialOption {
+	return WithDialer(DialContextFunc(f))
+}
+
+// WithLocalAddr opens the control and data connections from the local
+// address ip, on a multi-homed host whose server allows a given source
+// address only. The data connections of active mode listen on it too, as
+// on the local address of the control connection. With WithDialer, the
+// local address is up to the dialer.
+func WithLocalAddr(ip net.IP) DialOption {
+	return func(c *ClientConn) {
+		c.localIP = ip
+	}
+}
+
+// WithTLS secures the session with AUTH TLS as soon as connected, as
+// AuthTLS does.
+func WithTLS(config *tls.Config) DialOption {
+	return func(c *ClientConn) {
+		c.explicit = config
+	}
+}
+
+// WithImplicitTLS connects with implicit FTPS, as DialTLS does.
+func WithImplicitTLS(config *tls.Config) DialOption {
+	return func(c *ClientConn) {
+		c.implicit = config
+	}
+}
+
+// Logger receives the messages of a client on the progress of its
+// session, such as *log.Logger does.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// WithLogger logs the progress of the session to logger; a client logs
+// nothing without.
+func WithLogger(logger Logger) DialOption {
+	return func(c *ClientConn) {
+		c.logger = logger
+	}
+}
+
+// SetLogger logs the progress of the session to logger, nil silencing it,
+// as WithLogger.
+func (c *ClientConn) SetLogger(logger Logger) {
+	c.logger = logger
+}
+
+// WithDisabledEPSV opens the data connections with PASV only, for servers
+// or middleboxes mishandling EPSV.
+func WithDisabledEPSV() DialOption {
+	return func(c *ClientConn) {
+		c.disableEPSV = true
+	}
+}
+
+// WithPeerCheck refuses the data connections with another host than the
+// server of the control connection, against the bounce and injection
+// attacks: a PASV reply carrying another address fails, instead of being
+// ignored for the one of the server, and so does a passive data connection
+// landing on another address, through a dialer resolving anew. Active data
+// connections are always checked. Through a tunnel such as HTTPProxy, the
+// address of the server is unknown and not checked.
+func WithPeerCheck() DialOption {
+	return func(c *ClientConn) {
+		c.checkPeer = true
+	}
+}
+
+// dial opens a connection to addr with the dialer of c, given the context
+// of the operation if a DialContextFunc.
+func (c *ClientConn) dial(addr string) (net.Conn, error) {
+	switch d := c.dialer.(type) {
+	case nil:
+		nd := &net.Dialer{Timeout: c.timeout}
+		if c.localIP != nil {
+			nd.LocalAddr = &net.TCPAddr{IP: c.localIP}
+		}
+		return nd.Dial("tcp", addr)
+	case DialContextFunc:
+		ctx := context.Background()
+		if c.watch != nil {
+			ctx = c.watch.ctx
+		}
+		return d(ctx, "tcp", addr)
+	default:
+		return d.Dial("tcp", addr)
+	}
+}
+
+// logf logs to the logger of c, if any.
+func (c *ClientConn) logf(format string, v ...interface{}) {
+	if c.logger != nil {
+		c.logger.Printf(format, v...)
+	}
+}
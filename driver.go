@@ -0,0 +1,299 @@
+package ftplib
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Driver is the storage backend of a Server.
+//
+// Paths handed to a Driver are absolute, slash separated and already
+// cleaned; "/" is the root of the tree the driver serves.
+type Driver interface {
+	Stat(path string) (os.FileInfo, error)
+	ReadDir(path string) ([]os.FileInfo, error)
+
+	// Open returns the content of the file at path, starting at offset.
+	Open(path string, offset int64) (io.ReadCloser, error)
+
+	// Put stores the content of r at path, replacing the file, or adding to
+	// its end when appending is set. It returns the number of bytes read
+	// from r. If r fails, no partial file may be left behind.
+	Put(path string, r io.Reader, appending bool) (int64, error)
+
+	Remove(path string) error
+	// RemoveDir removes the directory at path and everything it contains.
+	RemoveDir(path string) error
+	Rename(from, to string) error
+	MakeDir(path string) error
+}
+
+// Copier is implemented by drivers able to copy a file without the server
+// reading it back, such as object stores with a native copy operation.
+type Copier interface {
+	Copy(from, to string) error
+}
+
+// Linker is implemented by drivers able to tell where a symbolic link
+// points. Listings show the target of links next to their name.
+type Linker interface {
+	// Readlink returns the target of the link at path, as the link stores
+	// it: relative to its directory or absolute in the driver's tree.
+	Readlink(path string) (string, error)
+}
+
+var errNoLinks = errors.New("driver has no symbolic links")
+
+// readlink returns the target of the link p through d.
+func readlink(d Driver, p string) (string, error) {
+	if linker, ok := d.(Linker); ok {
+		return linker.Readlink(p)
+	}
+	return "", errNoLinks
+}
+
+// copyFile copies from to to through d, preferring its native copy.
+func copyFile(d Driver, from, to string) error {
+	if copier, ok := d.(Copier); ok {
+		return copier.Copy(from, to)
+	}
+	src, err := d.Open(from, 0)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	_, err = d.Put(to, src, false)
+	return err
+}
+
+// diskUsage returns the total size of the regular files at or below p.
+func diskUsage(d Driver, p string) int64 {
+	info, err := d.Stat(p)
+	if err != nil {
+		return 0
+	}
+	if !info.IsDir() {
+		if info.Mode().IsRegular() {
+			return info.Size()
+		}
+		return 0
+	}
+	items, err := d.ReadDir(p)
+	if err != nil {
+		return 0
+	}
+	var size int64
+	for _, item := range items {
+		size += diskUsage(d, path.Join(p, item.Name()))
+	}
+	return size
+}
+
+// DiskDriver is a Driver serving the local directory Root. Symbolic links
+// are followed as long as they lead to files below Root.
+type DiskDriver struct {
+	Root string
+}
+
+var errOutOfRoot = errors.New("path leads out of the root")
+
+// realPath maps the slash separated p to a path below Root, following its
+// symbolic links, and refuses it when one of them leads out of Root.
+func (d *DiskDriver) realPath(p string) (string, error) {
+	return d.resolve(p, true)
+}
+
+// linkPath is realPath leaving the last element of p unresolved, for the
+// operations on a link rather than on its target.
+func (d *DiskDriver) linkPath(p string) (string, error) {
+	return d.resolve(p, false)
+}
+
+// resolve maps p below Root, following the links of its directories, and
+// of its last element with followLast unless it does not exist yet, as for
+// a file about to be created.
+func (d *DiskDriver) resolve(p string, followLast bool) (string, error) {
+	root, err := filepath.Abs(d.Root)
+	if err != nil {
+		return "", err
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return "", err
+	}
+	name := filepath.Join(root, filepath.FromSlash(path.Clean("/"+p)))
+	if name == root {
+		return root, nil
+	}
+	real, err := filepath.EvalSymlinks(name)
+	if !followLast || os.IsNotExist(err) {
+		dir, base := filepath.Split(name)
+		if real, err = filepath.EvalSymlinks(dir); err == nil {
+			real = filepath.Join(real, base)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	if outOfRoot(root, real) {
+		return "", &os.PathError{Op: "resolve", Path: p, Err: errOutOfRoot}
+	}
+	return real, nil
+}
+
+// outOfRoot reports whether name lies out of the directory root.
+func outOfRoot(root, name string) bool {
+	rel, err := filepath.Rel(root, name)
+	return err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (d *DiskDriver) Stat(p string) (os.FileInfo, error) {
+	name, err := d.realPath(p)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(name)
+}
+
+func (d *DiskDriver) ReadDir(p string) ([]os.FileInfo, error) {
+	name, err := d.realPath(p)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadDir(name)
+}
+
+// Readlink maps absolute targets into the tree below Root and refuses the
+// ones pointing out of it, which would reveal the layout of the host.
+func (d *DiskDriver) Readlink(p string) (string, error) {
+	name, err := d.linkPath(p)
+	if err != nil {
+		return "", err
+	}
+	target, err := os.Readlink(name)
+	if err != nil || !filepath.IsAbs(target) {
+		return filepath.ToSlash(target), err
+	}
+	root, err := filepath.Abs(d.Root)
+	if err != nil {
+		return "", err
+	}
+	if outOfRoot(root, target) {
+		return "", errors.New("link points out of the root")
+	}
+	rel, _ := filepath.Rel(root, target)
+	return path.Join("/", filepath.ToSlash(rel)), nil
+}
+
+func (d *DiskDriver) Open(p string, offset int64) (io.ReadCloser, error) {
+	name, err := d.realPath(p)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// Put writes r to a temporary file next to p which replaces p once r is
+// exhausted, so readers never see a partial upload. A link at p is replaced
+// rather than written through.
+func (d *DiskDriver) Put(p string, r io.Reader, appending bool) (int64, error) {
+	name, err := d.linkPath(p)
+	if err != nil {
+		return 0, err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(name), ".ftplib-upload-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if appending {
+		if err := d.appendFile(tmp, p); err != nil && !os.IsNotExist(err) {
+			tmp.Close()
+			return 0, err
+		}
+	}
+	n, err := io.Copy(tmp, r)
+	if err2 := tmp.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		return n, err
+	}
+	return n, os.Rename(tmp.Name(), name)
+}
+
+func (d *DiskDriver) Remove(p string) error {
+	name, err := d.linkPath(p)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return errors.New("is a directory")
+	}
+	return os.Remove(name)
+}
+
+func (d *DiskDriver) RemoveDir(p string) error {
+	name, err := d.linkPath(p)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return errors.New("not a directory")
+	}
+	return os.RemoveAll(name)
+}
+
+func (d *DiskDriver) Rename(from, to string) error {
+	fromName, err := d.linkPath(from)
+	if err != nil {
+		return err
+	}
+	toName, err := d.linkPath(to)
+	if err != nil {
+		return err
+	}
+	return os.Rename(fromName, toName)
+}
+
+func (d *DiskDriver) MakeDir(p string) error {
+	name, err := d.linkPath(p)
+	if err != nil {
+		return err
+	}
+	return os.Mkdir(name, 0777)
+}
+
+// appendFile copies the content of the file at p into dst.
+func (d *DiskDriver) appendFile(dst io.Writer, p string) error {
+	src, err := d.Open(p, 0)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	_, err = io.Copy(dst, src)
+	return err
+}
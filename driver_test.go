@@ -0,0 +1,140 @@
+package ftplib
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, errors.New("broken") }
+
+// go test -run TestDiskDriver
+func TestDiskDriver(t *testing.T) {
+	root, err := ioutil.TempDir("", "ftplib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	d := &DiskDriver{Root: root}
+
+	if _, err := d.Put("/../a.txt", bytes.NewBufferString("hello"), false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "a.txt")); err != nil {
+		t.Error("path escaped the root:", err)
+	}
+	if _, err := d.Put("/a.txt", bytes.NewBufferString(" world"), true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Put("/a.txt", io.MultiReader(bytes.NewBufferString("partial"), failingReader{}), false); err == nil {
+		t.Error("expected the failing upload to fail")
+	}
+	if err := copyFile(d, "/a.txt", "/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	r, err := d.Open("/b.txt", 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(r)
+	r.Close()
+	if string(data) != "world" {
+		t.Errorf("unexpected content %q", data)
+	}
+	if items, _ := d.ReadDir("/"); len(items) != 2 {
+		t.Errorf("expected 2 files, got %d", len(items))
+	}
+}
+
+// go test -run TestDiskDriverReadlink
+func TestDiskDriverReadlink(t *testing.T) {
+	root, err := ioutil.TempDir("", "ftplib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	d := &DiskDriver{Root: root}
+
+	links := map[string]string{
+		"relative": "a.txt",
+		"inside":   filepath.Join(root, "dir", "a.txt"),
+		"outside":  os.TempDir(),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skip("symbolic links unavailable:", err)
+		}
+	}
+	for name, want := range map[string]string{"relative": "a.txt", "inside": "/dir/a.txt"} {
+		if target, err := d.Readlink("/" + name); err != nil || target != want {
+			t.Errorf("%s: got %q, %v; want %q", name, target, err, want)
+		}
+	}
+	if target, err := d.Readlink("/outside"); err == nil {
+		t.Errorf("outside: revealed %q", target)
+	}
+}
+
+// go test -run TestDiskDriverLinkOutOfRoot
+func TestDiskDriverLinkOutOfRoot(t *testing.T) {
+	root, err := ioutil.TempDir("", "ftplib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	outside, err := ioutil.TempDir("", "ftplib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+	ioutil.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644)
+	ioutil.WriteFile(filepath.Join(root, "a.txt"), []byte("hello"), 0644)
+	d := &DiskDriver{Root: root}
+
+	links := map[string]string{
+		"inside": "a.txt",
+		"secret": filepath.Join(outside, "secret.txt"),
+		"out":    outside,
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skip("symbolic links unavailable:", err)
+		}
+	}
+
+	if r, err := d.Open("/inside", 0); err != nil {
+		t.Errorf("link within the root: %v", err)
+	} else {
+		r.Close()
+	}
+	for _, p := range []string{"/secret", "/out/secret.txt"} {
+		if r, err := d.Open(p, 0); err == nil {
+			r.Close()
+			t.Errorf("opened %s out of the root", p)
+		}
+		if _, err := d.Stat(p); err == nil {
+			t.Errorf("stat of %s out of the root", p)
+		}
+	}
+	if _, err := d.ReadDir("/out"); err == nil {
+		t.Error("listed a directory out of the root")
+	}
+	if _, err := d.Put("/out/new.txt", bytes.NewBufferString("x"), false); err == nil {
+		t.Error("stored a file out of the root")
+	}
+	if _, err := d.Put("/secret", bytes.NewBufferString("x"), true); err == nil {
+		t.Error("appended to a file out of the root")
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(outside, "secret.txt")); string(data) != "secret" {
+		t.Errorf("file out of the root changed to %q", data)
+	}
+	if items, _ := ioutil.ReadDir(outside); len(items) != 1 {
+		t.Errorf("%d files stored out of the root", len(items)-1)
+	}
+}
@@ -0,0 +1,191 @@
+package ftplib
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// SortKey is the order of the entries of ListWithOptions.
+type SortKey int
+
+const (
+	SortNone SortKey = iota // the order of the server
+	SortByName
+	SortBySize
+	SortByTime
+)
+
+// EntryFilter selects and orders the entries of ListWithOptions. The zero
+// value keeps every entry, in the order of the server.
+type EntryFilter struct {
+	// Pattern, if set, keeps the names it matches, as path.Match does.
+	Pattern string
+	// Types, if set, keeps the entries of these types.
+	Types []EntryType
+	// MinSize and MaxSize bound the sizes kept; a zero MaxSize means no
+	// upper bound.
+	MinSize, MaxSize uint64
+	// ModifiedAfter, if set, keeps the entries modified since.
+	ModifiedAfter time.Time
+
+	SortBy  SortKey
+	Reverse bool
+}
+
+// ListWithOptions lists path as List does, then filters and sorts the
+// entries by opts. The work is done by the client, so it behaves the same
+// whatever the server.
+func (c *ClientConn) ListWithOptions(path string, opts EntryFilter) ([]*Entry, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	entries, err := c.List(path)
+	if err != nil {
+		return nil, err
+	}
+	return FilterEntries(entries, opts)
+}
+
+// FilterEntries returns the entries selected by opts, in the order of opts.
+func FilterEntries(entries []*Entry, opts EntryFilter) ([]*Entry, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	var kept []*Entry
+	for _, entry := range entries {
+		if opts.match(entry) {
+			kept = append(kept, entry)
+		}
+	}
+	opts.sort(kept)
+	return kept, nil
+}
+
+// validate checks the pattern of opts, which path.Match only reports on
+// the names it cannot tell apart.
+func (opts *EntryFilter) validate() error {
+	if opts.Pattern == "" {
+		return nil
+	}
+	_, err := path.Match(opts.Pattern, "")
+	return err
+}
+
+// match reports whether opts keeps entry.
+func (opts *EntryFilter) match(entry *Entry) bool {
+	if opts.Pattern != "" {
+		if ok, _ := path.Match(opts.Pattern, entry.Name); !ok {
+			return false
+		}
+	}
+	if len(opts.Types) > 0 {
+		found := false
+		for _, t := range opts.Types {
+			found = found || entry.Type == t
+		}
+		if !found {
+			return false
+		}
+	}
+	if entry.Size < opts.MinSize || opts.MaxSize > 0 && entry.Size > opts.MaxSize {
+		return false
+	}
+	return opts.ModifiedAfter.IsZero() || entry.Time.After(opts.ModifiedAfter)
+}
+
+// sort orders entries by opts, by name between equals.
+func (opts *EntryFilter) sort(entries []*Entry) {
+	var less func(a, b *Entry) bool
+	switch opts.SortBy {
+	case SortByName:
+		less = func(a, b *Entry) bool { return a.Name < b.Name }
+	case SortBySize:
+		less = func(a, b *Entry) bool {
+			if a.Size != b.Size {
+				return a.Size < b.Size
+			}
+			return a.Name < b.Name
+		}
+	case SortByTime:
+		less = func(a, b *Entry) bool {
+			if !a.Time.Equal(b.Time) {
+				return a.Time.Before(b.Time)
+			}
+			return a.Name < b.Name
+		}
+	default:
+		return
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if opts.Reverse {
+			return less(entries[j], entries[i])
+		}
+		return less(entries[i], entries[j])
+	})
+}
+
+// PathFilter selects the files of the recursive operations, WalkFiltered,
+// UploadDir and Sync, by their slash-separated path relative to the root of
+// the tree, as the rules of rsync do. The globs, as path.Match takes them,
+// match the path or its last element, so that ".git" skips the .git
+// directories at every depth and "*.csv" keeps the CSV files in every
+// directory; the regular expressions match the path. The zero value keeps
+// everything.
+type PathFilter struct {
+	// Include, if set, keeps only the files matching one of the globs or
+	// regular expressions. Directories are walked regardless.
+	Include       []string
+	IncludeRegexp []*regexp.Regexp
+	// Exclude skips the files and directories matching one of the globs or
+	// regular expressions, the directories with their trees.
+	Exclude       []string
+	ExcludeRegexp []*regexp.Regexp
+}
+
+// validate checks the globs of f, which path.Match only reports on the
+// names it cannot tell apart.
+func (f *PathFilter) validate() error {
+	for _, globs := range [][]string{f.Include, f.Exclude} {
+		for _, glob := range globs {
+			if _, err := path.Match(glob, ""); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Excluded reports whether f skips the file or directory rel, with its
+// tree.
+func (f *PathFilter) Excluded(rel string) bool {
+	return matchPath(f.Exclude, f.ExcludeRegexp, rel)
+}
+
+// Selected reports whether f keeps the file rel.
+func (f *PathFilter) Selected(rel string) bool {
+	if f.Excluded(rel) {
+		return false
+	}
+	return len(f.Include) == 0 && len(f.IncludeRegexp) == 0 || matchPath(f.Include, f.IncludeRegexp, rel)
+}
+
+// matchPath reports whether rel, or its last element, matches one of globs,
+// or rel one of res.
+func matchPath(globs []string, res []*regexp.Regexp, rel string) bool {
+	for _, glob := range globs {
+		if ok, _ := path.Match(glob, rel); ok {
+			return true
+		}
+		if ok, _ := path.Match(glob, path.Base(rel)); ok {
+			return true
+		}
+	}
+	for _, re := range res {
+		if re.MatchString(rel) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package ftplib
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// go test -run TestFilterEntries
+func TestFilterEntries(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC) }
+	entries := []*Entry{
+		{Name: "b.txt", Type: EntryTypeFile, Size: 30, Time: day(3)},
+		{Name: "docs", Type: EntryTypeFolder, Time: day(1)},
+		{Name: "a.txt", Type: EntryTypeFile, Size: 30, Time: day(2)},
+		{Name: "c.log", Type: EntryTypeFile, Size: 5, Time: day(4)},
+		{Name: "latest", Type: EntryTypeLink, Time: day(5)},
+	}
+	for _, test := range []struct {
+		opts EntryFilter
+		want []string
+	}{
+		{EntryFilter{}, []string{"b.txt", "docs", "a.txt", "c.log", "latest"}},
+		{EntryFilter{Pattern: "*.txt"}, []string{"b.txt", "a.txt"}},
+		{EntryFilter{Types: []EntryType{EntryTypeFolder, EntryTypeLink}}, []string{"docs", "latest"}},
+		{EntryFilter{MinSize: 10}, []string{"b.txt", "a.txt"}},
+		{EntryFilter{Types: []EntryType{EntryTypeFile}, MaxSize: 10}, []string{"c.log"}},
+		{EntryFilter{ModifiedAfter: day(3)}, []string{"c.log", "latest"}},
+		{EntryFilter{SortBy: SortByName}, []string{"a.txt", "b.txt", "c.log", "docs", "latest"}},
+		{EntryFilter{SortBy: SortBySize, Reverse: true}, []string{"b.txt", "a.txt", "c.log", "latest", "docs"}},
+		{EntryFilter{SortBy: SortByTime}, []string{"docs", "a.txt", "b.txt", "c.log", "latest"}},
+	} {
+		got, err := FilterEntries(entries, test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, entry := range got {
+			names = append(names, entry.Name)
+		}
+		if !reflect.DeepEqual(names, test.want) {
+			t.Errorf("%+v: got %v, want %v", test.opts, names, test.want)
+		}
+	}
+	if _, err := FilterEntries(entries, EntryFilter{Pattern: "["}); err == nil {
+		t.Error("bad pattern accepted")
+	}
+}
+
+// go test -run TestPathFilter
+func TestPathFilter(t *testing.T) {
+	filter := PathFilter{
+		Include:       []string{"*.csv", "docs/*"},
+		IncludeRegexp: []*regexp.Regexp{regexp.MustCompile(`^data/\d+\.json$`)},
+		Exclude:       []string{".git", "*.tmp"},
+		ExcludeRegexp: []*regexp.Regexp{regexp.MustCompile(`^private/`)},
+	}
+	for _, test := range []struct {
+		rel                string
+		excluded, selected bool
+	}{
+		{"a.csv", false, true},
+		{"deep/down/b.csv", false, true},
+		{"docs/readme.txt", false, true},
+		{"docs/sub/readme.txt", false, false},
+		{"data/42.json", false, true},
+		{"data/x.json", false, false},
+		{"notes.txt", false, false},
+		{".git", true, false},
+		{"src/.git", true, false},
+		{"c.csv.tmp", true, false},
+		{"private/a.csv", true, false},
+	} {
+		if got := filter.Excluded(test.rel); got != test.excluded {
+			t.Errorf("Excluded(%q) = %v", test.rel, got)
+		}
+		if got := filter.Selected(test.rel); got != test.selected {
+			t.Errorf("Selected(%q) = %v", test.rel, got)
+		}
+	}
+	if !(&PathFilter{}).Selected("any/file") {
+		t.Error("zero PathFilter left a file out")
+	}
+	if err := (&PathFilter{Exclude: []string{"["}}).validate(); err == nil {
+		t.Error("bad glob accepted")
+	}
+}
@@ -0,0 +1,166 @@
+package ftpfs
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// File is an open file of an FS, spooled to a temporary file.
+type File struct {
+	fs       *FS
+	name     string // clean path
+	writable bool
+
+	mu    sync.Mutex
+	spool *os.File
+	dirty bool // whether the spool differs from the server
+}
+
+// Open opens the file p for reading.
+func (fs *FS) Open(p string) (*File, error) {
+	return fs.OpenFile(p, os.O_RDONLY)
+}
+
+// Create creates the file p, or truncates it, for writing.
+func (fs *FS) Create(p string) (*File, error) {
+	return fs.OpenFile(p, os.O_RDWR|os.O_CREATE|os.O_TRUNC)
+}
+
+// OpenFile opens the file p with the flags of os.OpenFile. The file is
+// downloaded unless truncated, and created on the server when closed.
+func (fs *FS) OpenFile(p string, flag int) (*File, error) {
+	p = clean(p)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fi, err := fs.stat(p)
+	switch {
+	case os.IsNotExist(err) && flag&os.O_CREATE != 0:
+		fi = nil
+	case err != nil:
+		return nil, err
+	case flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, pathError("open", p, os.ErrExist)
+	case fi.IsDir():
+		return nil, pathError("open", p, errIsDir)
+	}
+
+	spool, err := ioutil.TempFile("", "ftpfs-")
+	if err != nil {
+		return nil, err
+	}
+	f := &File{
+		fs:       fs,
+		name:     p,
+		writable: flag&(os.O_WRONLY|os.O_RDWR) != 0,
+		spool:    spool,
+	}
+	if fi == nil || flag&os.O_TRUNC != 0 {
+		f.dirty = f.writable
+		return f, nil
+	}
+	if err := fs.download(p, spool); err != nil {
+		f.remove()
+		return nil, err
+	}
+	return f, nil
+}
+
+var errIsDir = errors.New("is a directory")
+
+// download copies the file p to spool. The caller holds fs.mu.
+func (fs *FS) download(p string, spool *os.File) error {
+	r, err := fs.client.Retr(fs.remote(p))
+	if err != nil {
+		return pathError("open", p, err)
+	}
+	_, err = io.Copy(spool, r)
+	if cerr := r.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return pathError("open", p, err)
+	}
+	return nil
+}
+
+// Name returns the path of the file.
+func (f *File) Name() string {
+	return f.name
+}
+
+// ReadAt reads from the spool.
+func (f *File) ReadAt(b []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.spool.ReadAt(b, off)
+}
+
+// WriteAt writes to the spool, for Sync or Close to upload.
+func (f *File) WriteAt(b []byte, off int64) (int, error) {
+	if !f.writable {
+		return 0, pathError("write", f.name, os.ErrPermission)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.dirty = true
+	return f.spool.WriteAt(b, off)
+}
+
+// Truncate changes the size of the file.
+func (f *File) Truncate(size int64) error {
+	if !f.writable {
+		return pathError("truncate", f.name, os.ErrPermission)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.dirty = true
+	return f.spool.Truncate(size)
+}
+
+// Size returns the size of the file as open.
+func (f *File) Size() (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fi, err := f.spool.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+// Sync uploads the file if written since opened or last synced.
+func (f *File) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.dirty {
+		return nil
+	}
+	if _, err := f.spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	f.fs.invalidate(f.name)
+	if err := f.fs.client.Stor(f.fs.remote(f.name), f.spool); err != nil {
+		return pathError("write", f.name, err)
+	}
+	f.dirty = false
+	return nil
+}
+
+// Close uploads the file if written, then drops the spool.
+func (f *File) Close() error {
+	err := f.Sync()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.remove()
+	return err
+}
+
+func (f *File) remove() {
+	f.spool.Close()
+	os.Remove(f.spool.Name())
+}
@@ -0,0 +1,218 @@
+// Package ftpfs presents the tree of an FTP server as a file system, for
+// cmd/ftpfs to mount it with FUSE or for programs to browse it directly:
+//
+//	c, err := ftplib.Connect("ftp.example.com:21", "joe", "secret")
+//	fsys := ftpfs.New(c, "/pub", 5*time.Second)
+//	infos, err := fsys.ReadDir("/")
+//
+// Directory listings are cached for a while, and dropped when the file
+// system changes them. Files are spooled to temporary files: opening one
+// downloads it, and closing it after writing uploads it with STOR.
+//
+// The methods are safe for concurrent use; they take turns on the control
+// connection of the client.
+package ftpfs
+
+import (
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/cxfans/ftplib"
+)
+
+// FS is the tree of an FTP server under a root directory. Its paths are
+// slash separated, relative to the root, "/" being the root itself.
+type FS struct {
+	root string
+	ttl  time.Duration
+
+	mu     sync.Mutex
+	client ftplib.Client
+	dirs   map[string]*dirCache // by clean path
+}
+
+type dirCache struct {
+	infos   []os.FileInfo
+	fetched time.Time
+}
+
+// New returns the tree of the server of client under root, the current
+// directory if "", caching the directory listings for ttl; a zero ttl
+// disables the cache.
+func New(client ftplib.Client, root string, ttl time.Duration) *FS {
+	if root == "" {
+		root = "."
+	}
+	return &FS{
+		root:   root,
+		ttl:    ttl,
+		client: client,
+		dirs:   make(map[string]*dirCache),
+	}
+}
+
+func clean(p string) string {
+	return path.Clean("/" + p)
+}
+
+// remote returns the path on the server of the clean path p.
+func (fs *FS) remote(p string) string {
+	return path.Join(fs.root, p)
+}
+
+func pathError(op, p string, err error) error {
+	return &os.PathError{Op: op, Path: p, Err: err}
+}
+
+// entryInfo describes a listed entry.
+type entryInfo struct {
+	*ftplib.Entry
+	name string
+}
+
+func (fi *entryInfo) Name() string       { return fi.name }
+func (fi *entryInfo) Size() int64        { return int64(fi.Entry.Size) }
+func (fi *entryInfo) ModTime() time.Time { return fi.Time }
+func (fi *entryInfo) IsDir() bool        { return fi.Type == ftplib.EntryTypeFolder }
+func (fi *entryInfo) Sys() interface{}   { return fi.Entry }
+
+func (fi *entryInfo) Mode() os.FileMode {
+	if fi.Entry.Mode != 0 {
+		return fi.Entry.Mode
+	}
+	switch fi.Type {
+	case ftplib.EntryTypeFolder:
+		return os.ModeDir | 0755
+	case ftplib.EntryTypeLink:
+		return os.ModeSymlink | 0777
+	}
+	return 0644
+}
+
+// rootInfo describes the root, which no listing shows.
+type rootInfo struct{}
+
+func (rootInfo) Name() string       { return "/" }
+func (rootInfo) Size() int64        { return 0 }
+func (rootInfo) ModTime() time.Time { return time.Time{} }
+func (rootInfo) IsDir() bool        { return true }
+func (rootInfo) Sys() interface{}   { return nil }
+func (rootInfo) Mode() os.FileMode  { return os.ModeDir | 0755 }
+
+// readDir returns the listing of the clean path p. The caller holds fs.mu.
+func (fs *FS) readDir(p string) ([]os.FileInfo, error) {
+	if d, ok := fs.dirs[p]; ok && time.Since(d.fetched) < fs.ttl {
+		return d.infos, nil
+	}
+	entries, err := fs.client.List(fs.remote(p))
+	if err != nil {
+		return nil, pathError("readdir", p, err)
+	}
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		name := path.Base(e.Name)
+		if name == "." || name == ".." {
+			continue
+		}
+		infos = append(infos, &entryInfo{e, name})
+	}
+	if fs.ttl > 0 {
+		fs.dirs[p] = &dirCache{infos: infos, fetched: time.Now()}
+	}
+	return infos, nil
+}
+
+// invalidate drops the cached listings of the parents of the clean paths,
+// and of the paths themselves, with their subdirectories, since they may
+// have been renamed or removed. The caller holds fs.mu.
+func (fs *FS) invalidate(paths ...string) {
+	for _, p := range paths {
+		delete(fs.dirs, path.Dir(p))
+		for dir := range fs.dirs {
+			if dir == p || len(dir) > len(p) && dir[:len(p)+1] == p+"/" {
+				delete(fs.dirs, dir)
+			}
+		}
+	}
+}
+
+// ReadDir returns the entries of the directory p, without "." and "..".
+func (fs *FS) ReadDir(p string) ([]os.FileInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.readDir(clean(p))
+}
+
+// Stat describes p, as listed in its parent directory.
+func (fs *FS) Stat(p string) (os.FileInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.stat(clean(p))
+}
+
+func (fs *FS) stat(p string) (os.FileInfo, error) {
+	if p == "/" {
+		return rootInfo{}, nil
+	}
+	infos, err := fs.readDir(path.Dir(p))
+	if err != nil {
+		return nil, err
+	}
+	name := path.Base(p)
+	for _, fi := range infos {
+		if fi.Name() == name {
+			return fi, nil
+		}
+	}
+	return nil, pathError("stat", p, os.ErrNotExist)
+}
+
+// Mkdir makes the directory p.
+func (fs *FS) Mkdir(p string) error {
+	p = clean(p)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.invalidate(p)
+	if err := fs.client.MakeDir(fs.remote(p)); err != nil {
+		return pathError("mkdir", p, err)
+	}
+	return nil
+}
+
+// Remove removes the file p.
+func (fs *FS) Remove(p string) error {
+	p = clean(p)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.invalidate(p)
+	if err := fs.client.Delete(fs.remote(p)); err != nil {
+		return pathError("remove", p, err)
+	}
+	return nil
+}
+
+// RemoveDir removes the directory p, which servers usually want empty.
+func (fs *FS) RemoveDir(p string) error {
+	p = clean(p)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.invalidate(p)
+	if err := fs.client.RemoveDir(fs.remote(p)); err != nil {
+		return pathError("rmdir", p, err)
+	}
+	return nil
+}
+
+// Rename renames from to to.
+func (fs *FS) Rename(from, to string) error {
+	from, to = clean(from), clean(to)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.invalidate(from, to)
+	if err := fs.client.Rename(fs.remote(from), fs.remote(to)); err != nil {
+		return pathError("rename", from, err)
+	}
+	return nil
+}
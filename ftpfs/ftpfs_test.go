@@ -0,0 +1,149 @@
+package ftpfs_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cxfans/ftplib"
+	"github.com/cxfans/ftplib/ftpfs"
+	"github.com/cxfans/ftplib/ftptest"
+)
+
+// go test -run TestFS
+func TestFS(t *testing.T) {
+	driver := ftptest.NewMemDriver()
+	if err := driver.WriteFile("/pub/readme.txt", []byte("read me")); err != nil {
+		t.Fatal(err)
+	}
+	addr, cleanup, err := ftptest.Start(driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	c, err := ftplib.Connect(addr, "user", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Quit()
+	fsys := ftpfs.New(c, "/pub", time.Minute)
+
+	infos, err := fsys.ReadDir("/")
+	if err != nil || len(infos) != 1 || infos[0].Name() != "readme.txt" || infos[0].Size() != 7 {
+		t.Fatalf("ReadDir: %v, %v", infos, err)
+	}
+	f, err := fsys.Open("readme.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 4)
+	if n, err := f.ReadAt(b, 5); n != 2 || string(b[:n]) != "me" {
+		t.Errorf("ReadAt: %q, %v", b[:n], err)
+	}
+	if _, err := f.WriteAt(b, 0); !os.IsPermission(err) {
+		t.Errorf("WriteAt on a read-only file: %v", err)
+	}
+	f.Close()
+
+	// Writing through the cache updates the listing.
+	f, err = fsys.OpenFile("readme.txt", os.O_RDWR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt([]byte("READ"), 0)
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := driver.ReadFile("/pub/readme.txt"); string(got) != "READ me" {
+		t.Errorf("uploaded %q", got)
+	}
+	if f, err = fsys.Create("/new/file.txt"); err == nil {
+		t.Error("created a file in a missing directory")
+		f.Close()
+	}
+	if err := fsys.Mkdir("new"); err != nil {
+		t.Fatal(err)
+	}
+	if f, err = fsys.Create("/new/file.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := fsys.Stat("/new/file.txt"); err != nil || fi.Size() != 0 || fi.IsDir() {
+		t.Errorf("Stat: %v, %v", fi, err)
+	}
+	if _, err := fsys.OpenFile("/new/file.txt", os.O_RDWR|os.O_CREATE|os.O_EXCL); !os.IsExist(err) {
+		t.Errorf("exclusive create of an existing file: %v", err)
+	}
+
+	if err := fsys.Rename("/new/file.txt", "/moved.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.Stat("/new/file.txt"); !os.IsNotExist(err) {
+		t.Errorf("Stat after rename: %v", err)
+	}
+	if err := fsys.Remove("/moved.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.RemoveDir("/new"); err != nil {
+		t.Fatal(err)
+	}
+	if infos, err := fsys.ReadDir("/"); err != nil || len(infos) != 1 {
+		t.Errorf("ReadDir after removals: %v, %v", infos, err)
+	}
+}
+
+// go test -run TestHTTP
+func TestHTTP(t *testing.T) {
+	driver := ftptest.NewMemDriver()
+	if err := driver.WriteFile("/pub/docs/readme.txt", []byte("read me, then the rest")); err != nil {
+		t.Fatal(err)
+	}
+	addr, cleanup, err := ftptest.Start(driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	c, err := ftplib.Connect(addr, "user", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Quit()
+	srv := httptest.NewServer(http.FileServer(ftpfs.New(c, "/pub", time.Minute).HTTP()))
+	defer srv.Close()
+
+	get := func(path, rng string) (int, string) {
+		req, _ := http.NewRequest("GET", srv.URL+path, nil)
+		if rng != "" {
+			req.Header.Set("Range", rng)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+	if code, body := get("/docs/readme.txt", ""); code != http.StatusOK || body != "read me, then the rest" {
+		t.Errorf("GET: %d %q", code, body)
+	}
+	if code, body := get("/docs/readme.txt", "bytes=9-12"); code != http.StatusPartialContent || body != "then" {
+		t.Errorf("GET of a range: %d %q", code, body)
+	}
+	if code, body := get("/docs/", ""); code != http.StatusOK || !strings.Contains(body, `href="readme.txt"`) {
+		t.Errorf("GET of a directory: %d %q", code, body)
+	}
+	if code, _ := get("/missing.txt", ""); code != http.StatusNotFound {
+		t.Errorf("GET of a missing file: %d", code)
+	}
+	// The session is free again.
+	if err := c.NoOp(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,154 @@
+package ftpfs
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+)
+
+// HTTP returns fs as an http.FileSystem, for http.FileServer to serve the
+// tree over HTTP, directory listings included:
+//
+//	http.Handle("/", http.FileServer(fsys.HTTP()))
+//
+// The files are not spooled but read straight from the server, from the
+// offset they were sought to with REST, which serves range requests without
+// downloading the files whole. A file being read holds the control
+// connection of the client until sought elsewhere or closed, the requests
+// taking turns on it; an FS per client serves as many at once.
+func (fs *FS) HTTP() http.FileSystem {
+	return httpFS{fs}
+}
+
+type httpFS struct {
+	fs *FS
+}
+
+func (h httpFS) Open(name string) (http.File, error) {
+	p := clean(name)
+	fi, err := h.fs.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	return &httpFile{fs: h.fs, name: p, info: fi}, nil
+}
+
+var errSeek = errors.New("seek to a negative offset")
+
+// httpFile is a file or directory of an FS open for HTTP.
+type httpFile struct {
+	fs   *FS
+	name string // clean path
+	info os.FileInfo
+
+	// Of a file.
+	offset int64
+	r      io.ReadCloser // from offset on, holding fs.mu while open
+	eof    bool          // whether r was read to its end
+
+	// Of a directory.
+	infos []os.FileInfo // left to Readdir, nil until listed
+}
+
+func (f *httpFile) Stat() (os.FileInfo, error) {
+	return f.info, nil
+}
+
+// Read reads the file from the offset, retrieving it from there with REST
+// on the first Read.
+func (f *httpFile) Read(b []byte) (int, error) {
+	if f.info.IsDir() {
+		return 0, pathError("read", f.name, errIsDir)
+	}
+	if f.r == nil {
+		if f.offset >= f.info.Size() {
+			return 0, io.EOF
+		}
+		f.fs.mu.Lock()
+		r, err := f.fs.client.RetrFrom(f.fs.remote(f.name), uint64(f.offset))
+		if err != nil {
+			f.fs.mu.Unlock()
+			return 0, pathError("read", f.name, err)
+		}
+		f.r, f.eof = r, false
+	}
+	n, err := f.r.Read(b)
+	f.offset += int64(n)
+	if err == io.EOF {
+		f.eof = true
+	}
+	return n, err
+}
+
+// Seek sets the offset of the next Read, stopping the retrieval under way
+// if the offset changes.
+func (f *httpFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.info.Size()
+	}
+	if offset < 0 {
+		return f.offset, pathError("seek", f.name, errSeek)
+	}
+	if offset != f.offset {
+		f.closeReader()
+		f.offset = offset
+	}
+	return offset, nil
+}
+
+// closeReader stops the retrieval under way, if any. The server fails a
+// retrieval cut short, which is no error of the file.
+func (f *httpFile) closeReader() error {
+	if f.r == nil {
+		return nil
+	}
+	err := f.r.Close()
+	f.r = nil
+	f.fs.mu.Unlock()
+	if !f.eof {
+		return nil
+	}
+	return err
+}
+
+// Readdir returns the next count entries of the directory, or all of them
+// if count <= 0, as os.File.Readdir does.
+func (f *httpFile) Readdir(count int) ([]os.FileInfo, error) {
+	if !f.info.IsDir() {
+		return nil, pathError("readdir", f.name, errNotDir)
+	}
+	if f.infos == nil {
+		infos, err := f.fs.ReadDir(f.name)
+		if err != nil {
+			return nil, err
+		}
+		f.infos = append([]os.FileInfo{}, infos...)
+	}
+	if count <= 0 {
+		infos := f.infos
+		f.infos = f.infos[:0]
+		return infos, nil
+	}
+	if len(f.infos) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(f.infos) {
+		count = len(f.infos)
+	}
+	infos := f.infos[:count]
+	f.infos = f.infos[count:]
+	return infos, nil
+}
+
+var errNotDir = errors.New("not a directory")
+
+func (f *httpFile) Close() error {
+	if err := f.closeReader(); err != nil {
+		return pathError("read", f.name, err)
+	}
+	return nil
+}
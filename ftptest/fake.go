@@ -0,0 +1,280 @@
+package ftptest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Step is an exchange of a Script.
+type Step struct {
+	// Expect is the command line the client must send, without its end of
+	// line; a trailing "*" matches any rest. An empty Expect sends Reply
+	// unprompted, as for the greeting or the end of a transfer.
+	Expect string
+
+	// Reply is sent back verbatim, each line ending with CRLF. "{pasv}" is
+	// replaced with the address of the data listener as in a 227 reply,
+	// "{pasvport}" with its port as in a 227 reply and "{port}" with its
+	// port in decimal. Data connections opened before such a reply are
+	// dropped.
+	Reply string
+
+	// Data is sent on the data connection after Reply, then the connection
+	// is closed.
+	Data string
+
+	// Upload reads the data connection to its end after Reply; Uploads
+	// returns what was read.
+	Upload bool
+
+	// Hangup closes the control connection after Reply, as a server
+	// shutting down after a 421 reply does.
+	Hangup bool
+}
+
+// Script is the session a FakeServer holds with its client.
+type Script []Step
+
+// LoginScript returns the steps of ftplib.Connect logging in user with
+// password on a server without features.
+func LoginScript(user, password string) Script {
+	return Script{
+		{Reply: "220 Service ready for new user."},
+		{Expect: "FEAT", Reply: "502 Command not implemented."},
+		{Expect: "USER " + user, Reply: "331 User name okay, need password."},
+		{Expect: "PASS " + password, Reply: "230 User logged in, proceed."},
+		{Expect: "TYPE I", Reply: "200 Type set to binary."},
+	}
+}
+
+// FakeServer plays a Script to the first client connecting, to test how
+// clients deal with replies a real server would not send on demand.
+type FakeServer struct {
+	listener, data net.Listener
+	dataConns      chan net.Conn
+	script         Script
+	done           chan struct{}
+
+	mu       sync.Mutex
+	conn     net.Conn
+	errs     []string
+	uploads  []string
+	finished bool
+}
+
+// dataTimeout bounds the wait for a data connection.
+const dataTimeout = 5 * time.Second
+
+// NewFakeServer starts playing script on a free local port.
+func NewFakeServer(script Script) (*FakeServer, error) {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	data, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	s := &FakeServer{
+		listener:  listener,
+		data:      data,
+		dataConns: make(chan net.Conn, 16),
+		script:    script,
+		done:      make(chan struct{}),
+	}
+	go s.acceptData()
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the address of the server.
+func (s *FakeServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Uploads returns what the Upload steps read, in order.
+func (s *FakeServer) Uploads() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.uploads...)
+}
+
+// Close stops the server, leaving a second to the client to end the
+// session. It returns an error if the client departed from the script or
+// did not play it to its end.
+func (s *FakeServer) Close() error {
+	s.listener.Close()
+	select {
+	case <-s.done:
+	case <-time.After(time.Second):
+		s.mu.Lock()
+		if s.conn != nil {
+			s.conn.Close()
+		}
+		s.mu.Unlock()
+		<-s.done
+	}
+	s.data.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	errs := s.errs
+	if !s.finished {
+		errs = append(errs, "script not played to its end")
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (s *FakeServer) fail(format string, args ...interface{}) {
+	s.mu.Lock()
+	s.errs = append(s.errs, fmt.Sprintf(format, args...))
+	s.mu.Unlock()
+}
+
+// matches reports whether line is the command expect.
+func matches(expect, line string) bool {
+	if strings.HasSuffix(expect, "*") {
+		return strings.HasPrefix(line, strings.TrimSuffix(expect, "*"))
+	}
+	return line == expect
+}
+
+// reply returns the reply of step, its placeholders replaced.
+func (s *FakeServer) reply(step Step) (reply string, passive bool) {
+	addr := s.data.Addr().(*net.TCPAddr)
+	ip := addr.IP.To4()
+	port := fmt.Sprintf("%d,%d", addr.Port>>8, addr.Port&0xff)
+	pasv := fmt.Sprintf("%d,%d,%d,%d,%s", ip[0], ip[1], ip[2], ip[3], port)
+	reply = strings.NewReplacer("{pasv}", pasv, "{pasvport}", port, "{port}", strconv.Itoa(addr.Port)).Replace(step.Reply)
+	return reply, reply != step.Reply
+}
+
+// acceptData queues the data connections until the server stops.
+func (s *FakeServer) acceptData() {
+	defer close(s.dataConns)
+	for {
+		conn, err := s.data.Accept()
+		if err != nil {
+			return
+		}
+		s.dataConns <- conn
+	}
+}
+
+// dropDataConns closes the data connections the client left unused.
+func (s *FakeServer) dropDataConns() {
+	for {
+		select {
+		case conn, ok := <-s.dataConns:
+			if !ok {
+				return
+			}
+			conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+func (s *FakeServer) serve() {
+	defer close(s.done)
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	s.conn = conn
+	s.mu.Unlock()
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	for i, step := range s.script {
+		if step.Expect != "" {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				s.fail("step %d: expected %q: %v", i, step.Expect, err)
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			if !matches(step.Expect, line) {
+				s.fail("step %d: expected %q, got %q", i, step.Expect, line)
+				conn.Write([]byte("500 Unexpected command.\r\n"))
+				return
+			}
+		}
+		reply, passive := s.reply(step)
+		if passive {
+			// The client connects anew after the reply.
+			s.dropDataConns()
+		}
+		if reply != "" {
+			reply = strings.Replace(strings.TrimRight(reply, "\r\n"), "\r\n", "\n", -1)
+			conn.Write([]byte(strings.Replace(reply, "\n", "\r\n", -1) + "\r\n"))
+		}
+		if step.Data != "" || step.Upload {
+			if !s.transfer(i, step) {
+				return
+			}
+		}
+		if step.Hangup {
+			s.mu.Lock()
+			s.finished = i == len(s.script)-1
+			s.mu.Unlock()
+			if !s.finished {
+				s.fail("step %d: hung up before the end of the script", i)
+			}
+			return
+		}
+	}
+	s.mu.Lock()
+	s.finished = true
+	s.mu.Unlock()
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		s.fail("unexpected command %q after the script", strings.TrimRight(line, "\r\n"))
+		conn.Write([]byte("500 Unexpected command.\r\n"))
+	}
+}
+
+// transfer runs the data transfer of step on the next data connection.
+func (s *FakeServer) transfer(i int, step Step) bool {
+	var dc net.Conn
+	select {
+	case dc = <-s.dataConns:
+	case <-time.After(dataTimeout):
+	}
+	if dc == nil {
+		s.fail("step %d: the client opened no data connection", i)
+		return false
+	}
+	defer dc.Close()
+	if step.Data != "" {
+		if _, err := dc.Write([]byte(step.Data)); err != nil {
+			s.fail("step %d: %v", i, err)
+		}
+	}
+	if step.Upload {
+		b, err := ioutil.ReadAll(dc)
+		if err != nil {
+			s.fail("step %d: %v", i, err)
+		}
+		s.mu.Lock()
+		s.uploads = append(s.uploads, string(b))
+		s.mu.Unlock()
+	}
+	return true
+}
@@ -0,0 +1,39 @@
+package ftptest
+
+import (
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// go test -run TestFakeServerMismatch
+func TestFakeServerMismatch(t *testing.T) {
+	s, err := NewFakeServer(Script{
+		{Reply: "220 Ready."},
+		{Expect: "USER *", Reply: "331 Password required."},
+		{Expect: "PASS secret", Reply: "230 Logged in."},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := textproto.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, _, err := c.ReadResponse(220); err != nil {
+		t.Fatal(err)
+	}
+	c.Cmd("USER joe")
+	if _, _, err := c.ReadResponse(331); err != nil {
+		t.Fatal(err)
+	}
+	c.Cmd("PASS wrong")
+	if code, _, _ := c.ReadResponse(-1); code != 500 {
+		t.Errorf("unexpected command got %d, want 500", code)
+	}
+	err = s.Close()
+	if err == nil || !strings.Contains(err.Error(), `expected "PASS secret", got "PASS wrong"`) {
+		t.Errorf("Close() = %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+// Package ftptest runs FTP servers for tests, in the manner of
+// net/http/httptest.
+//
+// Start serves an in-memory file tree on a free local port and logs in the
+// canned Users:
+//
+//	addr, cleanup, err := ftptest.Start(nil)
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer cleanup()
+//	c, err := ftplib.Connect(addr, "user", "password")
+package ftptest
+
+import (
+	"github.com/cxfans/ftplib"
+)
+
+// Users are the canned accounts of the servers, by name and password.
+// "anonymous" logs in with any password.
+var Users = map[string]string{
+	"user": "password",
+	"up":   "up",
+}
+
+// checkPasswd checks the credentials against Users.
+func checkPasswd(user, password string) (bool, error) {
+	if user == "anonymous" {
+		return true, nil
+	}
+	want, ok := Users[user]
+	return ok && password == want, nil
+}
+
+// NewServer returns a server listening on 127.0.0.1 on a free port, storing
+// its files in driver, or a new MemDriver if nil, and checking passwords
+// against Users. It can be configured further before Serve.
+func NewServer(driver ftplib.Driver) (*ftplib.Server, error) {
+	server, err := ftplib.NewServer("127.0.0.1:0", "")
+	if err != nil {
+		return nil, err
+	}
+	if driver == nil {
+		driver = NewMemDriver()
+	}
+	server.Driver = driver
+	server.Auth = ftplib.AuthFunc(checkPasswd)
+	return server, nil
+}
+
+// Serve serves server in the background. It returns its address and a
+// function stopping it.
+func Serve(server *ftplib.Server) (addr string, cleanup func()) {
+	done := make(chan struct{})
+	go func() {
+		server.ListenAndServe()
+		close(done)
+	}()
+	return server.Addr().String(), func() {
+		server.Stop()
+		<-done
+	}
+}
+
+// Start serves driver, or a new MemDriver if nil, on a free local port. It
+// returns the address of the server and a function stopping it.
+func Start(driver ftplib.Driver) (addr string, cleanup func(), err error) {
+	server, err := NewServer(driver)
+	if err != nil {
+		return "", nil, err
+	}
+	addr, cleanup = Serve(server)
+	return addr, cleanup, nil
+}
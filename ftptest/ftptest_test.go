@@ -0,0 +1,53 @@
+package ftptest_test
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/cxfans/ftplib"
+	"github.com/cxfans/ftplib/ftptest"
+)
+
+// go test -run TestStart
+func TestStart(t *testing.T) {
+	driver := ftptest.NewMemDriver()
+	if err := driver.WriteFile("/pub/readme.txt", []byte("read me")); err != nil {
+		t.Fatal(err)
+	}
+	addr, cleanup, err := ftptest.Start(driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	c, err := ftplib.Connect(addr, "user", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Quit()
+	r, err := c.Retr("/pub/readme.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil || string(got) != "read me" {
+		t.Errorf("retrieved %q, %v", got, err)
+	}
+	if err := c.Stor("/pub/new.txt", strings.NewReader("stored")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := driver.ReadFile("/pub/new.txt"); err != nil || string(got) != "stored" {
+		t.Errorf("stored %q, %v", got, err)
+	}
+	entries, err := c.List("/pub")
+	if err != nil || len(entries) != 2 {
+		t.Errorf("listed %d entries, %v", len(entries), err)
+	}
+
+	if c, err := ftplib.Connect(addr, "user", "wrong"); err == nil {
+		c.Quit()
+		t.Error("logged in with a wrong password")
+	}
+}
@@ -0,0 +1,253 @@
+package ftptest
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemDriver is an ftplib.Driver keeping its files in memory.
+type MemDriver struct {
+	mu    sync.Mutex
+	files map[string]*memFile // by clean absolute path, "/" included
+}
+
+type memFile struct {
+	data    []byte
+	dir     bool
+	modTime time.Time
+}
+
+// NewMemDriver returns a MemDriver holding an empty root directory.
+func NewMemDriver() *MemDriver {
+	return &MemDriver{files: map[string]*memFile{
+		"/": {dir: true, modTime: time.Now()},
+	}}
+}
+
+func clean(p string) string {
+	return path.Clean("/" + p)
+}
+
+func pathError(op, p string, err error) error {
+	return &os.PathError{Op: op, Path: p, Err: err}
+}
+
+var (
+	errIsDir  = errors.New("is a directory")
+	errNotDir = errors.New("not a directory")
+)
+
+// parentDir checks that the parent of the clean path p is a directory.
+// The caller holds d.mu.
+func (d *MemDriver) parentDir(op, p string) error {
+	parent, ok := d.files[path.Dir(p)]
+	switch {
+	case !ok:
+		return pathError(op, p, os.ErrNotExist)
+	case !parent.dir:
+		return pathError(op, p, errNotDir)
+	}
+	return nil
+}
+
+// memInfo describes a file of a MemDriver.
+type memInfo struct {
+	name    string
+	size    int64
+	dir     bool
+	modTime time.Time
+}
+
+func (fi *memInfo) Name() string       { return fi.name }
+func (fi *memInfo) Size() int64        { return fi.size }
+func (fi *memInfo) ModTime() time.Time { return fi.modTime }
+func (fi *memInfo) IsDir() bool        { return fi.dir }
+func (fi *memInfo) Sys() interface{}   { return nil }
+
+func (fi *memInfo) Mode() os.FileMode {
+	if fi.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+func (d *MemDriver) Stat(p string) (os.FileInfo, error) {
+	p = clean(p)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	f, ok := d.files[p]
+	if !ok {
+		return nil, pathError("stat", p, os.ErrNotExist)
+	}
+	return &memInfo{name: path.Base(p), size: int64(len(f.data)), dir: f.dir, modTime: f.modTime}, nil
+}
+
+func (d *MemDriver) ReadDir(p string) ([]os.FileInfo, error) {
+	p = clean(p)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if f, ok := d.files[p]; !ok {
+		return nil, pathError("readdir", p, os.ErrNotExist)
+	} else if !f.dir {
+		return nil, pathError("readdir", p, errNotDir)
+	}
+	var infos []os.FileInfo
+	for name, f := range d.files {
+		if name != p && path.Dir(name) == p {
+			infos = append(infos, &memInfo{name: path.Base(name), size: int64(len(f.data)), dir: f.dir, modTime: f.modTime})
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+func (d *MemDriver) Open(p string, offset int64) (io.ReadCloser, error) {
+	p = clean(p)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	f, ok := d.files[p]
+	switch {
+	case !ok:
+		return nil, pathError("open", p, os.ErrNotExist)
+	case f.dir:
+		return nil, pathError("open", p, errIsDir)
+	}
+	data := f.data
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	// Put replaces the data rather than changing it, the slice stays valid.
+	return ioutil.NopCloser(bytes.NewReader(data[offset:])), nil
+}
+
+// Put reads r whole before storing it, so no partial file is left behind.
+func (d *MemDriver) Put(p string, r io.Reader, appending bool) (int64, error) {
+	p = clean(p)
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return int64(len(data)), err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.parentDir("put", p); err != nil {
+		return 0, err
+	}
+	if f, ok := d.files[p]; ok {
+		if f.dir {
+			return 0, pathError("put", p, errIsDir)
+		}
+		if appending {
+			data = append(append([]byte(nil), f.data...), data...)
+		}
+	}
+	d.files[p] = &memFile{data: data, modTime: time.Now()}
+	return int64(len(data)), nil
+}
+
+func (d *MemDriver) Remove(p string) error {
+	p = clean(p)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	f, ok := d.files[p]
+	switch {
+	case !ok:
+		return pathError("remove", p, os.ErrNotExist)
+	case f.dir:
+		return pathError("remove", p, errIsDir)
+	}
+	delete(d.files, p)
+	return nil
+}
+
+func (d *MemDriver) RemoveDir(p string) error {
+	p = clean(p)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	f, ok := d.files[p]
+	switch {
+	case !ok:
+		return pathError("rmdir", p, os.ErrNotExist)
+	case !f.dir:
+		return pathError("rmdir", p, errNotDir)
+	case p == "/":
+		return pathError("rmdir", p, os.ErrPermission)
+	}
+	for name := range d.files {
+		if name == p || strings.HasPrefix(name, p+"/") {
+			delete(d.files, name)
+		}
+	}
+	return nil
+}
+
+func (d *MemDriver) Rename(from, to string) error {
+	from, to = clean(from), clean(to)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.files[from]; !ok {
+		return pathError("rename", from, os.ErrNotExist)
+	}
+	if from == "/" || strings.HasPrefix(to, from+"/") {
+		return pathError("rename", from, os.ErrInvalid)
+	}
+	if err := d.parentDir("rename", to); err != nil {
+		return err
+	}
+	if f, ok := d.files[to]; ok && f.dir {
+		return pathError("rename", to, os.ErrExist)
+	}
+	for name, f := range d.files {
+		if name == from || strings.HasPrefix(name, from+"/") {
+			delete(d.files, name)
+			d.files[to+strings.TrimPrefix(name, from)] = f
+		}
+	}
+	return nil
+}
+
+func (d *MemDriver) MakeDir(p string) error {
+	p = clean(p)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.files[p]; ok {
+		return pathError("mkdir", p, os.ErrExist)
+	}
+	if err := d.parentDir("mkdir", p); err != nil {
+		return err
+	}
+	d.files[p] = &memFile{dir: true, modTime: time.Now()}
+	return nil
+}
+
+// WriteFile stores data at p, making its missing parent directories, for
+// tests to lay out the files served.
+func (d *MemDriver) WriteFile(p string, data []byte) error {
+	p = clean(p)
+	d.mu.Lock()
+	for dir := path.Dir(p); dir != "/"; dir = path.Dir(dir) {
+		if _, ok := d.files[dir]; !ok {
+			d.files[dir] = &memFile{dir: true, modTime: time.Now()}
+		}
+	}
+	d.mu.Unlock()
+	_, err := d.Put(p, bytes.NewReader(data), false)
+	return err
+}
+
+// ReadFile returns the content of the file at p.
+func (d *MemDriver) ReadFile(p string) ([]byte, error) {
+	r, err := d.Open(p, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
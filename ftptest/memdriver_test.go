@@ -0,0 +1,59 @@
+package ftptest
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// go test -run TestMemDriver
+func TestMemDriver(t *testing.T) {
+	d := NewMemDriver()
+	if err := d.WriteFile("/a/b/c.txt", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := d.Stat("a/b"); err != nil || !info.IsDir() {
+		t.Errorf("Stat(a/b) = %v, %v", info, err)
+	}
+	if _, err := d.Put("/a/b/c.txt", strings.NewReader(" world"), true); err != nil {
+		t.Fatal(err)
+	}
+	r, err := d.Open("/a/b/c.txt", 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadAll(r); string(got) != "world" {
+		t.Errorf("read %q from offset 6", got)
+	}
+	if _, err := d.Put("/missing/f", strings.NewReader(""), false); !os.IsNotExist(err) {
+		t.Errorf("Put in a missing directory: %v", err)
+	}
+	if err := d.MakeDir("/a"); !os.IsExist(err) {
+		t.Errorf("MakeDir of an existing directory: %v", err)
+	}
+	if err := d.Remove("/a"); err == nil {
+		t.Error("removed a directory as a file")
+	}
+
+	if err := d.Rename("/a", "/z"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := d.ReadFile("/z/b/c.txt"); err != nil || !bytes.Equal(got, []byte("hello world")) {
+		t.Errorf("renamed file holds %q, %v", got, err)
+	}
+	infos, err := d.ReadDir("/")
+	if err != nil || len(infos) != 1 || infos[0].Name() != "z" {
+		t.Errorf("ReadDir(/) = %v, %v", infos, err)
+	}
+	if err := d.RemoveDir("/z"); err != nil {
+		t.Fatal(err)
+	}
+	if infos, _ := d.ReadDir("/"); len(infos) != 0 {
+		t.Errorf("root holds %d files after RemoveDir", len(infos))
+	}
+	if err := d.RemoveDir("/"); err == nil {
+		t.Error("removed the root")
+	}
+}
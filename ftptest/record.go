@@ -0,0 +1,377 @@
+package ftptest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cxfans/ftplib"
+)
+
+// Recorder is a proxy recording the session of its first client with a
+// live server as a Script, for a FakeServer to replay it offline:
+//
+//	rec, err := ftptest.NewRecorder("ftp.example.com:21")
+//	// Run the client against rec.Addr().
+//	script, err := rec.Close()
+//	err = script.Save(f)
+//
+// Passive transfers are recorded with their data; active ones and TLS are
+// refused with a 502 reply.
+type Recorder struct {
+	upstream       string
+	listener, data net.Listener
+	dataConns      chan net.Conn
+	done           chan struct{}
+
+	mu     sync.Mutex
+	conn   net.Conn
+	script Script
+	err    error
+}
+
+// NewRecorder starts a recorder on a free local port, forwarding to the
+// server at upstream.
+func NewRecorder(upstream string) (*Recorder, error) {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	data, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	rec := &Recorder{
+		upstream:  upstream,
+		listener:  listener,
+		data:      data,
+		dataConns: make(chan net.Conn, 16),
+		done:      make(chan struct{}),
+	}
+	go rec.acceptData()
+	go rec.serve()
+	return rec, nil
+}
+
+// Addr returns the address the client connects to.
+func (rec *Recorder) Addr() string {
+	return rec.listener.Addr().String()
+}
+
+// Close stops the recorder, leaving a second to the client to end the
+// session, and returns the recorded script.
+func (rec *Recorder) Close() (Script, error) {
+	rec.listener.Close()
+	select {
+	case <-rec.done:
+	case <-time.After(time.Second):
+		rec.mu.Lock()
+		if rec.conn != nil {
+			rec.conn.Close()
+		}
+		rec.mu.Unlock()
+		<-rec.done
+	}
+	rec.data.Close()
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.script, rec.err
+}
+
+func (rec *Recorder) add(step Step) {
+	rec.mu.Lock()
+	rec.script = append(rec.script, step)
+	rec.mu.Unlock()
+}
+
+func (rec *Recorder) fail(err error) {
+	rec.mu.Lock()
+	if rec.err == nil {
+		rec.err = err
+	}
+	rec.mu.Unlock()
+}
+
+func (rec *Recorder) acceptData() {
+	defer close(rec.dataConns)
+	for {
+		conn, err := rec.data.Accept()
+		if err != nil {
+			return
+		}
+		rec.dataConns <- conn
+	}
+}
+
+// dropDataConns closes the data connections the client left unused.
+func (rec *Recorder) dropDataConns() {
+	for {
+		select {
+		case conn, ok := <-rec.dataConns:
+			if !ok {
+				return
+			}
+			conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+// readReply reads a whole reply, returning its raw lines and its code.
+func readReply(r *bufio.Reader) (string, int, error) {
+	var raw strings.Builder
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", 0, err
+	}
+	raw.WriteString(line)
+	if len(line) < 4 {
+		return "", 0, fmt.Errorf("short reply %q", line)
+	}
+	code, err := strconv.Atoi(line[:3])
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid reply %q", line)
+	}
+	if line[3] == '-' {
+		end := line[:3] + " "
+		for !strings.HasPrefix(line, end) {
+			if line, err = r.ReadString('\n'); err != nil {
+				return "", 0, err
+			}
+			raw.WriteString(line)
+		}
+	}
+	return raw.String(), code, nil
+}
+
+// scriptReply returns raw as a Step keeps it.
+func scriptReply(raw string) string {
+	return strings.TrimRight(strings.Replace(raw, "\r\n", "\n", -1), "\n")
+}
+
+var (
+	pasvAddr = regexp.MustCompile(`\d+,\d+,\d+,\d+,(\d+),(\d+)`)
+	epsvPort = regexp.MustCompile(`\|\|\|(\d+)\|`)
+)
+
+// passivePort returns the port of the 227 or 229 reply raw, and the reply
+// as scripted, its address replaced with a placeholder.
+func passivePort(code int, raw string) (port int, scripted string, ok bool) {
+	switch code {
+	case ftplib.StatusPassiveMode:
+		m := pasvAddr.FindStringSubmatchIndex(raw)
+		if m == nil {
+			return 0, "", false
+		}
+		p1, _ := strconv.Atoi(raw[m[2]:m[3]])
+		p2, _ := strconv.Atoi(raw[m[4]:m[5]])
+		return p1<<8 | p2, raw[:m[0]] + "{pasv}" + raw[m[1]:], true
+	case ftplib.StatusExtendedPassiveMode:
+		m := epsvPort.FindStringSubmatchIndex(raw)
+		if m == nil {
+			return 0, "", false
+		}
+		port, _ = strconv.Atoi(raw[m[2]:m[3]])
+		return port, raw[:m[2]] + "{port}" + raw[m[3]:], true
+	}
+	return 0, "", false
+}
+
+// notImplemented refuses the commands the recorder cannot forward.
+const notImplemented = "502 Command not implemented.\r\n"
+
+// localReply returns the 227 or 229 reply pointing the client to the data
+// listener of the recorder.
+func (rec *Recorder) localReply(code int) string {
+	addr := rec.data.Addr().(*net.TCPAddr)
+	if code == ftplib.StatusExtendedPassiveMode {
+		return fmt.Sprintf("229 Entering Extended Passive Mode (|||%d|)\r\n", addr.Port)
+	}
+	ip := addr.IP.To4()
+	return fmt.Sprintf("227 Entering Passive Mode (%d,%d,%d,%d,%d,%d).\r\n",
+		ip[0], ip[1], ip[2], ip[3], addr.Port>>8, addr.Port&0xff)
+}
+
+func (rec *Recorder) serve() {
+	defer close(rec.done)
+	client, err := rec.listener.Accept()
+	if err != nil {
+		return
+	}
+	rec.mu.Lock()
+	rec.conn = client
+	rec.mu.Unlock()
+	defer client.Close()
+
+	server, err := net.Dial("tcp", rec.upstream)
+	if err != nil {
+		rec.fail(err)
+		return
+	}
+	defer server.Close()
+	upstreamHost, _, _ := net.SplitHostPort(server.RemoteAddr().String())
+	cr, sr := bufio.NewReader(client), bufio.NewReader(server)
+
+	greeting, code, err := readReply(sr)
+	if err != nil {
+		rec.fail(err)
+		return
+	}
+	io.WriteString(client, greeting)
+	rec.add(Step{Reply: scriptReply(greeting), Hangup: code == ftplib.StatusNotAvailable})
+
+	var upData net.Conn // data connection to the server, while passive
+	defer func() {
+		if upData != nil {
+			upData.Close()
+		}
+	}()
+	for {
+		line, err := cr.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.SplitN(cmd, " ", 2)[0])
+		switch verb {
+		case "PORT", "EPRT", "AUTH":
+			io.WriteString(client, notImplemented)
+			rec.add(Step{Expect: cmd, Reply: scriptReply(notImplemented)})
+			continue
+		}
+		if _, err := io.WriteString(server, line); err != nil {
+			rec.add(Step{Expect: cmd, Hangup: true})
+			return
+		}
+		raw, code, err := readReply(sr)
+		if err != nil {
+			rec.add(Step{Expect: cmd, Hangup: true})
+			return
+		}
+		step := Step{Expect: cmd, Reply: scriptReply(raw), Hangup: code == ftplib.StatusNotAvailable}
+		if port, scripted, ok := passivePort(code, raw); ok {
+			if upData != nil {
+				upData.Close()
+			}
+			upData, err = net.DialTimeout("tcp", net.JoinHostPort(upstreamHost, strconv.Itoa(port)), dataTimeout)
+			if err != nil {
+				rec.fail(err)
+				return
+			}
+			step.Reply = scriptReply(scripted)
+			raw = rec.localReply(code)
+			rec.dropDataConns()
+		}
+		io.WriteString(client, raw)
+		if code >= 100 && code < 200 && upData != nil {
+			step.Upload = verb == "STOR" || verb == "APPE" || verb == "STOU"
+			step.Data, err = rec.pipe(upData)
+			upData = nil
+			if err != nil {
+				rec.fail(err)
+				return
+			}
+			rec.add(step)
+			raw, code, err = readReply(sr)
+			if err != nil {
+				rec.add(Step{Hangup: true})
+				return
+			}
+			io.WriteString(client, raw)
+			step = Step{Reply: scriptReply(raw), Hangup: code == ftplib.StatusNotAvailable}
+		}
+		rec.add(step)
+		if step.Hangup {
+			return
+		}
+	}
+}
+
+// pipe copies the transfer between the client and the server on upData,
+// returning what the server sent.
+func (rec *Recorder) pipe(upData net.Conn) (string, error) {
+	defer upData.Close()
+	var clientData net.Conn
+	select {
+	case clientData = <-rec.dataConns:
+	case <-time.After(dataTimeout):
+	}
+	if clientData == nil {
+		return "", errors.New("the client opened no data connection")
+	}
+	defer clientData.Close()
+	var down bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		io.Copy(upData, clientData)
+		if c, ok := upData.(*net.TCPConn); ok {
+			c.CloseWrite()
+		}
+		close(done)
+	}()
+	_, err := io.Copy(io.MultiWriter(clientData, &down), upData)
+	if c, ok := clientData.(*net.TCPConn); ok {
+		c.CloseWrite()
+	}
+	<-done
+	return down.String(), err
+}
+
+// jsonStep is the JSON form of a Step, data being base64 encoded when not
+// valid UTF-8.
+type jsonStep struct {
+	Expect string `json:"expect,omitempty"`
+	Reply  string `json:"reply,omitempty"`
+	Data   string `json:"data,omitempty"`
+	Data64 []byte `json:"data64,omitempty"`
+	Upload bool   `json:"upload,omitempty"`
+	Hangup bool   `json:"hangup,omitempty"`
+}
+
+func (step Step) MarshalJSON() ([]byte, error) {
+	js := jsonStep{Expect: step.Expect, Reply: step.Reply, Upload: step.Upload, Hangup: step.Hangup}
+	if utf8.ValidString(step.Data) {
+		js.Data = step.Data
+	} else {
+		js.Data64 = []byte(step.Data)
+	}
+	return json.Marshal(js)
+}
+
+func (step *Step) UnmarshalJSON(b []byte) error {
+	var js jsonStep
+	if err := json.Unmarshal(b, &js); err != nil {
+		return err
+	}
+	*step = Step{Expect: js.Expect, Reply: js.Reply, Data: js.Data, Upload: js.Upload, Hangup: js.Hangup}
+	if js.Data64 != nil {
+		step.Data = string(js.Data64)
+	}
+	return nil
+}
+
+// Save writes script to w as JSON.
+func (script Script) Save(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(script)
+}
+
+// LoadScript reads a script written by Save.
+func LoadScript(r io.Reader) (Script, error) {
+	var script Script
+	err := json.NewDecoder(r).Decode(&script)
+	return script, err
+}
@@ -0,0 +1,95 @@
+package ftptest_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/cxfans/ftplib"
+	"github.com/cxfans/ftplib/ftptest"
+)
+
+// session runs a client session against addr, returning what it saw.
+func session(t *testing.T, addr string) string {
+	t.Helper()
+	c, err := ftplib.Connect(addr, "user", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Quit()
+	var seen []string
+	entries, err := c.List("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		seen = append(seen, entry.Name)
+	}
+	r, err := c.Retr("/bin.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err := r.Close(); err != nil {
+		t.Error(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen = append(seen, string(b))
+	if err := c.Stor("/up.txt", strings.NewReader("uploaded")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Retr("/missing"); err == nil {
+		t.Error("retrieved a missing file")
+	}
+	return strings.Join(seen, "|")
+}
+
+// go test -run TestRecordReplay
+func TestRecordReplay(t *testing.T) {
+	driver := ftptest.NewMemDriver()
+	driver.WriteFile("/a.txt", []byte("alpha"))
+	driver.WriteFile("/bin.dat", []byte{0, 0xff, 0xfe, '\r', '\n'})
+	addr, cleanup, err := ftptest.Start(driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	rec, err := ftptest.NewRecorder(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	live := session(t, rec.Addr())
+	script, err := rec.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := driver.ReadFile("/up.txt"); string(got) != "uploaded" {
+		t.Errorf("recorded upload stored %q", got)
+	}
+
+	var saved bytes.Buffer
+	if err := script.Save(&saved); err != nil {
+		t.Fatal(err)
+	}
+	script, err = ftptest.LoadScript(&saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay, err := ftptest.NewFakeServer(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed := session(t, replay.Addr()); replayed != live {
+		t.Errorf("replay saw %q, live %q", replayed, live)
+	}
+	if err := replay.Close(); err != nil {
+		t.Error(err)
+	}
+	if uploads := replay.Uploads(); len(uploads) != 1 || uploads[0] != "uploaded" {
+		t.Errorf("replay uploads %q", uploads)
+	}
+}
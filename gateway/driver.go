@@ -0,0 +1,243 @@
+package gateway
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/cxfans/ftplib"
+)
+
+var (
+	errIsDir  = errors.New("is a directory")
+	errNotDir = errors.New("not a directory")
+)
+
+// driver serves the upstream tree of a session. Its calls take turns on
+// the control connection, a download holding it until closed.
+type driver struct {
+	mu   sync.Mutex
+	c    *ftplib.ClientConn
+	root string
+}
+
+func newDriver(c *ftplib.ClientConn, root string) *driver {
+	if root == "" {
+		root = "."
+	}
+	return &driver{c: c, root: root}
+}
+
+// remote returns the upstream path of p.
+func (d *driver) remote(p string) string {
+	return path.Join(d.root, p)
+}
+
+// Close ends the upstream session.
+func (d *driver) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.c.Quit()
+}
+
+// entryInfo describes a listed entry.
+type entryInfo struct {
+	*ftplib.Entry
+	name string
+}
+
+func (fi *entryInfo) Name() string       { return fi.name }
+func (fi *entryInfo) Size() int64        { return int64(fi.Entry.Size) }
+func (fi *entryInfo) ModTime() time.Time { return fi.Time }
+func (fi *entryInfo) IsDir() bool        { return fi.Type == ftplib.EntryTypeFolder }
+func (fi *entryInfo) Sys() interface{}   { return fi.Entry }
+
+func (fi *entryInfo) Mode() os.FileMode {
+	if fi.Entry.Mode != 0 {
+		return fi.Entry.Mode
+	}
+	if fi.IsDir() {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+// rootInfo describes the root, which no listing shows.
+type rootInfo struct{}
+
+func (rootInfo) Name() string       { return "/" }
+func (rootInfo) Size() int64        { return 0 }
+func (rootInfo) ModTime() time.Time { return time.Time{} }
+func (rootInfo) IsDir() bool        { return true }
+func (rootInfo) Sys() interface{}   { return nil }
+func (rootInfo) Mode() os.FileMode  { return os.ModeDir | 0755 }
+
+// readDir lists p. The caller holds d.mu.
+func (d *driver) readDir(p string) ([]os.FileInfo, error) {
+	entries, err := d.c.List(d.remote(p))
+	if err != nil {
+		return nil, &os.PathError{Op: "readdir", Path: p, Err: err}
+	}
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		name := path.Base(e.Name)
+		if name != "." && name != ".." {
+			infos = append(infos, &entryInfo{e, name})
+		}
+	}
+	return infos, nil
+}
+
+// stat describes p from the listing of its parent. The caller holds d.mu.
+func (d *driver) stat(p string) (os.FileInfo, error) {
+	if p == "/" {
+		return rootInfo{}, nil
+	}
+	infos, err := d.readDir(path.Dir(p))
+	if err != nil {
+		return nil, err
+	}
+	for _, fi := range infos {
+		if fi.Name() == path.Base(p) {
+			return fi, nil
+		}
+	}
+	return nil, &os.PathError{Op: "stat", Path: p, Err: os.ErrNotExist}
+}
+
+func (d *driver) Stat(p string) (os.FileInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stat(p)
+}
+
+func (d *driver) ReadDir(p string) ([]os.FileInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if fi, err := d.stat(p); err != nil {
+		return nil, err
+	} else if !fi.IsDir() {
+		return nil, &os.PathError{Op: "readdir", Path: p, Err: errNotDir}
+	}
+	return d.readDir(p)
+}
+
+// download holds the control connection of its driver until closed.
+type download struct {
+	io.ReadCloser
+	d    *driver
+	once sync.Once
+}
+
+func (r *download) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.d.mu.Unlock)
+	return err
+}
+
+func (d *driver) Open(p string, offset int64) (io.ReadCloser, error) {
+	d.mu.Lock()
+	fi, err := d.stat(p)
+	if err == nil && fi.IsDir() {
+		err = &os.PathError{Op: "open", Path: p, Err: errIsDir}
+	}
+	if err != nil {
+		d.mu.Unlock()
+		return nil, err
+	}
+	r, err := d.c.RetrFrom(d.remote(p), uint64(offset))
+	if err != nil {
+		d.mu.Unlock()
+		return nil, &os.PathError{Op: "open", Path: p, Err: err}
+	}
+	return &download{ReadCloser: r, d: d}, nil
+}
+
+// counter counts the bytes read through it.
+type counter struct {
+	io.Reader
+	n int64
+}
+
+func (c *counter) Read(b []byte) (int, error) {
+	n, err := c.Reader.Read(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// Put appends by resuming the upload at the size of the file upstream.
+func (d *driver) Put(p string, r io.Reader, appending bool) (int64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var offset uint64
+	if appending {
+		if fi, err := d.stat(p); err == nil {
+			offset = uint64(fi.Size())
+		}
+	}
+	cr := &counter{Reader: r}
+	if err := d.c.StorFrom(d.remote(p), cr, offset); err != nil {
+		return cr.n, &os.PathError{Op: "put", Path: p, Err: err}
+	}
+	return cr.n, nil
+}
+
+func (d *driver) Remove(p string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.c.Delete(d.remote(p)); err != nil {
+		return &os.PathError{Op: "remove", Path: p, Err: err}
+	}
+	return nil
+}
+
+// RemoveDir empties the directory first, upstream servers refusing to
+// remove directories that are not.
+func (d *driver) RemoveDir(p string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.removeAll(p)
+}
+
+func (d *driver) removeAll(p string) error {
+	infos, err := d.readDir(p)
+	if err != nil {
+		return err
+	}
+	for _, fi := range infos {
+		child := path.Join(p, fi.Name())
+		if fi.IsDir() {
+			err = d.removeAll(child)
+		} else if err = d.c.Delete(d.remote(child)); err != nil {
+			err = &os.PathError{Op: "remove", Path: child, Err: err}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := d.c.RemoveDir(d.remote(p)); err != nil {
+		return &os.PathError{Op: "rmdir", Path: p, Err: err}
+	}
+	return nil
+}
+
+func (d *driver) Rename(from, to string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.c.Rename(d.remote(from), d.remote(to)); err != nil {
+		return &os.PathError{Op: "rename", Path: from, Err: err}
+	}
+	return nil
+}
+
+func (d *driver) MakeDir(p string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.c.MakeDir(d.remote(p)); err != nil {
+		return &os.PathError{Op: "mkdir", Path: p, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+// Package gateway relays the FTP sessions of a local server to an upstream
+// server, bridging the clients it serves to a backend they could not use
+// directly, such as an FTPS-only one for legacy clients:
+//
+//	g := &gateway.Gateway{
+//		Upstream:  "ftps.example.com:21",
+//		TLSConfig: &tls.Config{ServerName: "ftps.example.com"},
+//	}
+//	server, err := gateway.NewServer(":2121", g)
+//	err = server.ListenAndServe()
+//
+// Each client logging in opens a session upstream, with its credentials or
+// those Credentials maps them to, which serves its commands until it logs
+// out. The client sees the upstream tree under Root as its own.
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"time"
+
+	"github.com/cxfans/ftplib"
+)
+
+// Gateway is the ftplib.DriverAuth of a gateway server.
+type Gateway struct {
+	// Upstream is the address of the server relayed to.
+	Upstream string
+
+	// Root is the upstream directory served, the login directory if "".
+	Root string
+
+	// Credentials, if set, maps the credentials of the clients to those
+	// used upstream; ok false refuses the client without asking upstream.
+	Credentials func(user, password string) (upstreamUser, upstreamPassword string, ok bool)
+
+	// TLSConfig, if set, secures the upstream sessions with AUTH TLS, their
+	// data connections included.
+	TLSConfig *tls.Config
+
+	// Timeout bounds the connections to upstream; zero means none.
+	Timeout time.Duration
+}
+
+var _ ftplib.DriverAuth = (*Gateway)(nil)
+
+// NewServer returns a server listening on addr relaying to g.
+func NewServer(addr string, g *Gateway) (*ftplib.Server, error) {
+	server, err := ftplib.NewServer(addr, "")
+	if err != nil {
+		return nil, err
+	}
+	server.Driver = nil
+	server.Auth = g
+	return server, nil
+}
+
+// errRefused is returned by upstream logins refused by Credentials.
+var errRefused = errors.New("gateway: credentials refused")
+
+// dial logs user in upstream, with the credentials mapped.
+func (g *Gateway) dial(user, password string) (*ftplib.ClientConn, error) {
+	if g.Credentials != nil {
+		var ok bool
+		if user, password, ok = g.Credentials(user, password); !ok {
+			return nil, errRefused
+		}
+	}
+	opts := []ftplib.DialOption{ftplib.WithTimeout(g.Timeout)}
+	if g.TLSConfig != nil {
+		opts = append(opts, ftplib.WithTLS(g.TLSConfig))
+	}
+	c, err := ftplib.Dial(g.Upstream, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Login(user, password); err != nil {
+		c.Quit()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Login opens the upstream session of user. Failing to log in upstream
+// refuses the user; other errors, such as upstream being down, are
+// returned too.
+func (g *Gateway) Login(ctx context.Context, user, password string) (ftplib.Driver, error) {
+	c, err := g.dial(user, password)
+	if err == nil {
+		return newDriver(c, g.Root), nil
+	}
+	if err == errRefused {
+		return nil, nil
+	}
+	var e *ftplib.FTPError
+	if errors.As(err, &e) {
+		switch e.Code {
+		case ftplib.StatusNotLoggedIn, ftplib.StatusInvalidCredentials:
+			return nil, nil
+		}
+	}
+	return nil, err
+}
+
+// CheckPasswd checks the credentials upstream, logging in and out.
+func (g *Gateway) CheckPasswd(user, password string) (bool, error) {
+	d, err := g.Login(context.Background(), user, password)
+	if d == nil {
+		return false, err
+	}
+	return true, d.(*driver).Close()
+}
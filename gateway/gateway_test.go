@@ -0,0 +1,119 @@
+package gateway_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cxfans/ftplib"
+	"github.com/cxfans/ftplib/ftptest"
+	"github.com/cxfans/ftplib/gateway"
+)
+
+// testCert returns a self-signed certificate for name.
+func testCert(t *testing.T, name string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// go test -run TestGateway
+func TestGateway(t *testing.T) {
+	driver := ftptest.NewMemDriver()
+	if err := driver.WriteFile("/home/readme.txt", []byte("read me")); err != nil {
+		t.Fatal(err)
+	}
+	upstream, err := ftptest.NewServer(driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := testCert(t, "ftp.example")
+	upstream.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	upstreamAddr, stopUpstream := ftptest.Serve(upstream)
+	defer stopUpstream()
+
+	roots := x509.NewCertPool()
+	leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+	roots.AddCert(leaf)
+	g := &gateway.Gateway{
+		Upstream: upstreamAddr,
+		Root:     "/home",
+		Credentials: func(user, password string) (string, string, bool) {
+			if user == "joe" && password == "secret" {
+				return "user", "password", true
+			}
+			return "", "", false
+		},
+		TLSConfig: &tls.Config{ServerName: "ftp.example", RootCAs: roots},
+		Timeout:   5 * time.Second,
+	}
+	server, err := gateway.NewServer("127.0.0.1:0", g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, stop := ftptest.Serve(server)
+	defer stop()
+
+	if c, err := ftplib.Connect(addr, "joe", "wrong"); err == nil {
+		t.Error("logged in with a wrong password")
+		c.Quit()
+	}
+	c, err := ftplib.Connect(addr, "joe", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Quit()
+
+	r, err := c.Retr("/readme.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil || string(got) != "read me" {
+		t.Errorf("retrieved %q, %v", got, err)
+	}
+	if err := c.MakeDir("/docs"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Stor("/docs/new.txt", strings.NewReader("stored")); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := driver.ReadFile("/home/docs/new.txt"); string(got) != "stored" {
+		t.Errorf("upstream holds %q", got)
+	}
+	entries, err := c.List("/docs")
+	if err != nil || len(entries) != 1 || entries[0].Name != "new.txt" || entries[0].Size != 6 {
+		t.Errorf("listed %v, %v", entries, err)
+	}
+	if err := c.Rename("/docs/new.txt", "/docs/renamed.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RemoveDir("/docs"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := driver.Stat("/home/docs"); err == nil {
+		t.Error("directory not removed upstream")
+	}
+}
@@ -0,0 +1,105 @@
+package ftplib
+
+import (
+	"sync"
+	"time"
+)
+
+// keepAlive sends NOOP on the control connection of a client idle for
+// interval, between its operations.
+type keepAlive struct {
+	interval time.Duration
+
+	mu           sync.Mutex // held during the exchanges of the client
+	last         time.Time  // end of the last exchange
+	transferring bool       // while a transfer awaits its final reply
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// SetKeepAlive sends NOOP whenever the session stays idle for interval
+// between operations, so that the stateful firewalls and servers timing
+// idle sessions out keep it open. Zero stops.
+func (c *ClientConn) SetKeepAlive(interval time.Duration) {
+	c.stopKeepAlive()
+	c.alive = nil
+	if interval > 0 {
+		c.alive = &keepAlive{interval: interval}
+		c.startKeepAlive()
+	}
+}
+
+// WithKeepAlive dials a ClientConn keeping its session alive, as
+// SetKeepAlive.
+func WithKeepAlive(interval time.Duration) DialOption {
+	return func(c *ClientConn) {
+		if interval > 0 {
+			c.alive = &keepAlive{interval: interval}
+		}
+	}
+}
+
+func (c *ClientConn) startKeepAlive() {
+	k := c.alive
+	if k == nil {
+		return
+	}
+	k.last = time.Now()
+	k.transferring = false
+	k.done, k.stopped = make(chan struct{}), make(chan struct{})
+	go k.run(c)
+}
+
+func (c *ClientConn) stopKeepAlive() {
+	if k := c.alive; k != nil && k.done != nil {
+		close(k.done)
+		<-k.stopped
+		k.done = nil
+	}
+}
+
+func (k *keepAlive) run(c *ClientConn) {
+	defer close(k.stopped)
+	timer := time.NewTimer(k.interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-k.done:
+			return
+		case <-timer.C:
+		}
+		k.mu.Lock()
+		if !k.transferring && time.Since(k.last) >= k.interval {
+			_, err := c.conn.Cmd("NOOP")
+			if err == nil {
+				_, _, err = c.conn.ReadResponse(StatusCommandOK)
+			}
+			if err != nil {
+				c.logf("Keep-alive: %v", err)
+			}
+			k.last = time.Now()
+		}
+		wait := k.interval - time.Since(k.last)
+		k.mu.Unlock()
+		timer.Reset(wait)
+	}
+}
+
+// lockControl starts an exchange on the control connection, which the
+// NOOPs of keep-alive wait for.
+func (c *ClientConn) lockControl() {
+	if k := c.alive; k != nil {
+		k.mu.Lock()
+	}
+}
+
+// unlockControl ends an exchange on the control connection, which leaves
+// a transfer under way or not.
+func (c *ClientConn) unlockControl(transferring bool) {
+	if k := c.alive; k != nil {
+		k.transferring = transferring
+		k.last = time.Now()
+		k.mu.Unlock()
+	}
+}
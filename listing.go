@@ -0,0 +1,145 @@
+package ftplib
+
+import (
+	"os"
+	"strings"
+)
+
+// ListOptions describes the listing a ListFormatter is asked for.
+type ListOptions struct {
+	Verb  string   // LIST, NLST or MLSD
+	Args  string   // options the client set for Verb with OPTS, if any
+	Facts []string // MLSx facts selected with "OPTS MLST", nil for all
+}
+
+// ListFormatter renders the entries of a directory listing.
+type ListFormatter interface {
+	FormatList(items []os.FileInfo, opts *ListOptions) []byte
+}
+
+// ListFormatterFunc adapts a function to the ListFormatter interface.
+type ListFormatterFunc func(items []os.FileInfo, opts *ListOptions) []byte
+
+func (f ListFormatterFunc) FormatList(items []os.FileInfo, opts *ListOptions) []byte {
+	return f(items, opts)
+}
+
+// Formatters of the listings sent by the server.
+var (
+	DetailedListFormatter ListFormatter = ListFormatterFunc(func(items []os.FileInfo, _ *ListOptions) []byte {
+		return ListDetailed(items)
+	})
+	ShortListFormatter ListFormatter = ListFormatterFunc(func(items []os.FileInfo, _ *ListOptions) []byte {
+		return ListShort(items)
+	})
+	MLSxListFormatter ListFormatter = ListFormatterFunc(func(items []os.FileInfo, opts *ListOptions) []byte {
+		return listMLSx(items, opts.Facts)
+	})
+)
+
+// DefaultListFormatters are the formatters of the listing commands the
+// server's ListFormatters do not override.
+var DefaultListFormatters = map[string]ListFormatter{
+	LIST: DetailedListFormatter,
+	NLST: ShortListFormatter,
+	MLSD: MLSxListFormatter,
+}
+
+// listFormatter returns the formatter of the listing command verb.
+func (server *Server) listFormatter(verb string) ListFormatter {
+	if formatter, ok := server.ListFormatters[verb]; ok {
+		return formatter
+	}
+	return DefaultListFormatters[verb]
+}
+
+// list sends the listing of the directory named by params, or of the
+// working directory, as formatted for verb.
+func (serverConn *ServerConn) list(verb string, params []string) {
+	// LIST and NLST are commonly sent "ls" flags, which are not paths.
+	if verb != MLSD && len(params) > 0 && strings.HasPrefix(params[0], "-") {
+		params = params[1:]
+	}
+	p := serverConn.parsingPath(params)
+	if !serverConn.hasDataConn() {
+		return
+	}
+	items, err := serverConn.listDir(p)
+	if err != nil {
+		serverConn.closeDataConn()
+		serverConn.sendStatusText(serverConn.errorCode(err))
+		return
+	}
+	opts := &ListOptions{
+		Verb:  verb,
+		Args:  serverConn.listArgs[verb],
+		Facts: serverConn.facts,
+	}
+	serverConn.reply(StatusAboutToSend, "list")
+	listing := serverConn.server.listFormatter(verb).FormatList(items, opts)
+	serverConn.sendData([]byte(serverConn.encodeClient(string(listing))))
+}
+
+// mlst sends the facts of the file p on the control connection, as
+// requested by MLST (RFC 3659 section 7).
+func (serverConn *ServerConn) mlst(p string) {
+	info, err := serverConn.driver().Stat(p)
+	if err != nil {
+		serverConn.sendStatusText(serverConn.errorCode(err))
+		return
+	}
+	facts := serverConn.facts
+	if facts == nil {
+		facts = mlsxFactNames
+	}
+	serverConn.sendMultiline(StatusRequestedFileActionOK,
+		serverConn.text(StatusRequestedFileActionOK, "mlst", p),
+		[]string{mlsxFacts(info, facts) + " " + p},
+		serverConn.text(StatusRequestedFileActionOK, "mlst.end"))
+}
+
+// opts sets the options of a command, as requested by OPTS (RFC 2389).
+// "OPTS UTF8" selects the encoding of names, "OPTS MLST" the MLSx facts;
+// the options of the other listing commands are handed to their formatter.
+func (serverConn *ServerConn) opts(params []string) {
+	if len(params) == 0 {
+		serverConn.sendStatusText(StatusBadArguments)
+		return
+	}
+	verb, args := strings.ToUpper(params[0]), strings.Join(params[1:], " ")
+	switch {
+	case verb == "UTF8":
+		serverConn.utf8Opts(args)
+	case verb == MLST:
+		serverConn.facts = selectFacts(args)
+		var list string
+		for _, fact := range serverConn.facts {
+			list += fact + ";"
+		}
+		serverConn.reply(StatusCommandOK, "opts.mlst", list)
+	case serverConn.server.listFormatter(verb) != nil:
+		if serverConn.listArgs == nil {
+			serverConn.listArgs = make(map[string]string)
+		}
+		serverConn.listArgs[verb] = args
+		serverConn.sendStatusText(StatusCommandOK)
+	default:
+		serverConn.sendStatusText(StatusNotImplementedParameter)
+	}
+}
+
+// selectFacts returns the known facts of the list "type;size;", in the
+// order and spelling the server uses. Unknown facts are dropped, as
+// RFC 3659 asks.
+func selectFacts(list string) []string {
+	facts := []string{}
+	for _, fact := range mlsxFactNames {
+		for _, name := range strings.Split(list, ";") {
+			if strings.EqualFold(name, fact) {
+				facts = append(facts, fact)
+				break
+			}
+		}
+	}
+	return facts
+}
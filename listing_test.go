@@ -0,0 +1,111 @@
+package ftplib
+
+import (
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// go test -run TestListFormatters
+func TestListFormatters(t *testing.T) {
+	var got []*ListOptions
+	recorder := ListFormatterFunc(func(items []os.FileInfo, opts *ListOptions) []byte {
+		got = append(got, opts)
+		return nil
+	})
+	server := &Server{
+		Driver:         &DiskDriver{Root: "."},
+		ListFormatters: map[string]ListFormatter{LIST: recorder, MLSD: recorder},
+		LenientReplies: true,
+	}
+	c, done := pipeServe(server)
+	expect := func(cmd string, code int, msg string) {
+		c.Cmd(cmd)
+		if _, got, err := c.ReadResponse(code); err != nil || (msg != "" && got != msg) {
+			t.Errorf("%s: got %q (%v), want %q", cmd, got, err, msg)
+		}
+	}
+
+	expect("OPTS MLST size;Type;bogus;", StatusCommandOK, "MLST OPTS type;size;")
+	expect("OPTS LIST long", StatusCommandOK, "")
+	expect("OPTS FOO", StatusNotImplementedParameter, "")
+	for _, cmd := range []string{"LIST -la", "MLSD"} {
+		// Without a data connection, lenient servers format the listing,
+		// then abort it.
+		expect(cmd, StatusAboutToSend, "")
+		if _, _, err := c.ReadResponse(StatusTransfertAborted); err != nil {
+			t.Error(cmd, err)
+		}
+	}
+
+	c.Cmd("QUIT")
+	c.ReadResponse(StatusClosing)
+	<-done
+	if len(got) != 2 || got[0].Verb != LIST || got[0].Args != "long" ||
+		got[1].Verb != MLSD || len(got[1].Facts) != 2 {
+		t.Errorf("unexpected options %+v", got)
+	}
+}
+
+// go test -run TestListMissingDir
+func TestListMissingDir(t *testing.T) {
+	c, done := pipeServe(&Server{Driver: &DiskDriver{Root: "."}})
+	c.Cmd("EPSV")
+	_, msg, err := c.ReadResponse(StatusExtendedPassiveMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := strings.TrimSuffix(msg[strings.Index(msg, "|||")+3:], "|)")
+	c.Cmd("LIST missing")
+	if _, msg, err := c.ReadResponse(StatusFileUnavailable); err != nil {
+		t.Errorf("LIST of a missing directory: %s (%v)", msg, err)
+	}
+	// The data connection of the failed listing is closed, not left for
+	// the next transfer.
+	if conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", port)); err == nil {
+		conn.Close()
+		t.Error("passive listener left open")
+	}
+	c.Cmd("LIST")
+	if _, msg, err := c.ReadResponse(StatusCanNotOpenDataConnection); err != nil {
+		t.Errorf("LIST after a failed listing: %s (%v)", msg, err)
+	}
+	c.Cmd("QUIT")
+	c.ReadResponse(StatusClosing)
+	<-done
+}
+
+// go test -run TestListMLSxFacts
+func TestListMLSxFacts(t *testing.T) {
+	items := []os.FileInfo{&fakeFileInfo{"a.txt", 12, 0644, time.Date(2022, 6, 1, 10, 24, 0, 0, time.UTC)}}
+	want := "size=12;type=file; a.txt\r\n"
+	if got := string(listMLSx(items, []string{"size", "type"})); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := string(listMLSx(items, []string{})); got != " a.txt\r\n" {
+		t.Errorf("got %q without facts", got)
+	}
+}
+
+// go test -run TestMLST
+func TestMLST(t *testing.T) {
+	server := &Server{Driver: &DiskDriver{Root: "."}}
+	c, done := pipeServe(server)
+	c.Cmd("OPTS MLST type;")
+	c.ReadResponse(StatusCommandOK)
+	c.Cmd("MLST go.mod")
+	if _, msg, err := c.ReadResponse(StatusRequestedFileActionOK); err != nil {
+		t.Error(err)
+	} else if lines := strings.Split(msg, "\n"); len(lines) != 3 || lines[1] != " type=file; /go.mod" {
+		t.Errorf("unexpected reply %q", msg)
+	}
+	c.Cmd("MLST missing")
+	if _, _, err := c.ReadResponse(StatusFileUnavailable); err != nil {
+		t.Error(err)
+	}
+	c.Cmd("QUIT")
+	c.ReadResponse(StatusClosing)
+	<-done
+}
@@ -0,0 +1,143 @@
+package ftplib
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Metrics records the commands served: their latency, from reading the
+// command to its last reply, and that reply's code.
+//
+// An adapter over a Prometheus HistogramVec and CounterVec takes a few
+// lines; CommandMetrics keeps them in memory.
+type Metrics interface {
+	ObserveCommand(verb string, code int, latency time.Duration)
+}
+
+// DefaultLatencyBuckets are the upper bounds of the latency histograms of
+// a CommandMetrics without Buckets.
+var DefaultLatencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	25 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	2500 * time.Millisecond,
+	10 * time.Second,
+	time.Minute,
+}
+
+// CommandMetrics is a Metrics holding, per verb, a latency histogram and
+// the distribution of the reply codes.
+//
+// Its String method returns the statistics in JSON, so that it can be
+// published with expvar.Publish.
+type CommandMetrics struct {
+	// Buckets are the upper bounds of the latency histograms, in increasing
+	// order. They may not change once commands are observed.
+	Buckets []time.Duration
+
+	mu    sync.Mutex
+	verbs map[string]*CommandStats
+}
+
+// CommandStats are the statistics of a verb.
+type CommandStats struct {
+	Count uint64        // commands observed
+	Sum   time.Duration // total latency
+
+	// Buckets counts the commands per latency: Buckets[i] those no slower
+	// than the i-th bound, less those counted by Buckets[i-1]. The last
+	// counts the commands slower than every bound.
+	Buckets []uint64
+
+	Codes map[int]uint64 // commands per reply code
+}
+
+// ObserveCommand records a command.
+func (metrics *CommandMetrics) ObserveCommand(verb string, code int, latency time.Duration) {
+	bounds := metrics.bounds()
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	if metrics.verbs == nil {
+		metrics.verbs = make(map[string]*CommandStats)
+	}
+	stats := metrics.verbs[verb]
+	if stats == nil {
+		stats = &CommandStats{Buckets: make([]uint64, len(bounds)+1), Codes: make(map[int]uint64)}
+		metrics.verbs[verb] = stats
+	}
+	stats.Count++
+	stats.Sum += latency
+	stats.Buckets[sort.Search(len(bounds), func(i int) bool { return latency <= bounds[i] })]++
+	stats.Codes[code]++
+}
+
+func (metrics *CommandMetrics) bounds() []time.Duration {
+	if metrics.Buckets == nil {
+		return DefaultLatencyBuckets
+	}
+	return metrics.Buckets
+}
+
+// Snapshot returns a copy of the statistics, per verb.
+func (metrics *CommandMetrics) Snapshot() map[string]CommandStats {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	snapshot := make(map[string]CommandStats, len(metrics.verbs))
+	for verb, stats := range metrics.verbs {
+		copied := *stats
+		copied.Buckets = append([]uint64(nil), stats.Buckets...)
+		copied.Codes = make(map[int]uint64, len(stats.Codes))
+		for code, n := range stats.Codes {
+			copied.Codes[code] = n
+		}
+		snapshot[verb] = copied
+	}
+	return snapshot
+}
+
+// String returns the statistics as a JSON object keyed by verb, with the
+// bucket bounds as keys in seconds ("+Inf" for the last).
+func (metrics *CommandMetrics) String() string {
+	type verbJSON struct {
+		Count   uint64            `json:"count"`
+		Sum     float64           `json:"sum"`
+		Buckets map[string]uint64 `json:"buckets"`
+		Codes   map[int]uint64    `json:"codes"`
+	}
+	bounds := metrics.bounds()
+	verbs := make(map[string]verbJSON)
+	for verb, stats := range metrics.Snapshot() {
+		buckets := make(map[string]uint64, len(stats.Buckets))
+		for i, n := range stats.Buckets {
+			le := "+Inf"
+			if i < len(bounds) {
+				le = strconv.FormatFloat(bounds[i].Seconds(), 'g', -1, 64)
+			}
+			buckets[le] = n
+		}
+		verbs[verb] = verbJSON{stats.Count, stats.Sum.Seconds(), buckets, stats.Codes}
+	}
+	b, _ := json.Marshal(verbs)
+	return string(b)
+}
+
+// replied records code as the reply to the command being served.
+func (serverConn *ServerConn) replied(code int) {
+	serverConn.replyCode = code
+	serverConn.setAttribute(AttrReplyCode, code)
+}
+
+// observeCommand hands the command being served to the server's Metrics.
+func (serverConn *ServerConn) observeCommand() {
+	metrics := serverConn.server.Metrics
+	if metrics == nil || serverConn.verb == "" {
+		return
+	}
+	metrics.ObserveCommand(serverConn.verb, serverConn.replyCode, time.Since(serverConn.cmdStart))
+	serverConn.verb = ""
+}
@@ -0,0 +1,81 @@
+package ftplib
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// go test -run TestCommandMetrics
+func TestCommandMetrics(t *testing.T) {
+	metrics := &CommandMetrics{Buckets: []time.Duration{time.Millisecond, time.Second}}
+	metrics.ObserveCommand(LIST, 226, 500*time.Microsecond)
+	metrics.ObserveCommand(LIST, 226, time.Millisecond)
+	metrics.ObserveCommand(LIST, 550, 2*time.Second)
+	metrics.ObserveCommand(NOOP, 200, 10*time.Millisecond)
+
+	stats := metrics.Snapshot()
+	list := stats[LIST]
+	if list.Count != 3 || list.Sum != 2*time.Second+1500*time.Microsecond {
+		t.Errorf("LIST count %d, sum %v", list.Count, list.Sum)
+	}
+	if want := []uint64{2, 0, 1}; !equalCounts(list.Buckets, want) {
+		t.Errorf("LIST buckets %v, want %v", list.Buckets, want)
+	}
+	if list.Codes[226] != 2 || list.Codes[550] != 1 {
+		t.Errorf("LIST codes %v", list.Codes)
+	}
+	if want := []uint64{0, 1, 0}; !equalCounts(stats[NOOP].Buckets, want) {
+		t.Errorf("NOOP buckets %v, want %v", stats[NOOP].Buckets, want)
+	}
+
+	var published map[string]struct {
+		Count   uint64
+		Buckets map[string]uint64
+		Codes   map[string]uint64
+	}
+	if err := json.Unmarshal([]byte(metrics.String()), &published); err != nil {
+		t.Fatal(err)
+	}
+	if b := published[LIST].Buckets; b["0.001"] != 2 || b["+Inf"] != 1 {
+		t.Errorf("published buckets %v", b)
+	}
+	if published[LIST].Codes["550"] != 1 {
+		t.Errorf("published codes %v", published[LIST].Codes)
+	}
+}
+
+func equalCounts(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// go test -run TestServerMetrics
+func TestServerMetrics(t *testing.T) {
+	metrics := &CommandMetrics{}
+	c, done := pipeServe(&Server{Driver: &DiskDriver{Root: "."}, Metrics: metrics})
+	for _, cmd := range []string{"NOOP", "NOOP", "CWD /nowhere"} {
+		c.Cmd(cmd)
+		c.ReadResponse(0)
+	}
+	c.Cmd("QUIT")
+	c.ReadResponse(StatusClosing)
+	<-done
+	stats := metrics.Snapshot()
+	if stats[NOOP].Codes[StatusCommandOK] != 2 {
+		t.Errorf("NOOP %+v", stats[NOOP])
+	}
+	if stats[CWD].Codes[StatusFileUnavailable] != 1 {
+		t.Errorf("CWD %+v", stats[CWD])
+	}
+	if stats[QUIT].Count != 1 {
+		t.Errorf("QUIT %+v", stats[QUIT])
+	}
+}
@@ -0,0 +1,149 @@
+package ftplib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// NetrcCredentials returns the login and password of host in the netrc
+// file, as ftp and curl read it: the file $NETRC names, or .netrc in the
+// home directory, _netrc on Windows. The entry is the first "machine" of
+// host, or else "default". A non-empty user only matches the entries of
+// its login, for the password of a user the caller knows. ok is false
+// without an entry, and when the file is missing or unreadable.
+func NetrcCredentials(host, user string) (login, password string, ok bool) {
+	name := netrcPath()
+	if name == "" {
+		return "", "", false
+	}
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return "", "", false
+	}
+	m, ok := lookupNetrc(parseNetrc(string(b)), host, user)
+	if !ok {
+		return "", "", false
+	}
+	return m.login, m.password, true
+}
+
+// netrcPath returns the path of the netrc file, "" if unknown.
+func netrcPath() string {
+	if name := os.Getenv("NETRC"); name != "" {
+		return name
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(home, "_netrc")
+	}
+	return filepath.Join(home, ".netrc")
+}
+
+// netrcMachine is an entry of a netrc file; machine is "" for "default".
+type netrcMachine struct {
+	machine, login, password, account string
+}
+
+// lookupNetrc returns the entry of host, and of the login user if not "",
+// falling back to the default entry.
+func lookupNetrc(machines []netrcMachine, host, user string) (netrcMachine, bool) {
+	var def *netrcMachine
+	for i, m := range machines {
+		if user != "" && m.login != user {
+			continue
+		}
+		if m.machine == "" {
+			if def == nil {
+				def = &machines[i]
+			}
+			continue
+		}
+		if strings.EqualFold(m.machine, host) {
+			return m, true
+		}
+	}
+	if def != nil {
+		return *def, true
+	}
+	return netrcMachine{}, false
+}
+
+// parseNetrc returns the entries of the netrc file s, skipping the macro
+// definitions and the tokens it does not know.
+func parseNetrc(s string) []netrcMachine {
+	var machines []netrcMachine
+	var m *netrcMachine
+	for {
+		tok, rest, ok := netrcToken(s)
+		if !ok {
+			break
+		}
+		s = rest
+		switch tok {
+		case "machine", "default":
+			machines = append(machines, netrcMachine{})
+			m = &machines[len(machines)-1]
+			if tok == "machine" {
+				m.machine, s, _ = netrcToken(s)
+			}
+		case "login", "password", "account":
+			var value string
+			value, s, _ = netrcToken(s)
+			if m == nil {
+				continue
+			}
+			switch tok {
+			case "login":
+				m.login = value
+			case "password":
+				m.password = value
+			case "account":
+				m.account = value
+			}
+		case "macdef":
+			// The macro runs to the next empty line.
+			if i := strings.Index(s, "\n\n"); i >= 0 {
+				s = s[i+2:]
+			} else {
+				s = ""
+			}
+		}
+	}
+	return machines
+}
+
+// netrcToken returns the token at the start of s, skipping white space,
+// and the rest of s. A token in double quotes may hold white space, and
+// escapes characters with a backslash.
+func netrcToken(s string) (tok, rest string, ok bool) {
+	s = strings.TrimLeft(s, " \t\r\n")
+	if s == "" {
+		return "", "", false
+	}
+	if s[0] != '"' {
+		i := strings.IndexAny(s, " \t\r\n")
+		if i < 0 {
+			return s, "", true
+		}
+		return s[:i], s[i:], true
+	}
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			return b.String(), s[i+1:], true
+		case c == '\\' && i+1 < len(s):
+			i++
+			b.WriteByte(s[i])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), "", true
+}
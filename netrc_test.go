@@ -0,0 +1,61 @@
+package ftplib
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+const testNetrc = `machine ftp.example.com login joe password secret
+machine ftp.example.com
+	login ann password "two words \"quoted\""
+macdef init
+machine macro.example.com login macro password macro
+
+default login anonymous password guest@
+machine other.example.com login bob password hunter2 account acct
+`
+
+// go test -run TestNetrc
+func TestNetrc(t *testing.T) {
+	machines := parseNetrc(testNetrc)
+	tests := []struct {
+		host, user      string
+		login, password string
+		ok              bool
+	}{
+		{"ftp.example.com", "", "joe", "secret", true},
+		{"FTP.example.com", "", "joe", "secret", true},
+		{"ftp.example.com", "ann", "ann", `two words "quoted"`, true},
+		{"other.example.com", "", "bob", "hunter2", true},
+		{"macro.example.com", "", "anonymous", "guest@", true},
+		{"unknown.example.com", "", "anonymous", "guest@", true},
+		{"unknown.example.com", "eve", "", "", false},
+	}
+	for _, test := range tests {
+		m, ok := lookupNetrc(machines, test.host, test.user)
+		if ok != test.ok || m.login != test.login || m.password != test.password {
+			t.Errorf("lookupNetrc(%q, %q) = %q, %q, %v", test.host, test.user, m.login, m.password, ok)
+		}
+	}
+	if m, _ := lookupNetrc(machines, "other.example.com", ""); m.account != "acct" {
+		t.Errorf("account = %q", m.account)
+	}
+
+	f, err := ioutil.TempFile("", "netrc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(testNetrc)
+	f.Close()
+	defer os.Setenv("NETRC", os.Getenv("NETRC"))
+	os.Setenv("NETRC", f.Name())
+	if login, password, ok := NetrcCredentials("ftp.example.com", ""); !ok || login != "joe" || password != "secret" {
+		t.Errorf("NetrcCredentials = %q, %q, %v", login, password, ok)
+	}
+	os.Setenv("NETRC", f.Name()+".missing")
+	if _, _, ok := NetrcCredentials("ftp.example.com", ""); ok {
+		t.Error("credentials from a missing file")
+	}
+}
@@ -0,0 +1,112 @@
+package ftplib
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Upload describes a file the server has finished receiving.
+type Upload struct {
+	User     string
+	Client   string // client software announced with CLNT
+	Path     string
+	Size     int64
+	Checksum string // hex encoded SHA-256 of the received data
+	Duration time.Duration
+
+	// Context is the context of the session, cancelled once it ends: a
+	// Notifier runs after the upload, maybe after the session.
+	Context context.Context
+}
+
+// Notifier is told about every upload once the server has stored it.
+type Notifier interface {
+	Notify(upload *Upload) error
+}
+
+// SignatureHeader carries the HMAC-SHA256 of a webhook body.
+const SignatureHeader = "X-Ftplib-Signature"
+
+// WebhookNotifier posts each completed upload as JSON to URL.
+//
+// When Secret is set the body is signed with HMAC-SHA256 and the hex digest
+// is sent in the SignatureHeader. Failed deliveries are retried up to Retries
+// times, doubling Backoff between attempts.
+type WebhookNotifier struct {
+	URL     string
+	Secret  string
+	Retries int
+	Backoff time.Duration
+	Client  *http.Client
+}
+
+type webhookPayload struct {
+	User     string `json:"user"`
+	Client   string `json:"client,omitempty"`
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum"`
+	Duration int64  `json:"duration_ms"`
+}
+
+func (w *WebhookNotifier) Notify(upload *Upload) error {
+	body, err := json.Marshal(&webhookPayload{
+		User:     upload.User,
+		Client:   upload.Client,
+		Path:     upload.Path,
+		Size:     upload.Size,
+		Checksum: upload.Checksum,
+		Duration: int64(upload.Duration / time.Millisecond),
+	})
+	if err != nil {
+		return err
+	}
+
+	backoff := w.Backoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+	for attempt := 0; ; attempt++ {
+		retry, err := w.post(body)
+		if err == nil || !retry || attempt >= w.Retries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post delivers body once and reports whether a failure is worth retrying.
+func (w *WebhookNotifier) post(body []byte) (retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(w.Secret))
+		mac.Write(body)
+		req.Header.Set(SignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return resp.StatusCode >= 500, fmt.Errorf("webhook %s: %s", w.URL, resp.Status)
+	}
+	return false, nil
+}
@@ -0,0 +1,48 @@
+package ftplib
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// go test -run TestWebhookNotifier
+func TestWebhookNotifier(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write(body)
+		if r.Header.Get(SignatureHeader) != hex.EncodeToString(mac.Sum(nil)) {
+			t.Error("bad signature")
+		}
+		var payload map[string]interface{}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Error(err)
+		}
+		if payload["path"] != "a/b.txt" || payload["size"] != float64(42) {
+			t.Error("unexpected payload", payload)
+		}
+	}))
+	defer srv.Close()
+
+	n := &WebhookNotifier{URL: srv.URL, Secret: "secret", Retries: 2, Backoff: time.Millisecond}
+	err := n.Notify(&Upload{User: "up", Path: "a/b.txt", Size: 42, Duration: time.Second})
+	if err != nil {
+		t.Error(err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 attempts, got %d", calls)
+	}
+}
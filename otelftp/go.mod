@@ -0,0 +1,20 @@
+module github.com/cxfans/ftplib/otelftp
+
+go 1.20
+
+require (
+	github.com/cxfans/ftplib v0.0.0-20261017062344-d79f170c0354
+	go.opentelemetry.io/otel v1.24.0
+	go.opentelemetry.io/otel/sdk v1.24.0
+	go.opentelemetry.io/otel/trace v1.24.0
+)
+
+require (
+	github.com/go-logr/logr v1.4.1 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	go.opentelemetry.io/otel/metric v1.24.0 // indirect
+	golang.org/x/sys v0.17.0 // indirect
+)
+
+// Within this repository, build against the ftplib next to the module.
+replace github.com/cxfans/ftplib => ..
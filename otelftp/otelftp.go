@@ -0,0 +1,86 @@
+// Package otelftp records the spans of ftplib servers and clients with
+// OpenTelemetry:
+//
+//	server.Tracer = otelftp.New(otel.Tracer("ftpd"))
+//	c, err := ftplib.Dial(addr, ftplib.WithTracer(otelftp.New(otel.Tracer("sync"))))
+//
+// The attributes of the spans keep their names, such as ftplib.AttrVerb,
+// and their types where OpenTelemetry has one. A span with an
+// ftplib.AttrError attribute also ends with the status Error.
+//
+// The package is a module of its own, for ftplib not to depend on
+// OpenTelemetry.
+package otelftp
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/cxfans/ftplib"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer is an ftplib.Tracer starting the spans with an OpenTelemetry
+// tracer, made by New.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// New returns the ftplib.Tracer recording its spans with tracer.
+func New(tracer trace.Tracer) *Tracer {
+	return &Tracer{tracer: tracer}
+}
+
+// Start starts the span name as a child of the span of ctx, if any.
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, ftplib.Span) {
+	ctx, s := t.tracer.Start(ctx, name)
+	return ctx, &span{s}
+}
+
+// span is an ftplib.Span over an OpenTelemetry span.
+type span struct {
+	span trace.Span
+}
+
+// SetAttribute records the attribute key. Strings, booleans, integers and
+// floats keep their type; other values are formatted with fmt.Sprint.
+func (s *span) SetAttribute(key string, value interface{}) {
+	s.span.SetAttributes(keyValue(key, value))
+	if key == ftplib.AttrError {
+		s.span.SetStatus(codes.Error, fmt.Sprint(value))
+	}
+}
+
+func (s *span) End() {
+	s.span.End()
+}
+
+// keyValue returns the attribute key of value.
+func keyValue(key string, value interface{}) attribute.KeyValue {
+	switch v := value.(type) {
+	case string:
+		return attribute.String(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case int32:
+		return attribute.Int64(key, int64(v))
+	case int64:
+		return attribute.Int64(key, v)
+	case uint32:
+		return attribute.Int64(key, int64(v))
+	case uint64:
+		if v <= math.MaxInt64 {
+			return attribute.Int64(key, int64(v))
+		}
+	case float64:
+		return attribute.Float64(key, v)
+	case error:
+		return attribute.String(key, v.Error())
+	}
+	return attribute.String(key, fmt.Sprint(value))
+}
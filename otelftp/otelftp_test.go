@@ -0,0 +1,131 @@
+package otelftp_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cxfans/ftplib"
+	"github.com/cxfans/ftplib/ftptest"
+	"github.com/cxfans/ftplib/otelftp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// newTracer returns a tracer recording its spans in the returned recorder.
+func newTracer() (*otelftp.Tracer, *tracetest.SpanRecorder) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	return otelftp.New(provider.Tracer("otelftp_test")), recorder
+}
+
+// find returns the ended span name, or nil.
+func find(recorder *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	for _, span := range recorder.Ended() {
+		if span.Name() == name {
+			return span
+		}
+	}
+	return nil
+}
+
+// attr returns the attribute key of span.
+func attr(span sdktrace.ReadOnlySpan, key string) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if string(kv.Key) == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+// go test -run TestTracer
+func TestTracer(t *testing.T) {
+	serverTracer, serverSpans := newTracer()
+	server, err := ftptest.NewServer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Tracer = serverTracer
+	addr, cleanup := ftptest.Serve(server)
+	defer cleanup()
+
+	c, err := ftplib.Connect(addr, "user", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Stor("/f.txt", strings.NewReader("content")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete("/missing.txt"); err == nil {
+		t.Error("deleted a missing file")
+	}
+	c.Quit()
+
+	// The session span ends once the server is done with the connection.
+	var session sdktrace.ReadOnlySpan
+	for deadline := time.Now().Add(time.Second); session == nil && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		session = find(serverSpans, "FTP session")
+	}
+	if session == nil {
+		t.Fatalf("server spans %v", serverSpans.Ended())
+	}
+	if v := attr(session, ftplib.AttrUser); v.AsString() != "user" {
+		t.Errorf("session user %v", v.Emit())
+	}
+	cmd := find(serverSpans, "FTP STOR")
+	if cmd == nil || cmd.Parent().SpanID() != session.SpanContext().SpanID() {
+		t.Fatalf("STOR span %+v not below the session", cmd)
+	}
+	if v := attr(cmd, ftplib.AttrPath); v.AsString() != "/f.txt" {
+		t.Errorf("STOR path %v", v.Emit())
+	}
+	if dele := find(serverSpans, "FTP DELE"); dele == nil || attr(dele, ftplib.AttrReplyCode).AsInt64() != ftplib.StatusFileUnavailable {
+		t.Errorf("DELE of a missing file: %+v", dele)
+	}
+}
+
+// go test -run TestClientTracer
+func TestClientTracer(t *testing.T) {
+	tracer, spans := newTracer()
+	addr, cleanup, err := ftptest.Start(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	c, err := ftplib.Dial(addr, ftplib.WithTracer(tracer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Quit()
+	if err := c.Login("user", "password"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Stor("/f.txt", strings.NewReader("content")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete("/missing.txt"); err == nil {
+		t.Error("deleted a missing file")
+	}
+
+	stor := find(spans, "FTP STOR")
+	if stor == nil {
+		t.Fatalf("client spans %v", spans.Ended())
+	}
+	if v := attr(stor, ftplib.AttrBytes); v.Type() != attribute.INT64 || v.AsInt64() != 7 {
+		t.Errorf("STOR bytes %v", v.Emit())
+	}
+	if v := attr(stor, ftplib.AttrReplyCode); v.AsInt64() != ftplib.StatusClosingDataConnection {
+		t.Errorf("STOR reply code %v", v.Emit())
+	}
+	if stor.Status().Code == codes.Error {
+		t.Errorf("STOR status %v", stor.Status())
+	}
+	dele := find(spans, "FTP DELE")
+	if dele == nil || dele.Status().Code != codes.Error || attr(dele, ftplib.AttrError).AsString() == "" {
+		t.Errorf("DELE of a missing file: %+v", dele)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package ftplib
+
+import "os"
+
+// fileOwner returns placeholders where the platform has no Unix owners.
+func fileOwner(info os.FileInfo) (owner, group string, links uint64) {
+	return anonymousOwner(info)
+}
@@ -0,0 +1,54 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package ftplib
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+var (
+	userNames  sync.Map // uid → name
+	groupNames sync.Map // gid → name
+)
+
+// fileOwner returns the owner, group and number of hard links of info,
+// falling back to numeric ids for unknown users.
+func fileOwner(info os.FileInfo) (owner, group string, links uint64) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return anonymousOwner(info)
+	}
+	uid := strconv.FormatUint(uint64(st.Uid), 10)
+	gid := strconv.FormatUint(uint64(st.Gid), 10)
+	return lookupName(&userNames, uid, func(id string) (string, error) {
+			u, err := user.LookupId(id)
+			if err != nil {
+				return "", err
+			}
+			return u.Username, nil
+		}), lookupName(&groupNames, gid, func(id string) (string, error) {
+			g, err := user.LookupGroupId(id)
+			if err != nil {
+				return "", err
+			}
+			return g.Name, nil
+		}), uint64(st.Nlink)
+}
+
+// lookupName resolves id with lookup, caching the answer in cache.
+func lookupName(cache *sync.Map, id string, lookup func(string) (string, error)) string {
+	if name, ok := cache.Load(id); ok {
+		return name.(string)
+	}
+	name, err := lookup(id)
+	if err != nil {
+		name = id
+	}
+	cache.Store(id, name)
+	return name
+}
@@ -0,0 +1,588 @@
+package ftplib
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errUnsupportedListLine = errors.New("unsupported LIST line")
+
+// ErrSkipLine is returned by a ListParser for lines carrying no entry, such
+// as the "total 123" heading ls output. List skips them silently.
+var ErrSkipLine = errors.New("no entry on LIST line")
+
+// ListParser parses one line of a LIST reply into an Entry.
+type ListParser interface {
+	ParseListLine(line string) (*Entry, error)
+}
+
+// ListParserFunc adapts an ordinary function to a ListParser.
+type ListParserFunc func(line string) (*Entry, error)
+
+func (f ListParserFunc) ParseListLine(line string) (*Entry, error) {
+	return f(line)
+}
+
+// ListParserChain tries each of its parsers in turn and returns the first
+// entry parsed, since nothing in a LIST reply tells which format the server
+// uses. A parser returning ErrSkipLine ends the chain.
+type ListParserChain []ListParser
+
+func (chain ListParserChain) ParseListLine(line string) (*Entry, error) {
+	for _, parser := range chain {
+		e, err := parser.ParseListLine(line)
+		if err == nil || err == ErrSkipLine {
+			return e, err
+		}
+	}
+	return nil, errUnsupportedListLine
+}
+
+// Parsers of the LIST formats known to the package.
+var (
+	UnixListParser ListParser = &UnixParser{}
+	DOSListParser  ListParser = ListParserFunc(parseDOSListLine)
+	EPLFListParser ListParser = ListParserFunc(parseEPLFListLine)
+	MLSxListParser ListParser = ListParserFunc(ParseMLSxLine)
+)
+
+// DefaultListParser is used by clients without a parser of their own. It
+// understands Unix, MS-DOS, EPLF and MLSx lines. Custom parsers for odd
+// servers can fall back on it: ListParserChain{myParser, DefaultListParser}.
+var DefaultListParser ListParser = ListParserChain{
+	ListParserFunc(skipTotalLine),
+	EPLFListParser,
+	UnixListParser,
+	DOSListParser,
+	MLSxListParser,
+}
+
+// skipTotalLine skips the "total 123" line heading the output of ls.
+func skipTotalLine(line string) (*Entry, error) {
+	if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "total" {
+		return nil, ErrSkipLine
+	}
+	return nil, errUnsupportedListLine
+}
+
+// UnixParser parses the "ls -l" style lines most servers return.
+//
+// Rather than expecting the date at a fixed column, it looks for the first
+// run of fields reading as a date preceded by a number, so that lines with
+// localized month names, ISO dates or missing columns parse too.
+type UnixParser struct {
+	// Now returns the reference time used to infer the year of recent
+	// entries, which ls shows without one. It defaults to time.Now.
+	Now func() time.Time
+}
+
+func (p *UnixParser) ParseListLine(line string) (*Entry, error) {
+	now := time.Now
+	if p.Now != nil {
+		now = p.Now
+	}
+	return parseUnixListLine(line, now().UTC())
+}
+
+func parseUnixListLine(line string, now time.Time) (*Entry, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 6 || fields[0] == "" {
+		return nil, errUnsupportedListLine
+	}
+
+	e := &Entry{Raw: strings.TrimRight(line, "\r\n")}
+	switch fields[0][0] {
+	case '-':
+		e.Type = EntryTypeFile
+	case 'd':
+		e.Type = EntryTypeFolder
+	case 'l':
+		e.Type = EntryTypeLink
+	case 'b', 'c', 'p', 's', 'D':
+		e.Type = EntryTypeOther
+	default:
+		return nil, errors.New("unknown entry type")
+	}
+	e.Mode = parseListMode(fields[0])
+	e.NLink, _ = strconv.ParseUint(fields[1], 10, 64)
+
+	// Devices show "major, minor" where other entries show their size, and
+	// some servers leave the group column out: the date is searched for.
+	for i := 2; i < len(fields)-1; i++ {
+		t, n, ok := parseListTime(fields[i:], now)
+		if !ok || i+n >= len(fields) {
+			continue
+		}
+		size, err := strconv.ParseUint(fields[i-1], 10, 64)
+		if err != nil {
+			continue
+		}
+		if e.Type == EntryTypeFile {
+			e.Size = size
+		}
+		e.Time = t
+		e.Name = afterFields(line, i+n)
+		if e.Type == EntryTypeLink {
+			if arrow := strings.Index(e.Name, " -> "); arrow != -1 {
+				e.Name, e.Target = e.Name[:arrow], e.Name[arrow+4:]
+			}
+		}
+
+		// Between the link count and the size come the owner and group,
+		// or the major number of devices.
+		var users []string
+		if i > 2 {
+			users = fields[2 : i-1]
+		}
+		if len(users) > 0 && strings.HasSuffix(users[len(users)-1], ",") {
+			users = users[:len(users)-1]
+		}
+		if len(users) > 0 {
+			e.Owner = users[0]
+		}
+		if len(users) > 1 {
+			e.Group = users[1]
+		}
+		return e, nil
+	}
+	return nil, errUnsupportedListLine
+}
+
+// parseListMode parses the mode column of ls, "drwxr-xr-x".
+func parseListMode(s string) os.FileMode {
+	var mode os.FileMode
+	switch s[0] {
+	case 'd':
+		mode = os.ModeDir
+	case 'l':
+		mode = os.ModeSymlink
+	case 'c':
+		mode = os.ModeDevice | os.ModeCharDevice
+	case 'b':
+		mode = os.ModeDevice
+	case 'p':
+		mode = os.ModeNamedPipe
+	case 's':
+		mode = os.ModeSocket
+	}
+	const bits = "rwxrwxrwx"
+	for i := 0; i < len(bits) && i+1 < len(s); i++ {
+		switch c := s[i+1]; {
+		case c == bits[i]:
+			mode |= 1 << uint(8-i)
+		case c == 's' || c == 't':
+			mode |= 1 << uint(8-i)
+			fallthrough
+		case c == 'S' || c == 'T':
+			mode |= [...]os.FileMode{os.ModeSetuid, os.ModeSetgid, os.ModeSticky}[i/3]
+		}
+	}
+	return mode
+}
+
+// monthNames maps the lower-cased month abbreviations of the locales FTP
+// servers are commonly run with to their month.
+var monthNames = map[string]time.Month{
+	// English, and the many abbreviations other languages share with it
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	// French
+	"janv": 1, "févr": 2, "fév": 2, "fev": 2, "mars": 3, "avr": 4, "mai": 5,
+	"juin": 6, "juil": 7, "août": 8, "aoû": 8, "sept": 9, "déc": 12,
+	// German
+	"jän": 1, "mär": 3, "mrz": 3, "okt": 10, "dez": 12,
+	// Spanish, Italian and Portuguese
+	"ene": 1, "abr": 4, "ago": 8, "dic": 12, "gen": 1, "mag": 5, "giu": 6,
+	"lug": 7, "set": 9, "ott": 10, "out": 10,
+	// Dutch
+	"mrt": 3, "mei": 5,
+	// Russian
+	"янв": 1, "фев": 2, "мар": 3, "апр": 4, "май": 5, "мая": 5, "июн": 6,
+	"июл": 7, "авг": 8, "сен": 9, "окт": 10, "ноя": 11, "дек": 12,
+}
+
+// parseMonth parses a month name or abbreviation, or a CJK "6月" month.
+func parseMonth(s string) (time.Month, bool) {
+	s = strings.ToLower(strings.TrimSuffix(s, "."))
+	if m, ok := monthNames[s]; ok {
+		return m, true
+	}
+	if strings.HasSuffix(s, "月") {
+		n, err := strconv.Atoi(strings.TrimSuffix(s, "月"))
+		return time.Month(n), err == nil && n >= 1 && n <= 12
+	}
+	// Full month names: "january", "juillet", "августа"...
+	for _, size := range []int{4, 3} {
+		if r := []rune(s); len(r) > size {
+			if m, ok := monthNames[string(r[:size])]; ok {
+				return m, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// parseListTime parses the date starting fields, in one of the layouts of
+// ls: "Jun  9 10:24", "9 juin 2014", "2022-06-09 10:24" or the full ISO
+// "2022-06-09 10:24:00.000000000 +0200". It returns the number of fields
+// used.
+func parseListTime(fields []string, now time.Time) (t time.Time, n int, ok bool) {
+	if len(fields) < 2 {
+		return t, 0, false
+	}
+
+	if _, err := time.Parse("2006-01-02", fields[0]); err == nil {
+		clock := fields[1]
+		if i := strings.IndexByte(clock, '.'); i != -1 {
+			clock = clock[:i]
+		}
+		if len(fields) > 2 {
+			t, err := time.Parse("2006-01-02 15:04:05 -0700", fields[0]+" "+clock+" "+fields[2])
+			if err == nil {
+				return t.UTC(), 3, true
+			}
+		}
+		for _, layout := range []string{"2006-01-02 15:04", "2006-01-02 15:04:05"} {
+			if t, err := time.Parse(layout, fields[0]+" "+clock); err == nil {
+				return t, 2, true
+			}
+		}
+		return t, 0, false
+	}
+
+	if len(fields) < 3 {
+		return t, 0, false
+	}
+	month, ok := parseMonth(fields[0])
+	dayField := fields[1]
+	if !ok {
+		// Some locales put the day first.
+		if month, ok = parseMonth(fields[1]); !ok {
+			return t, 0, false
+		}
+		dayField = fields[0]
+	}
+	day, err := strconv.Atoi(strings.TrimRight(dayField, ".日"))
+	if err != nil || day < 1 || day > 31 {
+		return t, 0, false
+	}
+	t, ok = listTime(month, day, fields[2], now)
+	return t, 3, ok
+}
+
+// listTime builds the time of a listing entry from its month, day and the
+// field holding either the time of day or the year.
+//
+// ls shows the time of day instead of the year for entries less than six
+// months old, so such an entry lies in the year before now: the current
+// year, or the previous one when that would put it in the future.
+func listTime(month time.Month, day int, timeOrYear string, now time.Time) (time.Time, bool) {
+	if strings.Contains(timeOrYear, ":") {
+		c, err := time.Parse("15:04", timeOrYear)
+		if err != nil {
+			return time.Time{}, false
+		}
+		t := time.Date(now.Year(), month, day, c.Hour(), c.Minute(), 0, 0, time.UTC)
+		// Leave a day of slack for clock skew and time zones.
+		if t.After(now.AddDate(0, 0, 1)) {
+			t = t.AddDate(-1, 0, 0)
+		}
+		return t, true
+	}
+	year, err := strconv.Atoi(strings.TrimSuffix(timeOrYear, "年"))
+	if err != nil || year < 1000 {
+		return time.Time{}, false
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC), true
+}
+
+// afterFields returns what follows the first n whitespace separated fields
+// of line, without its line ending.
+func afterFields(line string, n int) string {
+	line = strings.TrimRight(line, "\r\n")
+	for i := 0; i < n; i++ {
+		line = strings.TrimLeft(line, " \t")
+		end := strings.IndexAny(line, " \t")
+		if end == -1 {
+			return ""
+		}
+		line = line[end:]
+	}
+	return strings.TrimLeft(line, " \t")
+}
+
+// parseDOSListLine parses the MS-DOS style lines of IIS and some NAS:
+// "06-09-22  10:24AM  <DIR>  foo" or "06-09-22  10:24AM  1234 foo.txt".
+func parseDOSListLine(line string) (*Entry, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 {
+		return nil, errUnsupportedListLine
+	}
+
+	var t time.Time
+	var err error
+	for _, layout := range []string{"01-02-06 03:04PM", "01-02-2006 03:04PM", "01-02-06 15:04", "01-02-2006 15:04"} {
+		if t, err = time.Parse(layout, fields[0]+" "+fields[1]); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Entry{Time: t, Raw: strings.TrimRight(line, "\r\n")}
+	if fields[2] == "<DIR>" {
+		e.Type = EntryTypeFolder
+		e.Mode = os.ModeDir
+	} else {
+		size, err := strconv.ParseUint(fields[2], 10, 0)
+		if err != nil {
+			return nil, err
+		}
+		e.Type = EntryTypeFile
+		e.Size = size
+	}
+
+	// The name is the rest of the line, spaces included.
+	e.Name = afterFields(line, 3)
+	return e, nil
+}
+
+// parseEPLFListLine parses the Easily Parsed LIST Format of publicfile:
+// "+i8388621.48594,m825718503,r,s280,\tdjb.html".
+func parseEPLFListLine(line string) (*Entry, error) {
+	line = strings.TrimRight(line, "\r\n")
+	tab := strings.IndexByte(line, '\t')
+	if !strings.HasPrefix(line, "+") || tab == -1 {
+		return nil, errUnsupportedListLine
+	}
+
+	e := &Entry{Name: line[tab+1:], Raw: line}
+	for _, fact := range strings.Split(line[1:tab], ",") {
+		if fact == "" {
+			continue
+		}
+		switch fact[0] {
+		case '/':
+			e.Type = EntryTypeFolder
+			e.Mode = os.ModeDir
+		case 'r':
+			e.Type = EntryTypeFile
+		case 's':
+			size, err := strconv.ParseUint(fact[1:], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			e.Size = size
+		case 'm':
+			secs, err := strconv.ParseInt(fact[1:], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			e.Time = time.Unix(secs, 0).UTC()
+		}
+	}
+	return e, nil
+}
+
+// ParseMLSxLine parses a line of facts returned by MLSD or MLST (RFC 3659),
+// such as "type=file;size=1024;modify=20220609102400; notes.txt".
+//
+// The type facts "cdir" and "pdir", naming the listed directory and its
+// parent, are returned as folders.
+func ParseMLSxLine(line string) (*Entry, error) {
+	line = strings.TrimRight(line, "\r\n")
+	sep := strings.Index(line, " ")
+	if sep == -1 || !strings.Contains(line[:sep], "=") {
+		return nil, errors.New("unsupported MLSx line")
+	}
+
+	e := &Entry{Name: line[sep+1:], Raw: line}
+	for _, fact := range strings.Split(line[:sep], ";") {
+		eq := strings.IndexByte(fact, '=')
+		if eq == -1 {
+			continue
+		}
+		key, value := strings.ToLower(fact[:eq]), fact[eq+1:]
+		switch key {
+		case "type":
+			switch t := strings.ToLower(value); {
+			case t == "file":
+				e.Type = EntryTypeFile
+			case t == "dir" || t == "cdir" || t == "pdir":
+				e.Type = EntryTypeFolder
+				e.Mode |= os.ModeDir
+			case strings.HasPrefix(t, "os.unix=slink") || strings.HasPrefix(t, "os.unix=symlink"):
+				e.Type = EntryTypeLink
+				e.Mode |= os.ModeSymlink
+				// Some servers append the target: "OS.unix=slink:/etc/hosts".
+				if colon := strings.IndexByte(value, ':'); colon != -1 {
+					e.Target = value[colon+1:]
+				}
+			}
+		case "size", "sizd":
+			size, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			e.Size = size
+		case "modify":
+			t, err := parseMLSxTime(value)
+			if err != nil {
+				return nil, err
+			}
+			e.Time = t
+		case "perm":
+			e.Perm = value
+		case "unique":
+			e.Unique = value
+		case "unix.mode":
+			perm, err := strconv.ParseUint(value, 8, 32)
+			if err != nil {
+				return nil, err
+			}
+			e.Mode |= os.FileMode(perm) & os.ModePerm
+		case "unix.owner", "unix.ownername":
+			e.Owner = value
+		case "unix.group", "unix.groupname":
+			e.Group = value
+		case "unix.nlink":
+			e.NLink, _ = strconv.ParseUint(value, 10, 64)
+		}
+	}
+	return e, nil
+}
+
+// parseMLSxTime parses the "YYYYMMDDHHMMSS[.sss]" UTC timestamps of MLSx.
+func parseMLSxTime(value string) (time.Time, error) {
+	if len(value) < 14 {
+		return time.Time{}, errors.New("invalid MLSx time " + value)
+	}
+	t, err := time.Parse("20060102150405", value[:14])
+	if err != nil {
+		return t, err
+	}
+	if frac := value[14:]; strings.HasPrefix(frac, ".") {
+		// Digits below the nanosecond are dropped.
+		if len(frac) > 10 {
+			frac = frac[:10]
+		}
+		if ns, err := strconv.Atoi(frac[1:]); err == nil {
+			for i := len(frac) - 1; i < 9; i++ {
+				ns *= 10
+			}
+			t = t.Add(time.Duration(ns))
+		}
+	}
+	return t, nil
+}
+
+// ParseListLine parses a line of a LIST reply with the DefaultListParser.
+func ParseListLine(line string) (*Entry, error) {
+	return DefaultListParser.ParseListLine(line)
+}
+
+// Errors of the reply parsers.
+var (
+	ErrInvalidPASV = errors.New("invalid PASV reply")
+	ErrInvalidEPSV = errors.New("invalid EPSV reply")
+	ErrInvalidPWD  = errors.New("invalid PWD reply")
+)
+
+// ParsePASV parses the address of a 227 reply, with or without its code.
+// As RFC 1123 recommends, it scans the text for the six numbers
+// "h1,h2,h3,h4,p1,p2" rather than expecting them between parentheses, which
+// many servers leave out.
+func ParsePASV(reply string) (host string, port int, err error) {
+	for i := 0; i < len(reply); i++ {
+		if !isDigit(reply[i]) || i > 0 && isDigit(reply[i-1]) {
+			continue
+		}
+		var n [6]int
+		j, k := i, 0
+		for ; k < len(n); k++ {
+			v, end, ok := parseByte(reply, j)
+			if !ok {
+				break
+			}
+			n[k], j = v, end
+			if k < len(n)-1 {
+				if j >= len(reply) || reply[j] != ',' {
+					break
+				}
+				j++
+			}
+		}
+		if k == len(n) && (j == len(reply) || !isDigit(reply[j])) {
+			host = strconv.Itoa(n[0]) + "." + strconv.Itoa(n[1]) + "." + strconv.Itoa(n[2]) + "." + strconv.Itoa(n[3])
+			return host, n[4]<<8 | n[5], nil
+		}
+	}
+	return "", 0, ErrInvalidPASV
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// parseByte parses the number from 0 to 255 starting s[i], returning the
+// index following it.
+func parseByte(s string, i int) (v, end int, ok bool) {
+	for end = i; end < len(s) && isDigit(s[end]) && end-i < 4; end++ {
+		v = v*10 + int(s[end]-'0')
+	}
+	return v, end, end > i && end-i <= 3 && v <= 255
+}
+
+// ParseEPSV parses the port of a 229 reply, with or without its code:
+// "Entering Extended Passive Mode (|||6446|)". RFC 2428 lets the server
+// choose the delimiter, any printable character but digits.
+func ParseEPSV(reply string) (port int, err error) {
+	open := strings.IndexByte(reply, '(')
+	if open == -1 || len(reply) < open+6 {
+		return 0, ErrInvalidEPSV
+	}
+	s := reply[open+1:]
+	d := s[0]
+	if d < 33 || d > 126 || isDigit(d) || s[1] != d || s[2] != d {
+		return 0, ErrInvalidEPSV
+	}
+	i := 3
+	for ; i < len(s) && isDigit(s[i]); i++ {
+		port = port*10 + int(s[i]-'0')
+		if port > 65535 {
+			return 0, ErrInvalidEPSV
+		}
+	}
+	if i == 3 || port == 0 || i+1 >= len(s) || s[i] != d || s[i+1] != ')' {
+		return 0, ErrInvalidEPSV
+	}
+	return port, nil
+}
+
+// ParsePWD parses the path of a 257 reply, with or without its code, as
+// RFC 959 quotes it: between double quotes, the quotes it contains being
+// doubled, as in "257 "/a ""quoted"" dir" is current directory".
+func ParsePWD(reply string) (string, error) {
+	start := strings.IndexByte(reply, '"')
+	if start == -1 {
+		return "", ErrInvalidPWD
+	}
+	s := reply[start+1:]
+	end := strings.IndexByte(s, '"')
+	for end != -1 && end+1 < len(s) && s[end+1] == '"' {
+		next := strings.IndexByte(s[end+2:], '"')
+		if next == -1 {
+			end = -1
+			break
+		}
+		end += 2 + next
+	}
+	if end == -1 {
+		return "", ErrInvalidPWD
+	}
+	return strings.Replace(s[:end], `""`, `"`, -1), nil
+}
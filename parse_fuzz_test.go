@@ -0,0 +1,73 @@
+//go:build go1.18
+// +build go1.18
+
+package ftplib
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// go test -fuzz FuzzParsePASV
+func FuzzParsePASV(f *testing.F) {
+	f.Add("227 Entering Passive Mode (172,17,66,241,254,179).")
+	f.Add("227 =127,0,0,1,200,10")
+	f.Add("227 (1,2,3,4,5,256)")
+	f.Fuzz(func(t *testing.T, reply string) {
+		host, port, err := ParsePASV(reply)
+		if err != nil {
+			return
+		}
+		if port < 0 || port > 65535 || strings.Count(host, ".") != 3 {
+			t.Errorf("ParsePASV(%q) = %q, %d", reply, host, port)
+		}
+	})
+}
+
+// go test -fuzz FuzzParseEPSV
+func FuzzParseEPSV(f *testing.F) {
+	f.Add("229 Entering Extended Passive Mode (|||6446|)")
+	f.Add("229 (|||abc|)")
+	f.Add("229 (|||")
+	f.Fuzz(func(t *testing.T, reply string) {
+		port, err := ParseEPSV(reply)
+		if err != nil {
+			return
+		}
+		if port < 1 || port > 65535 || !strings.Contains(reply, strconv.Itoa(port)) {
+			t.Errorf("ParseEPSV(%q) = %d", reply, port)
+		}
+	})
+}
+
+// go test -fuzz FuzzParsePWD
+func FuzzParsePWD(f *testing.F) {
+	f.Add(`257 "/a ""quoted"" dir" is current directory`)
+	f.Add(`257 "/unterminated`)
+	f.Fuzz(func(t *testing.T, reply string) {
+		dir, err := ParsePWD(reply)
+		if err != nil {
+			return
+		}
+		// Quoting the path back must give a part of the reply.
+		if quoted := `"` + strings.Replace(dir, `"`, `""`, -1) + `"`; !strings.Contains(reply, quoted) {
+			t.Errorf("ParsePWD(%q) = %q", reply, dir)
+		}
+	})
+}
+
+// go test -fuzz FuzzParseListLine
+func FuzzParseListLine(f *testing.F) {
+	for _, test := range listLineTests {
+		f.Add(test.line)
+	}
+	f.Add("total 12")
+	f.Add("type=file;size=;modify=2022; x")
+	f.Fuzz(func(t *testing.T, line string) {
+		e, err := ParseListLine(line)
+		if err == nil && e == nil {
+			t.Errorf("ParseListLine(%q) returned no entry and no error", line)
+		}
+	})
+}
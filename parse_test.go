@@ -0,0 +1,267 @@
+package ftplib
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+var listLineTests = []struct {
+	line string
+	name string
+	typ  EntryType
+	size uint64
+	time time.Time
+}{
+	{"06-09-22  10:24AM       <DIR>          foo", "foo", EntryTypeFolder, 0,
+		time.Date(2022, 6, 9, 10, 24, 0, 0, time.UTC)},
+	{"06-09-22  01:05PM              1234 my file.txt\r\n", "my file.txt", EntryTypeFile, 1234,
+		time.Date(2022, 6, 9, 13, 5, 0, 0, time.UTC)},
+	{"12-31-2019  23:59               42 report.csv", "report.csv", EntryTypeFile, 42,
+		time.Date(2019, 12, 31, 23, 59, 0, 0, time.UTC)},
+	{"06-09-22\t10:24AM\t<DIR>\tfoo", "foo", EntryTypeFolder, 0,
+		time.Date(2022, 6, 9, 10, 24, 0, 0, time.UTC)},
+	{"+i8388621.48594,m825718503,r,s280,\tdjb.html\r\n", "djb.html", EntryTypeFile, 280,
+		time.Unix(825718503, 0)},
+	{"+i8388621.50690,m824255907,/,\t514", "514", EntryTypeFolder, 0,
+		time.Unix(824255907, 0)},
+	{"-rw-r--r--   1 ftp      ftp            12 déc.  3  2019 noël.txt", "noël.txt", EntryTypeFile, 12,
+		time.Date(2019, 12, 3, 0, 0, 0, 0, time.UTC)},
+	{"-rw-r--r--   1 ftp      ftp            12  3 févr. 2019 a  b.txt", "a  b.txt", EntryTypeFile, 12,
+		time.Date(2019, 2, 3, 0, 0, 0, 0, time.UTC)},
+	{"-rw-r--r--   1 ftp      ftp            12 авг  21  2018 отчёт.pdf", "отчёт.pdf", EntryTypeFile, 12,
+		time.Date(2018, 8, 21, 0, 0, 0, 0, time.UTC)},
+	{"-rw-r--r--   1 ftp      ftp            12 6月  9  2014 文件.txt", "文件.txt", EntryTypeFile, 12,
+		time.Date(2014, 6, 9, 0, 0, 0, 0, time.UTC)},
+	{"drwxr-xr-x   2 ftp      ftp          4096 2022-06-09 10:24 iso", "iso", EntryTypeFolder, 0,
+		time.Date(2022, 6, 9, 10, 24, 0, 0, time.UTC)},
+	{"-rw-r--r--   1 ftp      ftp             7 2022-06-09 10:24:01.123456789 +0200 full iso", "full iso", EntryTypeFile, 7,
+		time.Date(2022, 6, 9, 8, 24, 1, 0, time.UTC)},
+	{"crw-rw-rw-   1 root     root       1,   3 Jun  9  2014 null", "null", EntryTypeOther, 0,
+		time.Date(2014, 6, 9, 0, 0, 0, 0, time.UTC)},
+	{"prw-r--r--   1 root     root          0 Jun  9  2014 fifo", "fifo", EntryTypeOther, 0,
+		time.Date(2014, 6, 9, 0, 0, 0, 0, time.UTC)},
+	{"srwxrwxrwx   1 root     root          0 Jun  9  2014 sock", "sock", EntryTypeOther, 0,
+		time.Date(2014, 6, 9, 0, 0, 0, 0, time.UTC)},
+	{"-rw-r--r--   1 ftp          4096 Jun  9  2014 nogroup.txt", "nogroup.txt", EntryTypeFile, 4096,
+		time.Date(2014, 6, 9, 0, 0, 0, 0, time.UTC)},
+	{"-rw-r--r-- 1 Jun 9 2014 x", "x", EntryTypeFile, 1,
+		time.Date(2014, 6, 9, 0, 0, 0, 0, time.UTC)},
+	{"type=file;size=7;modify=20220609102400; mlsx.txt", "mlsx.txt", EntryTypeFile, 7,
+		time.Date(2022, 6, 9, 10, 24, 0, 0, time.UTC)},
+	{"-rw-r--r--   1 ftp      ftp          4096 Jun  9  2014 unix.txt", "unix.txt", EntryTypeFile, 4096,
+		time.Date(2014, 6, 9, 0, 0, 0, 0, time.UTC)},
+}
+
+// go test -run TestDefaultListParser
+func TestDefaultListParser(t *testing.T) {
+	for _, test := range listLineTests {
+		e, err := DefaultListParser.ParseListLine(test.line)
+		if err != nil {
+			t.Errorf("%q: %v", test.line, err)
+			continue
+		}
+		if e.Name != test.name || e.Type != test.typ || e.Size != test.size || !e.Time.Equal(test.time) {
+			t.Errorf("%q: got %+v", test.line, e)
+		}
+	}
+
+	for _, line := range []string{"garbage", "total 123\r\n"} {
+		if _, err := DefaultListParser.ParseListLine(line); err == nil {
+			t.Errorf("%q: expected an error", line)
+		}
+	}
+}
+
+// go test -run TestParseMLSxLine
+func TestParseMLSxLine(t *testing.T) {
+	tests := []struct {
+		line string
+		name string
+		typ  EntryType
+		size uint64
+		time time.Time
+		perm string
+	}{
+		{"type=file;size=1024;modify=20220609102400; notes.txt\r\n", "notes.txt", EntryTypeFile, 1024,
+			time.Date(2022, 6, 9, 10, 24, 0, 0, time.UTC), ""},
+		{"Type=dir;Modify=20220609102400.250;Perm=flcdmpe; my dir", "my dir", EntryTypeFolder, 0,
+			time.Date(2022, 6, 9, 10, 24, 0, 250000000, time.UTC), "flcdmpe"},
+		{"type=file;modify=20220609102400.1234567891234; precise.txt", "precise.txt", EntryTypeFile, 0,
+			time.Date(2022, 6, 9, 10, 24, 0, 123456789, time.UTC), ""},
+		{"type=OS.unix=slink:/etc/hosts;size=10; hosts", "hosts", EntryTypeLink, 10, time.Time{}, ""},
+	}
+	for _, test := range tests {
+		e, err := ParseMLSxLine(test.line)
+		if err != nil {
+			t.Errorf("%q: %v", test.line, err)
+			continue
+		}
+		if e.Name != test.name || e.Type != test.typ || e.Size != test.size || !e.Time.Equal(test.time) || e.Perm != test.perm {
+			t.Errorf("%q: got %+v", test.line, e)
+		}
+	}
+
+	for _, line := range []string{"nospace", "size=abc; x", "modify=2022; x"} {
+		if _, err := ParseMLSxLine(line); err == nil {
+			t.Errorf("%q: expected an error", line)
+		}
+	}
+}
+
+// go test -run TestEntryAttributes
+func TestEntryAttributes(t *testing.T) {
+	tests := []struct {
+		line string
+		want Entry
+	}{
+		{"lrwxrwxrwx   2 alice    staff        11 Jun  9  2014 latest -> releases/v2\r\n", Entry{
+			Name: "latest", Mode: os.ModeSymlink | 0777, Owner: "alice", Group: "staff",
+			Target: "releases/v2", NLink: 2}},
+		{"drwxr-sr-t   1 ftp      ftp          4096 Jun  9  2014 shared", Entry{
+			Name: "shared", Mode: os.ModeDir | os.ModeSetgid | os.ModeSticky | 0755, Owner: "ftp", Group: "ftp", NLink: 1}},
+		{"crw-rw-rw-   1 root     tty        1,   3 Jun  9  2014 null", Entry{
+			Name: "null", Mode: os.ModeDevice | os.ModeCharDevice | 0666, Owner: "root", Group: "tty", NLink: 1}},
+		{"-rw-r--r--   1 ftp          4096 Jun  9  2014 nogroup.txt", Entry{
+			Name: "nogroup.txt", Mode: 0644, Owner: "ftp", NLink: 1}},
+		{"type=OS.unix=slink:/etc/hosts;UNIX.mode=0777;UNIX.owner=root;UNIX.group=wheel; hosts", Entry{
+			Name: "hosts", Mode: os.ModeSymlink | 0777, Owner: "root", Group: "wheel", Target: "/etc/hosts"}},
+		{"06-09-22  10:24AM       <DIR>          foo", Entry{Name: "foo", Mode: os.ModeDir}},
+	}
+	for _, test := range tests {
+		e, err := DefaultListParser.ParseListLine(test.line)
+		if err != nil {
+			t.Errorf("%q: %v", test.line, err)
+			continue
+		}
+		if e.Name != test.want.Name || e.Mode != test.want.Mode || e.Owner != test.want.Owner ||
+			e.Group != test.want.Group || e.Target != test.want.Target || e.NLink != test.want.NLink {
+			t.Errorf("%q: got %+v", test.line, e)
+		}
+		if e.Raw != strings.TrimRight(test.line, "\r\n") {
+			t.Errorf("%q: raw line %q", test.line, e.Raw)
+		}
+	}
+}
+
+// go test -run TestListParserChain
+func TestListParserChain(t *testing.T) {
+	appliance := ListParserFunc(func(line string) (*Entry, error) {
+		if !strings.HasPrefix(line, "FILE:") {
+			return nil, errors.New("not an appliance line")
+		}
+		return &Entry{Name: strings.TrimPrefix(line, "FILE:")}, nil
+	})
+	parser := ListParserChain{appliance, DefaultListParser}
+
+	if e, err := parser.ParseListLine("FILE:odd.bin"); err != nil || e.Name != "odd.bin" {
+		t.Error("custom parser not used", e, err)
+	}
+	if e, err := parser.ParseListLine("06-09-22  10:24AM  <DIR>  foo"); err != nil || e.Name != "foo" {
+		t.Error("default parser not used", e, err)
+	}
+	if _, err := parser.ParseListLine("total 8"); err != ErrSkipLine {
+		t.Error("expected ErrSkipLine, got", err)
+	}
+}
+
+// go test -run TestUnixParserYear
+func TestUnixParserYear(t *testing.T) {
+	tests := []struct {
+		now  time.Time
+		line string
+		want time.Time
+	}{
+		{time.Date(2023, 1, 5, 12, 0, 0, 0, time.UTC),
+			"-rw-r--r-- 1 ftp ftp 1 Dec 30 23:10 a", time.Date(2022, 12, 30, 23, 10, 0, 0, time.UTC)},
+		{time.Date(2023, 1, 5, 12, 0, 0, 0, time.UTC),
+			"-rw-r--r-- 1 ftp ftp 1 Jan  5 13:00 a", time.Date(2023, 1, 5, 13, 0, 0, 0, time.UTC)},
+		{time.Date(2023, 6, 9, 12, 0, 0, 0, time.UTC),
+			"-rw-r--r-- 1 ftp ftp 1 Feb 28 08:00 a", time.Date(2023, 2, 28, 8, 0, 0, 0, time.UTC)},
+		{time.Date(2023, 6, 9, 12, 0, 0, 0, time.UTC),
+			"-rw-r--r-- 1 ftp ftp 1 Jun  9  1999 a", time.Date(1999, 6, 9, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		now := test.now
+		p := &UnixParser{Now: func() time.Time { return now }}
+		e, err := p.ParseListLine(test.line)
+		if err != nil {
+			t.Errorf("%q: %v", test.line, err)
+			continue
+		}
+		if !e.Time.Equal(test.want) {
+			t.Errorf("%q at %v: got %v, want %v", test.line, now, e.Time, test.want)
+		}
+	}
+}
+
+// go test -run TestParsePASV
+func TestParsePASV(t *testing.T) {
+	for _, test := range []struct {
+		reply string
+		host  string
+		port  int
+	}{
+		{"227 Entering Passive Mode (172,17,66,241,254,179).", "172.17.66.241", 65203},
+		{"Entering Passive Mode (10,0,0,1,4,1)", "10.0.0.1", 1025},
+		{"227 Entering Passive Mode 192,168,1,2,0,21", "192.168.1.2", 21},
+		{"227 =127,0,0,1,200,10", "127.0.0.1", 51210},
+		{"227 Passive 1,2,3 (127,0,0,1,0,255)", "127.0.0.1", 255},
+	} {
+		host, port, err := ParsePASV(test.reply)
+		if err != nil || host != test.host || port != test.port {
+			t.Errorf("ParsePASV(%q) = %q, %d, %v, want %q, %d", test.reply, host, port, err, test.host, test.port)
+		}
+	}
+	for _, reply := range []string{
+		"", "227 Entering Passive Mode", "227 (1,2,3,4,5)", "227 (1,2,3,4,5,256)",
+		"227 (1,2,3,4,5,6000)", "227 (1,2,3,4,,5,6)", "227 (1,2,3,4,5,)",
+	} {
+		if host, port, err := ParsePASV(reply); err == nil {
+			t.Errorf("ParsePASV(%q) = %q, %d", reply, host, port)
+		}
+	}
+}
+
+// go test -run TestParseEPSV
+func TestParseEPSV(t *testing.T) {
+	for reply, want := range map[string]int{
+		"229 Entering Extended Passive Mode (|||6446|)": 6446,
+		"Entering Extended Passive Mode (!!!65535!)":    65535,
+		"229 (###21#)": 21,
+	} {
+		if port, err := ParseEPSV(reply); err != nil || port != want {
+			t.Errorf("ParseEPSV(%q) = %d, %v, want %d", reply, port, err, want)
+		}
+	}
+	for _, reply := range []string{
+		"", "229 (|||abc|)", "229 (|||)", "229 (||||)", "229 (|||65536|)", "229 (|||0|)",
+		"229 (|||21|", "229 (|||21", "229 (1112111)", "229 (||!21|)", "229 (|||21!)", "(",
+	} {
+		if port, err := ParseEPSV(reply); err == nil {
+			t.Errorf("ParseEPSV(%q) = %d", reply, port)
+		}
+	}
+}
+
+// go test -run TestParsePWD
+func TestParsePWD(t *testing.T) {
+	for reply, want := range map[string]string{
+		`257 "/" is the current directory`:             "/",
+		`"/home/joe"`:                                  "/home/joe",
+		`257 "/a ""quoted"" dir" is current directory`: `/a "quoted" dir`,
+		`257 "/ends with quote"""`:                     `/ends with quote"`,
+		`257 ""`:                                       "",
+	} {
+		if got, err := ParsePWD(reply); err != nil || got != want {
+			t.Errorf("ParsePWD(%q) = %q, %v, want %q", reply, got, err, want)
+		}
+	}
+	for _, reply := range []string{"", "257 /no/quotes", `257 "/unterminated`, `257 "/a ""b`} {
+		if got, err := ParsePWD(reply); err == nil {
+			t.Errorf("ParsePWD(%q) = %q", reply, got)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package ftplib
+
+import (
+	"errors"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// ErrPassivePoolExhausted is returned when every listener of a PassivePool
+// is borrowed.
+var ErrPassivePoolExhausted = errors.New("no passive port available")
+
+// PassivePool holds listeners bound in advance to a range of passive ports,
+// which sessions borrow for PASV and EPSV and give back once the transfer
+// is over. Reusing them spares a bind per transfer and keeps passive mode
+// within the ports a firewall lets through.
+type PassivePool struct {
+	mu        sync.Mutex
+	free      []*net.TCPListener
+	size      int
+	exhausted uint64
+	closed    bool
+}
+
+// PassivePoolStats are the metrics of a PassivePool.
+type PassivePoolStats struct {
+	Size      int    // listeners in the pool
+	InUse     int    // listeners borrowed
+	Exhausted uint64 // requests refused for want of a free listener
+}
+
+// NewPassivePool binds a listener to every port from first to last on host.
+// Ports already in use are skipped.
+func NewPassivePool(host string, first, last int) (*PassivePool, error) {
+	pool := &PassivePool{}
+	for port := first; port <= last; port++ {
+		laddr, err := net.ResolveTCPAddr("tcp4", net.JoinHostPort(host, strconv.Itoa(port)))
+		if err != nil {
+			return nil, err
+		}
+		listener, err := net.ListenTCP("tcp4", laddr)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		pool.free = append(pool.free, listener)
+	}
+	pool.size = len(pool.free)
+	if pool.size == 0 {
+		return nil, errors.New("no passive port could be bound")
+	}
+	return pool, nil
+}
+
+// get borrows a listener.
+func (pool *PassivePool) get() (*net.TCPListener, error) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	if len(pool.free) == 0 {
+		pool.exhausted++
+		return nil, ErrPassivePoolExhausted
+	}
+	listener := pool.free[len(pool.free)-1]
+	pool.free = pool.free[:len(pool.free)-1]
+	return listener, nil
+}
+
+// put gives back a listener borrowed with get.
+func (pool *PassivePool) put(listener *net.TCPListener) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	if pool.closed {
+		listener.Close()
+		return
+	}
+	pool.free = append(pool.free, listener)
+}
+
+// Stats returns the current metrics of the pool.
+func (pool *PassivePool) Stats() PassivePoolStats {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	return PassivePoolStats{
+		Size:      pool.size,
+		InUse:     pool.size - len(pool.free),
+		Exhausted: pool.exhausted,
+	}
+}
+
+// Close closes the listeners not borrowed; the others are closed when given
+// back.
+func (pool *PassivePool) Close() error {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	for _, listener := range pool.free {
+		listener.Close()
+	}
+	pool.free = nil
+	pool.closed = true
+	return nil
+}
@@ -0,0 +1,176 @@
+package ftplib
+
+import (
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// go test -run TestPassivePool
+func TestPassivePool(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	pool, err := NewPassivePool("127.0.0.1", first, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	passiveConn, err := newPassiveConn("127.0.0.1", pool, 0, SocketOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if passiveConn.Port() != first {
+		t.Errorf("listening on %d, not on the pooled port %d", passiveConn.Port(), first)
+	}
+	if _, err := newPassiveConn("127.0.0.1", pool, 0, SocketOptions{}); err != ErrPassivePoolExhausted {
+		t.Error("expected the pool to be exhausted, got", err)
+	}
+	if stats := pool.Stats(); stats != (PassivePoolStats{Size: 1, InUse: 1, Exhausted: 1}) {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	conn, err := net.Dial("tcp4", "127.0.0.1:"+strconv.Itoa(first))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("data"))
+	conn.Close()
+	buf := make([]byte, 4)
+	if n, err := passiveConn.Read(buf); err != nil || string(buf[:n]) != "data" {
+		t.Errorf("read %q, %v", buf[:n], err)
+	}
+	passiveConn.Close()
+
+	// A listener given back without a connection is reusable too.
+	for i := 0; i < 2; i++ {
+		passiveConn, err := newPassiveConn("127.0.0.1", pool, 0, SocketOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		passiveConn.Close()
+	}
+	if stats := pool.Stats(); stats.InUse != 0 {
+		t.Errorf("listeners not given back: %+v", stats)
+	}
+}
+
+// go test -run TestPassiveConnTimeout
+func TestPassiveConnTimeout(t *testing.T) {
+	passiveConn, err := newPassiveConn("127.0.0.1", nil, 10*time.Millisecond, SocketOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := passiveConn.Write([]byte("data")); err == nil {
+		t.Error("expected the wait for the client to time out")
+	}
+	if err := passiveConn.Close(); err != nil {
+		t.Error(err)
+	}
+	if _, err := net.Dial("tcp4", "127.0.0.1:"+strconv.Itoa(passiveConn.Port())); err == nil {
+		t.Error("listener left open")
+	}
+
+	// Closing a connection no client used must not hang nor panic.
+	passiveConn, err = NewPassiveConn("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	passiveConn.Close()
+	passiveConn.Close()
+}
+
+// go test -run TestPassiveConnDeadline
+func TestPassiveConnDeadline(t *testing.T) {
+	passiveConn, err := NewPassiveConn("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer passiveConn.Close()
+	if addr := passiveConn.RemoteAddr(); addr != nil {
+		t.Error("peer known before connecting:", addr)
+	}
+	passiveConn.SetReadDeadline(time.Now().Add(-time.Second))
+
+	conn, err := net.Dial("tcp4", "127.0.0.1:"+strconv.Itoa(passiveConn.Port()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := passiveConn.Read(make([]byte, 1)); err == nil {
+		t.Error("deadline set before connecting was not applied")
+	}
+	if addr := passiveConn.RemoteAddr(); addr == nil || addr.String() != conn.LocalAddr().String() {
+		t.Errorf("got peer %v, want %v", addr, conn.LocalAddr())
+	}
+}
+
+// go test -run TestPassiveAddress
+func TestPassiveAddress(t *testing.T) {
+	var ip net.IP
+	addrs, _ := net.InterfaceAddrs()
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
+			ip = ipNet.IP.To4()
+			break
+		}
+	}
+	if ip == nil {
+		t.Skip("no IPv4 address but the loopback")
+	}
+	server, err := NewServer("0.0.0.0:0", ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	go server.ListenAndServe()
+
+	port := server.listener.Addr().(*net.TCPAddr).Port
+	c, err := textproto.Dial("tcp4", net.JoinHostPort(ip.String(), strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.ReadResponse(StatusReady)
+	c.Cmd("PASV")
+	_, msg, err := c.ReadResponse(StatusPassiveMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, dataPort, err := ParsePASV(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host != ip.String() {
+		t.Errorf("PASV announced %s to a client of %s", host, ip)
+	}
+	data, err := net.Dial("tcp4", net.JoinHostPort(host, strconv.Itoa(dataPort)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer data.Close()
+	c.Cmd("LIST")
+	c.ReadResponse(StatusAboutToSend)
+	ioutil.ReadAll(data)
+	if _, msg, err := c.ReadResponse(StatusClosingDataConnection); err != nil {
+		t.Errorf("LIST: %s (%v)", msg, err)
+	}
+
+	// Behind NAT the public address is announced instead.
+	p, done := pipeServe(&Server{Driver: &DiskDriver{Root: "."}, PassiveAddress: "198.51.100.7"})
+	p.Cmd("PASV")
+	_, msg, err = p.ReadResponse(StatusPassiveMode)
+	if host, _, _ := ParsePASV(msg); err != nil || host != "198.51.100.7" {
+		t.Errorf("PASV = %q (%v), want the PassiveAddress", msg, err)
+	}
+	p.Cmd("QUIT")
+	p.ReadResponse(StatusClosing)
+	<-done
+}
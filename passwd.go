@@ -0,0 +1,151 @@
+package ftplib
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// VerifyFunc reports whether password matches hash. Adapting
+// golang.org/x/crypto/bcrypt takes a few lines:
+//
+//	func(hash, password string) (bool, error) {
+//		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+//		return err == nil, nil
+//	}
+type VerifyFunc func(hash, password string) (bool, error)
+
+// PasswordAuth is an Auth checking passwords against stored hashes.
+//
+// Hashes in the "$pbkdf2-sha256$" scheme of HashPassword are verified out
+// of the box; the other "$"-prefixed schemes, such as bcrypt ("$2a$",
+// "$2b$", "$2y$") or argon2 ("$argon2id$"), by the Verifiers registered
+// for them. Hashes without a scheme are plaintext passwords, compared in
+// constant time.
+type PasswordAuth struct {
+	// Hashes maps the user names to their password hashes.
+	Hashes map[string]string
+
+	// Verifiers maps the scheme prefixes to the functions verifying them.
+	Verifiers map[string]VerifyFunc
+}
+
+// pbkdf2Scheme is the prefix of the hashes of HashPassword, as written by
+// passlib: "$pbkdf2-sha256$rounds$salt$key", in base64 with "." for "+".
+const pbkdf2Scheme = "$pbkdf2-sha256$"
+
+// pbkdf2Rounds is the cost of the hashes of HashPassword.
+const pbkdf2Rounds = 100000
+
+var (
+	errUnknownScheme = errors.New("unknown password hash scheme")
+	errBadHash       = errors.New("malformed password hash")
+)
+
+// HashPassword returns a salted PBKDF2-SHA256 hash of password, for the
+// Hashes of a PasswordAuth.
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := pbkdf2SHA256([]byte(password), salt, pbkdf2Rounds, sha256.Size)
+	return fmt.Sprintf("%s%d$%s$%s", pbkdf2Scheme, pbkdf2Rounds, ab64(salt), ab64(key)), nil
+}
+
+// CheckPasswd verifies the password of user. Unknown users cost as much as
+// wrong passwords, not to tell them apart.
+func (auth *PasswordAuth) CheckPasswd(user, password string) (bool, error) {
+	hash, ok := auth.Hashes[user]
+	if !ok {
+		pbkdf2SHA256([]byte(password), []byte(user), pbkdf2Rounds, sha256.Size)
+		return false, nil
+	}
+	return auth.verify(hash, password)
+}
+
+// verify reports whether password matches hash.
+func (auth *PasswordAuth) verify(hash, password string) (bool, error) {
+	if !strings.HasPrefix(hash, "$") {
+		return constantTimeEqual(hash, password), nil
+	}
+	var verifier VerifyFunc
+	prefix := ""
+	for scheme, f := range auth.Verifiers {
+		if strings.HasPrefix(hash, scheme) && len(scheme) > len(prefix) {
+			verifier, prefix = f, scheme
+		}
+	}
+	switch {
+	case verifier != nil:
+		return verifier(hash, password)
+	case strings.HasPrefix(hash, pbkdf2Scheme):
+		return verifyPBKDF2(hash, password)
+	}
+	return false, errUnknownScheme
+}
+
+// constantTimeEqual reports whether a and b are equal, in a time depending
+// on neither their content nor their length.
+func constantTimeEqual(a, b string) bool {
+	da, db := sha256.Sum256([]byte(a)), sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(da[:], db[:]) == 1
+}
+
+// verifyPBKDF2 verifies password against a hash of HashPassword.
+func verifyPBKDF2(hash, password string) (bool, error) {
+	fields := strings.Split(strings.TrimPrefix(hash, pbkdf2Scheme), "$")
+	if len(fields) != 3 {
+		return false, errBadHash
+	}
+	rounds, err := strconv.Atoi(fields[0])
+	if err != nil || rounds <= 0 {
+		return false, errBadHash
+	}
+	salt, err1 := unab64(fields[1])
+	key, err2 := unab64(fields[2])
+	if err1 != nil || err2 != nil || len(key) == 0 {
+		return false, errBadHash
+	}
+	derived := pbkdf2SHA256([]byte(password), salt, rounds, len(key))
+	return subtle.ConstantTimeCompare(derived, key) == 1, nil
+}
+
+// pbkdf2SHA256 derives a key of size bytes from password (RFC 8018).
+func pbkdf2SHA256(password, salt []byte, rounds, size int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var key []byte
+	for block := uint32(1); len(key) < size; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.Write(prf, binary.BigEndian, block)
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < rounds; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:size]
+}
+
+// ab64 encodes b in the base64 of passlib: unpadded, with "." for "+".
+func ab64(b []byte) string {
+	return strings.Replace(base64.RawStdEncoding.EncodeToString(b), "+", ".", -1)
+}
+
+func unab64(s string) ([]byte, error) {
+	return base64.RawStdEncoding.DecodeString(strings.Replace(s, ".", "+", -1))
+}
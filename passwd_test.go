@@ -0,0 +1,61 @@
+package ftplib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+// go test -run TestPBKDF2
+func TestPBKDF2(t *testing.T) {
+	// RFC 7914, section 11.
+	key := pbkdf2SHA256([]byte("passwd"), []byte("salt"), 1, 64)
+	want := "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc" +
+		"49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"
+	if got := hex.EncodeToString(key); got != want {
+		t.Errorf("PBKDF2 = %s, want %s", got, want)
+	}
+	if key := pbkdf2SHA256([]byte("p"), []byte("s"), 2, sha256.Size); len(key) != sha256.Size {
+		t.Errorf("len = %d", len(key))
+	}
+}
+
+// go test -run TestPasswordAuth
+func TestPasswordAuth(t *testing.T) {
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := &PasswordAuth{
+		Hashes: map[string]string{
+			"alice": hash,
+			"bob":   "plain",
+			"carol": "$2a$10$notverified",
+			"dave":  "$custom$letmein",
+			"eve":   "$pbkdf2-sha256$x$y$z",
+		},
+		Verifiers: map[string]VerifyFunc{
+			"$custom$": func(hash, password string) (bool, error) {
+				return hash == "$custom$"+password, nil
+			},
+		},
+	}
+	for _, tt := range []struct {
+		user, password string
+		ok, err        bool
+	}{
+		{"alice", "secret", true, false},
+		{"alice", "Secret", false, false},
+		{"bob", "plain", true, false},
+		{"bob", "plai", false, false},
+		{"carol", "$2a$10$notverified", false, true},
+		{"dave", "letmein", true, false},
+		{"eve", "z", false, true},
+		{"mallory", "secret", false, false},
+	} {
+		ok, err := auth.CheckPasswd(tt.user, tt.password)
+		if ok != tt.ok || (err != nil) != tt.err {
+			t.Errorf("%s/%s: got %v, %v", tt.user, tt.password, ok, err)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package ftplib
+
+import "sync"
+
+// Privileges are what the server process drops to once its listeners are
+// bound, so that it can open privileged ports such as 21 or 990 as root
+// without keeping root for its sessions. Only Unix hosts support them, and
+// Linux ones only in programs built with Go 1.16 or later: with older
+// versions syscall.Setuid and Setgid fail there with EOPNOTSUPP, and so
+// does Drop. Drop also fails when the ids of the process are not those of
+// User and Group afterwards, so that a server never goes on as root.
+type Privileges struct {
+	// User and Group are the names or numeric ids to run as. An empty
+	// Group selects the primary group of User.
+	User, Group string
+
+	// Chroot, if set, confines the whole process to this directory. The
+	// paths the server opens afterwards, such as the Root of a DiskDriver
+	// or the files of a FileCertManager, are then relative to it.
+	Chroot string
+}
+
+var (
+	dropOnce sync.Once
+	dropErr  error
+)
+
+// Drop confines the process and switches it to the user and group of p.
+// Privileges are dropped once per process: later calls, with p or other
+// Privileges, return the outcome of the first one.
+func (p *Privileges) Drop() error {
+	dropOnce.Do(func() {
+		dropErr = p.drop()
+	})
+	return dropErr
+}
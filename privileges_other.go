@@ -0,0 +1,11 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package ftplib
+
+import "errors"
+
+// drop fails where the platform has no Unix users.
+func (p *Privileges) drop() error {
+	return errors.New("dropping privileges is not supported on this platform")
+}
@@ -0,0 +1,87 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package ftplib
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// drop looks up the ids of p before entering the chroot, where the user
+// database may be out of reach, then gives up the groups before the user,
+// which could not change them anymore.
+func (p *Privileges) drop() error {
+	uid, gid, err := p.ids()
+	if err != nil {
+		return err
+	}
+	if p.Chroot != "" {
+		if err := syscall.Chroot(p.Chroot); err != nil {
+			return &os.PathError{Op: "chroot", Path: p.Chroot, Err: err}
+		}
+		if err := os.Chdir("/"); err != nil {
+			return err
+		}
+	}
+	if err := syscall.Setgroups(nil); err != nil {
+		return fmt.Errorf("setgroups: %v", err)
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return setidError("setgid", gid, err)
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return setidError("setuid", uid, err)
+	}
+	return checkIDs(uid, gid)
+}
+
+// setidError returns the error of the call switching to id. Before Go
+// 1.16, syscall.Setuid and Setgid always fail on Linux with EOPNOTSUPP.
+func setidError(call string, id int, err error) error {
+	if err == syscall.EOPNOTSUPP {
+		return fmt.Errorf("%s %d: %v: dropping privileges on Linux needs Go 1.16 or later", call, id, err)
+	}
+	return fmt.Errorf("%s %d: %v", call, id, err)
+}
+
+// checkIDs makes sure that the real and effective ids of the process are
+// uid and gid, rather than trusting the calls which set them: a process
+// still root would serve everything to everyone.
+func checkIDs(uid, gid int) error {
+	if os.Getuid() != uid || os.Geteuid() != uid || os.Getgid() != gid || os.Getegid() != gid {
+		return fmt.Errorf("privileges not dropped: running as uid %d (effective %d), gid %d (effective %d) instead of uid %d, gid %d",
+			os.Getuid(), os.Geteuid(), os.Getgid(), os.Getegid(), uid, gid)
+	}
+	return nil
+}
+
+// ids returns the numeric user and group ids of p.
+func (p *Privileges) ids() (uid, gid int, err error) {
+	u, err := user.Lookup(p.User)
+	if err != nil {
+		if u, err = user.LookupId(p.User); err != nil {
+			return 0, 0, err
+		}
+	}
+	groupID := u.Gid
+	if p.Group != "" {
+		g, err := user.LookupGroup(p.Group)
+		if err != nil {
+			if g, err = user.LookupGroupId(p.Group); err != nil {
+				return 0, 0, err
+			}
+		}
+		groupID = g.Gid
+	}
+	if uid, err = strconv.Atoi(u.Uid); err != nil {
+		return 0, 0, fmt.Errorf("user %s: non-numeric id %q", p.User, u.Uid)
+	}
+	if gid, err = strconv.Atoi(groupID); err != nil {
+		return 0, 0, fmt.Errorf("group of %s: non-numeric id %q", p.User, groupID)
+	}
+	return uid, gid, nil
+}
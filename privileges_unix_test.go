@@ -0,0 +1,51 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package ftplib
+
+import (
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// go test -run TestPrivilegesIDs
+func TestPrivilegesIDs(t *testing.T) {
+	for _, p := range []*Privileges{
+		{User: "root"},
+		{User: "0", Group: "0"},
+	} {
+		if uid, gid, err := p.ids(); err != nil || uid != 0 || gid != 0 {
+			t.Errorf("%+v: ids %d, %d, %v", p, uid, gid, err)
+		}
+	}
+	for _, p := range []*Privileges{
+		{User: "no-such-user"},
+		{User: "root", Group: "no-such-group"},
+	} {
+		if _, _, err := p.ids(); err == nil {
+			t.Errorf("%+v: no error", p)
+		}
+	}
+}
+
+// go test -run TestPrivilegesCheck
+func TestPrivilegesCheck(t *testing.T) {
+	uid, gid := os.Geteuid(), os.Getegid()
+	if os.Getuid() == uid && os.Getgid() == gid {
+		if err := checkIDs(uid, gid); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := checkIDs(uid+1, gid); err == nil {
+		t.Errorf("uid %d taken for %d", uid, uid+1)
+	}
+	if err := checkIDs(uid, gid+1); err == nil {
+		t.Errorf("gid %d taken for %d", gid, gid+1)
+	}
+	err := setidError("setuid", 21, syscall.EOPNOTSUPP)
+	if !strings.Contains(err.Error(), "Go 1.16") {
+		t.Errorf("unsupported setuid: %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+package ftplib
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// go test -run TestReadProxyHeader
+func TestReadProxyHeader(t *testing.T) {
+	v2 := append([]byte{}, proxyV2Signature...)
+	v2 = append(v2, 0x21, 0x11, 0, 12,
+		192, 0, 2, 7, 10, 0, 0, 1, 0x30, 0x39, 0, 21)
+
+	tests := []struct {
+		header string
+		addr   string
+	}{
+		{"PROXY TCP4 192.0.2.7 10.0.0.1 12345 21\r\n", "192.0.2.7:12345"},
+		{"PROXY TCP6 2001:db8::7 2001:db8::1 12345 21\r\n", "[2001:db8::7]:12345"},
+		{"PROXY UNKNOWN\r\n", ""},
+		{string(v2), "192.0.2.7:12345"},
+	}
+	for _, test := range tests {
+		r := bufio.NewReader(bytes.NewBufferString(test.header + "USER up\r\n"))
+		addr, err := readProxyHeader(r)
+		if err != nil {
+			t.Errorf("%q: %v", test.header, err)
+			continue
+		}
+		if (addr == nil && test.addr != "") || (addr != nil && addr.String() != test.addr) {
+			t.Errorf("%q: got %v, want %s", test.header, addr, test.addr)
+		}
+		if line, _ := r.ReadString('\n'); line != "USER up\r\n" {
+			t.Errorf("%q: header not fully consumed, got %q", test.header, line)
+		}
+	}
+
+	if _, err := readProxyHeader(bufio.NewReader(bytes.NewBufferString("USER up\r\n"))); err == nil {
+		t.Error("expected an error without header")
+	}
+}
+
+func TestTrustsProxy(t *testing.T) {
+	_, network, _ := net.ParseCIDR("10.0.0.0/8")
+	server := &Server{TrustedProxies: []*net.IPNet{network}}
+	if !server.trustsProxy(&net.TCPAddr{IP: net.ParseIP("10.1.2.3")}) {
+		t.Error("10.1.2.3 should be trusted")
+	}
+	if server.trustsProxy(&net.TCPAddr{IP: net.ParseIP("192.0.2.1")}) {
+		t.Error("192.0.2.1 should not be trusted")
+	}
+}
+
+// go test -run TestProxiedSession
+func TestProxiedSession(t *testing.T) {
+	server, err := NewServer("127.0.0.1:0", ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	server.TrustedProxies = []*net.IPNet{loopback}
+	go server.ListenAndServe()
+
+	// dial opens a session through the load balancer on the loopback,
+	// which starts it with header.
+	dial := func(header string) *textproto.Conn {
+		conn, err := net.Dial("tcp", server.listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprint(conn, header)
+		return textproto.NewConn(conn)
+	}
+
+	c := dial("PROXY TCP4 192.0.2.1 127.0.0.1 40000 21\r\n")
+	defer c.Close()
+	if _, msg, err := c.ReadResponse(StatusReady); err != nil {
+		t.Fatalf("greeting after a PROXY header: %s (%v)", msg, err)
+	}
+	c.Cmd("USER user")
+	if _, msg, err := c.ReadResponse(StatusUserOK); err != nil {
+		t.Errorf("USER after a PROXY header: %s (%v)", msg, err)
+	}
+
+	// The load balancer must announce the client.
+	c = dial("USER anonymous\r\n")
+	defer c.Close()
+	if _, _, err := c.ReadResponse(StatusReady); err == nil {
+		t.Error("session of a trusted proxy accepted without a PROXY header")
+	}
+}
+
+// go test -run TestProxiedDataPeer
+func TestProxiedDataPeer(t *testing.T) {
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+
+	// list lists over a session of a server behind a load balancer on the
+	// loopback, announced from client by the PROXY header, and returns the
+	// code of the reply ending the transfer.
+	list := func(client string, allowForeignData bool) int {
+		server, err := NewServer("127.0.0.1:0", ".")
+		if err != nil {
+			t.Fatal(err)
+		}
+		server.TrustedProxies = []*net.IPNet{loopback}
+		server.AllowForeignData = allowForeignData
+		defer server.Stop()
+		go server.ListenAndServe()
+
+		conn, err := net.Dial("tcp", server.listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(conn, "PROXY TCP4 %s 127.0.0.1 40000 21\r\n", client)
+		c := textproto.NewConn(conn)
+		defer c.Close()
+		c.ReadResponse(StatusReady)
+		c.Cmd("USER user")
+		c.ReadResponse(StatusUserOK)
+		c.Cmd("PASS pass")
+		c.ReadResponse(StatusLoggedIn)
+		c.Cmd("EPSV")
+		_, msg, err := c.ReadResponse(StatusExtendedPassiveMode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		port := strings.TrimSuffix(msg[strings.Index(msg, "|||")+3:], "|)")
+		data, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer data.Close()
+		c.Cmd("LIST")
+		c.ReadResponse(StatusAboutToSend)
+		ioutil.ReadAll(data)
+		code, _, _ := c.ReadResponse(0)
+		return code
+	}
+
+	// The data connections come from 127.0.0.1 rather than from the client
+	// announced.
+	if code := list("192.0.2.1", false); code != StatusTransfertAborted {
+		t.Errorf("data connection from another host than the proxied client: %d, want %d", code, StatusTransfertAborted)
+	}
+	if code := list("127.0.0.1", false); code != StatusClosingDataConnection {
+		t.Errorf("data connection from the proxied client: %d, want %d", code, StatusClosingDataConnection)
+	}
+	if code := list("192.0.2.1", true); code != StatusClosingDataConnection {
+		t.Errorf("data connection from another host with AllowForeignData: %d, want %d", code, StatusClosingDataConnection)
+	}
+}
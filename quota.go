@@ -0,0 +1,209 @@
+package ftplib
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+)
+
+// ErrQuotaExceeded is returned when a reservation does not fit a user's quota.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Quota is the storage accounting of one user. A Limit of zero means the
+// user is not limited.
+type Quota struct {
+	Used     int64 `json:"used"`
+	Reserved int64 `json:"-"`
+	Limit    int64 `json:"limit"`
+}
+
+// Available returns the bytes the user may still store, or -1 when the user
+// is not limited.
+func (q Quota) Available() int64 {
+	if q.Limit <= 0 {
+		return -1
+	}
+	if n := q.Limit - q.Used - q.Reserved; n > 0 {
+		return n
+	}
+	return 0
+}
+
+// QuotaStore keeps the storage usage of every user. Implementations backed
+// by a database let quotas survive restarts and be shared between servers.
+type QuotaStore interface {
+	// Get returns the current accounting of user.
+	Get(user string) (Quota, error)
+	// Reserve holds n bytes for an upload in progress, failing with
+	// ErrQuotaExceeded when they do not fit in the user's quota.
+	Reserve(user string, n int64) error
+	// Commit settles a reservation of reserved bytes, adding used bytes
+	// (which may be negative when a file shrinks) to the usage.
+	Commit(user string, reserved, used int64) error
+	// Release frees n used bytes, after a file was deleted or overwritten.
+	Release(user string, n int64) error
+}
+
+// FileQuotaStore is a QuotaStore kept in memory and, when created with a
+// file name, persisted to that file as JSON after every change.
+type FileQuotaStore struct {
+	mu    sync.Mutex
+	name  string
+	users map[string]*Quota
+}
+
+// NewFileQuotaStore loads the quotas saved in name, if it exists. An empty
+// name keeps the quotas in memory only.
+func NewFileQuotaStore(name string) (*FileQuotaStore, error) {
+	store := &FileQuotaStore{name: name, users: make(map[string]*Quota)}
+	if name == "" {
+		return store, nil
+	}
+	data, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return store, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &store.users); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// SetLimit sets the quota limit of user, zero meaning unlimited.
+func (store *FileQuotaStore) SetLimit(user string, limit int64) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.quota(user).Limit = limit
+	return store.save()
+}
+
+func (store *FileQuotaStore) Get(user string) (Quota, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return *store.quota(user), nil
+}
+
+func (store *FileQuotaStore) Reserve(user string, n int64) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	q := store.quota(user)
+	if available := q.Available(); available >= 0 && n > available {
+		return ErrQuotaExceeded
+	}
+	q.Reserved += n
+	return nil
+}
+
+func (store *FileQuotaStore) Commit(user string, reserved, used int64) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	q := store.quota(user)
+	q.Reserved -= reserved
+	if q.Reserved < 0 {
+		q.Reserved = 0
+	}
+	q.Used += used
+	if q.Used < 0 {
+		q.Used = 0
+	}
+	return store.save()
+}
+
+func (store *FileQuotaStore) Release(user string, n int64) error {
+	return store.Commit(user, 0, -n)
+}
+
+// quota returns the accounting of user, creating it if needed.
+// The caller must hold store.mu.
+func (store *FileQuotaStore) quota(user string) *Quota {
+	q, ok := store.users[user]
+	if !ok {
+		q = &Quota{}
+		store.users[user] = q
+	}
+	return q
+}
+
+// save writes the quotas to the store's file, atomically replacing it.
+// The caller must hold store.mu.
+func (store *FileQuotaStore) save() error {
+	if store.name == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(store.users, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := store.name + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, store.name)
+}
+
+// quotaChunk is the granularity at which uploads reserve quota.
+const quotaChunk = 1 << 20
+
+// quotaReservation is the quota held by one upload in progress. A nil
+// reservation stands for an unlimited user.
+type quotaReservation struct {
+	store QuotaStore
+	user  string
+	n     int64
+}
+
+// reserveQuota starts a reservation for the session's user, or returns nil
+// when the server has no QuotaStore.
+func (serverConn *ServerConn) reserveQuota() *quotaReservation {
+	if serverConn.server.Quota == nil {
+		return nil
+	}
+	return &quotaReservation{store: serverConn.server.Quota, user: serverConn.user}
+}
+
+// cover grows the reservation to at least size bytes.
+func (r *quotaReservation) cover(size int64) error {
+	for r != nil && r.n < size {
+		// Reserve whole chunks to spare the store, falling back to the
+		// exact need when the user is close to the limit.
+		n := int64(quotaChunk)
+		if err := r.store.Reserve(r.user, n); err != nil {
+			n = size - r.n
+			if err := r.store.Reserve(r.user, n); err != nil {
+				return err
+			}
+		}
+		r.n += n
+	}
+	return nil
+}
+
+// settle ends the reservation, accounting used bytes to the user.
+func (r *quotaReservation) settle(used int64) {
+	if r == nil {
+		return
+	}
+	if err := r.store.Commit(r.user, r.n, used); err != nil {
+		log.Println(err)
+	}
+}
+
+// releaseQuota measures the file or tree p about to be removed and returns a
+// function giving that space back to the session's user once it is gone.
+func (serverConn *ServerConn) releaseQuota(p string) func() {
+	store := serverConn.server.Quota
+	if store == nil {
+		return func() {}
+	}
+	size := diskUsage(serverConn.driver(), p)
+	return func() {
+		if err := store.Release(serverConn.user, size); err != nil {
+			log.Println(err)
+		}
+	}
+}
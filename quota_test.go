@@ -0,0 +1,90 @@
+package ftplib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// go test -run TestFileQuotaStore
+func TestFileQuotaStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftplib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "quota.json")
+
+	store, err := NewFileQuotaStore(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.SetLimit("up", 100)
+	if err := store.Reserve("up", 60); err != nil {
+		t.Error(err)
+	}
+	if err := store.Reserve("up", 60); err != ErrQuotaExceeded {
+		t.Error("expected ErrQuotaExceeded, got", err)
+	}
+	store.Commit("up", 60, 60)
+	store.Release("up", 20)
+
+	store, err = NewFileQuotaStore(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, _ := store.Get("up")
+	if q.Used != 40 || q.Limit != 100 || q.Available() != 60 {
+		t.Errorf("unexpected quota after reload: %+v", q)
+	}
+}
+
+// go test -run TestQuotaAccounting
+func TestQuotaAccounting(t *testing.T) {
+	store, _ := NewFileQuotaStore("")
+	store.SetLimit("user", 40)
+	dir, c, stop := serveDir(t, func(server *Server) {
+		server.Quota = store
+	})
+	defer stop()
+
+	used := func() int64 {
+		q, _ := store.Get("user")
+		if q.Reserved != 0 {
+			t.Errorf("%d bytes left reserved", q.Reserved)
+		}
+		return q.Used
+	}
+	if err := c.Stor("a", strings.NewReader(strings.Repeat("a", 30))); err != nil {
+		t.Fatal(err)
+	}
+	err := c.Stor("b", strings.NewReader(strings.Repeat("b", 20)))
+	if code := errCode(err); code != StatusExceededStorage {
+		t.Errorf("STOR over the quota: %v, want a 552 reply", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b")); !os.IsNotExist(err) {
+		t.Errorf("STOR over the quota left the file: %v", err)
+	}
+	if n := used(); n != 30 {
+		t.Errorf("used %d bytes after STOR, want 30", n)
+	}
+
+	if err := c.Stor("b", strings.NewReader(strings.Repeat("b", 10))); err != nil {
+		t.Fatal(err)
+	}
+	// Renaming over b frees the space b used.
+	if err := c.Rename("a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if n := used(); n != 30 {
+		t.Errorf("used %d bytes after RNTO, want 30", n)
+	}
+	if err := c.Delete("b"); err != nil {
+		t.Fatal(err)
+	}
+	if n := used(); n != 0 {
+		t.Errorf("used %d bytes after DELE, want 0", n)
+	}
+}
@@ -0,0 +1,100 @@
+package ftplib
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"path"
+)
+
+// SetAutoReconnect makes the client reconnect when it loses the control
+// connection, or the server closes it with a 421 reply: it logs in again,
+// secures the session as before, returns to the working directory and
+// selects the MLSx facts again, then retries the command that failed. A
+// transfer is retried if the connection was lost before it started; data
+// lost in the middle of a transfer is not sent again.
+func (c *ClientConn) SetAutoReconnect(on bool) {
+	c.autoReconnect = on
+}
+
+// WithAutoReconnect dials a ClientConn reconnecting by itself, as
+// SetAutoReconnect.
+func WithAutoReconnect() DialOption {
+	return func(c *ClientConn) {
+		c.autoReconnect = true
+	}
+}
+
+// shouldRestore reports whether the session is to be restored after err.
+func (c *ClientConn) shouldRestore(err error) bool {
+	return err != nil && c.autoReconnect && !c.restoring && connLost(err)
+}
+
+// connLost reports whether err tells that the control connection is gone,
+// rather than a refused command or an interrupted operation.
+func connLost(err error) bool {
+	if code, ok := replyCode(err); ok {
+		return code == StatusNotAvailable
+	}
+	switch e := err.(type) {
+	case *net.OpError:
+		// Failing to open a data connection leaves the session alone.
+		return e.Op != "dial" && !e.Timeout()
+	case net.Error:
+		return !e.Timeout()
+	}
+	return err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
+// restore replaces a lost session with a new one in the same state.
+func (c *ClientConn) restore() error {
+	c.restoring = true
+	defer func() { c.restoring = false }()
+
+	// connect resets the state of the session.
+	authTLS := c.secure != nil && c.implicit == nil && c.explicit == nil
+	secure, clear := c.secure, c.secure != nil && c.tls == nil
+	dir, facts := c.dir, c.facts
+	c.logf("Reconnecting: %s", c.addr)
+	if err := c.Reconnect(); err != nil {
+		return err
+	}
+	if !authTLS {
+		secure = nil
+	}
+	err := c.resume(secure, clear, c)
+	if err == nil && dir != "" {
+		err = c.ChangeDir(dir)
+	}
+	if err == nil && facts != nil {
+		_, err = c.SetMLSTFacts(facts...)
+	}
+	return err
+}
+
+// resume sets up a new session: secures it with AuthTLS and config unless
+// nil, carries the data connections in the clear if clear, and logs in as
+// from is logged in, if at all.
+func (c *ClientConn) resume(config *tls.Config, clear bool, from *ClientConn) error {
+	var err error
+	if config != nil && c.secure == nil {
+		err = c.AuthTLS(config)
+	}
+	if err == nil && clear {
+		err = c.SetDataProtection(ProtectionClear)
+	}
+	if err == nil {
+		err = c.relogin(from)
+	}
+	return err
+}
+
+// changedDir records a change of the working directory to dir, relative
+// to the login directory unless absolute, for restore.
+func (c *ClientConn) changedDir(dir string) {
+	if path.IsAbs(dir) {
+		c.dir = path.Clean(dir)
+	} else {
+		c.dir = path.Join(c.dir, dir)
+	}
+}
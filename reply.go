@@ -0,0 +1,135 @@
+package ftplib
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// serverCommands are the commands the server implements, listed by HELP.
+var serverCommands = []string{
+	ALLO, APPE, AUTH, CDUP, CLNT, CWD, DELE, EPRT, EPSV, FEAT, HELP, HOST,
+	LANG, LIST, MKD, MLSD, MLST, MODE, NLST, NOOP, OPTS, PASS, PASV, PBSZ,
+	PORT, PROT, PWD, QUIT, REST, RETR, RMD, RNFR, RNTO, SITE, SIZE, STAT,
+	STOR, STRU, SYST, TYPE, USER, XCUP, XCWD, XMKD, XPWD, XRMD,
+}
+
+// sendMultiline sends a multiline reply (RFC 959 section 4.2): "211-first",
+// then lines, then "211 last". Each of lines is indented by a space, so
+// that none can be mistaken for the end of the reply.
+func (serverConn *ServerConn) sendMultiline(code int, first string, lines []string, last string) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%d-%s\r\n", code, first)
+	for _, line := range lines {
+		buf.WriteString(" " + line + "\r\n")
+	}
+	fmt.Fprintf(&buf, "%d %s", code, last)
+	serverConn.replied(code)
+	serverConn.cmd(buf.String())
+}
+
+// features returns the extensions announced by FEAT (RFC 2389).
+func (serverConn *ServerConn) features() []string {
+	features := []string{CLNT, EPSV, HOST, SIZE, "REST STREAM", "TVFS", "UTF8"}
+	if serverConn.tlsConfig() != nil {
+		features = append(features, "AUTH TLS", "PBSZ", "PROT")
+	}
+
+	// RFC 2640 marks the language in use with an asterisk.
+	langs := []string{defaultLang}
+	for tag := range serverConn.server.Catalogs {
+		if !strings.EqualFold(tag, defaultLang) {
+			langs = append(langs, tag)
+		}
+	}
+	sort.Strings(langs[1:])
+	for i, tag := range langs {
+		if strings.EqualFold(tag, serverConn.lang) || (serverConn.lang == "" && i == 0) {
+			langs[i] += "*"
+		}
+	}
+	features = append(features, "LANG "+strings.Join(langs, ";"))
+
+	// RFC 3659 marks the MLSx facts sent with an asterisk.
+	selected := serverConn.facts
+	if selected == nil {
+		selected = mlsxFactNames
+	}
+	var facts string
+	for _, fact := range mlsxFactNames {
+		facts += fact
+		for _, s := range selected {
+			if s == fact {
+				facts += "*"
+			}
+		}
+		facts += ";"
+	}
+	features = append(features, "MLST "+facts)
+	sort.Strings(features)
+	return features
+}
+
+// feat lists the extensions the server supports.
+func (serverConn *ServerConn) feat() {
+	serverConn.sendMultiline(StatusSystem, serverConn.text(StatusSystem, "feat"),
+		serverConn.features(), serverConn.text(StatusSystem, "feat.end"))
+}
+
+// stat sends the status of the session, or the listing of the path named
+// by params over the control connection.
+func (serverConn *ServerConn) stat(params []string) {
+	if len(params) == 0 {
+		user := serverConn.user
+		if user == "" {
+			user = "-"
+		}
+		lines := []string{
+			"Connected from " + serverConn.RemoteAddr().String(),
+			"Logged in as " + user,
+		}
+		if serverConn.clientName != "" {
+			lines = append(lines, "Client "+serverConn.clientName)
+		}
+		serverConn.sendMultiline(StatusSystem, serverConn.text(StatusSystem, "stat"),
+			lines, serverConn.text(StatusSystem, "stat.end"))
+		return
+	}
+
+	p := serverConn.parsingPath(params)
+	info, err := serverConn.driver().Stat(p)
+	if err != nil {
+		serverConn.sendStatusText(StatusFileUnavailable)
+		return
+	}
+	code, items := StatusFile, []os.FileInfo{info}
+	if info.IsDir() {
+		code = StatusDirectory
+		if items, err = serverConn.listDir(p); err != nil {
+			serverConn.sendStatusText(StatusFileUnavailable)
+			return
+		}
+	}
+	var lines []string
+	if listing := strings.TrimSuffix(string(ListDetailed(items)), "\r\n"); listing != "" {
+		lines = strings.Split(listing, "\r\n")
+	}
+	serverConn.sendMultiline(code, serverConn.text(code, "stat", p), lines,
+		serverConn.text(code, "stat.end"))
+}
+
+// help lists the commands the server implements.
+func (serverConn *ServerConn) help() {
+	var lines []string
+	for i := 0; i < len(serverCommands); i += 8 {
+		end := i + 8
+		if end > len(serverCommands) {
+			end = len(serverCommands)
+		}
+		lines = append(lines, strings.Join(serverCommands[i:end], " "))
+	}
+	serverConn.sendMultiline(StatusHelp, serverConn.text(StatusHelp, "help"),
+		lines, serverConn.text(StatusHelp, "help.end"))
+}
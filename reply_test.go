@@ -0,0 +1,41 @@
+package ftplib
+
+import (
+	"strings"
+	"testing"
+)
+
+// go test -run TestMultilineReplies
+func TestMultilineReplies(t *testing.T) {
+	server := &Server{
+		Driver:   &DiskDriver{Root: "."},
+		Catalogs: map[string]Catalog{"fr": {}},
+	}
+	c, done := pipeServe(server)
+	expect := func(cmd string, code int, contains ...string) {
+		c.Cmd(cmd)
+		_, msg, err := c.ReadResponse(code)
+		if err != nil {
+			t.Errorf("%s: %v", cmd, err)
+		}
+		for _, s := range contains {
+			if !strings.Contains(msg, s) {
+				t.Errorf("%s: %q lacks %q", cmd, msg, s)
+			}
+		}
+	}
+
+	expect("FEAT", StatusSystem, "Features:", "\n LANG en*;fr\n", "\n MLST type*;size*;modify*;UNIX.mode*;\n", "\nEnd")
+	expect("OPTS MLST type;", StatusCommandOK)
+	expect("LANG fr", StatusCommandOK)
+	expect("FEAT", StatusSystem, "\n LANG en;fr*\n", "\n MLST type*;size;modify;UNIX.mode;\n")
+	expect("USER alice", StatusUserOK)
+	expect("STAT", StatusSystem, "\n Logged in as alice\n", "\nEnd of status")
+	expect("STAT go.mod", StatusFile, "Status of /go.mod:", " go.mod\n")
+	expect("STAT /", StatusDirectory, " go.mod\n", " server.go\n")
+	expect("HELP", StatusHelp, "RETR", "\nHelp OK.")
+
+	c.Cmd("QUIT")
+	c.ReadResponse(StatusClosing)
+	<-done
+}
@@ -0,0 +1,67 @@
+package ftplib
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// The replies of lenient servers (Server.LenientReplies), which former
+// versions sent where the RFCs ask for another code:
+//
+//	unknown command                     202, not 500 or 502
+//	SIZE of a directory                 213 1024, not 550
+//	failures worth retrying, full disk  550, not 450 or 452
+//	RNFR of a missing file              350, not 550
+//	RNTO without RNFR                   550, not 503
+//	DELE of a directory                 the Driver's answer, not 550
+//	RETR or LIST without PORT or PASV   150 then 426, not 425
+
+// lenient reports whether the session keeps the replies of former versions.
+func (serverConn *ServerConn) lenient() bool {
+	return serverConn.server.LenientReplies
+}
+
+// errorCode returns the reply code to the failure err of the Driver: 450
+// when retrying may succeed, 452 when storage ran out, 550 otherwise.
+func (serverConn *ServerConn) errorCode(err error) int {
+	if serverConn.lenient() {
+		return StatusFileUnavailable
+	}
+	var temporary interface{ Temporary() bool }
+	switch {
+	case errors.Is(err, syscall.ENOSPC):
+		return StatusInsufficientStorage
+	case errors.As(err, &temporary) && temporary.Temporary():
+		return StatusFileActionIgnored
+	}
+	return StatusFileUnavailable
+}
+
+// fileError replies to the failure err of the Driver.
+func (serverConn *ServerConn) fileError(err error) {
+	serverConn.sendCodeLine(serverConn.errorCode(err), fmt.Sprint(err))
+}
+
+// unknownCommand replies to a command the server does not serve: 502 when
+// it is an FTP command, 500 when it is not.
+func (serverConn *ServerConn) unknownCommand(verb string) {
+	switch {
+	case serverConn.lenient():
+		serverConn.sendStatusText(StatusCommandNotImplemented)
+	case knownCommands[verb]:
+		serverConn.sendStatusText(StatusNotImplemented)
+	default:
+		serverConn.sendStatusText(StatusBadCommand)
+	}
+}
+
+// hasDataConn reports whether a transfer may start, replying 425 when the
+// client did not set a data connection up.
+func (serverConn *ServerConn) hasDataConn() bool {
+	if serverConn.dataConn != nil || serverConn.lenient() {
+		return true
+	}
+	serverConn.sendStatusText(StatusCanNotOpenDataConnection)
+	return false
+}
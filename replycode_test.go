@@ -0,0 +1,86 @@
+package ftplib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// go test -run TestReplyCodes
+func TestReplyCodes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftplib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "f"), []byte("f"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	type step struct {
+		cmd   string
+		codes []int
+	}
+	for _, tt := range []struct {
+		lenient bool
+		steps   []step
+	}{
+		{false, []step{
+			{"BOGUS", []int{StatusBadCommand}},
+			{"ABOR", []int{StatusNotImplemented}},
+			{"SIZE d", []int{StatusFileUnavailable}},
+			{"DELE d", []int{StatusFileUnavailable}},
+			{"RNFR nope", []int{StatusFileUnavailable}},
+			{"RNTO x", []int{StatusBadSequence}},
+			{"RETR f", []int{StatusCanNotOpenDataConnection}},
+			{"TYPE", []int{StatusBadArguments}},
+		}},
+		{true, []step{
+			{"BOGUS", []int{StatusCommandNotImplemented}},
+			{"SIZE d", []int{StatusFile}},
+			{"RNFR nope", []int{StatusRequestFilePending}},
+			{"RNTO x", []int{StatusFileUnavailable}},
+			{"RETR f", []int{StatusAboutToSend, StatusTransfertAborted}},
+		}},
+	} {
+		c, done := pipeServe(&Server{Driver: &DiskDriver{Root: dir}, LenientReplies: tt.lenient})
+		for _, step := range tt.steps {
+			c.Cmd(step.cmd)
+			for _, code := range step.codes {
+				if _, msg, err := c.ReadResponse(code); err != nil {
+					t.Errorf("lenient %v, %s: %s (%v)", tt.lenient, step.cmd, msg, err)
+				}
+			}
+		}
+		c.Cmd("MKD e")
+		if _, msg, err := c.ReadResponse(StatusPathCreated); err != nil || msg != `"/e" created.` {
+			t.Errorf("MKD: %s (%v)", msg, err)
+		}
+		os.Remove(filepath.Join(dir, "e"))
+		c.Cmd("QUIT")
+		c.ReadResponse(StatusClosing)
+		<-done
+	}
+}
+
+// go test -run TestErrorCode
+func TestErrorCode(t *testing.T) {
+	serverConn := &ServerConn{server: &Server{}}
+	for err, code := range map[error]int{
+		&os.PathError{Op: "write", Path: "f", Err: syscall.ENOSPC}: StatusInsufficientStorage,
+		&os.PathError{Op: "open", Path: "f", Err: syscall.EMFILE}:  StatusFileActionIgnored,
+		&os.PathError{Op: "open", Path: "f", Err: syscall.ENOENT}:  StatusFileUnavailable,
+	} {
+		if got := serverConn.errorCode(err); got != code {
+			t.Errorf("%v: %d, want %d", err, got, code)
+		}
+	}
+	serverConn.server.LenientReplies = true
+	if got := serverConn.errorCode(syscall.ENOSPC); got != StatusFileUnavailable {
+		t.Errorf("lenient: %d", got)
+	}
+}
@@ -0,0 +1,135 @@
+package ftplib
+
+import (
+	"io"
+	"net"
+	"time"
+)
+
+// DefaultRetryBackoff is the wait before the second attempt of an
+// operation, unless RetryPolicy sets it.
+const DefaultRetryBackoff = 500 * time.Millisecond
+
+// RetryPolicy retries the operations failing transiently: commands refused
+// with a 4xx reply, and transfers whose data connection fails to open or
+// breaks. Each retry waits twice as long as the one before.
+//
+// Downloads in binary resume where the connection broke, with REST.
+// Uploads with Stor and StorFrom start over if their reader is an
+// io.Seeker, and are not retried otherwise once the data is flowing;
+// neither are those of Append and StorUnique, which would store the data
+// twice.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts of an operation, the first
+	// one included; 0 and 1 do not retry.
+	MaxAttempts int
+	// Backoff is the wait before the second attempt, DefaultRetryBackoff
+	// if zero.
+	Backoff time.Duration
+	// MaxBackoff, if set, caps the waits.
+	MaxBackoff time.Duration
+}
+
+// delay returns the wait after the failed attempt, counted from 1.
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.Backoff
+	if d <= 0 {
+		d = DefaultRetryBackoff
+	}
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// SetRetryPolicy retries the operations as p sets; the zero RetryPolicy
+// does not retry.
+func (c *ClientConn) SetRetryPolicy(p RetryPolicy) {
+	c.retry = p
+}
+
+// WithRetryPolicy dials a ClientConn retrying its operations, as
+// SetRetryPolicy.
+func WithRetryPolicy(p RetryPolicy) DialOption {
+	return func(c *ClientConn) {
+		c.retry = p
+	}
+}
+
+// retries reports whether c retries its operations.
+func (c *ClientConn) retries() bool {
+	return c.retry.MaxAttempts > 1
+}
+
+// retryReply reports whether a command is to be sent again after its
+// attempt failed with err, once backoff has waited.
+func (c *ClientConn) retryReply(err error, attempt int) bool {
+	code, ok := replyCode(err)
+	return ok && transientCode(code) && c.retryAttempt(attempt)
+}
+
+// retryTransfer reports whether a transfer is to be attempted again after
+// its attempt failed with err, once backoff has waited.
+func (c *ClientConn) retryTransfer(err error, attempt int) bool {
+	return transient(err) && c.retryAttempt(attempt)
+}
+
+func (c *ClientConn) retryAttempt(attempt int) bool {
+	return attempt < c.retry.MaxAttempts && !c.restoring
+}
+
+// transient reports whether err may go away by itself: a 4xx reply, or a
+// network failure other than a timeout, the expiry of a context included.
+func transient(err error) bool {
+	if code, ok := replyCode(err); ok {
+		return transientCode(code)
+	}
+	switch e := err.(type) {
+	case net.Error:
+		return !e.Timeout()
+	}
+	return err == io.ErrUnexpectedEOF
+}
+
+// transientCode reports whether a reply of code refuses a command for the
+// time being. 421 closes the session, which only SetAutoReconnect
+// restores.
+func transientCode(code int) bool {
+	return IsTemporary(code) && code != StatusNotAvailable
+}
+
+// backoff waits before the attempt following attempt, and reports false
+// if the context of the operation is done in the meantime.
+func (c *ClientConn) backoff(attempt int) bool {
+	d := c.retry.delay(attempt)
+	c.logf("Retrying in %v", d)
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	var done <-chan struct{}
+	if c.watch != nil {
+		done = c.watch.ctx.Done()
+	}
+	select {
+	case <-timer.C:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// reopen opens the download of r again where it broke.
+func (r *response) reopen() error {
+	c := r.c
+	r.conn.Close()
+	// The reply ending the broken transfer, usually 426.
+	c.finalReply(-1, r.cmd)
+	conn, err := c.cmdDataConnFrom(r.offset, "RETR %s", r.path)
+	if err != nil {
+		return err
+	}
+	r.conn = conn
+	return nil
+}
@@ -6,21 +6,131 @@ package ftplib
 
 import (
 	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"net"
 	"os"
 	"path"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Server struct {
 	listener *net.TCPListener
 	host     string
-	rootDir  string
+
+	// Driver stores the files served. NewServer sets it to a DiskDriver
+	// serving the root directory.
+	Driver Driver
+
+	// ActiveTimeout bounds the connection to the client in active mode
+	// (PORT, EPRT). Zero means DefaultActiveTimeout.
+	ActiveTimeout time.Duration
+
+	// PassiveTimeout bounds the wait for the client to connect in passive
+	// mode. Zero means DefaultPassiveTimeout.
+	PassiveTimeout time.Duration
+
+	// DataTimeout, if set, aborts the transfers during which no data moved
+	// for that long.
+	DataTimeout time.Duration
+
+	// ControlSocket and DataSocket tune the TCP connections of the control
+	// channel and of the transfers.
+	ControlSocket, DataSocket SocketOptions
+
+	// AllowForeignData accepts data connections from other hosts than the
+	// client, as FXP transfers between servers require.
+	AllowForeignData bool
+
+	// PassivePool, if set, provides the listeners of passive mode (PASV,
+	// EPSV) instead of a new one per transfer.
+	PassivePool *PassivePool
+
+	// PassiveAddress is the IPv4 address announced in the replies to PASV,
+	// such as the public address of a server behind NAT. By default it is
+	// the address the client reached the server at.
+	PassiveAddress string
+
+	// Auth, if set, checks the passwords of the users, who must log in
+	// before using the server. Without Auth anyone is let in.
+	Auth Auth
+
+	// Hosts are the virtual hosts clients can select with HOST, by name.
+	Hosts map[string]*VirtualHost
+
+	// Notifier, if set, is told about every successful upload.
+	Notifier Notifier
+
+	// Scanner, if set, vets every upload before it is published.
+	Scanner UploadScanner
+
+	// MaxUploadSize limits the bytes accepted by a single STOR or APPE.
+	// Zero means no limit.
+	MaxUploadSize int64
+
+	// Users, if set, returns the settings overriding the server defaults
+	// for a user. It may return nil for users without overrides.
+	Users func(user string) *UserSettings
+
+	// TrustedProxies lists the load balancers allowed to announce the real
+	// client address with a PROXY protocol header. Connections from these
+	// networks must start with such a header; others are taken as is. The
+	// data connections must then come from the announced address, unless
+	// AllowForeignData is set.
+	TrustedProxies []*net.IPNet
+
+	// TLSConfig enables explicit FTPS (AUTH TLS) when it holds a
+	// certificate, or when CertManager is set.
+	TLSConfig *tls.Config
+
+	// CertManager, if set, supplies the TLS certificates, letting them be
+	// renewed while the server runs.
+	CertManager CertManager
+
+	// RequireTLSSessionReuse refuses the encrypted data connections that do
+	// not resume the TLS session of their control connection.
+	RequireTLSSessionReuse bool
+
+	// Catalogs overrides the texts of the replies per language. The "en"
+	// catalog applies unless the client selected another one with LANG.
+	Catalogs map[string]Catalog
+
+	// ListFormatters overrides, per command, the formatting of the
+	// listings found in DefaultListFormatters.
+	ListFormatters map[string]ListFormatter
+
+	// DiskCharset is the encoding of the names stored by the Driver, when
+	// not UTF-8.
+	DiskCharset Charset
+
+	// ClientCharset is the encoding of the names exchanged with the
+	// clients not sending "OPTS UTF8 ON", when not UTF-8: the legacy
+	// codepage of old clients.
+	ClientCharset Charset
+
+	// Tracer, if set, records a span for every session and command.
+	Tracer Tracer
+
+	// Metrics, if set, records the latency and reply code of every command.
+	Metrics Metrics
+
+	// LenientReplies keeps the reply codes of former versions where they
+	// differ from the RFCs, for clients depending on them.
+	LenientReplies bool
+
+	// Quota, if set, accounts the space used by each user and refuses
+	// uploads beyond their limit.
+	Quota QuotaStore
+
+	// Privileges, if set, are dropped by ListenAndServe before serving,
+	// the listener being bound already.
+	Privileges *Privileges
 }
 
 func NewServer(addr, rootDir string) (server *Server, err error) {
@@ -35,10 +145,20 @@ func NewServer(addr, rootDir string) (server *Server, err error) {
 		return nil, err
 	}
 	host, _, _ := net.SplitHostPort(addr)
-	return &Server{listener: listener, host: host, rootDir: rootDir}, nil
+	return &Server{
+		listener: listener,
+		host:     host,
+		Driver:   &DiskDriver{Root: rootDir},
+	}, nil
 }
 
 func (server *Server) ListenAndServe() (err error) {
+	if server.Privileges != nil {
+		if err := server.Privileges.Drop(); err != nil {
+			log.Println("Dropping privileges:", err)
+			return err
+		}
+	}
 	log.Println("Server start.")
 	for {
 		conn, err := server.listener.AcceptTCP()
@@ -46,21 +166,30 @@ func (server *Server) ListenAndServe() (err error) {
 			log.Println(err)
 			return err
 		}
+		if err := server.ControlSocket.apply(conn); err != nil {
+			log.Println(err)
+		}
 
 		serverConn := &ServerConn{
-			conn:   conn,
-			reader: bufio.NewReader(conn),
-			writer: bufio.NewWriter(conn),
-			prefix: server.rootDir,
-			host:   server.host,
+			conn:       conn,
+			reader:     bufio.NewReader(conn),
+			writer:     bufio.NewWriter(conn),
+			cwd:        "/",
+			host:       server.host,
+			server:     server,
+			remoteAddr: conn.RemoteAddr(),
 		}
 
-		log.Println(conn.RemoteAddr().String(), "connected.")
-
 		go serverConn.Serve()
 	}
 }
 
+// Addr returns the address the server listens on, with the port chosen by
+// the system when NewServer was given port 0.
+func (server *Server) Addr() net.Addr {
+	return server.listener.Addr()
+}
+
 func (server *Server) Stop() (err error) {
 	if server.listener != nil {
 		return server.listener.Close()
@@ -69,24 +198,59 @@ func (server *Server) Stop() (err error) {
 }
 
 type ServerConn struct {
-	conn             *net.TCPConn
+	conn             net.Conn
 	reader           *bufio.Reader
 	writer           *bufio.Writer
 	dataConn         DataConn
-	prefix, host, rn string
+	cwd, host, rn    string
+	user, copySource string
+	clientName, lang string
+	vhost            *VirtualHost
+	loggedIn         bool
+	utf8             bool
+	restart          int64 // offset set by REST for the next command
+	tls              *tls.Config
+	sessionDriver    Driver // given by a DriverAuth
+	pbszSet          bool
+	protected        bool
+	facts            []string
+	listArgs         map[string]string
+	remoteAddr       net.Addr
+	verb             string // command being served
+	cmdStart         time.Time
+	replyCode        int
+	ctx, cmdCtx      context.Context
+	cancel           context.CancelFunc // ends ctx with the session
+	session          *Session
+	sessionSpan      Span
+	cmdSpan          Span
+	server           *Server
+}
+
+// User returns the name the client logged in with.
+func (serverConn *ServerConn) User() string {
+	return serverConn.user
+}
+
+// ClientName returns the client software announced with CLNT, if any.
+func (serverConn *ServerConn) ClientName() string {
+	return serverConn.clientName
+}
+
+// RemoteAddr returns the address of the client, as announced by a trusted
+// proxy if the server sits behind one.
+func (serverConn *ServerConn) RemoteAddr() net.Addr {
+	return serverConn.remoteAddr
 }
 
 func (serverConn *ServerConn) Close() {
 	serverConn.conn.Close()
-	if serverConn.dataConn != nil {
-		serverConn.dataConn.Close()
-		serverConn.dataConn = nil
-	}
+	serverConn.closeDataConn()
 	log.Println("Closed one connection.")
 }
 
 func (serverConn *ServerConn) cmd(msg string, v ...interface{}) (n int) {
-	n, err := serverConn.writer.WriteString(msg + "\r\n")
+	n, err := serverConn.writer.WriteString(serverConn.encodeClient(msg) + "\r\n")
 	if err != nil {
 		log.Println(err)
 		serverConn.Close()
@@ -97,40 +261,259 @@ func (serverConn *ServerConn) cmd(msg string, v ...interface{}) (n int) {
 }
 
 func (serverConn *ServerConn) sendCodeLine(code int, msg string) {
+	serverConn.replied(code)
 	serverConn.cmd(fmt.Sprintf("%d %s", code, msg))
 }
 
 func (serverConn *ServerConn) sendStatusText(code int) {
-	serverConn.sendCodeLine(code, Message(code))
+	serverConn.reply(code, "")
 }
 
 func (serverConn *ServerConn) sendData(data []byte) {
 	if serverConn.dataConn != nil {
-		n, _ := serverConn.dataConn.Write(data)
-		serverConn.dataConn.Close()
-		msg := fmt.Sprintf("Closing data connection, sent %d bytes.", n)
-		serverConn.sendCodeLine(StatusClosingDataConnection, msg)
+		var n int
+		conn, err := serverConn.openDataConn()
+		if err == nil {
+			n, err = conn.Write(data)
+		}
+		serverConn.setAttribute(AttrBytes, n)
+		serverConn.closeDataConn()
+		if err != nil {
+			serverConn.sendCodeLine(StatusTransfertAborted, fmt.Sprint(err))
+			return
+		}
+		serverConn.reply(StatusClosingDataConnection, "data", n)
 	} else {
 		serverConn.sendStatusText(StatusTransfertAborted)
 	}
 }
 
+// dataWriter records the failure of the data connection it writes to, to
+// tell it from a failure of the Driver.
+type dataWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (d *dataWriter) Write(p []byte) (int, error) {
+	n, err := d.w.Write(p)
+	if err != nil {
+		d.err = err
+	}
+	return n, err
+}
+
+// retr streams the file p from offset over the data connection. A client
+// closing or resetting the data connection midway stops the transfer at
+// once with a 426, and the session goes on.
+func (serverConn *ServerConn) retr(p string, offset int64) {
+	driver := serverConn.driver()
+	var size int64
+	if f, err := driver.Stat(p); err == nil {
+		if offset > f.Size() {
+			serverConn.reply(StatusBadRestart, "rest", offset)
+			return
+		}
+		size = f.Size() - offset
+	}
+	r, err := driver.Open(p, offset)
+	if err != nil {
+		serverConn.fileError(err)
+		return
+	}
+	defer r.Close()
+	serverConn.reply(StatusAboutToSend, "retr", size)
+	if serverConn.dataConn == nil {
+		serverConn.sendStatusText(StatusTransfertAborted)
+		return
+	}
+
+	var n int64
+	conn, err := serverConn.openDataConn()
+	w := &dataWriter{w: conn}
+	if err == nil {
+		n, err = io.Copy(w, r)
+	}
+	serverConn.setAttribute(AttrBytes, n)
+	serverConn.closeDataConn()
+	switch {
+	case err == nil:
+		serverConn.reply(StatusClosingDataConnection, "data", n)
+	case w.err != nil || conn == nil:
+		log.Println("Transfer aborted:", err)
+		serverConn.sendCodeLine(StatusTransfertAborted, fmt.Sprint(err))
+	default:
+		log.Println(err)
+		serverConn.sendCodeLine(StatusActionAborted, fmt.Sprint(err))
+	}
+}
+
+// transferParam answers MODE or STRU: the server only implements the
+// default value, and refuses the other values defined by RFC 959.
+func (serverConn *ServerConn) transferParam(params []string, supported, known, variant string) {
+	switch value := strings.ToUpper(strings.Join(params, " ")); {
+	case value == supported:
+		serverConn.reply(StatusCommandOK, variant)
+	case len(value) == 1 && strings.Contains(known, value):
+		serverConn.sendStatusText(StatusNotImplementedParameter)
+	default:
+		serverConn.sendStatusText(StatusBadArguments)
+	}
+}
+
+var errForeignDataPeer = errors.New("data connection from another host than the client")
+
+// openDataConn waits for the data connection of a transfer and checks that
+// it comes from the client. Unless AllowForeignData is set, a connection
+// from elsewhere is refused, so that no other host can steal or inject the
+// data of a passive transfer. Behind a trusted proxy the client is the one
+// announced by its PROXY protocol header, not the proxy.
+func (serverConn *ServerConn) openDataConn() (DataConn, error) {
+	conn := serverConn.dataConn
+	// Writing nothing waits until the connection is established.
+	if _, err := conn.Write(nil); err != nil {
+		return nil, err
+	}
+	peer, _ := conn.RemoteAddr().(*net.TCPAddr)
+	client, _ := serverConn.RemoteAddr().(*net.TCPAddr)
+	log.Println("Data connection from", conn.RemoteAddr())
+	if peer != nil && client != nil && !peer.IP.Equal(client.IP) && !serverConn.server.AllowForeignData {
+		return nil, errForeignDataPeer
+	}
+	if timeout := serverConn.server.DataTimeout; timeout > 0 {
+		conn = &idleConn{DataConn: conn, timeout: timeout}
+	}
+	if rate := serverConn.settings().RateLimit; rate > 0 {
+		conn = &rateLimitedConn{DataConn: conn, rate: rate}
+	}
+	return conn, nil
+}
+
+// idleConn fails the transfers stalled for longer than timeout.
+type idleConn struct {
+	DataConn
+	timeout time.Duration
+}
+
+func (c *idleConn) Read(p []byte) (int, error) {
+	c.SetReadDeadline(time.Now().Add(c.timeout))
+	return c.DataConn.Read(p)
+}
+
+func (c *idleConn) Write(p []byte) (int, error) {
+	c.SetWriteDeadline(time.Now().Add(c.timeout))
+	return c.DataConn.Write(p)
+}
+
+// closeDataConn closes the data connection, which serves a single transfer.
+// passiveHost returns the address announced for passiveConn in the reply to
+// PASV: the PassiveAddress of the server, else the IPv4 address the client
+// reached the server at, else the one passiveConn listens on.
+func (serverConn *ServerConn) passiveHost(passiveConn *PassiveConn) string {
+	if addr := serverConn.server.PassiveAddress; addr != "" {
+		return addr
+	}
+	if local, ok := serverConn.conn.LocalAddr().(*net.TCPAddr); ok {
+		if ip := local.IP.To4(); ip != nil && !ip.IsUnspecified() {
+			return ip.String()
+		}
+	}
+	return passiveConn.Host()
+}
+
+func (serverConn *ServerConn) closeDataConn() {
+	if serverConn.dataConn != nil {
+		serverConn.dataConn.Close()
+		serverConn.dataConn = nil
+	}
+}
+
+// listDir returns the entries of the directory p, with the targets of its
+// symbolic links when the driver can resolve them.
+func (serverConn *ServerConn) listDir(p string) ([]os.FileInfo, error) {
+	d := serverConn.driver()
+	items, err := d.ReadDir(p)
+	if err != nil {
+		return nil, err
+	}
+	for i, item := range items {
+		if item.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		target, _ := readlink(d, path.Join(p, item.Name()))
+		items[i] = &linkInfo{FileInfo: item, target: target}
+	}
+	return items, nil
+}
+
+// parsingPath returns the path named by params with the semantics of TVFS
+// (RFC 3659): "/" separated, absolute from the root of the served tree or
+// relative to the working directory, and never above the root.
 func (serverConn *ServerConn) parsingPath(params []string) string {
 	p := strings.Join(params, " ")
-	if strings.HasPrefix(p, "/") {
-		p = path.Join(".", p)
-	} else {
-		p = path.Join(serverConn.prefix, p)
+	if !strings.HasPrefix(p, "/") {
+		p = path.Join(serverConn.cwd, p)
+	}
+	return path.Clean("/" + p)
+}
+
+// validArgs reports whether params are free of CR, LF and NUL, which would
+// split the replies echoing a path, or name surprising files on disk.
+func validArgs(params []string) bool {
+	for _, param := range params {
+		if strings.ContainsAny(param, "\r\n\x00") {
+			return false
+		}
+	}
+	return true
+}
+
+// setRestart sets the offset of the next transfer, as requested by REST.
+// "REST 0" cancels a previous REST.
+func (serverConn *ServerConn) setRestart(params []string) {
+	offset, err := strconv.ParseInt(strings.Join(params, " "), 10, 64)
+	if err != nil || offset < 0 {
+		serverConn.sendStatusText(StatusBadArguments)
+		return
+	}
+	serverConn.restart = offset
+	serverConn.reply(StatusRequestFilePending, "rest", offset)
+}
+
+// changeDir makes the directory p the working directory.
+func (serverConn *ServerConn) changeDir(p string) {
+	f, err := serverConn.driver().Stat(p)
+	if err != nil || !f.IsDir() {
+		serverConn.sendStatusText(StatusFileUnavailable)
+		return
 	}
-	return p
+	serverConn.cwd = p
+	serverConn.reply(StatusRequestedFileActionOK, "cwd", serverConn.cwd)
+}
+
+// quotePath doubles the quotes of p, for the quoted paths of 257 replies.
+func quotePath(p string) string {
+	return strings.Replace(p, `"`, `""`, -1)
 }
 
 func (serverConn *ServerConn) Serve() {
+	if serverConn.server.trustsProxy(serverConn.conn.RemoteAddr()) {
+		if err := serverConn.acceptProxy(); err != nil {
+			log.Println("PROXY protocol:", err)
+			serverConn.Close()
+			return
+		}
+	}
+	log.Println(serverConn.RemoteAddr().String(), "connected.")
 	log.Println("Connection established: start server.")
+	serverConn.startSession()
+	defer serverConn.endSession()
+	defer serverConn.setSessionDriver(nil)
 	serverConn.sendStatusText(StatusReady)
 
 loop:
 	for {
+		serverConn.endCommand()
 		cmdLine, err := serverConn.reader.ReadString('\n')
 		log.Print(cmdLine)
 		if err != nil {
@@ -142,168 +525,250 @@ loop:
 			serverConn.Close()
 			break loop
 		}
+		if cmdLine, err = serverConn.decodeClient(cmdLine); err != nil {
+			serverConn.sendStatusText(StatusBadArguments)
+			continue
+		}
 		params := strings.Split(strings.TrimSpace(cmdLine), " ")
-		switch strings.ToUpper(params[0]) {
+		verb := strings.ToUpper(params[0])
+		// The offset of REST only applies to the command right after it.
+		restart := serverConn.restart
+		if verb != REST {
+			serverConn.restart = 0
+		}
+		serverConn.startCommand(verb, params[1:])
+		if serverConn.loginRequired(verb) {
+			serverConn.sendStatusText(StatusNotLoggedIn)
+			continue
+		}
+		if (pathVerbs[verb] || verb == SITE) && !validArgs(params[1:]) {
+			serverConn.sendStatusText(StatusBadArguments)
+			continue
+		}
+		switch verb {
+
+		case ALLO:
+			// Storage needs no reservation ahead of STOR.
+			serverConn.reply(StatusCommandNotImplemented, "allo")
+
+		case MODE:
+			serverConn.transferParam(params[1:], "S", "BC", "mode")
+
+		case STRU:
+			serverConn.transferParam(params[1:], "F", "RP", "stru")
 
 		case USER:
+			serverConn.user = strings.Join(params[1:], " ")
+			serverConn.loggedIn = false
+			serverConn.setSessionDriver(nil)
+			serverConn.setSessionUser("")
 			serverConn.sendStatusText(StatusUserOK)
 
+		case HOST:
+			serverConn.selectHost(params[1:])
+
+		case AUTH:
+			serverConn.authTLS(params[1:])
+
+		case CLNT:
+			serverConn.clientName = strings.Join(params[1:], " ")
+			serverConn.setSessionClient(serverConn.clientName)
+			log.Println(serverConn.RemoteAddr(), "client:", serverConn.clientName)
+			serverConn.sendStatusText(StatusCommandOK)
+
 		case PASS:
-			serverConn.sendStatusText(StatusLoggedIn)
+			serverConn.login(strings.Join(params[1:], " "))
 
-		case PWD:
-			serverConn.sendCodeLine(StatusPathCreated,
-				fmt.Sprintf("\"%s\" is current directory.", serverConn.prefix))
+		case PWD, XPWD:
+			serverConn.reply(StatusPathCreated, "pwd", quotePath(serverConn.cwd))
 
-		case CWD:
-			p := serverConn.parsingPath(params[1:])
-			f, err := os.Stat(p)
-			if f.IsDir() && err == nil {
-				serverConn.prefix = p
-				serverConn.sendCodeLine(StatusRequestedFileActionOK,
-					"Directory changed to "+serverConn.prefix)
-			} else {
-				serverConn.sendStatusText(StatusFileUnavailable)
-			}
+		case CWD, XCWD:
+			serverConn.changeDir(serverConn.parsingPath(params[1:]))
+
+		case CDUP, XCUP:
+			serverConn.changeDir(path.Dir(serverConn.cwd))
 
 		case DELE:
 			p := serverConn.parsingPath(params[1:])
-			_, err := os.Stat(p)
+			f, err := serverConn.driver().Stat(p)
 			if err != nil {
+				serverConn.sendStatusText(serverConn.errorCode(err))
+			} else if f.IsDir() && !serverConn.lenient() {
 				serverConn.sendStatusText(StatusFileUnavailable)
 			} else {
-				os.Remove(p)
-				serverConn.sendCodeLine(StatusRequestedFileActionOK, "File deleted.")
+				release := serverConn.releaseQuota(p)
+				if err := serverConn.driver().Remove(p); err != nil {
+					serverConn.fileError(err)
+				} else {
+					release()
+					serverConn.reply(StatusRequestedFileActionOK, "dele")
+				}
 			}
 
+		case PORT, EPRT:
+			serverConn.active(verb, params[1:])
+
 		case EPSV:
-			passiveConn, err := NewPassiveConn(serverConn.host)
+			passiveConn, err := newPassiveConn(serverConn.host, serverConn.server.PassivePool, serverConn.server.PassiveTimeout, serverConn.server.DataSocket)
 			if err != nil {
 				serverConn.sendStatusText(StatusCanNotOpenDataConnection)
 			} else {
-				serverConn.dataConn = passiveConn
+				serverConn.setDataConn(passiveConn)
 				serverConn.sendCodeLine(StatusExtendedPassiveMode,
 					fmt.Sprintf("Entering Extended Passive Mode (|||%d|)", passiveConn.Port()))
 			}
 
 		case SIZE:
 			p := serverConn.parsingPath(params[1:])
-			f, err := os.Stat(p)
-			if f.IsDir() && err == nil {
+			f, err := serverConn.driver().Stat(p)
+			if err != nil {
+				serverConn.sendStatusText(serverConn.errorCode(err))
+			} else if f.IsDir() && !serverConn.lenient() {
+				serverConn.sendStatusText(StatusFileUnavailable)
+			} else if f.IsDir() {
 				serverConn.sendCodeLine(StatusFile, "1024")
 			} else {
 				serverConn.sendCodeLine(StatusFile, strconv.Itoa(int(f.Size())))
 			}
 
-		case LIST:
-			serverConn.sendCodeLine(StatusAboutToSend,
-				"Opening ASCII mode data connection for file list")
-			d, _ := os.Open(serverConn.prefix)
-			items, _ := d.Readdir(-1)
-			info := ListDetailed(items)
-			serverConn.sendData(info)
+		case FEAT:
+			serverConn.feat()
+
+		case HELP:
+			serverConn.help()
+
+		case LANG:
+			serverConn.setLang(params[1:])
 
-		case MKD:
+		case LIST, NLST, MLSD:
+			serverConn.list(verb, params[1:])
+
+		case MLST:
+			serverConn.mlst(serverConn.parsingPath(params[1:]))
+
+		case MKD, XMKD:
 			p := serverConn.parsingPath(params[1:])
-			err = os.Mkdir(p, 0777)
+			err = serverConn.driver().MakeDir(p)
 			if err == nil {
-				serverConn.sendStatusText(StatusPathCreated)
+				serverConn.reply(StatusPathCreated, "mkd", quotePath(p))
 			} else {
-				serverConn.sendCodeLine(StatusFileUnavailable, fmt.Sprint(err))
+				serverConn.fileError(err)
 			}
 
 		case NOOP:
 			serverConn.sendStatusText(StatusCommandOK)
 
+		case OPTS:
+			serverConn.opts(params[1:])
+
+		case PBSZ:
+			serverConn.pbsz(params[1:])
+
+		case PROT:
+			serverConn.prot(params[1:])
+
 		case PASV:
-			passiveConn, err := NewPassiveConn(serverConn.host)
+			passiveConn, err := newPassiveConn(serverConn.host, serverConn.server.PassivePool, serverConn.server.PassiveTimeout, serverConn.server.DataSocket)
 			if err != nil {
 				serverConn.sendStatusText(StatusCanNotOpenDataConnection)
 			} else {
-				serverConn.dataConn = passiveConn
+				serverConn.setDataConn(passiveConn)
 				port := passiveConn.Port()
 				x := port / 256
 				y := port - x*256
-				quad := strings.ReplaceAll(passiveConn.Host(), ".", ",")
+				quad := strings.ReplaceAll(serverConn.passiveHost(passiveConn), ".", ",")
 				msg := fmt.Sprintf("Entering Passive Mode (%s,%d,%d)", quad, x, y)
-				serverConn.sendCodeLine(227, msg)
+				serverConn.sendCodeLine(StatusPassiveMode, msg)
 			}
 
 		case QUIT:
+			serverConn.sendStatusText(StatusClosing)
 			serverConn.Close()
 			break loop
 
+		case REST:
+			serverConn.setRestart(params[1:])
+
 		case RETR:
-			p := serverConn.parsingPath(params[1:])
-			data, err := ioutil.ReadFile(p)
-			if err != nil {
-				serverConn.sendCodeLine(StatusFileUnavailable, fmt.Sprint(err))
-			} else {
-				bytes := strconv.Itoa(len(data))
-				serverConn.sendCodeLine(150, "Data transfer starting "+bytes+"bytes")
-				serverConn.sendData([]byte(data))
+			if !serverConn.hasDataConn() {
+				break
 			}
+			serverConn.retr(serverConn.parsingPath(params[1:]), restart)
 
 		case RMD, XRMD:
 			p := serverConn.parsingPath(params[1:])
-			f, err := os.Stat(p)
-			if f.IsDir() && err == nil {
-				err := os.RemoveAll(p)
+			f, err := serverConn.driver().Stat(p)
+			if err == nil && f.IsDir() {
+				release := serverConn.releaseQuota(p)
+				err := serverConn.driver().RemoveDir(p)
 				if err != nil {
-					serverConn.sendCodeLine(StatusFileUnavailable, fmt.Sprint(err))
+					serverConn.fileError(err)
 				} else {
-					serverConn.sendCodeLine(StatusRequestedFileActionOK, "Directory deleted.")
+					release()
+					serverConn.reply(StatusRequestedFileActionOK, "rmd")
 				}
 			} else {
 				serverConn.sendStatusText(StatusFileUnavailable)
 			}
 
 		case RNFR:
-			serverConn.rn = serverConn.parsingPath(params[1:])
+			p := serverConn.parsingPath(params[1:])
+			if _, err := serverConn.driver().Stat(p); err != nil && !serverConn.lenient() {
+				serverConn.rn = ""
+				serverConn.sendStatusText(serverConn.errorCode(err))
+				break
+			}
+			serverConn.rn = p
 			serverConn.sendStatusText(StatusRequestFilePending)
 
 		case RNTO:
+			if serverConn.rn == "" && !serverConn.lenient() {
+				serverConn.sendStatusText(StatusBadSequence)
+				break
+			}
 			p := serverConn.parsingPath(params[1:])
-			err := os.Rename(serverConn.rn, p)
+			release := serverConn.releaseQuota(p)
+			err := serverConn.driver().Rename(serverConn.rn, p)
+			serverConn.rn = ""
 			if err != nil {
-				serverConn.sendCodeLine(StatusFileUnavailable, fmt.Sprint(err))
+				serverConn.fileError(err)
 			} else {
-				serverConn.sendCodeLine(StatusRequestedFileActionOK, "File renamed.")
+				release()
+				serverConn.reply(StatusRequestedFileActionOK, "rnto")
 			}
 
+		case SITE:
+			serverConn.site(params[1:])
+
 		case SYST:
 			serverConn.sendStatusText(StatusName)
 
+		case STAT:
+			serverConn.stat(params[1:])
+
 		case STOR:
 			p := serverConn.parsingPath(params[1:])
-			serverConn.sendCodeLine(150, "Data transfer starting.")
-			file, err := os.OpenFile(p, os.O_WRONLY|os.O_TRUNC|os.O_CREATE,
-				0666)
-			if err != nil {
-				serverConn.sendStatusText(450)
-			}
-			n, _ := io.Copy(file, serverConn.dataConn)
+			serverConn.stor(p, false, restart)
 
-			if n >= 0 {
-				serverConn.sendCodeLine(226, "OK, received "+
-					strconv.Itoa(int(n))+" bytes.")
-			} else {
-				serverConn.sendStatusText(550)
-			}
-			file.Close()
+		case APPE:
+			p := serverConn.parsingPath(params[1:])
+			serverConn.stor(p, true, restart)
 
 		case TYPE:
-			param := strings.ToUpper(params[1])
+			param := ""
+			if len(params) > 1 {
+				param = strings.ToUpper(params[1])
+			}
 			if param == "A" {
-				serverConn.sendCodeLine(StatusCommandOK, "Type set to ASCII.")
+				serverConn.reply(StatusCommandOK, "type.a")
 			} else if param == "I" {
-				serverConn.sendCodeLine(StatusCommandOK, "Type set to binary.")
+				serverConn.reply(StatusCommandOK, "type.i")
 			} else {
-				serverConn.sendCodeLine(StatusBadArguments, "Invalid type.")
+				serverConn.reply(StatusBadArguments, "type")
 			}
 
 		default:
-			serverConn.sendStatusText(StatusCommandNotImplemented)
+			serverConn.unknownCommand(verb)
 
 		}
 	}
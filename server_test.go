@@ -0,0 +1,260 @@
+package ftplib
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// pipeServe serves a session of server over an in-memory connection. It
+// returns the client side, past the greeting, and a channel closed once
+// the session ended.
+func pipeServe(server *Server) (*textproto.Conn, <-chan struct{}) {
+	client, conn := net.Pipe()
+	serverConn := &ServerConn{
+		conn:       conn,
+		reader:     bufio.NewReader(conn),
+		writer:     bufio.NewWriter(conn),
+		cwd:        "/",
+		server:     server,
+		remoteAddr: conn.RemoteAddr(),
+	}
+	done := make(chan struct{})
+	go func() {
+		serverConn.Serve()
+		close(done)
+	}()
+	c := textproto.NewConn(client)
+	c.ReadResponse(StatusReady)
+	return c, done
+}
+
+// go test -run TestTransferParams
+func TestTransferParams(t *testing.T) {
+	c, done := pipeServe(&Server{Driver: &DiskDriver{Root: "."}})
+	for cmd, code := range map[string]int{
+		"MODE S":   StatusCommandOK,
+		"MODE b":   StatusNotImplementedParameter,
+		"MODE X":   StatusBadArguments,
+		"STRU F":   StatusCommandOK,
+		"STRU R":   StatusNotImplementedParameter,
+		"STRU":     StatusBadArguments,
+		"ALLO 512": StatusCommandNotImplemented,
+	} {
+		c.Cmd(cmd)
+		if _, msg, err := c.ReadResponse(code); err != nil {
+			t.Errorf("%s: %s (%v)", cmd, msg, err)
+		}
+	}
+	c.Cmd("QUIT")
+	c.ReadResponse(StatusClosing)
+	<-done
+}
+
+// go test -run TestTVFSPaths
+func TestTVFSPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftplib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "a", "b"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	c, done := pipeServe(&Server{Driver: &DiskDriver{Root: dir}})
+	for _, step := range []struct{ cmd, pwd string }{
+		{"CWD /a/b", "/a/b"},
+		{"CDUP", "/a"},
+		{"CWD b", "/a/b"},
+		{"CWD //a//b/../", "/a"},
+		{"XCWD ../..", "/"},
+		{"CDUP", "/"},
+		{"CWD a\\b", "/"},
+	} {
+		code := StatusRequestedFileActionOK
+		if step.cmd == "CWD a\\b" {
+			code = StatusFileUnavailable
+		}
+		c.Cmd(step.cmd)
+		if _, msg, err := c.ReadResponse(code); err != nil {
+			t.Errorf("%s: %s (%v)", step.cmd, msg, err)
+		}
+		c.Cmd("PWD")
+		_, msg, err := c.ReadResponse(StatusPathCreated)
+		if err != nil || !strings.HasPrefix(msg, `"`+step.pwd+`"`) {
+			t.Errorf("%s: PWD = %s (%v), want %q", step.cmd, msg, err, step.pwd)
+		}
+	}
+	c.Cmd("FEAT")
+	if _, msg, err := c.ReadResponse(StatusSystem); err != nil || !strings.Contains(msg, " TVFS") {
+		t.Errorf("FEAT = %s (%v), want TVFS", msg, err)
+	}
+	c.Cmd("QUIT")
+	c.ReadResponse(StatusClosing)
+	<-done
+}
+
+// go test -run TestControlCharsInPaths
+func TestControlCharsInPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftplib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c, done := pipeServe(&Server{Driver: &DiskDriver{Root: dir}})
+	for _, cmd := range []string{
+		"MKD a\rb",
+		"CWD /\r200 OK",
+		"RNFR a\x00b",
+		"SITE CPTO a\rb",
+	} {
+		c.Cmd(cmd)
+		if _, msg, err := c.ReadResponse(StatusBadArguments); err != nil {
+			t.Errorf("%q: %s (%v)", cmd, msg, err)
+		}
+	}
+	if names, _ := ioutil.ReadDir(dir); len(names) != 0 {
+		t.Errorf("files created: %v", names)
+	}
+	c.Cmd("QUIT")
+	c.ReadResponse(StatusClosing)
+	<-done
+}
+
+// go test -run TestRestart
+func TestRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftplib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "f"), []byte("hello world"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	server, err := NewServer("127.0.0.1:0", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	go server.ListenAndServe()
+	c, err := Connect(server.listener.Addr().String(), "user", "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Quit()
+
+	retr := func(offset uint64) string {
+		r, err := c.RetrFrom("f", offset)
+		if err != nil {
+			t.Fatalf("RETR from %d: %v", offset, err)
+		}
+		defer r.Close()
+		data, _ := ioutil.ReadAll(r)
+		return string(data)
+	}
+	if got := retr(6); got != "world" {
+		t.Errorf("RETR from 6 = %q", got)
+	}
+	// The offset applies to the next transfer only.
+	if got := retr(0); got != "hello world" {
+		t.Errorf("RETR after a restarted one = %q", got)
+	}
+	if err := c.StorFrom("f", strings.NewReader("!"), 11); err != nil {
+		t.Error(err)
+	}
+	if err := c.StorFrom("f", strings.NewReader("?"), 5); err == nil {
+		t.Error("STOR from an offset other than the size should fail")
+	}
+	if _, err := c.RetrFrom("f", 100); err == nil {
+		t.Error("RETR beyond the end should fail")
+	}
+	if got := retr(0); got != "hello world!" {
+		t.Errorf("RETR after refused restarts = %q", got)
+	}
+
+	for cmd, code := range map[string]int{
+		"REST -1": StatusBadArguments,
+		"REST x":  StatusBadArguments,
+		"REST 0":  StatusRequestFilePending,
+	} {
+		if _, msg, err := c.cmd(code, cmd); err != nil {
+			t.Errorf("%s: %s (%v)", cmd, msg, err)
+		}
+	}
+	// An unrelated command clears the offset too.
+	c.cmd(StatusRequestFilePending, "REST 3")
+	c.NoOp()
+	if got := retr(0); got != "hello world!" {
+		t.Errorf("RETR after REST and NOOP = %q", got)
+	}
+}
+
+// go test -run TestAbortedTransfers
+func TestAbortedTransfers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftplib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	f, err := os.Create(filepath.Join(dir, "big"))
+	if err == nil {
+		err = f.Truncate(1 << 30)
+		f.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := NewServer("127.0.0.1:0", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	go server.ListenAndServe()
+	c, err := Connect(server.listener.Addr().String(), "user", "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Quit()
+
+	// reset closes conn with a TCP reset, as a client killed midway would.
+	reset := func(conn net.Conn) {
+		conn.(*net.TCPConn).SetLinger(0)
+		conn.Close()
+	}
+
+	conn, err := c.cmdDataConnFrom(0, "RETR big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Read(make([]byte, 1024)); err != nil {
+		t.Fatal(err)
+	}
+	reset(conn)
+	if _, _, err := c.conn.ReadResponse(StatusTransfertAborted); err != nil {
+		t.Errorf("RETR aborted: %v", err)
+	}
+	if err := c.NoOp(); err != nil {
+		t.Fatalf("session lost after an aborted RETR: %v", err)
+	}
+
+	conn, err = c.cmdDataConnFrom(0, "STOR up")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("partial"))
+	reset(conn)
+	if _, _, err := c.conn.ReadResponse(StatusTransfertAborted); err != nil {
+		t.Errorf("STOR aborted: %v", err)
+	}
+	if err := c.NoOp(); err != nil {
+		t.Fatalf("session lost after an aborted STOR: %v", err)
+	}
+	if items, _ := ioutil.ReadDir(dir); len(items) != 1 {
+		t.Errorf("aborted upload left %d files", len(items)-1)
+	}
+}
@@ -0,0 +1,111 @@
+package ftplib
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"sync"
+)
+
+// Session describes the session of a client. The contexts the server hands
+// to drivers, auths and hooks carry it, and are cancelled when it ends.
+type Session struct {
+	id                    string
+	remoteAddr, localAddr net.Addr
+
+	mu           sync.Mutex
+	user, client string
+}
+
+// ID returns the random identifier of the session, for logs and traces.
+func (s *Session) ID() string {
+	return s.id
+}
+
+// User returns the name of the user logged in, "" before logging in.
+func (s *Session) User() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.user
+}
+
+// Client returns the client software announced with CLNT, if any.
+func (s *Session) Client() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.client
+}
+
+// RemoteAddr returns the address of the client, as announced by a trusted
+// proxy if the server sits behind one.
+func (s *Session) RemoteAddr() net.Addr {
+	return s.remoteAddr
+}
+
+// LocalAddr returns the address the client connected to.
+func (s *Session) LocalAddr() net.Addr {
+	return s.localAddr
+}
+
+type sessionKey struct{}
+
+// SessionFromContext returns the session a context of the server carries.
+func SessionFromContext(ctx context.Context) (*Session, bool) {
+	s, ok := ctx.Value(sessionKey{}).(*Session)
+	return s, ok
+}
+
+// ContextDriver is implemented by drivers wanting the context of the
+// session calling them, to act per user, to trace their calls or to give
+// up on those of sessions that ended. The server calls WithContext before
+// each use, and uses the Driver it returns.
+type ContextDriver interface {
+	Driver
+	WithContext(ctx context.Context) Driver
+}
+
+// ContextAuth is implemented by auths wanting the context of the session
+// logging in. The server then calls CheckPasswdContext instead of
+// CheckPasswd.
+type ContextAuth interface {
+	Auth
+	CheckPasswdContext(ctx context.Context, user, password string) (bool, error)
+}
+
+// newSessionID returns a random session identifier.
+func newSessionID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Context returns the context of the command being served, or of the
+// session between commands.
+func (serverConn *ServerConn) Context() context.Context {
+	if serverConn.cmdCtx != nil {
+		return serverConn.cmdCtx
+	}
+	if serverConn.ctx != nil {
+		return serverConn.ctx
+	}
+	return context.Background()
+}
+
+// setSessionUser records the user logged in, "" when logging in anew.
+func (serverConn *ServerConn) setSessionUser(user string) {
+	if s := serverConn.session; s != nil {
+		s.mu.Lock()
+		s.user = user
+		s.mu.Unlock()
+	}
+}
+
+// setSessionClient records the client software announced with CLNT.
+func (serverConn *ServerConn) setSessionClient(client string) {
+	if s := serverConn.session; s != nil {
+		s.mu.Lock()
+		s.client = client
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,77 @@
+package ftplib
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+// contextDriver records the contexts it is given.
+type contextDriver struct {
+	Driver
+	mu   sync.Mutex
+	ctxs []context.Context
+}
+
+func (d *contextDriver) WithContext(ctx context.Context) Driver {
+	d.mu.Lock()
+	d.ctxs = append(d.ctxs, ctx)
+	d.mu.Unlock()
+	return d.Driver
+}
+
+// contextAuth records the context of the logins.
+type contextAuth struct {
+	ctx context.Context
+}
+
+func (a *contextAuth) CheckPasswd(user, password string) (bool, error) {
+	return false, nil
+}
+
+func (a *contextAuth) CheckPasswdContext(ctx context.Context, user, password string) (bool, error) {
+	a.ctx = ctx
+	return password == "secret", nil
+}
+
+// go test -run TestSessionContext
+func TestSessionContext(t *testing.T) {
+	driver := &contextDriver{Driver: &DiskDriver{Root: "."}}
+	auth := &contextAuth{}
+	c, done := pipeServe(&Server{Driver: driver, Auth: auth})
+	c.Cmd("CLNT tester")
+	c.ReadResponse(StatusCommandOK)
+	c.Cmd("USER joe")
+	c.ReadResponse(StatusUserOK)
+	c.Cmd("PASS secret")
+	if _, _, err := c.ReadResponse(StatusLoggedIn); err != nil {
+		t.Fatal(err)
+	}
+	c.Cmd("SIZE go.mod")
+	c.ReadResponse(StatusFile)
+	c.Cmd("QUIT")
+	c.ReadResponse(StatusClosing)
+	<-done
+
+	if auth.ctx == nil {
+		t.Fatal("CheckPasswdContext not called")
+	}
+	session, ok := SessionFromContext(auth.ctx)
+	if !ok || len(session.ID()) != 16 || session.RemoteAddr() == nil {
+		t.Fatalf("session %+v", session)
+	}
+	if session.User() != "joe" || session.Client() != "tester" {
+		t.Errorf("user %q, client %q", session.User(), session.Client())
+	}
+	if len(driver.ctxs) == 0 {
+		t.Fatal("WithContext not called")
+	}
+	for _, ctx := range driver.ctxs {
+		if s, _ := SessionFromContext(ctx); s != session {
+			t.Errorf("driver called with session %v, want %v", s, session)
+		}
+		if ctx.Err() != context.Canceled {
+			t.Error("context not cancelled after the session")
+		}
+	}
+}
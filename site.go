@@ -0,0 +1,70 @@
+package ftplib
+
+import (
+	"strings"
+)
+
+// site dispatches the sub-commands of SITE.
+func (serverConn *ServerConn) site(params []string) {
+	if len(params) == 0 {
+		serverConn.sendStatusText(StatusBadArguments)
+		return
+	}
+	switch strings.ToUpper(params[0]) {
+
+	// CPFR and CPTO copy a file on the server, the way RNFR and RNTO
+	// rename it.
+	case "CPFR":
+		p := serverConn.parsingPath(params[1:])
+		f, err := serverConn.driver().Stat(p)
+		if err != nil || f.IsDir() {
+			serverConn.sendStatusText(StatusFileUnavailable)
+			return
+		}
+		serverConn.copySource = p
+		serverConn.reply(StatusRequestFilePending, "cpfr")
+
+	case "CPTO":
+		if serverConn.copySource == "" {
+			serverConn.sendStatusText(StatusBadSequence)
+			return
+		}
+		from, to := serverConn.copySource, serverConn.parsingPath(params[1:])
+		serverConn.copySource = ""
+		if err := serverConn.copy(from, to); err != nil {
+			serverConn.fileError(err)
+			return
+		}
+		serverConn.reply(StatusRequestedFileActionOK, "cpto")
+
+	default:
+		serverConn.sendStatusText(StatusNotImplementedParameter)
+	}
+}
+
+// copy copies the file from to to, charging the new file to the session's
+// quota.
+func (serverConn *ServerConn) copy(from, to string) error {
+	driver := serverConn.driver()
+	src, err := driver.Stat(from)
+	if err != nil {
+		return err
+	}
+	var oldSize int64
+	if info, err := driver.Stat(to); err == nil {
+		oldSize = info.Size()
+	}
+
+	reservation := serverConn.reserveQuota()
+	if err := reservation.cover(src.Size() - oldSize); err != nil {
+		reservation.settle(0)
+		return err
+	}
+	err = copyFile(driver, from, to)
+	var used int64
+	if err == nil {
+		used = src.Size() - oldSize
+	}
+	reservation.settle(used)
+	return err
+}
@@ -0,0 +1,58 @@
+package ftplib
+
+import (
+	"net"
+	"time"
+)
+
+// SocketOptions tune the TCP connections of the server. The zero value
+// keeps the defaults of the system and of the net package.
+type SocketOptions struct {
+	// KeepAlive is the period of the keepalive probes. Negative disables
+	// them.
+	KeepAlive time.Duration
+
+	// Delay enables Nagle's algorithm, which the net package disables
+	// (TCP_NODELAY).
+	Delay bool
+
+	// ReadBuffer and WriteBuffer size the receive and send buffers of the
+	// socket (SO_RCVBUF, SO_SNDBUF). Long fat networks need them beyond
+	// their bandwidth-delay product for full throughput.
+	ReadBuffer, WriteBuffer int
+}
+
+// apply sets the options on conn.
+func (opts *SocketOptions) apply(conn net.Conn) error {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+	switch {
+	case opts.KeepAlive < 0:
+		if err := tcpConn.SetKeepAlive(false); err != nil {
+			return err
+		}
+	case opts.KeepAlive > 0:
+		if err := tcpConn.SetKeepAlive(true); err != nil {
+			return err
+		}
+		if err := tcpConn.SetKeepAlivePeriod(opts.KeepAlive); err != nil {
+			return err
+		}
+	}
+	if opts.Delay {
+		if err := tcpConn.SetNoDelay(false); err != nil {
+			return err
+		}
+	}
+	if opts.ReadBuffer > 0 {
+		if err := tcpConn.SetReadBuffer(opts.ReadBuffer); err != nil {
+			return err
+		}
+	}
+	if opts.WriteBuffer > 0 {
+		return tcpConn.SetWriteBuffer(opts.WriteBuffer)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package ftplib
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// go test -run TestSocketOptions
+func TestSocketOptions(t *testing.T) {
+	passiveConn, err := newPassiveConn("127.0.0.1", nil, 0, SocketOptions{
+		KeepAlive:   time.Minute,
+		Delay:       true,
+		ReadBuffer:  1 << 16,
+		WriteBuffer: 1 << 16,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer passiveConn.Close()
+	client, err := net.Dial("tcp", net.JoinHostPort(passiveConn.host, passiveConn.port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.Write([]byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := passiveConn.Read(make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&SocketOptions{KeepAlive: -1}).apply(passiveConn.conn); err != nil {
+		t.Error(err)
+	}
+
+	// Connections other than TCP are left alone.
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	if err := (&SocketOptions{ReadBuffer: 1 << 16}).apply(c1); err != nil {
+		t.Error(err)
+	}
+}
@@ -1,6 +1,7 @@
 package ftplib
 
-// Status codes, defined in RFC 959
+// Status codes, defined in RFC 959, RFC 1639 (228), RFC 2228 (security
+// extensions), RFC 2428 (229, 522) and RFC 3659.
 const (
 	StatusInitiating    = 100
 	StatusRestartMarker = 110
@@ -25,36 +26,61 @@ const (
 	StatusLoggedIn              = 230
 	StatusLoggedOut             = 231
 	StatusLogoutAck             = 232
+	StatusAuthOK                = 234
+	StatusAuthDataAccepted      = 235
 	StatusRequestedFileActionOK = 250
 	StatusPathCreated           = 257
 
 	StatusUserOK             = 331
 	StatusLoginNeedAccount   = 332
+	StatusAuthDataNeeded     = 334
+	StatusAuthDataContinue   = 335
+	StatusPasswordChallenge  = 336
 	StatusRequestFilePending = 350
 
 	StatusNotAvailable             = 421
 	StatusCanNotOpenDataConnection = 425
 	StatusTransfertAborted         = 426
 	StatusInvalidCredentials       = 430
+	StatusSecurityUnavailable      = 431
 	StatusHostUnavailable          = 434
 	StatusFileActionIgnored        = 450
 	StatusActionAborted            = 451
-	Status452                      = 452
+	StatusInsufficientStorage      = 452
+	// Deprecated: use StatusInsufficientStorage.
+	Status452 = StatusInsufficientStorage
 
 	StatusBadCommand              = 500
 	StatusBadArguments            = 501
 	StatusNotImplemented          = 502
 	StatusBadSequence             = 503
 	StatusNotImplementedParameter = 504
+	StatusBadNetworkProtocol      = 522
 	StatusNotLoggedIn             = 530
 	StatusStorNeedAccount         = 532
+	StatusProtectionDenied        = 533
+	StatusPolicyDenied            = 534
+	StatusSecurityCheckFailed     = 535
+	StatusDataProtectionLevel     = 536
+	StatusCommandProtectionLevel  = 537
 	StatusFileUnavailable         = 550
 	StatusPageTypeUnknown         = 551
 	StatusExceededStorage         = 552
 	StatusBadFileName             = 553
+	StatusBadRestart              = 554
+
+	StatusIntegrityProtected       = 631
+	StatusConfidentialityProtected = 632
+	StatusPrivacyProtected         = 633
 )
 
 var messages = map[int]string{
+	// 100
+	StatusRestartMarker: "Restart marker reply.",
+	StatusReadyMinute:   "Service ready in a few minutes.",
+	StatusAlreadyOpen:   "Data connection already open; transfer starting.",
+	StatusAboutToSend:   "File status okay; about to open data connection.",
+
 	// 200
 	StatusCommandOK:             "Command okay.",
 	StatusCommandNotImplemented: "Command not implemented, superfluous at this site.",
@@ -73,12 +99,17 @@ var messages = map[int]string{
 	StatusLoggedIn:              "User logged in, proceed.",
 	StatusLoggedOut:             "User logged out; service terminated.",
 	StatusLogoutAck:             "Logout command noted, will complete when transfer done.",
+	StatusAuthOK:                "Security data exchange complete.",
+	StatusAuthDataAccepted:      "Security data exchange completed successfully.",
 	StatusRequestedFileActionOK: "Requested file action okay, completed.",
 	StatusPathCreated:           "Path created.",
 
 	// 300
 	StatusUserOK:             "User name okay, need password.",
 	StatusLoginNeedAccount:   "Need account for login.",
+	StatusAuthDataNeeded:     "Security mechanism accepted, security data needed.",
+	StatusAuthDataContinue:   "Security data accepted, more data needed.",
+	StatusPasswordChallenge:  "Username okay, need password; challenge follows.",
 	StatusRequestFilePending: "Requested file action pending further information.",
 
 	// 400
@@ -86,10 +117,11 @@ var messages = map[int]string{
 	StatusCanNotOpenDataConnection: "Can't open data connection.",
 	StatusTransfertAborted:         "Connection closed; transfer aborted.",
 	StatusInvalidCredentials:       "Invalid username or password.",
+	StatusSecurityUnavailable:      "Need some unavailable resource to process security.",
 	StatusHostUnavailable:          "Requested host unavailable.",
 	StatusFileActionIgnored:        "Requested file action not taken.",
 	StatusActionAborted:            "Requested action aborted. Local error in processing.",
-	Status452:                      "Insufficient storage space in system.",
+	StatusInsufficientStorage:      "Insufficient storage space in system.",
 
 	// 500
 	StatusBadCommand:              "Command unrecognized.",
@@ -97,15 +129,63 @@ var messages = map[int]string{
 	StatusNotImplemented:          "Command not implemented.",
 	StatusBadSequence:             "Bad sequence of commands.",
 	StatusNotImplementedParameter: "Command not implemented for that parameter.",
+	StatusBadNetworkProtocol:      "Network protocol not supported.",
 	StatusNotLoggedIn:             "Not logged in.",
 	StatusStorNeedAccount:         "Need account for storing files.",
+	StatusProtectionDenied:        "Command protection level denied for policy reasons.",
+	StatusPolicyDenied:            "Request denied for policy reasons.",
+	StatusSecurityCheckFailed:     "Failed security check.",
+	StatusDataProtectionLevel:     "Data protection level not supported by security mechanism.",
+	StatusCommandProtectionLevel:  "Command protection level not supported by security mechanism.",
 	StatusFileUnavailable:         "File unavailable.",
 	StatusPageTypeUnknown:         "Page type unknown.",
 	StatusExceededStorage:         "Exceeded storage allocation.",
 	StatusBadFileName:             "File name not allowed.",
+	StatusBadRestart:              "Requested action not taken: invalid REST parameter.",
+
+	// 600
+	StatusIntegrityProtected:       "Integrity protected reply.",
+	StatusConfidentialityProtected: "Confidentiality and integrity protected reply.",
+	StatusPrivacyProtected:         "Confidentiality protected reply.",
+}
+
+// classTexts describe the replies of each class, the first digit of their
+// code.
+var classTexts = map[int]string{
+	1: "Positive preliminary reply.",
+	2: "Positive completion reply.",
+	3: "Positive intermediate reply.",
+	4: "Transient negative completion reply.",
+	5: "Permanent negative completion reply.",
+	6: "Protected reply.",
 }
 
 // Returns a message for different status codes
 func Message(code int) string {
 	return messages[code]
 }
+
+// Text returns the message of code, or the description of its class for
+// the codes without a message of their own, such as those of extensions.
+// It returns "" for codes that are not FTP replies.
+func Text(code int) string {
+	if msg, ok := messages[code]; ok {
+		return msg
+	}
+	if code < 100 || code > 699 {
+		return ""
+	}
+	return classTexts[code/100]
+}
+
+// IsTemporary reports whether code is a transient negative reply (4yz):
+// the command failed but may succeed if sent again.
+func IsTemporary(code int) bool {
+	return code >= 400 && code < 500
+}
+
+// IsPermanent reports whether code is a permanent negative reply (5yz):
+// the command should not be sent again as is.
+func IsPermanent(code int) bool {
+	return code >= 500 && code < 600
+}
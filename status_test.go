@@ -0,0 +1,32 @@
+package ftplib
+
+import (
+	"testing"
+)
+
+// go test -run TestStatusText
+func TestStatusText(t *testing.T) {
+	tests := []struct {
+		code      int
+		text      string
+		temporary bool
+		permanent bool
+	}{
+		{StatusAboutToSend, "File status okay; about to open data connection.", false, false},
+		{StatusCanNotOpenDataConnection, "Can't open data connection.", true, false},
+		{StatusPolicyDenied, "Request denied for policy reasons.", false, true},
+		{299, "Positive completion reply.", false, false},
+		{999, "", false, false},
+	}
+	for _, test := range tests {
+		if text := Text(test.code); text != test.text {
+			t.Errorf("Text(%d) = %q, want %q", test.code, text, test.text)
+		}
+		if IsTemporary(test.code) != test.temporary || IsPermanent(test.code) != test.permanent {
+			t.Errorf("%d: wrong class", test.code)
+		}
+	}
+	if Message(299) != "" {
+		t.Error("Message made up a text")
+	}
+}
@@ -0,0 +1,218 @@
+package ftplib
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CertManager supplies the server certificate for each TLS handshake.
+//
+// The Manager of github.com/cxfans/ftplib/acmecert implements it,
+// obtaining and renewing Let's Encrypt certificates without a restart.
+type CertManager interface {
+	GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error)
+}
+
+// FileCertManager serves the certificate and key stored in PEM files and
+// reloads them when they change on disk, so certificates renewed by an
+// external tool such as certbot are used without a restart.
+type FileCertManager struct {
+	CertFile string
+	KeyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func (m *FileCertManager) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	info, err := os.Stat(m.CertFile)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cert != nil && !info.ModTime().After(m.modTime) {
+		return m.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(m.CertFile, m.KeyFile)
+	if err != nil {
+		if m.cert != nil {
+			// Keep serving the previous certificate while a renewal is
+			// half written.
+			return m.cert, nil
+		}
+		return nil, err
+	}
+	m.cert, m.modTime = &cert, info.ModTime()
+	return m.cert, nil
+}
+
+// tlsConfig returns the configuration for TLS sessions, or nil when the
+// server has no certificate.
+func (server *Server) tlsConfig() *tls.Config {
+	if server.CertManager == nil {
+		return server.TLSConfig
+	}
+	config := &tls.Config{}
+	if server.TLSConfig != nil {
+		config = server.TLSConfig.Clone()
+	}
+	config.GetCertificate = server.CertManager.GetCertificate
+	return config
+}
+
+// tlsConfig returns the configuration for the TLS sessions of the virtual
+// host selected, or of the server.
+func (serverConn *ServerConn) tlsConfig() *tls.Config {
+	if host := serverConn.vhost; host != nil && host.TLSConfig != nil {
+		return host.TLSConfig
+	}
+	return serverConn.server.tlsConfig()
+}
+
+// authTLS upgrades the control connection to TLS, as requested by
+// "AUTH TLS" (RFC 4217).
+func (serverConn *ServerConn) authTLS(params []string) {
+	mechanism := strings.ToUpper(strings.Join(params, " "))
+	if mechanism != "TLS" && mechanism != "TLS-C" && mechanism != "SSL" {
+		serverConn.sendStatusText(StatusNotImplementedParameter)
+		return
+	}
+	config := serverConn.tlsConfig()
+	if config == nil {
+		serverConn.reply(StatusNotImplemented, "auth")
+		return
+	}
+	serverConn.reply(StatusAuthOK, "auth")
+
+	conn := tls.Server(serverConn.conn, config)
+	if err := conn.Handshake(); err != nil {
+		serverConn.Close()
+		return
+	}
+	// The data connections use the same configuration, whose session ticket
+	// keys let them resume this session.
+	serverConn.tls = config
+	serverConn.conn = conn
+	serverConn.reader = bufio.NewReader(conn)
+	serverConn.writer = bufio.NewWriter(conn)
+}
+
+var errTLSSessionReuse = errors.New("data connection did not reuse the control connection's TLS session")
+
+// TLSDataConn encrypts a DataConn, as required by "PROT P" (RFC 4217).
+// The handshake takes place on first use, in the server or client role.
+type TLSDataConn struct {
+	DataConn
+	config       *tls.Config
+	server       bool
+	requireReuse bool
+
+	once sync.Once
+	conn *tls.Conn
+	err  error
+}
+
+// NewTLSDataConn wraps conn in TLS. On the server side, requireReuse
+// refuses the clients that do not resume the TLS session of their control
+// connection, which proves the data connection comes from the same client.
+// Clients resume it by sharing the ClientSessionCache of config.
+func NewTLSDataConn(conn DataConn, config *tls.Config, server, requireReuse bool) *TLSDataConn {
+	return &TLSDataConn{DataConn: conn, config: config, server: server, requireReuse: requireReuse}
+}
+
+// handshake secures the connection the first time it is called.
+func (tlsConn *TLSDataConn) handshake() error {
+	tlsConn.once.Do(func() {
+		raw := dataNetConn{tlsConn.DataConn}
+		if tlsConn.server {
+			tlsConn.conn = tls.Server(raw, tlsConn.config)
+		} else {
+			tlsConn.conn = tls.Client(raw, tlsConn.config)
+		}
+		if tlsConn.err = tlsConn.conn.Handshake(); tlsConn.err != nil {
+			return
+		}
+		if tlsConn.server && tlsConn.requireReuse && !tlsConn.conn.ConnectionState().DidResume {
+			tlsConn.err = errTLSSessionReuse
+		}
+	})
+	return tlsConn.err
+}
+
+func (tlsConn *TLSDataConn) Read(data []byte) (n int, err error) {
+	if err := tlsConn.handshake(); err != nil {
+		return 0, err
+	}
+	return tlsConn.conn.Read(data)
+}
+
+func (tlsConn *TLSDataConn) Write(data []byte) (n int, err error) {
+	if err := tlsConn.handshake(); err != nil {
+		return 0, err
+	}
+	return tlsConn.conn.Write(data)
+}
+
+// Close ends the TLS session, if one was established, and the connection.
+func (tlsConn *TLSDataConn) Close() error {
+	tlsConn.once.Do(func() {
+		tlsConn.err = errDataConnClosed
+	})
+	if tlsConn.conn != nil && tlsConn.err == nil {
+		return tlsConn.conn.Close()
+	}
+	return tlsConn.DataConn.Close()
+}
+
+// dataNetConn lets crypto/tls run over a DataConn.
+type dataNetConn struct {
+	DataConn
+}
+
+func (dataNetConn) LocalAddr() net.Addr { return nil }
+
+// pbsz accepts the protection buffer size of RFC 4217, always 0 for TLS.
+func (serverConn *ServerConn) pbsz(params []string) {
+	if serverConn.tls == nil {
+		serverConn.sendStatusText(StatusBadSequence)
+		return
+	}
+	serverConn.pbszSet = true
+	serverConn.reply(StatusCommandOK, "pbsz")
+}
+
+// prot sets the protection of the data connections: C(lear) or P(rivate).
+func (serverConn *ServerConn) prot(params []string) {
+	if serverConn.tls == nil || !serverConn.pbszSet {
+		serverConn.sendStatusText(StatusBadSequence)
+		return
+	}
+	switch level := strings.ToUpper(strings.Join(params, " ")); level {
+	case "C", "P":
+		serverConn.protected = level == "P"
+		serverConn.reply(StatusCommandOK, "prot", level)
+	case "S", "E":
+		serverConn.sendStatusText(StatusDataProtectionLevel)
+	default:
+		serverConn.sendStatusText(StatusNotImplementedParameter)
+	}
+}
+
+// setDataConn makes conn the data connection of the next transfer, closing
+// the previous one, and encrypts it when the client asked for PROT P.
+func (serverConn *ServerConn) setDataConn(conn DataConn) {
+	serverConn.closeDataConn()
+	if serverConn.protected {
+		conn = NewTLSDataConn(conn, serverConn.tls, true, serverConn.server.RequireTLSSessionReuse)
+	}
+	serverConn.dataConn = conn
+}
@@ -0,0 +1,264 @@
+package ftplib
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a self-signed certificate for name to dir.
+func writeTestCert(t *testing.T, dir, name string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile
+}
+
+// go test -run TestFileCertManager
+func TestFileCertManager(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftplib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeTestCert(t, dir, "old.example")
+	m := &FileCertManager{CertFile: certFile, KeyFile: keyFile}
+	cert, err := m.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestCert(t, dir, "new.example")
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	renewed, err := m.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renewed == cert {
+		t.Error("renewed certificate was not reloaded")
+	}
+}
+
+// go test -run TestProtectedDataConn
+func TestProtectedDataConn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftplib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeTestCert(t, dir, "ftp.example")
+	server := &Server{
+		Driver:                 &DiskDriver{Root: "."},
+		CertManager:            &FileCertManager{CertFile: certFile, KeyFile: keyFile},
+		RequireTLSSessionReuse: true,
+	}
+
+	client, conn := net.Pipe()
+	serverConn := &ServerConn{
+		conn:       conn,
+		reader:     bufio.NewReader(conn),
+		writer:     bufio.NewWriter(conn),
+		cwd:        "/",
+		server:     server,
+		remoteAddr: conn.RemoteAddr(),
+	}
+	go serverConn.Serve()
+	c := textproto.NewConn(client)
+	expect := func(code int, format string, args ...interface{}) {
+		c.Cmd(format, args...)
+		if _, msg, err := c.ReadResponse(code); err != nil {
+			t.Fatal(format, msg, err)
+		}
+	}
+	c.ReadResponse(StatusReady)
+	expect(StatusBadSequence, "PROT P")
+	expect(StatusAuthOK, "AUTH TLS")
+	config := &tls.Config{
+		ServerName:         "ftp.example",
+		InsecureSkipVerify: true,
+		ClientSessionCache: tls.NewLRUClientSessionCache(1),
+	}
+	c = textproto.NewConn(tls.Client(client, config))
+	expect(StatusCommandOK, "PBSZ 0")
+	expect(StatusCommandOK, "PROT P")
+
+	// nlst lists the root through an encrypted active data connection.
+	nlst := func(config *tls.Config) (string, error) {
+		l, err := net.Listen("tcp4", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		port := l.Addr().(*net.TCPAddr).Port
+		expect(StatusCommandOK, "PORT 127,0,0,1,%d,%d", port>>8, port&0xff)
+		c.Cmd("NLST")
+		c.ReadResponse(StatusAboutToSend)
+		conn, err := l.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(tls.Client(conn, config))
+		conn.Close()
+		_, _, err = c.ReadResponse(StatusClosingDataConnection)
+		return string(data), err
+	}
+	if data, err := nlst(config); err != nil || !strings.Contains(data, "go.mod\r\n") {
+		t.Errorf("resumed session: %q, %v", data, err)
+	}
+	fresh := &tls.Config{ServerName: "ftp.example", InsecureSkipVerify: true}
+	if _, err := nlst(fresh); err == nil {
+		t.Error("data connection without session reuse was accepted")
+	}
+	c.Cmd("QUIT")
+	c.ReadResponse(StatusClosing)
+}
+
+// serveImplicitTLS serves a session with implicit TLS, as on port 990, with
+// a certificate written to dir. Its data connections must resume the TLS
+// session of the control connection.
+func serveImplicitTLS(t *testing.T, dir string) net.Listener {
+	cert, err := tls.LoadX509KeyPair(writeTestCert(t, dir, "ftp.example"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		tconn := tls.Server(conn, config)
+		serverConn := &ServerConn{
+			conn:       tconn,
+			reader:     bufio.NewReader(tconn),
+			writer:     bufio.NewWriter(tconn),
+			cwd:        "/",
+			host:       "127.0.0.1",
+			server:     &Server{Driver: &DiskDriver{Root: "."}, RequireTLSSessionReuse: true},
+			remoteAddr: conn.RemoteAddr(),
+			tls:        config,
+		}
+		serverConn.Serve()
+	}()
+	return l
+}
+
+// go test -run TestDialTLS
+func TestDialTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftplib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	l := serveImplicitTLS(t, dir)
+	defer l.Close()
+
+	c, err := DialTLS(l.Addr().String(), &tls.Config{ServerName: "ftp.example", InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Quit()
+	if err := c.Login("user", "pass"); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := ioutil.ReadFile("go.mod")
+	retr := func() {
+		r, err := c.Retr("go.mod")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil || string(data) != string(want) {
+			t.Errorf("retrieved %q, %v", data, err)
+		}
+	}
+	retr()
+
+	// Back in the clear, then protected again.
+	if err := (&ClientConn{}).SetDataProtection(ProtectionClear); err != errNotSecured {
+		t.Errorf("PROT C without TLS: %v", err)
+	}
+	if err := c.SetDataProtection(ProtectionClear); err != nil {
+		t.Fatal(err)
+	}
+	retr()
+	if err := c.SetDataProtection(ProtectionPrivate); err != nil {
+		t.Fatal(err)
+	}
+	retr()
+}
+
+// go test -run TestPinCertificates
+func TestPinCertificates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftplib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	l := serveImplicitTLS(t, dir)
+	defer l.Close()
+	if c, err := DialTLS(l.Addr().String(), PinCertificates(nil, "AAAA")); err == nil {
+		t.Error("dialed a server matching no pin")
+		c.Quit()
+	}
+
+	l = serveImplicitTLS(t, dir)
+	defer l.Close()
+	data, _ := ioutil.ReadFile(filepath.Join(dir, "cert.pem"))
+	block, _ := pem.Decode(data)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := DialTLS(l.Addr().String(), PinCertificates(nil, "AAAA", SPKIHash(cert)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Quit()
+	if err := c.Login("user", "pass"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.List("/"); err != nil {
+		t.Errorf("LIST over the pinned session: %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+package ftplib
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+)
+
+// Tracer starts the spans recording the server's activity: one per session,
+// one per command as its child, and one per Driver call below the command.
+//
+// It is shaped after OpenTelemetry, which the otelftp module adapts it to,
+// leaving ftplib without the dependency.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a traced operation.
+type Span interface {
+	SetAttribute(key string, value interface{})
+	End()
+}
+
+// Span attributes recorded by the server, and by the client with
+// WithTracer.
+const (
+	AttrSession   = "ftp.session"
+	AttrUser      = "ftp.user"
+	AttrClient    = "ftp.client"
+	AttrPeer      = "net.peer.addr"
+	AttrVerb      = "ftp.verb"
+	AttrPath      = "ftp.path"
+	AttrBytes     = "ftp.bytes"
+	AttrReplyCode = "ftp.reply_code"
+	AttrError     = "error"
+)
+
+// pathVerbs are the commands whose argument is a path.
+var pathVerbs = map[string]bool{
+	APPE: true, CWD: true, DELE: true, LIST: true, MKD: true, MLSD: true, MLST: true, NLST: true,
+	RETR: true, RMD: true, RNFR: true, RNTO: true, SIZE: true, STAT: true,
+	STOR: true, XCWD: true, XMKD: true, XRMD: true,
+}
+
+// startSession sets up the context of the session, and opens the span
+// covering it.
+func (serverConn *ServerConn) startSession() {
+	serverConn.session = &Session{
+		id:         newSessionID(),
+		remoteAddr: serverConn.RemoteAddr(),
+		localAddr:  serverConn.conn.LocalAddr(),
+	}
+	serverConn.ctx, serverConn.cancel = context.WithCancel(context.Background())
+	serverConn.ctx = context.WithValue(serverConn.ctx, sessionKey{}, serverConn.session)
+	tracer := serverConn.server.Tracer
+	if tracer == nil {
+		return
+	}
+	serverConn.ctx, serverConn.sessionSpan = tracer.Start(serverConn.ctx, "FTP session")
+	serverConn.sessionSpan.SetAttribute(AttrSession, serverConn.session.id)
+	serverConn.sessionSpan.SetAttribute(AttrPeer, serverConn.RemoteAddr().String())
+}
+
+// endSession closes the session span, and cancels the context of the
+// session.
+func (serverConn *ServerConn) endSession() {
+	serverConn.endCommand()
+	if serverConn.cancel != nil {
+		defer serverConn.cancel()
+	}
+	if serverConn.sessionSpan != nil {
+		serverConn.sessionSpan.SetAttribute(AttrUser, serverConn.user)
+		serverConn.sessionSpan.SetAttribute(AttrClient, serverConn.clientName)
+		serverConn.sessionSpan.End()
+		serverConn.sessionSpan = nil
+	}
+}
+
+// startCommand opens the span of the command verb called with params, and
+// starts timing it for the Metrics.
+func (serverConn *ServerConn) startCommand(verb string, params []string) {
+	serverConn.verb, serverConn.cmdStart, serverConn.replyCode = verb, time.Now(), 0
+	tracer := serverConn.server.Tracer
+	if tracer == nil {
+		return
+	}
+	serverConn.cmdCtx, serverConn.cmdSpan = tracer.Start(serverConn.ctx, "FTP "+verb)
+	serverConn.cmdSpan.SetAttribute(AttrVerb, verb)
+	serverConn.cmdSpan.SetAttribute(AttrUser, serverConn.user)
+	if pathVerbs[verb] {
+		serverConn.cmdSpan.SetAttribute(AttrPath, serverConn.parsingPath(params))
+	}
+}
+
+// endCommand closes the span of the command being served, if any, and
+// records it in the Metrics.
+func (serverConn *ServerConn) endCommand() {
+	serverConn.observeCommand()
+	if serverConn.cmdSpan != nil {
+		serverConn.cmdSpan.End()
+		serverConn.cmdSpan = nil
+		serverConn.cmdCtx = nil
+	}
+}
+
+// setAttribute records an attribute on the span of the current command.
+func (serverConn *ServerConn) setAttribute(key string, value interface{}) {
+	if serverConn.cmdSpan != nil {
+		serverConn.cmdSpan.SetAttribute(key, value)
+	}
+}
+
+// driver returns the Driver of the session's virtual host, or the server's,
+// unless the user has a Root of their own. It refuses changes to read-only
+// users, stores names in the DiskCharset and is traced when the server has
+// a Tracer.
+func (serverConn *ServerConn) driver() Driver {
+	d := serverConn.server.Driver
+	if host := serverConn.vhost; host != nil && host.Driver != nil {
+		d = host.Driver
+	}
+	settings := serverConn.settings()
+	if settings.Root != "" {
+		d = &DiskDriver{Root: settings.Root}
+	}
+	if serverConn.sessionDriver != nil {
+		d = serverConn.sessionDriver
+	}
+	if contextDriver, ok := d.(ContextDriver); ok {
+		d = contextDriver.WithContext(serverConn.Context())
+	}
+	if settings.ReadOnly {
+		d = &readOnlyDriver{Driver: d}
+	}
+	if charset := serverConn.server.DiskCharset; charset != nil {
+		d = &charsetDriver{Driver: d, charset: charset}
+	}
+	if serverConn.server.Tracer == nil {
+		return d
+	}
+	return &tracedDriver{Driver: d, conn: serverConn}
+}
+
+// tracedDriver records a span for each call to the wrapped Driver, so slow
+// storage shows up below the command it slowed down.
+type tracedDriver struct {
+	Driver
+	conn *ServerConn
+}
+
+func (d *tracedDriver) span(name, p string) Span {
+	_, span := d.conn.server.Tracer.Start(d.conn.Context(), "Driver."+name)
+	span.SetAttribute(AttrPath, p)
+	return span
+}
+
+func (d *tracedDriver) Stat(p string) (os.FileInfo, error) {
+	defer d.span("Stat", p).End()
+	return d.Driver.Stat(p)
+}
+
+func (d *tracedDriver) ReadDir(p string) ([]os.FileInfo, error) {
+	defer d.span("ReadDir", p).End()
+	return d.Driver.ReadDir(p)
+}
+
+func (d *tracedDriver) Open(p string, offset int64) (io.ReadCloser, error) {
+	defer d.span("Open", p).End()
+	return d.Driver.Open(p, offset)
+}
+
+func (d *tracedDriver) Put(p string, r io.Reader, appending bool) (int64, error) {
+	span := d.span("Put", p)
+	defer span.End()
+	n, err := d.Driver.Put(p, r, appending)
+	span.SetAttribute(AttrBytes, n)
+	return n, err
+}
+
+func (d *tracedDriver) Remove(p string) error {
+	defer d.span("Remove", p).End()
+	return d.Driver.Remove(p)
+}
+
+func (d *tracedDriver) RemoveDir(p string) error {
+	defer d.span("RemoveDir", p).End()
+	return d.Driver.RemoveDir(p)
+}
+
+func (d *tracedDriver) Rename(from, to string) error {
+	defer d.span("Rename", from).End()
+	return d.Driver.Rename(from, to)
+}
+
+func (d *tracedDriver) MakeDir(p string) error {
+	defer d.span("MakeDir", p).End()
+	return d.Driver.MakeDir(p)
+}
+
+// Copy keeps the native copy of the wrapped Driver, if it has one.
+func (d *tracedDriver) Copy(from, to string) error {
+	defer d.span("Copy", from).End()
+	return copyFile(d.Driver, from, to)
+}
+
+// Readlink keeps the links of the wrapped Driver, if it has any.
+func (d *tracedDriver) Readlink(p string) (string, error) {
+	defer d.span("Readlink", p).End()
+	return readlink(d.Driver, p)
+}
@@ -0,0 +1,69 @@
+package ftplib
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+)
+
+type recordedSpan struct {
+	name  string
+	attrs map[string]interface{}
+}
+
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	span := &recordedSpan{name: name, attrs: make(map[string]interface{})}
+	t.spans = append(t.spans, span)
+	return ctx, span
+}
+
+func (s *recordedSpan) SetAttribute(key string, value interface{}) { s.attrs[key] = value }
+func (s *recordedSpan) End()                                       {}
+
+// go test -run TestTracer
+func TestTracer(t *testing.T) {
+	root, err := ioutil.TempDir("", "ftplib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	ioutil.WriteFile(root+"/a.txt", []byte("hello"), 0644)
+
+	tracer := &recordingTracer{}
+	server := &Server{Driver: &DiskDriver{Root: root}, Tracer: tracer}
+	c, done := pipeServe(server)
+	c.Cmd("CLNT FileZilla 3.60.2")
+	c.ReadResponse(StatusCommandOK)
+	c.Cmd("SIZE a.txt")
+	if _, msg, err := c.ReadResponse(StatusFile); err != nil || msg != "5" {
+		t.Error(msg, err)
+	}
+	c.Cmd("QUIT")
+	c.ReadResponse(StatusClosing)
+	<-done
+
+	var names []string
+	for _, span := range tracer.spans {
+		names = append(names, span.name)
+	}
+	if len(names) != 5 || names[0] != "FTP session" || names[1] != "FTP CLNT" ||
+		names[2] != "FTP SIZE" || names[3] != "Driver.Stat" || names[4] != "FTP QUIT" {
+		t.Fatal("unexpected spans", names)
+	}
+	if session := tracer.spans[0].attrs; session[AttrClient] != "FileZilla 3.60.2" {
+		t.Error("unexpected session attributes", session)
+	}
+	size := tracer.spans[2].attrs
+	if size[AttrPath] != "/a.txt" || size[AttrReplyCode] != StatusFile {
+		t.Error("unexpected attributes", size)
+	}
+}
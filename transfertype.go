@@ -0,0 +1,131 @@
+package ftplib
+
+import (
+	"bufio"
+	"io"
+	"path"
+	"strings"
+)
+
+// TransferType is the representation of the data of a transfer, as set
+// with TYPE.
+type TransferType string
+
+const (
+	TypeBinary TransferType = "I"
+	// TypeASCII sends text with CRLF line endings: the client converts
+	// them from and to the LF endings of local files.
+	TypeASCII TransferType = "A"
+)
+
+// DefaultTransferTypes transfers the usual text files in ASCII, in the
+// manner of the "ascii" lists of classic clients.
+var DefaultTransferTypes = map[string]TransferType{
+	".txt": TypeASCII, ".csv": TypeASCII, ".tsv": TypeASCII,
+	".htm": TypeASCII, ".html": TypeASCII, ".xml": TypeASCII,
+	".json": TypeASCII, ".md": TypeASCII, ".ini": TypeASCII,
+	".conf": TypeASCII, ".cfg": TypeASCII, ".log": TypeASCII,
+	".sh": TypeASCII, ".bat": TypeASCII,
+}
+
+// SetTransferTypes selects the type of the transfers of Retr, RetrFrom,
+// Stor and StorFrom by the extension of the file, compared ignoring case.
+// Files of other extensions are transferred in binary. A nil map, the
+// default, transfers everything in binary.
+func (c *ClientConn) SetTransferTypes(types map[string]TransferType) {
+	c.types = types
+}
+
+// typeFor returns the type of the transfers of the file p.
+func (c *ClientConn) typeFor(p string) TransferType {
+	if t, ok := c.types[strings.ToLower(path.Ext(p))]; ok {
+		return t
+	}
+	return TypeBinary
+}
+
+// setType sends TYPE unless t is the type in effect.
+func (c *ClientConn) setType(t TransferType) error {
+	if t == c.typ {
+		return nil
+	}
+	if _, _, err := c.cmd(StatusCommandOK, "TYPE %s", t); err != nil {
+		return err
+	}
+	c.typ = t
+	return nil
+}
+
+// RetrAs retrieves the file p in the type t, whatever its extension.
+func (c *ClientConn) RetrAs(p string, t TransferType) (io.ReadCloser, error) {
+	return c.retr(p, 0, t)
+}
+
+// StorAs stores r at p in the type t, whatever the extension of p.
+func (c *ClientConn) StorAs(p string, r io.Reader, t TransferType) error {
+	_, err := c.stor("STOR", p, r, 0, t)
+	return err
+}
+
+// fromNetASCII converts the CRLF line endings of a download to LF.
+type fromNetASCII struct {
+	io.ReadCloser
+	r *bufio.Reader
+}
+
+func (a *fromNetASCII) Read(b []byte) (int, error) {
+	n := 0
+	for n < len(b) {
+		c, err := a.r.ReadByte()
+		if err != nil {
+			return n, err
+		}
+		if c == '\r' {
+			if next, err := a.r.Peek(1); err == nil && next[0] == '\n' {
+				continue
+			}
+		}
+		b[n] = c
+		n++
+		if a.r.Buffered() == 0 {
+			break
+		}
+	}
+	return n, nil
+}
+
+// toNetASCII converts the LF line endings of an upload to CRLF.
+type toNetASCII struct {
+	r      *bufio.Reader
+	lastCR bool
+	lf     bool // an LF is due after the CR inserted
+}
+
+func (a *toNetASCII) Read(b []byte) (int, error) {
+	n := 0
+	for n < len(b) {
+		if a.lf {
+			b[n] = '\n'
+			n++
+			a.lf, a.lastCR = false, false
+			continue
+		}
+		c, err := a.r.ReadByte()
+		if err != nil {
+			return n, err
+		}
+		if c == '\n' && !a.lastCR {
+			b[n] = '\r'
+			n++
+			a.lf = true
+			continue
+		}
+		b[n] = c
+		n++
+		a.lastCR = c == '\r'
+		if a.r.Buffered() == 0 {
+			break
+		}
+	}
+	return n, nil
+}
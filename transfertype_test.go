@@ -0,0 +1,33 @@
+package ftplib
+
+import (
+	"bufio"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// go test -run TestNetASCII
+func TestNetASCII(t *testing.T) {
+	for _, tt := range []struct{ local, net string }{
+		{"", ""},
+		{"a\nb\n", "a\r\nb\r\n"},
+		{"a\r\nb", "a\r\nb"},
+		{"\n\n", "\r\n\r\n"},
+		{"a\rb", "a\rb"},
+	} {
+		r := &toNetASCII{r: bufio.NewReader(iotest.OneByteReader(strings.NewReader(tt.local)))}
+		if got, err := ioutil.ReadAll(r); err != nil || string(got) != tt.net {
+			t.Errorf("toNetASCII(%q) = %q, %v, want %q", tt.local, got, err, tt.net)
+		}
+		if tt.local == "a\r\nb" {
+			continue // not what a download of tt.net gives back
+		}
+		src := ioutil.NopCloser(iotest.OneByteReader(strings.NewReader(tt.net)))
+		r2 := &fromNetASCII{src, bufio.NewReader(src)}
+		if got, err := ioutil.ReadAll(r2); err != nil || string(got) != tt.local {
+			t.Errorf("fromNetASCII(%q) = %q, %v, want %q", tt.net, got, err, tt.local)
+		}
+	}
+}
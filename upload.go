@@ -0,0 +1,171 @@
+package ftplib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+)
+
+// UploadScanner inspects an upload before it is published, for instance to
+// run an antivirus or content policy check. content reads the received data;
+// returning an error rejects the file.
+type UploadScanner func(upload *Upload, content io.Reader) error
+
+var (
+	errUploadTooLarge = errors.New("upload too large")
+	errUploadRejected = errors.New("upload rejected")
+)
+
+// stor receives a file from the data connection and stores it at p through
+// the server's Driver. With appending set the received data is added to the
+// end of the existing file. A restart offset resumes an upload interrupted
+// after offset bytes, which must be the size of the file stored.
+func (serverConn *ServerConn) stor(p string, appending bool, offset int64) {
+	if serverConn.dataConn == nil {
+		serverConn.sendStatusText(StatusCanNotOpenDataConnection)
+		return
+	}
+	defer serverConn.closeDataConn()
+	driver := serverConn.driver()
+
+	var oldSize int64
+	if info, err := driver.Stat(p); err == nil {
+		oldSize = info.Size()
+	}
+	if offset > 0 {
+		if offset != oldSize {
+			serverConn.reply(StatusBadRestart, "rest", offset)
+			return
+		}
+		appending = true
+	}
+	serverConn.reply(StatusAboutToSend, "stor")
+
+	conn, err := serverConn.openDataConn()
+	if err != nil {
+		serverConn.sendCodeLine(StatusCanNotOpenDataConnection, fmt.Sprint(err))
+		return
+	}
+	limit := serverConn.maxUploadSize()
+	reservation := serverConn.reserveQuota()
+	src := &uploadReader{r: conn, max: limit, quota: reservation}
+	hash := sha256.New()
+	upload := &Upload{User: serverConn.user, Client: serverConn.clientName, Path: p, Context: serverConn.Context()}
+
+	start := time.Now()
+	n, err := serverConn.put(upload, io.TeeReader(src, hash), appending)
+	var used int64
+	if info, statErr := driver.Stat(p); err == nil && statErr == nil {
+		used = info.Size() - oldSize
+	}
+	reservation.settle(used)
+
+	switch {
+	case src.err == errUploadTooLarge:
+		serverConn.reply(StatusExceededStorage, "size", limit)
+	case src.err == ErrQuotaExceeded:
+		serverConn.reply(StatusExceededStorage, "quota")
+	case src.dataErr != nil:
+		log.Println("Transfer aborted:", src.dataErr)
+		serverConn.sendCodeLine(StatusTransfertAborted, fmt.Sprint(src.dataErr))
+	case err == errUploadRejected:
+		serverConn.reply(StatusBadFileName, "scan")
+	case err != nil:
+		log.Println(err)
+		serverConn.sendStatusText(serverConn.errorCode(err))
+	default:
+		upload.Size = n
+		upload.Checksum = hex.EncodeToString(hash.Sum(nil))
+		upload.Duration = time.Since(start)
+		serverConn.setAttribute(AttrBytes, n)
+		serverConn.reply(StatusClosingDataConnection, "stor", n)
+		serverConn.notify(upload)
+	}
+}
+
+// put hands src to the Driver. When the server has a Scanner the data is
+// staged in a local temporary file first, and only stored once accepted.
+func (serverConn *ServerConn) put(upload *Upload, src io.Reader, appending bool) (int64, error) {
+	driver := serverConn.driver()
+	scanner := serverConn.server.Scanner
+	if scanner == nil {
+		return driver.Put(upload.Path, src, appending)
+	}
+
+	tmp, err := ioutil.TempFile("", "ftplib-upload-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	n, err := io.Copy(tmp, src)
+	if err != nil {
+		return n, err
+	}
+	upload.Size = n
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return n, err
+	}
+	if err := scanner(upload, tmp); err != nil {
+		log.Println("Upload rejected:", err)
+		return n, errUploadRejected
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return n, err
+	}
+	return driver.Put(upload.Path, tmp, appending)
+}
+
+// uploadReader enforces the upload size limit and the user's quota while
+// the upload streams from the data connection. Once a limit is hit, err
+// records which one and every Read fails with it. dataErr records the
+// failure of the data connection itself.
+type uploadReader struct {
+	r       io.Reader
+	max     int64 // zero means no maximum
+	n       int64
+	quota   *quotaReservation
+	err     error
+	dataErr error
+}
+
+func (u *uploadReader) Read(p []byte) (int, error) {
+	if u.err != nil {
+		return 0, u.err
+	}
+	n, err := u.r.Read(p)
+	if err != nil && err != io.EOF {
+		u.dataErr = err
+	}
+	u.n += int64(n)
+	if u.max > 0 && u.n > u.max {
+		u.err = errUploadTooLarge
+		return 0, u.err
+	}
+	if rerr := u.quota.cover(u.n); rerr != nil {
+		u.err = rerr
+		return 0, u.err
+	}
+	return n, err
+}
+
+// notify hands a finished upload to the server's Notifier without holding up
+// the control connection.
+func (serverConn *ServerConn) notify(upload *Upload) {
+	notifier := serverConn.server.Notifier
+	if notifier == nil {
+		return
+	}
+	go func() {
+		if err := notifier.Notify(upload); err != nil {
+			log.Println(err)
+		}
+	}()
+}
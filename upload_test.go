@@ -0,0 +1,168 @@
+package ftplib
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// serveDir serves a new temporary directory with server, once set up by
+// setup, and returns the directory and a client logged in as "user". The
+// returned function stops both and removes the directory.
+func serveDir(t *testing.T, setup func(server *Server)) (string, *ClientConn, func()) {
+	dir, err := ioutil.TempDir("", "ftplib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := NewServer("127.0.0.1:0", dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	if setup != nil {
+		setup(server)
+	}
+	go server.ListenAndServe()
+	c, err := Connect(server.listener.Addr().String(), "user", "pass")
+	if err != nil {
+		server.Stop()
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return dir, c, func() {
+		c.Quit()
+		server.Stop()
+		os.RemoveAll(dir)
+	}
+}
+
+// errCode returns the code of the reply err reports, 0 if none.
+func errCode(err error) int {
+	var e *textproto.Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return 0
+}
+
+// uploadsNotified is a Notifier sending the paths of the uploads to its
+// channel.
+type uploadsNotified chan string
+
+func (ch uploadsNotified) Notify(upload *Upload) error {
+	ch <- upload.Path
+	return nil
+}
+
+// go test -run TestUploadScanner
+func TestUploadScanner(t *testing.T) {
+	notified := make(uploadsNotified, 2)
+	dir, c, stop := serveDir(t, func(server *Server) {
+		server.Notifier = notified
+		server.Scanner = func(upload *Upload, content io.Reader) error {
+			data, err := ioutil.ReadAll(content)
+			if err != nil {
+				return err
+			}
+			if strings.Contains(string(data), "EICAR") {
+				return errors.New("infected")
+			}
+			return nil
+		}
+	})
+	defer stop()
+
+	err := c.Stor("virus.com", strings.NewReader("X5O!P%@AP EICAR test"))
+	if code := errCode(err); code != StatusBadFileName {
+		t.Errorf("STOR of a rejected file: %v, want a 553 reply", err)
+	}
+	if err := c.Stor("clean.txt", strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if items, _ := ioutil.ReadDir(dir); len(items) != 1 || items[0].Name() != "clean.txt" {
+		t.Errorf("files stored: %v, want clean.txt only", items)
+	}
+	// Notified asynchronously, and in turn: the clean file comes first
+	// unless the rejected one was notified too.
+	if p := <-notified; !strings.HasSuffix(p, "clean.txt") {
+		t.Errorf("notified of %s", p)
+	}
+}
+
+// appendTo sends r to name with APPE, which the client lacks a method for.
+func appendTo(c *ClientConn, name string, r io.Reader) error {
+	conn, err := c.cmdDataConnFrom(0, "APPE %s", name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(conn, r)
+	conn.Close()
+	if err != nil {
+		return err
+	}
+	_, _, err = c.conn.ReadResponse(StatusClosingDataConnection)
+	return err
+}
+
+// go test -run TestMaxUploadSize
+func TestMaxUploadSize(t *testing.T) {
+	dir, c, stop := serveDir(t, func(server *Server) {
+		server.MaxUploadSize = 10
+	})
+	defer stop()
+
+	err := c.Stor("big", strings.NewReader(strings.Repeat("x", 100)))
+	if code := errCode(err); code != StatusExceededStorage {
+		t.Errorf("STOR over the limit: %v, want a 552 reply", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "big")); !os.IsNotExist(err) {
+		t.Errorf("STOR over the limit left the file: %v", err)
+	}
+
+	if err := c.Stor("log", strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	err = appendTo(c, "log", strings.NewReader(strings.Repeat("x", 100)))
+	if code := errCode(err); code != StatusExceededStorage {
+		t.Errorf("APPE over the limit: %v, want a 552 reply", err)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(dir, "log")); string(data) != "hello" {
+		t.Errorf("APPE over the limit left %q", data)
+	}
+	if items, _ := ioutil.ReadDir(dir); len(items) != 1 {
+		t.Errorf("uploads over the limit left %d files", len(items)-1)
+	}
+}
+
+// uploadClients is a Notifier sending the client software of the uploads
+// to its channel.
+type uploadClients chan string
+
+func (ch uploadClients) Notify(upload *Upload) error {
+	ch <- upload.Client
+	return nil
+}
+
+// go test -run TestCLNT
+func TestCLNT(t *testing.T) {
+	clients := make(uploadClients, 1)
+	_, c, stop := serveDir(t, func(server *Server) {
+		server.Notifier = clients
+	})
+	defer stop()
+
+	if _, msg, err := c.cmd(StatusCommandOK, "CLNT FileZilla 3.60.2"); err != nil {
+		t.Fatalf("CLNT: %s (%v)", msg, err)
+	}
+	if err := c.Stor("a", strings.NewReader("a")); err != nil {
+		t.Fatal(err)
+	}
+	if client := <-clients; client != "FileZilla 3.60.2" {
+		t.Errorf("upload from client %q, want FileZilla 3.60.2", client)
+	}
+}
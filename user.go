@@ -0,0 +1,126 @@
+package ftplib
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// UserSettings holds the per-user overrides of the server's limits.
+// Zero values fall back to the server-wide setting.
+type UserSettings struct {
+	MaxUploadSize int64
+
+	// Root, if set, is the local directory served to the user instead of
+	// the tree of the server's Driver.
+	Root string
+
+	// ReadOnly refuses the commands changing files to the user.
+	ReadOnly bool
+
+	// RateLimit bounds the bytes per second of the user's transfers, in
+	// each direction. Zero means no limit.
+	RateLimit int64
+}
+
+// settings returns the overrides for the logged in user, never nil.
+func (serverConn *ServerConn) settings() *UserSettings {
+	if lookup := serverConn.server.Users; lookup != nil {
+		if settings := lookup(serverConn.user); settings != nil {
+			return settings
+		}
+	}
+	return &UserSettings{}
+}
+
+// maxUploadSize returns the upload limit in effect for the session.
+func (serverConn *ServerConn) maxUploadSize() int64 {
+	if size := serverConn.settings().MaxUploadSize; size > 0 {
+		return size
+	}
+	return serverConn.server.MaxUploadSize
+}
+
+// readOnlyDriver refuses the changes to the files of the wrapped Driver.
+type readOnlyDriver struct {
+	Driver
+}
+
+func (d *readOnlyDriver) Put(p string, r io.Reader, appending bool) (int64, error) {
+	return 0, &os.PathError{Op: "put", Path: p, Err: os.ErrPermission}
+}
+
+func (d *readOnlyDriver) Remove(p string) error {
+	return &os.PathError{Op: "remove", Path: p, Err: os.ErrPermission}
+}
+
+func (d *readOnlyDriver) RemoveDir(p string) error {
+	return &os.PathError{Op: "rmdir", Path: p, Err: os.ErrPermission}
+}
+
+func (d *readOnlyDriver) Rename(from, to string) error {
+	return &os.PathError{Op: "rename", Path: from, Err: os.ErrPermission}
+}
+
+func (d *readOnlyDriver) MakeDir(p string) error {
+	return &os.PathError{Op: "mkdir", Path: p, Err: os.ErrPermission}
+}
+
+func (d *readOnlyDriver) Copy(from, to string) error {
+	return &os.PathError{Op: "copy", Path: to, Err: os.ErrPermission}
+}
+
+func (d *readOnlyDriver) Readlink(p string) (string, error) {
+	return readlink(d.Driver, p)
+}
+
+// rateLimitedConn paces the transfers of a data connection to rate bytes
+// per second.
+type rateLimitedConn struct {
+	DataConn
+	rate  int64
+	start time.Time
+	n     int64
+}
+
+// wait sleeps until n more bytes fit in the rate.
+func (c *rateLimitedConn) wait(n int) {
+	if c.start.IsZero() {
+		c.start = time.Now()
+	}
+	c.n += int64(n)
+	due := time.Duration(c.n * int64(time.Second) / c.rate)
+	if d := due - time.Since(c.start); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// chunk shortens p to a tenth of a second of transfer, so that the pace
+// stays even.
+func (c *rateLimitedConn) chunk(p []byte) []byte {
+	if max := c.rate/10 + 1; int64(len(p)) > max {
+		return p[:max]
+	}
+	return p
+}
+
+func (c *rateLimitedConn) Read(p []byte) (int, error) {
+	n, err := c.DataConn.Read(c.chunk(p))
+	c.wait(n)
+	return n, err
+}
+
+func (c *rateLimitedConn) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := c.chunk(p)
+		n, err := c.DataConn.Write(chunk)
+		written += n
+		c.wait(n)
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
@@ -0,0 +1,177 @@
+package ftplib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// UserEntry is the account of a user in a users file.
+type UserEntry struct {
+	Name string `json:"name"`
+	// Password is the hash of the password, as HashPassword returns it or
+	// in a scheme of the Verifiers of the UserFile.
+	Password string `json:"password"`
+	// Home is the directory served to the user, relative to the directory
+	// of the users file unless absolute. Empty serves the server's tree.
+	Home          string `json:"home,omitempty"`
+	ReadOnly      bool   `json:"read_only,omitempty"`
+	Quota         int64  `json:"quota,omitempty"`
+	MaxUploadSize int64  `json:"max_upload_size,omitempty"`
+	RateLimit     int64  `json:"rate_limit,omitempty"`
+}
+
+// UserFile is an Auth defining the accounts of a server in a JSON file,
+// along with their settings:
+//
+//	[
+//		{"name": "joe", "password": "$pbkdf2-sha256$...", "home": "/srv/ftp/joe",
+//		 "quota": 1073741824, "rate_limit": 1048576},
+//		{"name": "guest", "password": "$pbkdf2-sha256$...", "read_only": true}
+//	]
+//
+// The file is read again at the next login after it changes, so accounts
+// are added or removed without a restart. A change that does not validate
+// is logged and the previous accounts are kept.
+type UserFile struct {
+	// Verifiers maps the password hash schemes to the functions verifying
+	// them, as for a PasswordAuth.
+	Verifiers map[string]VerifyFunc
+
+	name string
+
+	mu      sync.Mutex
+	users   map[string]*UserEntry
+	modTime time.Time
+	quota   *FileQuotaStore
+}
+
+// LoadUserFile reads and validates the users file name.
+func LoadUserFile(name string) (*UserFile, error) {
+	f := &UserFile{name: name}
+	if err := f.reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Install makes f the Auth of server, and serves the settings of its users.
+func (f *UserFile) Install(server *Server) {
+	server.Auth = f
+	server.Users = f.Settings
+}
+
+// ApplyQuotas sets the quota limits of the users in store, now and whenever
+// the file changes.
+func (f *UserFile) ApplyQuotas(store *FileQuotaStore) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.quota = store
+	return f.applyQuotas()
+}
+
+// CheckPasswd verifies the password of user, after reading the file again
+// if it changed.
+func (f *UserFile) CheckPasswd(user, password string) (bool, error) {
+	if err := f.reload(); err != nil {
+		log.Println("Users file:", err)
+	}
+	f.mu.Lock()
+	auth := &PasswordAuth{Hashes: make(map[string]string, 1), Verifiers: f.Verifiers}
+	if entry, ok := f.users[user]; ok {
+		auth.Hashes[user] = entry.Password
+	}
+	f.mu.Unlock()
+	return auth.CheckPasswd(user, password)
+}
+
+// Settings returns the settings of user, nil for an unknown user.
+func (f *UserFile) Settings(user string) *UserSettings {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	entry, ok := f.users[user]
+	if !ok {
+		return nil
+	}
+	return &UserSettings{
+		MaxUploadSize: entry.MaxUploadSize,
+		Root:          entry.Home,
+		ReadOnly:      entry.ReadOnly,
+		RateLimit:     entry.RateLimit,
+	}
+}
+
+// reload reads the file if it changed since it was last read.
+func (f *UserFile) reload() error {
+	info, err := os.Stat(f.name)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.users != nil && !info.ModTime().After(f.modTime) {
+		return nil
+	}
+	data, err := ioutil.ReadFile(f.name)
+	if err != nil {
+		return err
+	}
+	users, err := parseUsers(data, filepath.Dir(f.name))
+	if err != nil {
+		return fmt.Errorf("%s: %v", f.name, err)
+	}
+	f.users, f.modTime = users, info.ModTime()
+	return f.applyQuotas()
+}
+
+// applyQuotas sets the quota limits of the users, if f has a store.
+func (f *UserFile) applyQuotas() error {
+	if f.quota == nil {
+		return nil
+	}
+	for _, entry := range f.users {
+		if err := f.quota.SetLimit(entry.Name, entry.Quota); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseUsers decodes and validates the entries of a users file, resolving
+// their homes against dir.
+func parseUsers(data []byte, dir string) (map[string]*UserEntry, error) {
+	var entries []*UserEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	users := make(map[string]*UserEntry, len(entries))
+	for i, entry := range entries {
+		switch {
+		case entry.Name == "":
+			return nil, fmt.Errorf("user %d: no name", i+1)
+		case users[entry.Name] != nil:
+			return nil, fmt.Errorf("user %q: defined twice", entry.Name)
+		case entry.Password == "":
+			return nil, fmt.Errorf("user %q: no password", entry.Name)
+		case entry.Quota < 0 || entry.MaxUploadSize < 0 || entry.RateLimit < 0:
+			return nil, fmt.Errorf("user %q: negative limit", entry.Name)
+		}
+		if entry.Home != "" {
+			if !filepath.IsAbs(entry.Home) {
+				entry.Home = filepath.Join(dir, entry.Home)
+			}
+			if info, err := os.Stat(entry.Home); err != nil {
+				return nil, fmt.Errorf("user %q: %v", entry.Name, err)
+			} else if !info.IsDir() {
+				return nil, fmt.Errorf("user %q: home %s is not a directory", entry.Name, entry.Home)
+			}
+		}
+		users[entry.Name] = entry
+	}
+	return users, nil
+}
@@ -0,0 +1,129 @@
+package ftplib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// go test -run TestUserFile
+func TestUserFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftplib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "joe"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "joe", "notes.txt"), []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, "users.json")
+	users := `[{"name": "joe", "password": "` + hash + `", "home": "joe", "read_only": true, "quota": 100}]`
+	if err := ioutil.WriteFile(name, []byte(users), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := LoadUserFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	quotas, _ := NewFileQuotaStore("")
+	if err := f.ApplyQuotas(quotas); err != nil {
+		t.Fatal(err)
+	}
+	if q, _ := quotas.Get("joe"); q.Limit != 100 {
+		t.Errorf("quota limit %d, want 100", q.Limit)
+	}
+
+	server := &Server{Driver: &DiskDriver{Root: "."}}
+	f.Install(server)
+	c, done := pipeServe(server)
+	c.Cmd("USER joe")
+	c.ReadResponse(StatusUserOK)
+	c.Cmd("PASS secret")
+	if _, _, err := c.ReadResponse(StatusLoggedIn); err != nil {
+		t.Fatal(err)
+	}
+	c.Cmd("SIZE notes.txt")
+	if _, msg, err := c.ReadResponse(StatusFile); err != nil || msg != "5" {
+		t.Errorf("SIZE in home: %q, %v", msg, err)
+	}
+	c.Cmd("MKD new")
+	if _, _, err := c.ReadResponse(StatusFileUnavailable); err != nil {
+		t.Errorf("MKD by a read-only user: %v", err)
+	}
+	c.Cmd("QUIT")
+	c.ReadResponse(StatusClosing)
+	<-done
+
+	// A change is picked up at the next login; an invalid one is ignored.
+	users = `[{"name": "ann", "password": "plain"}]`
+	ioutil.WriteFile(name, []byte(users), 0644)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(name, later, later)
+	if ok, _ := f.CheckPasswd("ann", "plain"); !ok {
+		t.Error("new user refused")
+	}
+	if ok, _ := f.CheckPasswd("joe", "secret"); ok {
+		t.Error("removed user accepted")
+	}
+	ioutil.WriteFile(name, []byte(`[{"name": "ann"}]`), 0644)
+	later = later.Add(time.Minute)
+	os.Chtimes(name, later, later)
+	if ok, _ := f.CheckPasswd("ann", "plain"); !ok {
+		t.Error("invalid change applied")
+	}
+}
+
+// go test -run TestParseUsers
+func TestParseUsers(t *testing.T) {
+	for _, test := range []struct {
+		users, err string
+	}{
+		{`[{"password": "x"}]`, "no name"},
+		{`[{"name": "a", "password": "x"}, {"name": "a", "password": "y"}]`, "defined twice"},
+		{`[{"name": "a"}]`, "no password"},
+		{`[{"name": "a", "password": "x", "rate_limit": -1}]`, "negative limit"},
+		{`[{"name": "a", "password": "x", "home": "missing"}]`, "missing"},
+		{`{"name": "a"}`, "cannot unmarshal"},
+	} {
+		if _, err := parseUsers([]byte(test.users), os.TempDir()); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: error %v, want %q", test.users, err, test.err)
+		}
+	}
+}
+
+// countingConn is a DataConn discarding what is written to it.
+type countingConn struct {
+	DataConn
+	n int
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	c.n += len(p)
+	return len(p), nil
+}
+
+// go test -run TestRateLimitedConn
+func TestRateLimitedConn(t *testing.T) {
+	conn := &countingConn{}
+	limited := &rateLimitedConn{DataConn: conn, rate: 10000}
+	start := time.Now()
+	if n, err := limited.Write(make([]byte, 3000)); n != 3000 || err != nil {
+		t.Fatalf("wrote %d, %v", n, err)
+	}
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Errorf("3000 bytes at 10000 B/s took %v", elapsed)
+	}
+	if conn.n != 3000 {
+		t.Errorf("%d bytes went through", conn.n)
+	}
+}
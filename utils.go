@@ -4,27 +4,173 @@ import (
 	"bytes"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
-var null = []byte("drwxrwxrwx 1 user group 0 Apr  1 00:00 .\r\n" +
-	"drwxrwxrwx 1 user group 0 Apr  1 00:00 ..\r\n")
-
+// ListDetailed formats items the way "ls -l" does, which is what clients
+// expect from LIST.
 func ListDetailed(items []os.FileInfo) []byte {
-	if len(items) == 0 {
-		return null
+	return listDetailed(items, time.Now())
+}
+
+func listDetailed(items []os.FileInfo, now time.Time) []byte {
+	type row struct {
+		mode, links, owner, group, size, date, name string
+	}
+	rows := make([]row, len(items))
+	var linksWidth, ownerWidth, groupWidth, sizeWidth int
+	for i, item := range items {
+		owner, group, links := fileOwner(item)
+		rows[i] = row{
+			mode:  listMode(item.Mode()),
+			links: strconv.FormatUint(links, 10),
+			owner: owner,
+			group: group,
+			size:  strconv.FormatInt(item.Size(), 10),
+			date:  listDate(item.ModTime(), now),
+			name:  item.Name(),
+		}
+		if link, ok := item.(*linkInfo); ok && link.target != "" {
+			rows[i].name += " -> " + link.target
+		}
+		linksWidth = maxInt(linksWidth, len(rows[i].links))
+		ownerWidth = maxInt(ownerWidth, len(owner))
+		groupWidth = maxInt(groupWidth, len(group))
+		sizeWidth = maxInt(sizeWidth, len(rows[i].size))
+	}
+
+	var buf bytes.Buffer
+	for _, r := range rows {
+		_, _ = fmt.Fprintf(&buf, "%s %*s %-*s %-*s %*s %s %s\r\n", r.mode,
+			linksWidth, r.links, ownerWidth, r.owner, groupWidth, r.group,
+			sizeWidth, r.size, r.date, r.name)
+	}
+	return buf.Bytes()
+}
+
+// listMode renders mode as ls does: os.FileMode.String uses its own letters
+// for the file types and prefixes several of them.
+func listMode(mode os.FileMode) string {
+	perm := []byte(mode.Perm().String())
+	switch {
+	case mode&os.ModeDir != 0:
+		perm[0] = 'd'
+	case mode&os.ModeSymlink != 0:
+		perm[0] = 'l'
+	case mode&os.ModeCharDevice != 0:
+		perm[0] = 'c'
+	case mode&os.ModeDevice != 0:
+		perm[0] = 'b'
+	case mode&os.ModeNamedPipe != 0:
+		perm[0] = 'p'
+	case mode&os.ModeSocket != 0:
+		perm[0] = 's'
+	}
+	setBit := func(i int, set bool, exec, noExec byte) {
+		if !set {
+			return
+		}
+		if perm[i] == 'x' {
+			perm[i] = exec
+		} else {
+			perm[i] = noExec
+		}
+	}
+	setBit(3, mode&os.ModeSetuid != 0, 's', 'S')
+	setBit(6, mode&os.ModeSetgid != 0, 's', 'S')
+	setBit(9, mode&os.ModeSticky != 0, 't', 'T')
+	return string(perm)
+}
+
+// listDate renders t as ls does: with the time of day for the files of the
+// last six months, with the year for older or future ones.
+func listDate(t, now time.Time) string {
+	if t.After(now.AddDate(0, -6, 0)) && !t.After(now.Add(time.Hour)) {
+		return t.Format("Jan _2 15:04")
+	}
+	return t.Format("Jan _2  2006")
+}
+
+// linkInfo is a listed symbolic link along with its target.
+type linkInfo struct {
+	os.FileInfo
+	target string
+}
+
+// ListMLSx formats items as the fact lines of MLSD (RFC 3659).
+func ListMLSx(items []os.FileInfo) []byte {
+	return listMLSx(items, nil)
+}
+
+// mlsxFactNames are the MLSx facts the server knows, in listing order.
+var mlsxFactNames = []string{"type", "size", "modify", "UNIX.mode"}
+
+// listMLSx formats items with the given facts, or all of them when facts
+// is nil.
+func listMLSx(items []os.FileInfo, facts []string) []byte {
+	if facts == nil {
+		facts = mlsxFactNames
 	}
 	var buf bytes.Buffer
 	for _, item := range items {
-		_, _ = fmt.Fprintf(&buf, "%s\t1 user\tgroup\t%8d %s %s\r\n", item.Mode(),
-			item.Size(), item.ModTime().Format("Jan _2 15:04"), item.Name())
+		_, _ = fmt.Fprintf(&buf, "%s %s\r\n", mlsxFacts(item, facts), item.Name())
 	}
 	return buf.Bytes()
 }
 
-func ListShort(items []os.FileInfo) []byte {
-	if len(items) == 0 {
-		return null
+// mlsxFacts returns the facts of item, each followed by a semicolon.
+func mlsxFacts(item os.FileInfo, facts []string) string {
+	var buf strings.Builder
+	mode := item.Mode()
+	for _, fact := range facts {
+		var value string
+		switch fact {
+		case "type":
+			switch {
+			case mode&os.ModeSymlink != 0:
+				value = "OS.unix=symlink"
+			case mode.IsDir():
+				value = "dir"
+			case mode.IsRegular():
+				value = "file"
+			default:
+				value = "OS.unix=" + listMode(mode)[:1]
+			}
+		case "size":
+			if !mode.IsRegular() {
+				continue
+			}
+			value = strconv.FormatInt(item.Size(), 10)
+		case "modify":
+			value = item.ModTime().UTC().Format("20060102150405")
+		case "UNIX.mode":
+			value = "0" + strconv.FormatUint(uint64(mode.Perm()), 8)
+		}
+		buf.WriteString(fact + "=" + value + ";")
+	}
+	return buf.String()
+}
+
+// anonymousOwner stands in for the owner of files that have none the
+// platform can tell.
+func anonymousOwner(info os.FileInfo) (owner, group string, links uint64) {
+	links = 1
+	if info.IsDir() {
+		links = 2
+	}
+	return "ftp", "ftp", links
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
 	}
+	return b
+}
+
+func ListShort(items []os.FileInfo) []byte {
 	var buf bytes.Buffer
 	for _, item := range items {
 		_, _ = fmt.Fprintf(&buf, "%s\r\n", item.Name())
@@ -3,7 +3,9 @@ package ftplib
 import (
 	"fmt"
 	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 // go test -run TestListDetailed
@@ -31,3 +33,65 @@ func TestListShort(t *testing.T) {
 	}
 	fmt.Println(string(ListShort(items)))
 }
+
+type fakeFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (fi *fakeFileInfo) Name() string       { return fi.name }
+func (fi *fakeFileInfo) Size() int64        { return fi.size }
+func (fi *fakeFileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *fakeFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fakeFileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *fakeFileInfo) Sys() interface{}   { return nil }
+
+// go test -run TestListDetailedFormat
+func TestListDetailedFormat(t *testing.T) {
+	now := time.Date(2022, 6, 9, 12, 0, 0, 0, time.UTC)
+	items := []os.FileInfo{
+		&fakeFileInfo{"recent file.txt", 1234, 0644, time.Date(2022, 6, 1, 10, 24, 0, 0, time.UTC)},
+		&fakeFileInfo{"old", 4096, os.ModeDir | 0755, time.Date(2014, 6, 9, 10, 24, 0, 0, time.UTC)},
+		&fakeFileInfo{"tmp", 0, os.ModeDir | os.ModeSticky | 0777, time.Date(2014, 6, 9, 10, 24, 0, 0, time.UTC)},
+		&linkInfo{&fakeFileInfo{"latest", 3, os.ModeSymlink | 0777, time.Date(2022, 6, 1, 10, 24, 0, 0, time.UTC)}, "old"},
+	}
+	want := "-rw-r--r-- 1 ftp ftp 1234 Jun  1 10:24 recent file.txt\r\n" +
+		"drwxr-xr-x 2 ftp ftp 4096 Jun  9  2014 old\r\n" +
+		"drwxrwxrwt 2 ftp ftp    0 Jun  9  2014 tmp\r\n" +
+		"lrwxrwxrwx 1 ftp ftp    3 Jun  1 10:24 latest -> old\r\n"
+	if got := string(listDetailed(items, now)); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	parser := &UnixParser{Now: func() time.Time { return now }}
+	for i, line := range strings.Split(strings.TrimSpace(want), "\r\n") {
+		e, err := parser.ParseListLine(line)
+		year, month, day := items[i].ModTime().Date()
+		if err != nil || e.Name != items[i].Name() || e.Mode != items[i].Mode() || e.Time.Year() != year || e.Time.Month() != month || e.Time.Day() != day {
+			t.Errorf("%q does not round trip: %+v %v", line, e, err)
+		}
+	}
+}
+
+// go test -run TestListMLSx
+func TestListMLSx(t *testing.T) {
+	modTime := time.Date(2022, 6, 1, 10, 24, 0, 0, time.UTC)
+	items := []os.FileInfo{
+		&fakeFileInfo{"a.txt", 1234, 0644, modTime},
+		&fakeFileInfo{"dir", 4096, os.ModeDir | 0755, modTime},
+		&linkInfo{&fakeFileInfo{"latest", 5, os.ModeSymlink | 0777, modTime}, "a.txt"},
+	}
+	want := "type=file;size=1234;modify=20220601102400;UNIX.mode=0644; a.txt\r\n" +
+		"type=dir;modify=20220601102400;UNIX.mode=0755; dir\r\n" +
+		"type=OS.unix=symlink;modify=20220601102400;UNIX.mode=0777; latest\r\n"
+	if got := string(ListMLSx(items)); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	for i, line := range strings.Split(strings.TrimSpace(want), "\r\n") {
+		if e, err := ParseMLSxLine(line); err != nil || e.Name != items[i].Name() {
+			t.Errorf("%q does not round trip: %+v %v", line, e, err)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package ftplib
+
+import (
+	"crypto/tls"
+	"strings"
+)
+
+// VirtualHost is the profile of one of the FTP sites served on a single
+// listener, selected by the client with HOST (RFC 7151). Unset fields fall
+// back to the server's.
+type VirtualHost struct {
+	Driver    Driver
+	Auth      Auth
+	Banner    string // text of the reply to HOST
+	TLSConfig *tls.Config
+}
+
+// virtualHost returns the server's virtual host named name, if any.
+func (server *Server) virtualHost(name string) *VirtualHost {
+	for hostname, host := range server.Hosts {
+		if strings.EqualFold(hostname, name) {
+			return host
+		}
+	}
+	return nil
+}
+
+// selectHost selects the virtual host named by params. It has to come
+// before the user logs in, since the host decides how users authenticate.
+func (serverConn *ServerConn) selectHost(params []string) {
+	name := strings.Join(params, " ")
+	// IPv6 literals come between brackets.
+	name = strings.TrimSuffix(strings.TrimPrefix(name, "["), "]")
+	if name == "" {
+		serverConn.sendStatusText(StatusBadArguments)
+		return
+	}
+	if serverConn.user != "" || serverConn.loggedIn {
+		serverConn.sendStatusText(StatusBadSequence)
+		return
+	}
+	host := serverConn.server.virtualHost(name)
+	if host == nil {
+		serverConn.reply(StatusNotImplementedParameter, "host", name)
+		return
+	}
+	serverConn.vhost = host
+	serverConn.cwd = "/"
+	if host.Banner != "" {
+		serverConn.sendCodeLine(StatusReady, host.Banner)
+		return
+	}
+	serverConn.reply(StatusReady, "host", name)
+}
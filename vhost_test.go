@@ -0,0 +1,55 @@
+package ftplib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// go test -run TestVirtualHosts
+func TestVirtualHosts(t *testing.T) {
+	root, err := ioutil.TempDir("", "ftplib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	ioutil.WriteFile(filepath.Join(root, "a.txt"), []byte("hello"), 0644)
+
+	server := &Server{
+		Driver: &DiskDriver{Root: "."},
+		Auth: AuthFunc(func(user, password string) (bool, error) {
+			return user == "admin" && password == "secret", nil
+		}),
+		Hosts: map[string]*VirtualHost{
+			"files.example": {
+				Driver: &DiskDriver{Root: root},
+				Auth: AuthFunc(func(user, password string) (bool, error) {
+					return user == "alice" && password == "wonderland", nil
+				}),
+				Banner: "Files of example.",
+			},
+		},
+	}
+	c, done := pipeServe(server)
+	expect := func(cmd string, code int, msg string) {
+		c.Cmd(cmd)
+		if _, got, err := c.ReadResponse(code); err != nil || (msg != "" && got != msg) {
+			t.Errorf("%s: got %q (%v), want %q", cmd, got, err, msg)
+		}
+	}
+
+	expect("SIZE a.txt", StatusNotLoggedIn, "")
+	expect("HOST other.example", StatusNotImplementedParameter, "Unknown host other.example.")
+	expect("HOST FILES.example", StatusReady, "Files of example.")
+	expect("USER admin", StatusUserOK, "")
+	expect("HOST files.example", StatusBadSequence, "")
+	expect("PASS secret", StatusNotLoggedIn, "")
+	expect("USER alice", StatusUserOK, "")
+	expect("PASS wonderland", StatusLoggedIn, "")
+	expect("SIZE a.txt", StatusFile, "5")
+
+	c.Cmd("QUIT")
+	c.ReadResponse(StatusClosing)
+	<-done
+}